@@ -6,6 +6,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
@@ -18,10 +20,12 @@ import (
 	"github.com/spf13/viper"
 	_ "github.com/ugcompsoc/apid/docs"
 	"github.com/ugcompsoc/apid/internal/config"
+	"github.com/ugcompsoc/apid/internal/logging"
 	"github.com/ugcompsoc/apid/internal/server"
 )
 
 var srv *server.Server
+var reloads = &server.ReloadStatus{}
 
 func init() {
 	// Config defaults
@@ -31,6 +35,7 @@ func init() {
 	viper.SetDefault("timeouts.shutdown", 30*time.Second)
 
 	viper.SetDefault("http.listen_address", ":8080")
+	viper.SetDefault("http.admin_listen_address", "127.0.0.1:9090")
 	viper.SetDefault("http.cors.allowed_origins", []string{"*"})
 
 	// Config file loading
@@ -43,8 +48,20 @@ func init() {
 	// Set logger defaults
 	zerolog.SetGlobalLevel(zerolog.TraceLevel)
 
-	// Config from flags
+	// Config from flags, --dev and --fixtures are named after the config
+	// keys they set so they are bound with the others
+	pflag.CommandLine.SetNormalizeFunc(func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		switch name {
+		case "dev":
+			return "dev.enabled"
+		case "fixtures":
+			return "dev.fixtures"
+		}
+		return pflag.NormalizedName(name)
+	})
 	pflag.StringP("log_level", "l", "info", "log level")
+	pflag.Bool("dev", false, "development mode; use an in-memory datastore seeded from fixtures")
+	pflag.String("fixtures", "fixtures.yml", "fixtures to seed the in-memory datastore with in development mode")
 	pflag.Parse()
 	if err := viper.BindPFlags(pflag.CommandLine); err != nil {
 		log.Err(err).Msg("failed to bind pflags to config")
@@ -57,25 +74,37 @@ func init() {
 }
 
 func reload() {
-	if srv != nil {
-		stop()
-		srv = nil
-	}
-
 	var cfg config.Config
-	if err := viper.Unmarshal(&cfg); err != nil {
-		log.Fatal().Err(err).Msg("failed to parse configuration")
+	err := viper.Unmarshal(&cfg)
+	if err != nil {
+		err = fmt.Errorf("failed to parse configuration: %w", err)
+	} else if cfg.GetZeroLogLevel() == zerolog.NoLevel {
+		err = errors.New("cannot start server without log level specified")
+	} else {
+		// the logger is configured first so the rest of the reload is logged
+		// as configured
+		err = logging.Configure(&cfg)
 	}
-
-	logLevel := cfg.GetZeroLogLevel()
-	if logLevel == zerolog.NoLevel {
-		log.Fatal().Msg("cannot start server without log level specified")
+	if err != nil {
+		// a running server is kept if the new config is broken, so a typo
+		// doesn't take the API down
+		if srv == nil {
+			log.Fatal().Err(err).Msg("failed to load configuration")
+		}
+		reloads.Record(viper.ConfigFileUsed(), err)
+		log.Error().Err(err).Msg("failed to reload configuration, keeping the running server")
+		return
 	}
-	zerolog.SetGlobalLevel(logLevel)
 
+	if srv != nil {
+		stop()
+		srv = nil
+	}
 	log.Trace().Any("config", cfg).Msg("got config")
 
 	srv = server.NewServer(cfg)
+	srv.Reloads = reloads
+	reloads.Record(viper.ConfigFileUsed(), nil)
 
 	log.Info().Msg("starting server")
 	go func() {
@@ -109,6 +138,10 @@ func stop() {
 // @license.name  	MIT
 // @license.url   	https://github.com/ugcompsoc/apid/blob/main/LICENSE
 // @BasePath  		/
+// @securityDefinitions.apikey	BearerToken
+// @in							header
+// @name						Authorization
+// @description					A token in the form 'Bearer {token}'
 func main() {
 	// Recover from panic
 	defer func() {
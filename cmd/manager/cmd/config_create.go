@@ -27,11 +27,14 @@ be generated in the folder specified.`,
 	createConfigCmd.Flags().String("timeouts_startup", "30s", "Startup Timeout")
 	createConfigCmd.Flags().String("timeouts_shutdown", "30s", "Shutdown Timeout")
 	createConfigCmd.Flags().String("http_listen_address", ":8080", "HTTP Listen Address; In the form of 'IP/DOMAIN:PORT'")
+	createConfigCmd.Flags().String("http_admin_listen_address", "127.0.0.1:9090", "HTTP Admin Listen Address for metrics, pprof and operational endpoints; In the form of 'IP:PORT'")
 	createConfigCmd.Flags().StringSlice("http_cors_allowed_orgins", []string{"*"}, "HTTP CORS Allowed Origins; In the form '[ORIGIN,ORIGIN]'")
+	createConfigCmd.Flags().StringSlice("http_trusted_proxies", []string{}, "HTTP Trusted Proxies whose X-Forwarded-For and X-Real-Ip headers are used; In the form '[IP/CIDR,IP/CIDR]'")
 	createConfigCmd.Flags().String("database_host", "mongodb://ugcompsoc_apid_local_db", "Database Host")
 	createConfigCmd.Flags().String("database_name", "apid", "Database Name")
 	createConfigCmd.Flags().String("database_username", "", "Database Username")
 	createConfigCmd.Flags().String("database_password", "", "Database Password")
+	createConfigCmd.Flags().Bool("database_auto_migrate", false, "Apply pending database migrations on startup")
 	createConfigCmd.MarkFlagRequired("database_username")
 	createConfigCmd.MarkFlagRequired("database_password")
 
@@ -55,11 +58,16 @@ func CreateConfig(cmd *cobra.Command, args []string) {
 		issues = append(issues, "Could not parse shutdown timeout. Use the format '[NUMBER]s'")
 	}
 	c.HTTP.ListenAddress, _ = createConfigCmd.Flags().GetString("http_listen_address")
+	c.HTTP.AdminListenAddress, _ = createConfigCmd.Flags().GetString("http_admin_listen_address")
 	c.HTTP.CORS.AllowedOrigins, _ = createConfigCmd.Flags().GetStringSlice("http_cors_allowed_orgins")
+	c.HTTP.TrustedProxies, _ = createConfigCmd.Flags().GetStringSlice("http_trusted_proxies")
 	c.Database.Host, _ = createConfigCmd.Flags().GetString("database_host")
 	c.Database.Name, _ = createConfigCmd.Flags().GetString("database_name")
-	c.Database.Username, _ = createConfigCmd.Flags().GetString("database_username")
-	c.Database.Password, _ = createConfigCmd.Flags().GetString("database_password")
+	username, _ := createConfigCmd.Flags().GetString("database_username")
+	c.Database.Username = config.Secret(username)
+	password, _ := createConfigCmd.Flags().GetString("database_password")
+	c.Database.Password = config.Secret(password)
+	c.Database.AutoMigrate, _ = createConfigCmd.Flags().GetBool("database_auto_migrate")
 	if c.Database.Username == "" {
 		issues = append(issues, "Database username has no default value and is required")
 	}
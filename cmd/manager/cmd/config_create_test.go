@@ -14,13 +14,16 @@ func TestCreateConfig(t *testing.T) {
   manager config create [flags]
 
 Flags:
+      --database_auto_migrate              Apply pending database migrations on startup
       --database_host string               Database Host (default "mongodb://ugcompsoc_apid_local_db")
       --database_name string               Database Name (default "apid")
       --database_password string           Database Password
       --database_username string           Database Username
   -h, --help                               help for create
+      --http_admin_listen_address string   HTTP Admin Listen Address for metrics, pprof and operational endpoints; In the form of 'IP:PORT' (default "127.0.0.1:9090")
       --http_cors_allowed_orgins strings   HTTP CORS Allowed Origins; In the form '[ORIGIN,ORIGIN]' (default [*])
       --http_listen_address string         HTTP Listen Address; In the form of 'IP/DOMAIN:PORT' (default ":8080")
+      --http_trusted_proxies strings       HTTP Trusted Proxies whose X-Forwarded-For and X-Real-Ip headers are used; In the form '[IP/CIDR,IP/CIDR]'
       --log_level string                   Log level; Available values: trace, disabled, panic, fatal, error, warn, info, or debug (default "debug")
       --timeouts_shutdown string           Shutdown Timeout (default "30s")
       --timeouts_startup string            Startup Timeout (default "30s")
@@ -150,6 +153,7 @@ timeouts:
   shutdown: 30s
 http:
   listen_address: :8080
+  admin_listen_address: 127.0.0.1:9090
   cors:
     allowed_origins:
     - '*'
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/ugcompsoc/apid/cmd/manager/utils"
+	"github.com/ugcompsoc/apid/internal/config"
+	"github.com/ugcompsoc/apid/internal/services/database"
+)
+
+// dbCmd represents the db command
+var dbCmd *cobra.Command
+
+func NewDBCmd() *cobra.Command {
+	dbCmd = &cobra.Command{
+		Use:   "db",
+		Short: "Administer the database of an APId deployment",
+		Long: `Connects to the database described in the config found in the default
+directory, or the directory specified, and administers it.`,
+	}
+
+	dbCmd.AddCommand(NewMigrateCmd())
+	dbCmd.AddCommand(NewBackupCmd())
+	dbCmd.AddCommand(NewRestoreCmd())
+
+	return dbCmd
+}
+
+// loadConfig extracts and verifies the config given by the directory and
+// filename flags. Any issues are printed and a nil config is returned.
+func loadConfig(cmd *cobra.Command) *config.Config {
+	filename, _ := cmd.Flags().GetString("filename")
+	err := utils.VerifyFilename(filename)
+	if err != nil {
+		cmd.Printf("An error occured while verifying the filename: %s\n", err)
+		return nil
+	}
+
+	directory, _ := cmd.Flags().GetString("directory")
+	absoluteFilePath := filepath.Join(directory, filename)
+	c, err := utils.ExtractFile(absoluteFilePath)
+	if err != nil {
+		cmd.Printf("An error occured while extracting the file: %s\n", err)
+		return nil
+	}
+
+	issues, err := c.Verify()
+	if err != nil {
+		cmd.Printf("An error occured while verifying the config: %s\n", err)
+		return nil
+	}
+	if len(issues) != 0 {
+		cmd.Printf("Error(s) were found while parsing %s, please address them:\n", absoluteFilePath)
+		for _, err := range issues {
+			cmd.Printf("  - %s\n", err)
+		}
+		return nil
+	}
+
+	return c
+}
+
+// connectDatastore loads the config and connects to the database it describes.
+// Any issues are printed and a nil datastore is returned.
+func connectDatastore(cmd *cobra.Command) *database.Datastore {
+	c := loadConfig(cmd)
+	if c == nil {
+		return nil
+	}
+	ds, err := database.NewDatastore(c)
+	if err != nil {
+		cmd.Printf("An error occured while connecting to the database: %s\n", err)
+		return nil
+	}
+	return ds
+}
+
+func init() {
+	dbCmd = NewDBCmd()
+}
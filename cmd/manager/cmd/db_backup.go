@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/ugcompsoc/apid/internal/services/database/backup"
+)
+
+// backupCmd represents the db backup command
+var backupCmd *cobra.Command
+
+// restoreCmd represents the db restore command
+var restoreCmd *cobra.Command
+
+func NewBackupCmd() *cobra.Command {
+	backupCmd = &cobra.Command{
+		Use:   "backup",
+		Short: "Write every collection of the database to a compressed archive",
+		Long: `Streams every collection of the database, along with its indexes, to a gzip
+compressed archive of Extended JSON in the output directory. A SHA-256 checksum
+of the archive is written alongside it. mongodump is not required.`,
+		Run: Backup,
+	}
+
+	backupCmd.Flags().StringP("output", "o", ".", "Directory to write the backup to")
+	backupCmd.Flags().Int("retain", 0, "Number of most recent backups to keep in the output directory; 0 keeps every backup")
+	backupCmd.Flags().Duration("timeout", 30*time.Minute, "Time to wait on the backup to complete")
+
+	return backupCmd
+}
+
+func NewRestoreCmd() *cobra.Command {
+	restoreCmd = &cobra.Command{
+		Use:   "restore [FILE]",
+		Short: "Restore a backup into an empty database",
+		Long: `Verifies a backup written by 'db backup' and restores it, along with its
+indexes, into the database in the config or the database named. The database
+restored into must be empty.`,
+		Args: cobra.ExactArgs(1),
+		Run:  Restore,
+	}
+
+	restoreCmd.Flags().String("database", "", "Name of the database to restore into; defaults to the database in the config")
+	restoreCmd.Flags().Duration("timeout", 30*time.Minute, "Time to wait on the restore to complete")
+
+	return restoreCmd
+}
+
+func Backup(cmd *cobra.Command, args []string) {
+	retain, _ := cmd.Flags().GetInt("retain")
+	if retain < 0 {
+		cmd.Printf("An error occured while verifying the flags: retain must not be negative\n")
+		return
+	}
+	output, _ := cmd.Flags().GetString("output")
+	if err := os.MkdirAll(output, os.ModePerm); err != nil {
+		cmd.Printf("An error occured while creating the output directory: %s\n", err)
+		return
+	}
+
+	ds := connectDatastore(cmd)
+	if ds == nil {
+		return
+	}
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	defer ds.Close(context.Background())
+
+	filename := backup.Filename(ds.Database.Name(), time.Now())
+	path := filepath.Join(output, filename)
+	// write to a temporary file so a failed backup is never mistaken for a
+	// complete one, or pruned in its place
+	partial := path + ".partial"
+	f, err := os.Create(partial)
+	if err != nil {
+		cmd.Printf("An error occured while creating the backup: %s\n", err)
+		return
+	}
+	hash := sha256.New()
+	buffered := bufio.NewWriter(io.MultiWriter(f, hash))
+	summary, err := backup.Dump(ctx, ds.Database, buffered)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(partial)
+		cmd.Printf("An error occured while writing the backup: %s\n", err)
+		return
+	}
+	// a backup is never replaced, in case two are taken in the same
+	// millisecond
+	if _, err := os.Stat(path); err == nil {
+		os.Remove(partial)
+		cmd.Printf("An error occured while writing the backup: %s already exists\n", path)
+		return
+	}
+	if err := os.Rename(partial, path); err != nil {
+		cmd.Printf("An error occured while writing the backup: %s\n", err)
+		return
+	}
+	checksum := fmt.Sprintf("%s  %s\n", hex.EncodeToString(hash.Sum(nil)), filename)
+	if err := os.WriteFile(path+backup.ChecksumExtension, []byte(checksum), 0644); err != nil {
+		cmd.Printf("An error occured while writing the backup checksum: %s\n", err)
+		return
+	}
+
+	cmd.Printf("Backed up %s to %s\n", summary.Database, path)
+	printCollections(cmd, summary)
+
+	if retain > 0 {
+		removed, err := backup.Prune(output, ds.Database.Name(), retain)
+		for _, path := range removed {
+			cmd.Printf("Removed old backup %s\n", path)
+		}
+		if err != nil {
+			cmd.Printf("An error occured while removing old backups: %s\n", err)
+			return
+		}
+	}
+
+	cmd.Print("OK\n")
+}
+
+func Restore(cmd *cobra.Command, args []string) {
+	path := args[0]
+	if err := verifyChecksumFile(cmd, path); err != nil {
+		cmd.Printf("An error occured while verifying the backup checksum: %s\n", err)
+		return
+	}
+	summary, err := verifyBackup(path)
+	if err != nil {
+		cmd.Printf("An error occured while verifying the backup: %s\n", err)
+		return
+	}
+	cmd.Printf("Verified backup of %s taken %s\n", summary.Database, summary.CreatedAt.Format(time.RFC3339))
+
+	ds := connectDatastore(cmd)
+	if ds == nil {
+		return
+	}
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	defer ds.Close(context.Background())
+
+	db := ds.Database
+	if name, _ := cmd.Flags().GetString("database"); name != "" {
+		db = ds.Client.Database(name)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		cmd.Printf("An error occured while opening the backup: %s\n", err)
+		return
+	}
+	defer f.Close()
+	summary, err = backup.Restore(ctx, db, bufio.NewReader(f))
+	if err != nil {
+		cmd.Printf("An error occured while restoring the backup: %s\n", err)
+		return
+	}
+
+	cmd.Printf("Restored %s into %s\n", summary.Database, db.Name())
+	printCollections(cmd, summary)
+	cmd.Print("OK\n")
+}
+
+// verifyChecksumFile compares the backup against its checksum sidecar, if it
+// has one. The archive holds its own checksum so the sidecar is optional.
+func verifyChecksumFile(cmd *cobra.Command, path string) error {
+	sidecar, err := os.ReadFile(path + backup.ChecksumExtension)
+	if os.IsNotExist(err) {
+		cmd.Printf("No checksum file was found for %s, relying on the checksum in the backup\n", path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(string(sidecar))
+	if len(fields) == 0 {
+		return fmt.Errorf("%s is empty", path+backup.ChecksumExtension)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return err
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != fields[0] {
+		return fmt.Errorf("%s does not match %s", path, path+backup.ChecksumExtension)
+	}
+	return nil
+}
+
+func verifyBackup(path string) (*backup.Summary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return backup.Verify(bufio.NewReader(f))
+}
+
+func printCollections(cmd *cobra.Command, summary *backup.Summary) {
+	names := []string{}
+	for name := range summary.Collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cmd.Printf("  - %s: %d document(s)\n", name, summary.Collections[name])
+	}
+}
+
+func init() {
+	backupCmd = NewBackupCmd()
+	restoreCmd = NewRestoreCmd()
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ugcompsoc/apid/internal/services/database/backup"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestBackup(t *testing.T) {
+	directory := "db_backup_test"
+	if _, err := os.Stat(directory); err != nil {
+		err := os.Mkdir(directory, os.ModePerm)
+		assert.NoError(t, err, "could not create test directory")
+	}
+
+	t.Run("prints file not found error", func(t *testing.T) {
+		out, err := execute(t, NewRootCmd(), "db", "backup", "--directory="+directory, "--output="+directory)
+		assert.NoError(t, err, "expected no error running manager")
+		assert.Equal(t, "An error occured while extracting the file: open db_backup_test/apid.yml: no such file or directory", out, "unexpected manager output")
+	})
+
+	t.Run("retain must not be negative", func(t *testing.T) {
+		out, err := execute(t, NewRootCmd(), "db", "backup", "--directory="+directory, "--retain=-1")
+		assert.NoError(t, err, "expected no error running manager")
+		assert.Equal(t, "An error occured while verifying the flags: retain must not be negative", out, "unexpected manager output")
+	})
+
+	err := os.RemoveAll(directory)
+	assert.NoError(t, err, "could not delete testing directory")
+}
+
+func TestRestore(t *testing.T) {
+	directory := "db_restore_test"
+	if _, err := os.Stat(directory); err != nil {
+		err := os.Mkdir(directory, os.ModePerm)
+		assert.NoError(t, err, "could not create test directory")
+	}
+
+	buf := &bytes.Buffer{}
+	w, err := backup.NewWriter(buf, "apid")
+	assert.NoError(t, err, "expected no error creating backup writer")
+	doc, err := bson.Marshal(bson.M{"_id": "a"})
+	assert.NoError(t, err, "expected no error marshalling document")
+	assert.NoError(t, w.WriteIndexes("users", nil), "expected no error writing indexes")
+	assert.NoError(t, w.WriteDocument("users", doc), "expected no error writing document")
+	_, err = w.Close()
+	assert.NoError(t, err, "expected no error closing backup writer")
+
+	path := filepath.Join(directory, backup.Filename("apid", time.Now()))
+	err = os.WriteFile(path, buf.Bytes(), 0644)
+	assert.NoError(t, err, "expected no error writing backup")
+
+	t.Run("requires a file", func(t *testing.T) {
+		_, err := execute(t, NewRootCmd(), "db", "restore")
+		assert.EqualError(t, err, "accepts 1 arg(s), received 0", "expected argument error")
+	})
+
+	t.Run("prints backup not found error", func(t *testing.T) {
+		out, err := execute(t, NewRootCmd(), "db", "restore", filepath.Join(directory, "missing.jsonl.gz"))
+		assert.NoError(t, err, "expected no error running manager")
+		assert.Contains(t, out, "An error occured while verifying the backup: open db_restore_test/missing.jsonl.gz: no such file or directory", "unexpected manager output")
+	})
+
+	t.Run("verifies the backup before connecting", func(t *testing.T) {
+		out, err := execute(t, NewRootCmd(), "db", "restore", path, "--directory="+directory)
+		assert.NoError(t, err, "expected no error running manager")
+		assert.Contains(t, out, "No checksum file was found for "+path, "expected missing checksum file to be noted")
+		assert.Contains(t, out, "Verified backup of apid taken", "expected backup to be verified")
+		assert.Contains(t, out, "An error occured while extracting the file: open db_restore_test/apid.yml: no such file or directory", "expected config to be read after verifying")
+	})
+
+	t.Run("rejects a backup that does not match its checksum file", func(t *testing.T) {
+		err := os.WriteFile(path+backup.ChecksumExtension, []byte("0000  backup\n"), 0644)
+		assert.NoError(t, err, "expected no error writing checksum file")
+		out, err := execute(t, NewRootCmd(), "db", "restore", path, "--directory="+directory)
+		assert.NoError(t, err, "expected no error running manager")
+		assert.Equal(t, "An error occured while verifying the backup checksum: "+path+" does not match "+path+backup.ChecksumExtension, out, "unexpected manager output")
+	})
+
+	t.Run("rejects a corrupted backup", func(t *testing.T) {
+		err := os.Remove(path + backup.ChecksumExtension)
+		assert.NoError(t, err, "expected no error removing checksum file")
+		err = os.WriteFile(path, buf.Bytes()[:len(buf.Bytes())/2], 0644)
+		assert.NoError(t, err, "expected no error writing corrupted backup")
+		out, err := execute(t, NewRootCmd(), "db", "restore", path, "--directory="+directory)
+		assert.NoError(t, err, "expected no error running manager")
+		assert.Contains(t, out, "An error occured while verifying the backup: ", "expected backup to fail verification")
+	})
+
+	err = os.RemoveAll(directory)
+	assert.NoError(t, err, "could not delete testing directory")
+}
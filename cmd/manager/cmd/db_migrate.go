@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/ugcompsoc/apid/internal/services/database"
+)
+
+// migrateCmd represents the db migrate command
+var migrateCmd *cobra.Command
+
+func NewMigrateCmd() *cobra.Command {
+	migrateCmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply, revert or list database migrations",
+		Long: `Applies, reverts or lists the versioned schema migrations of the database.
+Applied versions are recorded in the _migrations collection and a lock is
+held while migrating so that it is safe to run alongside other replicas.`,
+	}
+
+	migrateCmd.PersistentFlags().Int("steps", 0, "Number of migrations to apply or revert; up defaults to all, down defaults to 1")
+	migrateCmd.PersistentFlags().Duration("timeout", 5*time.Minute, "Time to wait on the migration lock and migrations to complete")
+
+	migrateCmd.AddCommand(&cobra.Command{
+		Use:   "up",
+		Short: "Apply pending migrations",
+		Run:   MigrateUp,
+	})
+	migrateCmd.AddCommand(&cobra.Command{
+		Use:   "down",
+		Short: "Revert applied migrations",
+		Run:   MigrateDown,
+	})
+	migrateCmd.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "List migrations and whether they have been applied",
+		Run:   MigrateStatus,
+	})
+
+	return migrateCmd
+}
+
+// newMigrator connects to the database and returns a migrator and a context
+// bound by the timeout flag. Any issues are printed and a nil migrator is
+// returned.
+func newMigrator(cmd *cobra.Command) (*database.Migrator, context.Context, context.CancelFunc) {
+	ds := connectDatastore(cmd)
+	if ds == nil {
+		return nil, nil, nil
+	}
+	migrator, err := ds.Migrator()
+	if err != nil {
+		cmd.Printf("An error occured while loading the migrations: %s\n", err)
+		ds.Client.Disconnect(context.Background())
+		return nil, nil, nil
+	}
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	ctx, cancelTimeout := context.WithTimeout(context.Background(), timeout)
+	cancel := func() {
+		cancelTimeout()
+		ds.Client.Disconnect(context.Background())
+	}
+	return migrator, ctx, cancel
+}
+
+func MigrateUp(cmd *cobra.Command, args []string) {
+	migrator, ctx, cancel := newMigrator(cmd)
+	if migrator == nil {
+		return
+	}
+	defer cancel()
+
+	steps, _ := cmd.Flags().GetInt("steps")
+	applied, err := migrator.Up(ctx, steps)
+	for _, m := range applied {
+		cmd.Printf("Applied migration %d: %s\n", m.Version, m.Description)
+	}
+	if err != nil {
+		cmd.Printf("An error occured while applying migrations: %s\n", err)
+		return
+	}
+	if len(applied) == 0 {
+		cmd.Print("No pending migrations\n")
+	}
+
+	cmd.Print("OK\n")
+}
+
+func MigrateDown(cmd *cobra.Command, args []string) {
+	migrator, ctx, cancel := newMigrator(cmd)
+	if migrator == nil {
+		return
+	}
+	defer cancel()
+
+	steps, _ := cmd.Flags().GetInt("steps")
+	reverted, err := migrator.Down(ctx, steps)
+	for _, m := range reverted {
+		cmd.Printf("Reverted migration %d: %s\n", m.Version, m.Description)
+	}
+	if err != nil {
+		cmd.Printf("An error occured while reverting migrations: %s\n", err)
+		return
+	}
+	if len(reverted) == 0 {
+		cmd.Print("No applied migrations\n")
+	}
+
+	cmd.Print("OK\n")
+}
+
+func MigrateStatus(cmd *cobra.Command, args []string) {
+	migrator, ctx, cancel := newMigrator(cmd)
+	if migrator == nil {
+		return
+	}
+	defer cancel()
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		cmd.Printf("An error occured while listing migrations: %s\n", err)
+		return
+	}
+	if len(statuses) == 0 {
+		cmd.Print("No migrations\n")
+	}
+	for _, status := range statuses {
+		if status.Applied {
+			cmd.Printf("  [x] %d: %s (applied %s)\n", status.Version, status.Description, status.AppliedAt.Format(time.RFC3339))
+		} else {
+			cmd.Printf("  [ ] %d: %s\n", status.Version, status.Description)
+		}
+	}
+}
+
+func init() {
+	migrateCmd = NewMigrateCmd()
+}
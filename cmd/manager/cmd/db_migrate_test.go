@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ugcompsoc/apid/internal/config"
+	"gopkg.in/yaml.v2"
+)
+
+func TestMigrate(t *testing.T) {
+	directory := "db_migrate_test"
+	if _, err := os.Stat(directory); err != nil {
+		err := os.Mkdir(directory, os.ModePerm)
+		assert.NoError(t, err, "could not create test directory")
+	}
+	absoluteFilePath := filepath.Join(directory, "apid.yml")
+
+	for _, subcommand := range []string{"up", "down", "status"} {
+		args := []string{"db", "migrate", subcommand, "--directory=" + directory}
+
+		t.Run(subcommand+" prints file not found error", func(t *testing.T) {
+			out, err := execute(t, NewRootCmd(), args...)
+			assert.NoError(t, err, "expected no error running manager")
+			assert.Equal(t, "An error occured while extracting the file: open db_migrate_test/apid.yml: no such file or directory", out, "unexpected manager output")
+		})
+
+		t.Run(subcommand+" an invalid filename will cause an issue", func(t *testing.T) {
+			out, err := execute(t, NewRootCmd(), append(args, "--filename=apid")...)
+			assert.NoError(t, err, "expected no error running manager")
+			assert.Equal(t, "An error occured while verifying the filename: The filename is not in the form [NAME].yml", out, "unexpected manager output")
+		})
+	}
+
+	t.Run("prints config issues instead of connecting", func(t *testing.T) {
+		c := &config.Config{
+			LogLevel: "debug",
+			Timeouts: config.Timeouts{
+				Shutdown: 30 * time.Second,
+				Startup:  30 * time.Second,
+			},
+			HTTP: config.HTTP{
+				ListenAddress: ":8080",
+				CORS: config.CORS{
+					AllowedOrigins: []string{"*"},
+				},
+			},
+			Database: config.Database{
+				Host:     "mongodb://ugcompsoc_apid_local_db",
+				Name:     "a",
+				Username: "test_username",
+				Password: "test_password",
+			},
+		}
+		cYaml, err := yaml.Marshal(c)
+		assert.NoError(t, err, "expected no error marshalling config to yaml")
+		err = ioutil.WriteFile(absoluteFilePath, cYaml, 0644)
+		assert.NoError(t, err, "expected no error writing file")
+
+		out, err := execute(t, NewRootCmd(), "db", "migrate", "status", "--directory="+directory)
+		assert.NoError(t, err, "expected no error running manager")
+		assert.Equal(t, `Error(s) were found while parsing db_migrate_test/apid.yml, please address them:
+  - Mongo database name is not long enough`, out, "unexpected manager output")
+	})
+
+	err := os.RemoveAll(directory)
+	assert.NoError(t, err, "could not delete testing directory")
+}
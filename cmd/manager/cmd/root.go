@@ -21,6 +21,7 @@ func NewRootCmd() *cobra.Command {
 	newRootCmd.PersistentFlags().StringP("directory", "d", ".", "Directory for config")
 	newRootCmd.PersistentFlags().StringP("filename", "f", "apid.yml", "filename for config")
 	newRootCmd.AddCommand(NewConfigCmd())
+	newRootCmd.AddCommand(NewDBCmd())
 	return newRootCmd
 }
 
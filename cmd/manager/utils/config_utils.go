@@ -15,12 +15,8 @@ func PrintConfig(c *config.Config, printSecrets bool) (string, error) {
 		return "", errors.New("A nil config struct was given")
 	}
 	if !printSecrets {
-		if len(c.Database.Username) != 0 {
-			c.Database.Username = "********"
-		}
-		if len(c.Database.Password) != 0 {
-			c.Database.Password = "********"
-		}
+		redacted := c.Redacted()
+		c = &redacted
 	}
 	cYaml, err := yaml.Marshal(&c)
 	// im not sure how we would reach this error unless the config is nil
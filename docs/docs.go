@@ -61,6 +61,12 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/helpers.Message"
                         }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.Problem"
+                        }
                     }
                 }
             }
@@ -75,11 +81,121 @@ const docTemplate = `{
                     "V2"
                 ],
                 "summary": "Brew coffee",
+                "responses": {
+                    "418": {
+                        "description": "I'm a teapot",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/health": {
+            "get": {
+                "description": "Responds with the status, latency and last error of every component, and the maintenance mode if the API is read-only",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "V2"
+                ],
+                "summary": "Get detailed health of API",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/helpers.Error"
+                            "$ref": "#/definitions/helpers.HealthReport"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.HealthReport"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/health/live": {
+            "get": {
+                "description": "Responds with 200 if the API is alive and should not be restarted",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "V2"
+                ],
+                "summary": "Liveness probe",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.HealthReport"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.HealthReport"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/health/ready": {
+            "get": {
+                "description": "Responds with 200 if the API is ready to receive traffic",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "V2"
+                ],
+                "summary": "Readiness probe",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.HealthReport"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.HealthReport"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/health/startup": {
+            "get": {
+                "description": "Responds with 200 once the API has finished starting up",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "V2"
+                ],
+                "summary": "Startup probe",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.HealthReport"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.HealthReport"
                         }
                     }
                 }
@@ -87,7 +203,7 @@ const docTemplate = `{
         },
         "/v2/healthcheck": {
             "get": {
-                "description": "Responds with any service errors",
+                "description": "Responds with any service errors, and the maintenance mode if the API is read-only",
                 "produces": [
                     "application/json"
                 ],
@@ -99,19 +215,19 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/helpers.Empty"
+                            "$ref": "#/definitions/helpers.Healthcheck"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/helpers.Error"
+                            "$ref": "#/definitions/helpers.Problem"
                         }
                     },
                     "503": {
                         "description": "Service Unavailable",
                         "schema": {
-                            "$ref": "#/definitions/helpers.ErrorsArray"
+                            "$ref": "#/definitions/helpers.Healthcheck"
                         }
                     }
                 }
@@ -133,25 +249,437 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/helpers.Message"
                         }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/users": {
+            "get": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Responds with a page of users. Filter with filter[field]=value or filter[field][op]=value, on username, email, name (eq, ne, in, prefix), roles (eq, ne, in) or created_at (eq, ne, lt, lte, gt, gte). Sort on username, email, name or created_at.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "List users",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Cursor is the next_cursor of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "minimum": 1,
+                        "type": "integer",
+                        "example": 20,
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "example": "-created_at,username",
+                        "description": "Sort is a list of fields, descending when they start with a '-'",
+                        "name": "sort",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.Paginated-database_User"
+                        },
+                        "headers": {
+                            "Link": {
+                                "type": "string",
+                                "description": "The first and next pages"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.Problem"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.Problem"
+                        }
+                    }
+                }
+            }
+        },
+        "/v2/users/me": {
+            "get": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Responds with the user the bearer token belongs to, or with 304 if it matches the If-None-Match header",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Get the current user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The ETag of the user the client has",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/database.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "The version of the user"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "Not Modified"
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.Problem"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Changes the username, email and name of the user the bearer token belongs to. Send the ETag of the user in If-Match so changes made since it was read aren't overwritten.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Update the current user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The ETag of the user being changed",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "The user",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/helpers.UserUpdate"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/database.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "The new version of the user"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.Problem"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.Problem"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "BearerToken": []
+                    }
+                ],
+                "description": "Changes the username, email or name of the user the bearer token belongs to with a JSON merge patch (RFC 7396) or a JSON patch (RFC 6902) of the user. Patches that change any other field are rejected. Send the ETag of the user in If-Match so changes made since it was read aren't overwritten.",
+                "consumes": [
+                    "application/merge-patch+json",
+                    "application/json-patch+json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Patch the current user",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "The ETag of the user being changed",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "The patch",
+                        "name": "patch",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "object"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/database.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "The new version of the user"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.Problem"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.Problem"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.Problem"
+                        }
+                    },
+                    "412": {
+                        "description": "Precondition Failed",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.Problem"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.Problem"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/helpers.Problem"
+                        }
                     }
                 }
             }
         }
     },
     "definitions": {
-        "helpers.Empty": {
-            "type": "object"
+        "database.User": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string",
+                    "example": "2023-07-01T12:00:00Z"
+                },
+                "email": {
+                    "type": "string",
+                    "example": "j.bloggs1@universityofgalway.ie"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "0b4c2f3e-5d6a-4b7c-8d9e-0f1a2b3c4d5e"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "Joe Bloggs"
+                },
+                "roles": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "member"
+                    ]
+                },
+                "updated_at": {
+                    "type": "string",
+                    "example": "2023-07-01T12:00:00Z"
+                },
+                "username": {
+                    "type": "string",
+                    "example": "jbloggs"
+                },
+                "version": {
+                    "description": "Version starts at 1 and goes up by one every time the document is\nupdated, so an update can't overwrite changes it didn't see",
+                    "type": "integer",
+                    "example": 1
+                }
+            }
         },
-        "helpers.Error": {
+        "helpers.ComponentHealth": {
             "type": "object",
             "properties": {
-                "error": {
+                "checked_at": {
+                    "type": "string",
+                    "example": "2023-07-01T12:00:00Z"
+                },
+                "last_error": {
+                    "type": "string",
+                    "example": "cannot ping database"
+                },
+                "latency_ns": {
+                    "type": "integer",
+                    "example": 1250000
+                },
+                "name": {
+                    "type": "string",
+                    "example": "database"
+                },
+                "status": {
                     "type": "string",
-                    "example": "a server error was encountered"
+                    "example": "up"
                 }
             }
         },
-        "helpers.ErrorsArray": {
+        "helpers.HealthReport": {
+            "type": "object",
+            "properties": {
+                "components": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/helpers.ComponentHealth"
+                    }
+                },
+                "maintenance": {
+                    "$ref": "#/definitions/helpers.Maintenance"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "up"
+                }
+            }
+        },
+        "helpers.Healthcheck": {
             "type": "object",
             "properties": {
                 "errors": {
@@ -163,6 +691,39 @@ const docTemplate = `{
                         "cannot ping database",
                         "scheduler offline"
                     ]
+                },
+                "maintenance": {
+                    "$ref": "#/definitions/helpers.Maintenance"
+                }
+            }
+        },
+        "helpers.Maintenance": {
+            "type": "object",
+            "properties": {
+                "enabled": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "groups": {
+                    "description": "Groups are the route groups that are read-only, every /v2 route is if\nnone are given",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "message": {
+                    "type": "string",
+                    "example": "APId is read-only while the database is upgraded"
+                },
+                "retry_after": {
+                    "description": "RetryAfter is how long clients are told to wait before retrying",
+                    "type": "string",
+                    "example": "5m0s"
+                },
+                "source": {
+                    "description": "Source is config, or admin if it was set through the admin listener",
+                    "type": "string",
+                    "example": "config"
                 }
             }
         },
@@ -174,6 +735,114 @@ const docTemplate = `{
                     "example": "i just wanted to say hi"
                 }
             }
+        },
+        "helpers.Paginated-database_User": {
+            "type": "object",
+            "properties": {
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/database.User"
+                    }
+                },
+                "next_cursor": {
+                    "type": "string",
+                    "example": "eyJzIjoiLWNyZWF0ZWRfYXQifQ"
+                }
+            }
+        },
+        "helpers.Problem": {
+            "type": "object",
+            "properties": {
+                "context_id": {
+                    "description": "ContextID is the context ID of the request, which its logs carry too",
+                    "type": "string",
+                    "example": "0b4c2f3e-5d6a-4b7c-8d9e-0f1a2b3c4d5e"
+                },
+                "detail": {
+                    "type": "string",
+                    "example": "the request has invalid fields"
+                },
+                "errors": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/helpers.ProblemField"
+                    }
+                },
+                "instance": {
+                    "description": "Instance is the path of the request that failed",
+                    "type": "string",
+                    "example": "/v2/users/me"
+                },
+                "retry_after": {
+                    "description": "RetryAfter is how many seconds until a rate limited request can be\nretried",
+                    "type": "integer",
+                    "example": 30
+                },
+                "status": {
+                    "type": "integer",
+                    "example": 400
+                },
+                "title": {
+                    "type": "string",
+                    "example": "Validation Failed"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "https://compsoc.ie/apid/problems/validation"
+                }
+            }
+        },
+        "helpers.ProblemField": {
+            "type": "object",
+            "properties": {
+                "field": {
+                    "description": "Field is the path of the field, named as it is in the request",
+                    "type": "string",
+                    "example": "level"
+                },
+                "message": {
+                    "type": "string",
+                    "example": "level is required"
+                },
+                "reason": {
+                    "description": "Reason is the check the field failed, e.g. required or email",
+                    "type": "string",
+                    "example": "required"
+                }
+            }
+        },
+        "helpers.UserUpdate": {
+            "type": "object",
+            "required": [
+                "email",
+                "name",
+                "username"
+            ],
+            "properties": {
+                "email": {
+                    "type": "string",
+                    "example": "j.bloggs1@universityofgalway.ie"
+                },
+                "name": {
+                    "type": "string",
+                    "maxLength": 100,
+                    "example": "Joe Bloggs"
+                },
+                "username": {
+                    "type": "string",
+                    "maxLength": 32,
+                    "example": "jbloggs"
+                }
+            }
+        }
+    },
+    "securityDefinitions": {
+        "BearerToken": {
+            "description": "A token in the form 'Bearer {token}'",
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
         }
     }
 }`
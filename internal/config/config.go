@@ -3,7 +3,11 @@ package config
 import (
 	"fmt"
 	"net"
+	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -16,32 +20,489 @@ type Timeouts struct {
 	Shutdown time.Duration `mapstructure:"shutdown" yaml:"shutdown"`
 }
 
+const (
+	CORSGroupUsers = "users"
+	// CORSGroupDocs is the swagger UI under /docs
+	CORSGroupDocs = "docs"
+)
+
+// CORSGroups are the route groups that can have their own CORS policy
+var CORSGroups = []string{CORSGroupUsers, CORSGroupDocs}
+
+// The CORS lists used when none are configured
+var (
+	DefaultCORSAllowedMethods = []string{"HEAD", "GET", "POST", "PUT", "PATCH", "DELETE"}
+	DefaultCORSAllowedHeaders = []string{
+		"Authorization", "Content-Type", "If-Match", "If-None-Match", "Idempotency-Key", "X-Request-ID", "context-id",
+		"traceparent", "tracestate",
+	}
+	DefaultCORSExposedHeaders = []string{
+		"ETag", "Link", "Location", "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy",
+		"Idempotent-Replayed", "Accept-Patch", "X-Request-ID", "context-id",
+	}
+)
+
+// CORS is the policy browsers are told to follow for requests from other
+// origins. An allowed origin is '*', an origin such as 'https://compsoc.ie',
+// or a pattern such as '*.compsoc.ie' that matches its subdomains. Origins
+// without a scheme match both http and https. Lists that are empty are the
+// defaults, and an allowed header of '*' allows every header. Credentials
+// can't be allowed from every origin.
 type CORS struct {
-	AllowedOrigins []string `mapstructure:"allowed_origins" yaml:"allowed_origins"`
+	AllowedOrigins   []string      `mapstructure:"allowed_origins" yaml:"allowed_origins"`
+	AllowedMethods   []string      `mapstructure:"allowed_methods" yaml:"allowed_methods,omitempty"`
+	AllowedHeaders   []string      `mapstructure:"allowed_headers" yaml:"allowed_headers,omitempty"`
+	ExposedHeaders   []string      `mapstructure:"exposed_headers" yaml:"exposed_headers,omitempty"`
+	AllowCredentials bool          `mapstructure:"allow_credentials" yaml:"allow_credentials,omitempty"`
+	MaxAge           time.Duration `mapstructure:"max_age" yaml:"max_age,omitempty"`
+	// Groups override the policy for the routes of a group
+	Groups map[string]CORSOverride `mapstructure:"groups" yaml:"groups,omitempty"`
+}
+
+// CORSOverride changes the CORS policy for a route group, anything it doesn't
+// give is the same as the policy it overrides
+type CORSOverride struct {
+	AllowedOrigins   []string      `mapstructure:"allowed_origins" yaml:"allowed_origins,omitempty"`
+	AllowedMethods   []string      `mapstructure:"allowed_methods" yaml:"allowed_methods,omitempty"`
+	AllowedHeaders   []string      `mapstructure:"allowed_headers" yaml:"allowed_headers,omitempty"`
+	ExposedHeaders   []string      `mapstructure:"exposed_headers" yaml:"exposed_headers,omitempty"`
+	AllowCredentials *bool         `mapstructure:"allow_credentials" yaml:"allow_credentials,omitempty"`
+	MaxAge           time.Duration `mapstructure:"max_age" yaml:"max_age,omitempty"`
+}
+
+// The defaults of the security headers that aren't configured. The swagger
+// UI needs inline scripts and styles, so /docs has a CSP of its own.
+const (
+	DefaultHSTSMaxAge                = 365 * 24 * time.Hour
+	DefaultFrameOptions              = "DENY"
+	DefaultReferrerPolicy            = "no-referrer"
+	DefaultContentSecurityPolicy     = "default-src 'none'; frame-ancestors 'none'"
+	DefaultDocsContentSecurityPolicy = "default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'; " +
+		"img-src 'self' data:; frame-ancestors 'none'"
+)
+
+// HSTS describes the Strict-Transport-Security header, which tells browsers
+// to only use HTTPS for the API. Browsers ignore it on plain HTTP responses.
+type HSTS struct {
+	Disabled bool          `mapstructure:"disabled" yaml:"disabled,omitempty"`
+	MaxAge   time.Duration `mapstructure:"max_age" yaml:"max_age,omitempty"`
+	// IncludeSubdomains and Preload should only be set once every subdomain
+	// is served over HTTPS, as they are hard to take back
+	IncludeSubdomains bool `mapstructure:"include_subdomains" yaml:"include_subdomains,omitempty"`
+	Preload           bool `mapstructure:"preload" yaml:"preload,omitempty"`
+}
+
+// Security describes the security headers of every response, those that
+// aren't configured have their defaults. The headers aren't sent at all if it
+// is disabled, e.g. when a proxy sets them.
+type Security struct {
+	Disabled       bool   `mapstructure:"disabled" yaml:"disabled,omitempty"`
+	HSTS           HSTS   `mapstructure:"hsts" yaml:"hsts,omitempty"`
+	FrameOptions   string `mapstructure:"frame_options" yaml:"frame_options,omitempty"`
+	ReferrerPolicy string `mapstructure:"referrer_policy" yaml:"referrer_policy,omitempty"`
+	// ContentSecurityPolicy applies to every route except /docs, which has
+	// DocsContentSecurityPolicy
+	ContentSecurityPolicy     string `mapstructure:"content_security_policy" yaml:"content_security_policy,omitempty"`
+	DocsContentSecurityPolicy string `mapstructure:"docs_content_security_policy" yaml:"docs_content_security_policy,omitempty"`
+}
+
+// The ways clients can be asked for certificates over TLS
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
+// TLS describes how the API is served over HTTPS, when it isn't behind a proxy
+// that terminates TLS. The files are loaded again whenever they change, so
+// rotated certificates are used without a restart. Client certificates are
+// verified against ClientCAFile if ClientAuth is optional or require, with
+// optional leaving it to the routes that need one to reject requests without.
+type TLS struct {
+	CertFile     string `mapstructure:"cert_file" yaml:"cert_file,omitempty"`
+	KeyFile      string `mapstructure:"key_file" yaml:"key_file,omitempty"`
+	ClientCAFile string `mapstructure:"client_ca_file" yaml:"client_ca_file,omitempty"`
+	ClientAuth   string `mapstructure:"client_auth" yaml:"client_auth,omitempty"`
+}
+
+// Enabled reports whether the API should be served over HTTPS
+func (t *TLS) Enabled() bool {
+	return t.CertFile != ""
+}
+
+// GetClientAuth returns how clients are asked for certificates
+func (t *TLS) GetClientAuth() string {
+	if t.ClientAuth == "" {
+		return ClientAuthNone
+	}
+	return t.ClientAuth
+}
+
+// Files returns the files TLS is loaded from
+func (t *TLS) Files() []string {
+	files := []string{}
+	for _, file := range []string{t.CertFile, t.KeyFile, t.ClientCAFile} {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+func (t *TLS) Verify() ([]string, error) {
+	issues := []string{}
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		issues = append(issues, "TLS needs both a cert file and a key file")
+	}
+	switch t.GetClientAuth() {
+	case ClientAuthNone:
+		if t.ClientCAFile != "" {
+			issues = append(issues, "A TLS client CA file is only used when client_auth is optional or require")
+		}
+	case ClientAuthOptional, ClientAuthRequire:
+		if !t.Enabled() {
+			issues = append(issues, "TLS client certificates can only be verified when TLS is enabled")
+		}
+		if t.ClientCAFile == "" {
+			issues = append(issues, "TLS client certificates can't be verified without a client CA file")
+		}
+	default:
+		issues = append(issues, fmt.Sprintf("The TLS client auth %s is invalid, use one of %s, %s, %s", t.ClientAuth,
+			ClientAuthNone, ClientAuthOptional, ClientAuthRequire))
+	}
+	return issues, nil
+}
+
+// The networks a listen address can be on. Unix addresses are "unix:" and the
+// path of the socket. Systemd addresses are "systemd" for the first socket
+// passed by systemd, or "systemd:" and the FileDescriptorName of the socket.
+// Any other address is a host and port.
+const (
+	NetworkTCP     = "tcp"
+	NetworkUnix    = "unix"
+	NetworkSystemd = "systemd"
+)
+
+// DefaultSocketMode is the permissions of unix sockets if none are configured
+const DefaultSocketMode os.FileMode = 0o660
+
+// maxSocketPathLength is the longest path a unix socket can have on Linux
+const maxSocketPathLength = 107
+
+// ParseListenAddress returns the network of a listen address and the address
+// on that network
+func ParseListenAddress(address string) (network string, addr string) {
+	if strings.HasPrefix(address, NetworkUnix+":") {
+		return NetworkUnix, strings.TrimPrefix(address, NetworkUnix+":")
+	}
+	if address == NetworkSystemd {
+		return NetworkSystemd, ""
+	}
+	if strings.HasPrefix(address, NetworkSystemd+":") {
+		return NetworkSystemd, strings.TrimPrefix(address, NetworkSystemd+":")
+	}
+	return NetworkTCP, address
 }
 
 type HTTP struct {
+	// ListenAddress is a host and port, a unix socket or a socket passed by
+	// systemd, see ParseListenAddress
 	ListenAddress string `mapstructure:"listen_address" yaml:"listen_address"`
-	CORS          CORS
+	// AdminListenAddress is where operational endpoints such as /metrics are
+	// served, they are not served at all if it is empty. It must be a loopback
+	// or private address unless AdminAllowPublic is set.
+	AdminListenAddress string `mapstructure:"admin_listen_address" yaml:"admin_listen_address,omitempty"`
+	AdminAllowPublic   bool   `mapstructure:"admin_allow_public" yaml:"admin_allow_public,omitempty"`
+	// TrustedProxies are the IPs or CIDRs of proxies, such as Traefik, that
+	// are trusted to give the client IP in X-Forwarded-For or X-Real-Ip
+	TrustedProxies []string `mapstructure:"trusted_proxies" yaml:"trusted_proxies,omitempty"`
+	CORS           CORS
+	Security       Security `mapstructure:"security" yaml:"security,omitempty"`
+	TLS            TLS      `mapstructure:"tls" yaml:"tls,omitempty"`
+	// SocketMode and SocketGroup are the permissions of unix sockets that are
+	// listened on
+	SocketMode  os.FileMode `mapstructure:"socket_mode" yaml:"socket_mode,omitempty"`
+	SocketGroup string      `mapstructure:"socket_group" yaml:"socket_group,omitempty"`
+}
+
+// GetSocketMode returns the permissions of unix sockets
+func (h *HTTP) GetSocketMode() os.FileMode {
+	if h.SocketMode == 0 {
+		return DefaultSocketMode
+	}
+	return h.SocketMode
 }
 
 type Database struct {
-	Host     string `mapstructure:"host" yaml:"host"`
-	Name     string `mapstructure:"name" yaml:"name"`
-	Username string `mapstructure:"username" yaml:"username"`
-	Password string `mapstructure:"password" yaml:"password"`
+	Host        string `mapstructure:"host" yaml:"host"`
+	Name        string `mapstructure:"name" yaml:"name"`
+	Username    Secret `mapstructure:"username" yaml:"username"`
+	Password    Secret `mapstructure:"password" yaml:"password"`
+	AutoMigrate bool   `mapstructure:"auto_migrate" yaml:"auto_migrate,omitempty"`
+}
+
+// Dev describes local development mode, where the server runs entirely in
+// process with an in-memory datastore seeded from fixtures
+type Dev struct {
+	Enabled  bool   `mapstructure:"enabled" yaml:"enabled,omitempty"`
+	Fixtures string `mapstructure:"fixtures" yaml:"fixtures,omitempty"`
+}
+
+const (
+	LogFormatJSON    = "json"
+	LogFormatConsole = "console"
+)
+
+const (
+	LogSubsystemHTTP     = "http"
+	LogSubsystemAuth     = "auth"
+	LogSubsystemDatabase = "database"
+)
+
+// LogSubsystems are the subsystems whose log level can be overridden
+var LogSubsystems = []string{LogSubsystemHTTP, LogSubsystemAuth, LogSubsystemDatabase}
+
+// LogFile describes a file logs are written to as well as stderr. The file is
+// rotated once it reaches MaxSizeMB, or 100MB if that is zero. MaxBackups old
+// files are kept for up to MaxAgeDays, old files are kept forever if these are
+// zero.
+type LogFile struct {
+	Path       string `mapstructure:"path" yaml:"path,omitempty"`
+	MaxSizeMB  int    `mapstructure:"max_size_mb" yaml:"max_size_mb,omitempty"`
+	MaxBackups int    `mapstructure:"max_backups" yaml:"max_backups,omitempty"`
+	MaxAgeDays int    `mapstructure:"max_age_days" yaml:"max_age_days,omitempty"`
+	Compress   bool   `mapstructure:"compress" yaml:"compress,omitempty"`
+}
+
+// Logging describes how logs are written. Logs are written to stderr as JSON
+// unless the console format is given, and to a file as JSON if one is given.
+type Logging struct {
+	Format string  `mapstructure:"format" yaml:"format,omitempty"`
+	File   LogFile `mapstructure:"file" yaml:"file,omitempty"`
+	// Subsystems overrides log_level for the subsystems named, e.g. to debug
+	// only the database
+	Subsystems map[string]string `mapstructure:"subsystems" yaml:"subsystems,omitempty"`
+}
+
+const (
+	RateLimitStoreMemory   = "memory"
+	RateLimitStoreDatabase = "database"
+)
+
+const (
+	RateLimitKeyIP    = "ip"
+	RateLimitKeyUser  = "user"
+	RateLimitKeyToken = "token"
+)
+
+const (
+	// RateLimitGroupDefault applies to every /v2 route except the health checks
+	RateLimitGroupDefault = "default"
+	RateLimitGroupUsers   = "users"
+)
+
+// RateLimitGroups are the route groups that can be rate limited
+var RateLimitGroups = []string{RateLimitGroupDefault, RateLimitGroupUsers}
+
+// RateLimit describes the token bucket each client of a route group gets.
+// Requests tokens are added to the bucket every Period, and it holds Burst
+// tokens, or Requests if Burst is zero. Clients are told apart by Key, their
+// IP unless it is user or token, anonymous clients are always told apart by
+// their IP.
+type RateLimit struct {
+	Requests int           `mapstructure:"requests" yaml:"requests"`
+	Period   time.Duration `mapstructure:"period" yaml:"period"`
+	Burst    int           `mapstructure:"burst" yaml:"burst,omitempty"`
+	Key      string        `mapstructure:"key" yaml:"key,omitempty"`
+}
+
+// RateLimits describes the rate limits of each route group, groups that are
+// not given are not limited. Buckets are kept in memory unless the store is
+// database, which should be used when running more than one replica.
+type RateLimits struct {
+	Store  string               `mapstructure:"store" yaml:"store,omitempty"`
+	Groups map[string]RateLimit `mapstructure:"groups" yaml:"groups,omitempty"`
+}
+
+// The defaults of the limits of requests that aren't configured
+const (
+	DefaultRequestTimeout     = 30 * time.Second
+	DefaultRequestMaxBodySize = 1 << 20
+)
+
+const (
+	// RequestGroupHealth has the health checks, which should time out before
+	// the probes calling them do
+	RequestGroupHealth = "health"
+	RequestGroupUsers  = "users"
+)
+
+// RequestGroups are the route groups that can have limits of their own
+var RequestGroups = []string{RequestGroupHealth, RequestGroupUsers}
+
+// RequestLimit describes how long a request can take, including the datastore
+// calls made for it, and how large its body can be in bytes
+type RequestLimit struct {
+	Timeout     time.Duration `mapstructure:"timeout" yaml:"timeout,omitempty"`
+	MaxBodySize int64         `mapstructure:"max_body_size" yaml:"max_body_size,omitempty"`
+}
+
+// Requests describes the limits of every request, which route groups can
+// override. Limits that aren't configured have their defaults.
+type Requests struct {
+	Timeout     time.Duration           `mapstructure:"timeout" yaml:"timeout,omitempty"`
+	MaxBodySize int64                   `mapstructure:"max_body_size" yaml:"max_body_size,omitempty"`
+	Groups      map[string]RequestLimit `mapstructure:"groups" yaml:"groups,omitempty"`
+}
+
+// Limit returns the limits of requests to the route group, which are those of
+// every request if the group is empty or doesn't override them
+func (r Requests) Limit(group string) RequestLimit {
+	limit := RequestLimit{Timeout: r.Timeout, MaxBodySize: r.MaxBodySize}
+	if override, ok := r.Groups[group]; ok {
+		if override.Timeout != 0 {
+			limit.Timeout = override.Timeout
+		}
+		if override.MaxBodySize != 0 {
+			limit.MaxBodySize = override.MaxBodySize
+		}
+	}
+	if limit.Timeout == 0 {
+		limit.Timeout = DefaultRequestTimeout
+	}
+	if limit.MaxBodySize == 0 {
+		limit.MaxBodySize = DefaultRequestMaxBodySize
+	}
+	return limit
+}
+
+// The defaults of maintenance mode that aren't configured
+const (
+	DefaultMaintenanceMessage    = "APId is read-only for maintenance, changes can't be made right now"
+	DefaultMaintenanceRetryAfter = 5 * time.Minute
+)
+
+const (
+	MaintenanceGroupUsers = "users"
+)
+
+// MaintenanceGroups are the route groups that can be made read-only on their
+// own
+var MaintenanceGroups = []string{MaintenanceGroupUsers}
+
+// Maintenance describes whether the API is read-only, e.g. while the database
+// is upgraded. Requests that make changes are turned away with Message and
+// told to retry after RetryAfter, while the others keep working. Every /v2
+// route is read-only unless Groups are given, in which case only theirs are.
+type Maintenance struct {
+	Enabled    bool          `mapstructure:"enabled" yaml:"enabled,omitempty"`
+	Message    string        `mapstructure:"message" yaml:"message,omitempty"`
+	RetryAfter time.Duration `mapstructure:"retry_after" yaml:"retry_after,omitempty"`
+	Groups     []string      `mapstructure:"groups" yaml:"groups,omitempty"`
+}
+
+// GetMessage returns the message requests that are turned away get
+func (m *Maintenance) GetMessage() string {
+	if m.Message == "" {
+		return DefaultMaintenanceMessage
+	}
+	return m.Message
+}
+
+// GetRetryAfter returns how long clients are told to wait before retrying
+func (m *Maintenance) GetRetryAfter() time.Duration {
+	if m.RetryAfter == 0 {
+		return DefaultMaintenanceRetryAfter
+	}
+	return m.RetryAfter
+}
+
+// ReadOnly reports whether the route group is read-only, the empty group has
+// every /v2 route
+func (m *Maintenance) ReadOnly(group string) bool {
+	if !m.Enabled {
+		return false
+	}
+	if len(m.Groups) == 0 {
+		return group == ""
+	}
+	for _, g := range m.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	FeatureFlagElections      = "elections"
+	FeatureFlagVMProvisioning = "vm_provisioning"
+)
+
+// FeatureFlagNames are the flags features can be hidden behind, a flag must be
+// added here before it can be configured
+var FeatureFlagNames = []string{FeatureFlagElections, FeatureFlagVMProvisioning}
+
+// FeatureFlag describes whether a feature is enabled for everyone. It can be
+// overridden for single users and roles through the admin listener.
+type FeatureFlag struct {
+	Enabled     bool   `mapstructure:"enabled" yaml:"enabled,omitempty"`
+	Description string `mapstructure:"description" yaml:"description,omitempty"`
+}
+
+// FeatureFlags are the configured flags by name, flags that aren't configured
+// are disabled
+type FeatureFlags map[string]FeatureFlag
+
+// DefaultIdempotencyTTL is how long idempotency keys are kept for if no TTL
+// is configured
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// Idempotency describes how long the responses of requests made with an
+// Idempotency-Key header are kept and replayed for
+type Idempotency struct {
+	TTL time.Duration `mapstructure:"ttl" yaml:"ttl,omitempty"`
+}
+
+const (
+	TracingExporterNone   = "none"
+	TracingExporterOTLP   = "otlp"
+	TracingExporterStdout = "stdout"
+)
+
+// Tracing describes where OpenTelemetry spans are exported to. Spans are not
+// exported if no exporter is given.
+type Tracing struct {
+	Exporter string `mapstructure:"exporter" yaml:"exporter,omitempty"`
+	// Endpoint is the host:port of an OTLP/HTTP collector
+	Endpoint string `mapstructure:"endpoint" yaml:"endpoint,omitempty"`
+	Insecure bool   `mapstructure:"insecure" yaml:"insecure,omitempty"`
 }
 
 // Config describes the configuration for Server
 type Config struct {
-	LogLevel string `mapstructure:"log_level" yaml:"log_level"`
-	Timeouts Timeouts
-	HTTP     HTTP
-	Database Database
+	LogLevel     string `mapstructure:"log_level" yaml:"log_level"`
+	Timeouts     Timeouts
+	HTTP         HTTP
+	Database     Database
+	Dev          Dev          `yaml:"dev,omitempty"`
+	Tracing      Tracing      `yaml:"tracing,omitempty"`
+	Logging      Logging      `yaml:"logging,omitempty"`
+	RateLimits   RateLimits   `mapstructure:"rate_limits" yaml:"rate_limits,omitempty"`
+	Idempotency  Idempotency  `yaml:"idempotency,omitempty"`
+	Requests     Requests     `yaml:"requests,omitempty"`
+	Maintenance  Maintenance  `yaml:"maintenance,omitempty"`
+	FeatureFlags FeatureFlags `mapstructure:"feature_flags" yaml:"feature_flags,omitempty"`
 }
 
 func (c *Config) GetZeroLogLevel() zerolog.Level {
-	switch c.LogLevel {
+	return ZeroLogLevel(c.LogLevel)
+}
+
+// ZeroLogLevel returns the zerolog level named, or zerolog.NoLevel if the name
+// is not a valid level
+func ZeroLogLevel(level string) zerolog.Level {
+	switch level {
 	case "trace":
 		return zerolog.TraceLevel
 	case "disabled":
@@ -80,25 +541,280 @@ func (t *Timeouts) Verify() ([]string, error) {
 
 func (h *HTTP) Verify() ([]string, error) {
 	issues := []string{}
-	_, _, err := net.SplitHostPort(h.ListenAddress)
+	// systemd socket names can be any printable characters except ':'
+	socketNameRegex, err := regexp.Compile(`^[!-9;-~]{1,255}$`)
+	if err != nil {
+		return nil, err
+	}
+	issues = append(issues, verifyListenAddress("HTTP listen address", h.ListenAddress, socketNameRegex)...)
+	if h.AdminListenAddress != "" {
+		addressIssues := verifyListenAddress("HTTP admin listen address", h.AdminListenAddress, socketNameRegex)
+		issues = append(issues, addressIssues...)
+		// unix and systemd sockets aren't public unless they are made to be
+		network, addr := ParseListenAddress(h.AdminListenAddress)
+		host, _, _ := net.SplitHostPort(addr)
+		if len(addressIssues) == 0 && network == NetworkTCP && !h.AdminAllowPublic && !isPrivateHost(host) {
+			issues = append(issues, "HTTP admin listen address must be a loopback or private IP address unless admin_allow_public is set")
+		}
+	}
+	if h.SocketMode&^os.ModePerm != 0 {
+		issues = append(issues, fmt.Sprintf("The socket mode %o is not valid, use permissions such as 0660", h.SocketMode))
+	}
+	if h.SocketMode != 0 || h.SocketGroup != "" {
+		listenNetwork, _ := ParseListenAddress(h.ListenAddress)
+		adminNetwork, _ := ParseListenAddress(h.AdminListenAddress)
+		if listenNetwork != NetworkUnix && adminNetwork != NetworkUnix {
+			issues = append(issues, "The socket mode and group are only used with unix: listen addresses")
+		}
+	}
+	for _, proxy := range h.TrustedProxies {
+		if !validIPOrCIDR(proxy) {
+			issues = append(issues, fmt.Sprintf("The trusted proxy %s is not a valid IP or CIDR", proxy))
+		}
+	}
+	corsIssues, err := h.CORS.Verify()
+	if err != nil {
+		return nil, err
+	}
+	issues = append(issues, corsIssues...)
+	securityIssues, err := h.Security.Verify()
 	if err != nil {
-		issues = append(issues, "HTTP listen address is not valid")
+		return nil, err
 	}
-	httpDomainRegex, err := regexp.Compile("^(?:https?://)?" + domainRegexStr + "$")
+	issues = append(issues, securityIssues...)
+	tlsIssues, err := h.TLS.Verify()
 	if err != nil {
 		return nil, err
 	}
-	if len(h.CORS.AllowedOrigins) == 0 {
+	issues = append(issues, tlsIssues...)
+	return issues, nil
+}
+
+// referrerPolicies are the values of the Referrer-Policy header
+var referrerPolicies = []string{
+	"no-referrer", "no-referrer-when-downgrade", "origin", "origin-when-cross-origin", "same-origin", "strict-origin",
+	"strict-origin-when-cross-origin", "unsafe-url",
+}
+
+func (s *Security) Verify() ([]string, error) {
+	issues := []string{}
+	if s.HSTS.MaxAge < 0 {
+		issues = append(issues, "The HSTS max age cannot be negative")
+	}
+	// the requirements of https://hstspreload.org
+	if s.HSTS.Preload && (!s.HSTS.IncludeSubdomains || s.HSTS.GetMaxAge() < DefaultHSTSMaxAge) {
+		issues = append(issues, "HSTS preload needs include_subdomains and a max age of at least a year")
+	}
+	switch s.FrameOptions {
+	case "", "DENY", "SAMEORIGIN":
+	default:
+		issues = append(issues, fmt.Sprintf("The frame options %s are invalid, use DENY or SAMEORIGIN", s.FrameOptions))
+	}
+	if s.ReferrerPolicy != "" {
+		valid := false
+		for _, policy := range referrerPolicies {
+			valid = valid || policy == s.ReferrerPolicy
+		}
+		if !valid {
+			issues = append(issues, fmt.Sprintf("The referrer policy %s is invalid, use one of %s", s.ReferrerPolicy, strings.Join(referrerPolicies, ", ")))
+		}
+	}
+	if strings.ContainsAny(s.ContentSecurityPolicy, "\r\n") {
+		issues = append(issues, "The content security policy must be on one line")
+	}
+	if strings.ContainsAny(s.DocsContentSecurityPolicy, "\r\n") {
+		issues = append(issues, "The docs content security policy must be on one line")
+	}
+	return issues, nil
+}
+
+// GetMaxAge returns the max age browsers should remember to use HTTPS for
+func (h *HSTS) GetMaxAge() time.Duration {
+	if h.MaxAge == 0 {
+		return DefaultHSTSMaxAge
+	}
+	return h.MaxAge
+}
+
+func (s *Security) GetFrameOptions() string {
+	if s.FrameOptions == "" {
+		return DefaultFrameOptions
+	}
+	return s.FrameOptions
+}
+
+func (s *Security) GetReferrerPolicy() string {
+	if s.ReferrerPolicy == "" {
+		return DefaultReferrerPolicy
+	}
+	return s.ReferrerPolicy
+}
+
+func (s *Security) GetContentSecurityPolicy() string {
+	if s.ContentSecurityPolicy == "" {
+		return DefaultContentSecurityPolicy
+	}
+	return s.ContentSecurityPolicy
+}
+
+func (s *Security) GetDocsContentSecurityPolicy() string {
+	if s.DocsContentSecurityPolicy == "" {
+		return DefaultDocsContentSecurityPolicy
+	}
+	return s.DocsContentSecurityPolicy
+}
+
+func (c *CORS) Verify() ([]string, error) {
+	issues := []string{}
+	if len(c.AllowedOrigins) == 0 {
 		issues = append(issues, "No allowed origins specified")
 	}
-	for _, origin := range h.CORS.AllowedOrigins {
-		if origin != "*" && !httpDomainRegex.MatchString(origin) {
+	policyIssues, err := c.Policy("").verify()
+	if err != nil {
+		return nil, err
+	}
+	issues = append(issues, policyIssues...)
+
+	groups := make([]string, 0, len(c.Groups))
+	for group := range c.Groups {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		if !contains(CORSGroups, group) {
+			issues = append(issues, fmt.Sprintf("The CORS group %s is unknown, use one of %s", group, strings.Join(CORSGroups, ", ")))
+			continue
+		}
+		groupIssues, err := c.Policy(group).verify()
+		if err != nil {
+			return nil, err
+		}
+		for _, issue := range groupIssues {
+			issues = append(issues, fmt.Sprintf("%s in the CORS group %s", issue, group))
+		}
+	}
+	return issues, nil
+}
+
+// verify checks a policy returned by Policy
+func (c CORS) verify() ([]string, error) {
+	issues := []string{}
+	originRegex, err := regexp.Compile(`^(?:https?://)?(?:(?:\*\.)?` + domainRegexStr + `|localhost)(?::[0-9]{1,5})?$`)
+	if err != nil {
+		return nil, err
+	}
+	// methods and headers are tokens, RFC 9110
+	tokenRegex, err := regexp.Compile("^[A-Za-z0-9!#$%&'*+.^_`|~-]+$")
+	if err != nil {
+		return nil, err
+	}
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			if c.AllowCredentials {
+				issues = append(issues, "Credentials can't be allowed from every origin, list the allowed origins instead of '*'")
+			}
+		} else if !originRegex.MatchString(origin) {
 			issues = append(issues, fmt.Sprintf("The allowed origin %s is invalid", origin))
 		}
 	}
+	for _, method := range c.AllowedMethods {
+		if !tokenRegex.MatchString(method) || strings.ToUpper(method) != method {
+			issues = append(issues, fmt.Sprintf("The allowed method %s is invalid", method))
+		}
+	}
+	for _, header := range c.AllowedHeaders {
+		if !tokenRegex.MatchString(header) {
+			issues = append(issues, fmt.Sprintf("The allowed header %s is invalid", header))
+		}
+	}
+	for _, header := range c.ExposedHeaders {
+		if header == "*" || !tokenRegex.MatchString(header) {
+			issues = append(issues, fmt.Sprintf("The exposed header %s is invalid", header))
+		}
+	}
+	if c.MaxAge < 0 {
+		issues = append(issues, "The CORS max age cannot be negative")
+	}
 	return issues, nil
 }
 
+// Policy returns the policy for the route group given, with the defaults for
+// lists that aren't configured. The policy of the routes outside any group is
+// returned for an empty group.
+func (c CORS) Policy(group string) CORS {
+	policy := c
+	policy.Groups = nil
+	if override, ok := c.Groups[group]; ok {
+		if len(override.AllowedOrigins) != 0 {
+			policy.AllowedOrigins = override.AllowedOrigins
+		}
+		if len(override.AllowedMethods) != 0 {
+			policy.AllowedMethods = override.AllowedMethods
+		}
+		if len(override.AllowedHeaders) != 0 {
+			policy.AllowedHeaders = override.AllowedHeaders
+		}
+		if len(override.ExposedHeaders) != 0 {
+			policy.ExposedHeaders = override.ExposedHeaders
+		}
+		if override.AllowCredentials != nil {
+			policy.AllowCredentials = *override.AllowCredentials
+		}
+		if override.MaxAge != 0 {
+			policy.MaxAge = override.MaxAge
+		}
+	}
+	if len(policy.AllowedMethods) == 0 {
+		policy.AllowedMethods = DefaultCORSAllowedMethods
+	}
+	if len(policy.AllowedHeaders) == 0 {
+		policy.AllowedHeaders = DefaultCORSAllowedHeaders
+	}
+	if len(policy.ExposedHeaders) == 0 {
+		policy.ExposedHeaders = DefaultCORSExposedHeaders
+	}
+	return policy
+}
+
+func validIPOrCIDR(s string) bool {
+	if net.ParseIP(s) != nil {
+		return true
+	}
+	_, _, err := net.ParseCIDR(s)
+	return err == nil
+}
+
+// verifyListenAddress returns the issues with a listen address, which is named
+// in them
+func verifyListenAddress(name string, address string, socketNameRegex *regexp.Regexp) []string {
+	network, addr := ParseListenAddress(address)
+	switch network {
+	case NetworkUnix:
+		if !filepath.IsAbs(addr) || len(addr) > maxSocketPathLength {
+			return []string{fmt.Sprintf("%s must be an absolute unix socket path of at most %d bytes", name, maxSocketPathLength)}
+		}
+	case NetworkSystemd:
+		if addr != "" && !socketNameRegex.MatchString(addr) {
+			return []string{fmt.Sprintf("%s has an invalid systemd socket name, names are up to 255 printable characters without ':'", name)}
+		}
+	default:
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return []string{name + " is not valid"}
+		}
+	}
+	return nil
+}
+
+// isPrivateHost reports whether a listen host only binds to loopback or
+// private networks. An empty host binds every interface so is not private.
+func isPrivateHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || ip.IsPrivate())
+}
+
 func (d *Database) Verify() ([]string, error) {
 	issues := []string{}
 	mongoHostRegex, err := regexp.Compile("^mongodb://" + domainRegexStr + "$")
@@ -120,6 +836,156 @@ func (d *Database) Verify() ([]string, error) {
 	return issues, nil
 }
 
+func (t *Tracing) Verify() ([]string, error) {
+	issues := []string{}
+	switch t.Exporter {
+	case "", TracingExporterNone, TracingExporterStdout:
+	case TracingExporterOTLP:
+		if _, _, err := net.SplitHostPort(t.Endpoint); err != nil {
+			issues = append(issues, "Tracing endpoint must be in the form 'HOST:PORT' when exporting with otlp")
+		}
+	default:
+		issues = append(issues, fmt.Sprintf("The tracing exporter %s is invalid, use otlp, stdout or none", t.Exporter))
+	}
+	return issues, nil
+}
+
+func (l *Logging) Verify() ([]string, error) {
+	issues := []string{}
+	switch l.Format {
+	case "", LogFormatJSON, LogFormatConsole:
+	default:
+		issues = append(issues, fmt.Sprintf("The log format %s is invalid, use json or console", l.Format))
+	}
+	if l.File.MaxSizeMB < 0 || l.File.MaxBackups < 0 || l.File.MaxAgeDays < 0 {
+		issues = append(issues, "The log file rotation limits cannot be negative")
+	}
+	subsystems := make([]string, 0, len(l.Subsystems))
+	for subsystem := range l.Subsystems {
+		subsystems = append(subsystems, subsystem)
+	}
+	// sorted so the issues are in a stable order
+	sort.Strings(subsystems)
+	for _, subsystem := range subsystems {
+		if !contains(LogSubsystems, subsystem) {
+			issues = append(issues, fmt.Sprintf("The log subsystem %s is unknown, use one of %s", subsystem, strings.Join(LogSubsystems, ", ")))
+			continue
+		}
+		if ZeroLogLevel(l.Subsystems[subsystem]) == zerolog.NoLevel {
+			issues = append(issues, fmt.Sprintf("The log level %s of the %s subsystem is invalid", l.Subsystems[subsystem], subsystem))
+		}
+	}
+	return issues, nil
+}
+
+func (r *RateLimits) Verify() ([]string, error) {
+	issues := []string{}
+	switch r.Store {
+	case "", RateLimitStoreMemory, RateLimitStoreDatabase:
+	default:
+		issues = append(issues, fmt.Sprintf("The rate limit store %s is invalid, use memory or database", r.Store))
+	}
+	groups := make([]string, 0, len(r.Groups))
+	for group := range r.Groups {
+		groups = append(groups, group)
+	}
+	// sorted so the issues are in a stable order
+	sort.Strings(groups)
+	for _, group := range groups {
+		if !contains(RateLimitGroups, group) {
+			issues = append(issues, fmt.Sprintf("The rate limit group %s is unknown, use one of %s", group, strings.Join(RateLimitGroups, ", ")))
+			continue
+		}
+		limit := r.Groups[group]
+		if limit.Requests <= 0 || limit.Period <= 0 {
+			issues = append(issues, fmt.Sprintf("The rate limit of the %s group must allow at least one request per period, e.g. 'requests: 10' and 'period: 1m'", group))
+		}
+		if limit.Burst < 0 {
+			issues = append(issues, fmt.Sprintf("The rate limit burst of the %s group cannot be negative", group))
+		}
+		switch limit.Key {
+		case "", RateLimitKeyIP, RateLimitKeyUser, RateLimitKeyToken:
+		default:
+			issues = append(issues, fmt.Sprintf("The rate limit key %s of the %s group is invalid, use ip, user or token", limit.Key, group))
+		}
+	}
+	return issues, nil
+}
+
+func (r *Requests) Verify() ([]string, error) {
+	issues := []string{}
+	if r.Timeout < 0 {
+		issues = append(issues, "The request timeout cannot be negative")
+	}
+	if r.MaxBodySize < 0 {
+		issues = append(issues, "The request max body size cannot be negative")
+	}
+	groups := make([]string, 0, len(r.Groups))
+	for group := range r.Groups {
+		groups = append(groups, group)
+	}
+	// sorted so the issues are in a stable order
+	sort.Strings(groups)
+	for _, group := range groups {
+		if !contains(RequestGroups, group) {
+			issues = append(issues, fmt.Sprintf("The request group %s is unknown, use one of %s", group, strings.Join(RequestGroups, ", ")))
+			continue
+		}
+		if r.Groups[group].Timeout < 0 {
+			issues = append(issues, fmt.Sprintf("The request timeout of the %s group cannot be negative", group))
+		}
+		if r.Groups[group].MaxBodySize < 0 {
+			issues = append(issues, fmt.Sprintf("The request max body size of the %s group cannot be negative", group))
+		}
+	}
+	return issues, nil
+}
+
+func (m *Maintenance) Verify() ([]string, error) {
+	issues := []string{}
+	if m.RetryAfter < 0 {
+		issues = append(issues, "The maintenance retry after cannot be negative")
+	}
+	for _, group := range m.Groups {
+		if !contains(MaintenanceGroups, group) {
+			issues = append(issues, fmt.Sprintf("The maintenance group %s is unknown, use one of %s", group, strings.Join(MaintenanceGroups, ", ")))
+		}
+	}
+	return issues, nil
+}
+
+func (f *FeatureFlags) Verify() ([]string, error) {
+	issues := []string{}
+	names := make([]string, 0, len(*f))
+	for name := range *f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !contains(FeatureFlagNames, name) {
+			issues = append(issues, fmt.Sprintf("The feature flag %s is unknown, use one of %s", name, strings.Join(FeatureFlagNames, ", ")))
+		}
+	}
+	return issues, nil
+}
+
+func (i *Idempotency) Verify() ([]string, error) {
+	issues := []string{}
+	if i.TTL < 0 {
+		issues = append(issues, "The idempotency TTL cannot be negative")
+	}
+	return issues, nil
+}
+
+// GetTTL returns the TTL of idempotency keys, or the default if none is
+// configured
+func (i *Idempotency) GetTTL() time.Duration {
+	if i.TTL == 0 {
+		return DefaultIdempotencyTTL
+	}
+	return i.TTL
+}
+
 func (c *Config) Verify() ([]string, error) {
 	issues := []string{}
 
@@ -139,11 +1005,66 @@ func (c *Config) Verify() ([]string, error) {
 	}
 	issues = append(issues, httpIssues...)
 
-	databaseIssues, err := c.Database.Verify()
+	// development mode doesn't connect to Mongo, so it needn't be configured
+	if !c.Dev.Enabled {
+		databaseIssues, err := c.Database.Verify()
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, databaseIssues...)
+	}
+
+	tracingIssues, err := c.Tracing.Verify()
+	if err != nil {
+		return nil, err
+	}
+	issues = append(issues, tracingIssues...)
+
+	loggingIssues, err := c.Logging.Verify()
 	if err != nil {
 		return nil, err
 	}
-	issues = append(issues, databaseIssues...)
+	issues = append(issues, loggingIssues...)
+
+	rateLimitIssues, err := c.RateLimits.Verify()
+	if err != nil {
+		return nil, err
+	}
+	issues = append(issues, rateLimitIssues...)
+
+	idempotencyIssues, err := c.Idempotency.Verify()
+	if err != nil {
+		return nil, err
+	}
+	issues = append(issues, idempotencyIssues...)
+
+	requestIssues, err := c.Requests.Verify()
+	if err != nil {
+		return nil, err
+	}
+	issues = append(issues, requestIssues...)
+
+	maintenanceIssues, err := c.Maintenance.Verify()
+	if err != nil {
+		return nil, err
+	}
+	issues = append(issues, maintenanceIssues...)
+
+	featureFlagIssues, err := c.FeatureFlags.Verify()
+	if err != nil {
+		return nil, err
+	}
+	issues = append(issues, featureFlagIssues...)
 
 	return issues, nil
 }
+
+// contains reports whether the value is one of the values given
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -175,6 +176,186 @@ func TestHTTPVerify(t *testing.T) {
 			issue:       "HTTP listen address is not valid",
 			expectIssue: true,
 		},
+		{
+			name: "expect no HTTP listen address issue for a unix socket",
+			beforeWork: func() {
+				testConfig.HTTP.ListenAddress = "unix:/run/apid/apid.sock"
+				testConfig.HTTP.SocketMode = 0o660
+				testConfig.HTTP.SocketGroup = "www-data"
+			},
+			issue:       "HTTP listen address must be an absolute unix socket path of at most 107 bytes",
+			expectIssue: false,
+		},
+		{
+			name: "expect HTTP listen address issue for a relative unix socket",
+			beforeWork: func() {
+				testConfig.HTTP.ListenAddress = "unix:apid.sock"
+			},
+			issue:       "HTTP listen address must be an absolute unix socket path of at most 107 bytes",
+			expectIssue: true,
+		},
+		{
+			name: "expect HTTP listen address issue for a long unix socket",
+			beforeWork: func() {
+				testConfig.HTTP.ListenAddress = "unix:/run/" + strings.Repeat("a", 100) + ".sock"
+			},
+			issue:       "HTTP listen address must be an absolute unix socket path of at most 107 bytes",
+			expectIssue: true,
+		},
+		{
+			name: "expect no HTTP listen address issue for the first systemd socket",
+			beforeWork: func() {
+				testConfig.HTTP.ListenAddress = "systemd"
+			},
+			issue:       "HTTP listen address is not valid",
+			expectIssue: false,
+		},
+		{
+			name: "expect no HTTP listen address issue for a named systemd socket",
+			beforeWork: func() {
+				testConfig.HTTP.ListenAddress = "systemd:apid-web"
+			},
+			issue:       "HTTP listen address has an invalid systemd socket name, names are up to 255 printable characters without ':'",
+			expectIssue: false,
+		},
+		{
+			name: "expect HTTP listen address issue for an invalid systemd socket name",
+			beforeWork: func() {
+				testConfig.HTTP.ListenAddress = "systemd:apid web"
+			},
+			issue:       "HTTP listen address has an invalid systemd socket name, names are up to 255 printable characters without ':'",
+			expectIssue: true,
+		},
+		{
+			name: "expect HTTP socket mode issue for an invalid mode",
+			beforeWork: func() {
+				testConfig.HTTP.ListenAddress = "unix:/run/apid/apid.sock"
+				testConfig.HTTP.SocketMode = 0o1777
+			},
+			issue:       "The socket mode 1777 is not valid, use permissions such as 0660",
+			expectIssue: true,
+		},
+		{
+			name: "expect HTTP socket mode issue without a unix socket",
+			beforeWork: func() {
+				testConfig.HTTP.SocketGroup = "www-data"
+			},
+			issue:       "The socket mode and group are only used with unix: listen addresses",
+			expectIssue: true,
+		},
+		// HTTP: Admin Listen Address
+		{
+			name:        "expect no HTTP admin listen address issue when not given",
+			beforeWork:  func() {},
+			issue:       "HTTP admin listen address is not valid",
+			expectIssue: false,
+		},
+		{
+			name: "expect no HTTP admin listen address issue",
+			beforeWork: func() {
+				testConfig.HTTP.AdminListenAddress = "127.0.0.1:9090"
+			},
+			issue:       "HTTP admin listen address is not valid",
+			expectIssue: false,
+		},
+		{
+			name: "expect no HTTP admin listen address issue for localhost",
+			beforeWork: func() {
+				testConfig.HTTP.AdminListenAddress = "localhost:9090"
+			},
+			issue:       "HTTP admin listen address must be a loopback or private IP address unless admin_allow_public is set",
+			expectIssue: false,
+		},
+		{
+			name: "expect no HTTP admin listen address issue for a private network",
+			beforeWork: func() {
+				testConfig.HTTP.AdminListenAddress = "10.0.3.7:9090"
+			},
+			issue:       "HTTP admin listen address must be a loopback or private IP address unless admin_allow_public is set",
+			expectIssue: false,
+		},
+		{
+			name: "expect HTTP admin listen address issue for every interface",
+			beforeWork: func() {
+				testConfig.HTTP.AdminListenAddress = ":9090"
+			},
+			issue:       "HTTP admin listen address must be a loopback or private IP address unless admin_allow_public is set",
+			expectIssue: true,
+		},
+		{
+			name: "expect HTTP admin listen address issue for a public address",
+			beforeWork: func() {
+				testConfig.HTTP.AdminListenAddress = "140.203.1.1:9090"
+			},
+			issue:       "HTTP admin listen address must be a loopback or private IP address unless admin_allow_public is set",
+			expectIssue: true,
+		},
+		{
+			name: "expect HTTP admin listen address issue for a hostname",
+			beforeWork: func() {
+				testConfig.HTTP.AdminListenAddress = "apid.compsoc.ie:9090"
+			},
+			issue:       "HTTP admin listen address must be a loopback or private IP address unless admin_allow_public is set",
+			expectIssue: true,
+		},
+		{
+			name: "expect no HTTP admin listen address issue for a unix socket",
+			beforeWork: func() {
+				testConfig.HTTP.AdminListenAddress = "unix:/run/apid/admin.sock"
+			},
+			issue:       "HTTP admin listen address must be a loopback or private IP address unless admin_allow_public is set",
+			expectIssue: false,
+		},
+		{
+			name: "expect HTTP admin listen address issue for an invalid systemd socket name",
+			beforeWork: func() {
+				testConfig.HTTP.AdminListenAddress = "systemd:admin:9090"
+			},
+			issue:       "HTTP admin listen address has an invalid systemd socket name, names are up to 255 printable characters without ':'",
+			expectIssue: true,
+		},
+		{
+			name: "expect no HTTP admin listen address issue for a public address when allowed",
+			beforeWork: func() {
+				testConfig.HTTP.AdminListenAddress = "0.0.0.0:9090"
+				testConfig.HTTP.AdminAllowPublic = true
+			},
+			issue:       "HTTP admin listen address must be a loopback or private IP address unless admin_allow_public is set",
+			expectIssue: false,
+		},
+		{
+			name: "expect HTTP admin listen address issue when invalid",
+			beforeWork: func() {
+				testConfig.HTTP.AdminListenAddress = "9090"
+			},
+			issue:       "HTTP admin listen address is not valid",
+			expectIssue: true,
+		},
+		// HTTP: Trusted Proxies
+		{
+			name: "expect no HTTP trusted proxy issue for IPs and CIDRs",
+			beforeWork: func() {
+				testConfig.HTTP.TrustedProxies = []string{"10.0.0.1", "172.16.0.0/12", "fd00::/8"}
+			},
+			issue:       "The trusted proxy 172.16.0.0/12 is not a valid IP or CIDR",
+			expectIssue: false,
+		},
+		{
+			name: "expect HTTP trusted proxy issue for an invalid CIDR",
+			beforeWork: func() {
+				testConfig.HTTP.TrustedProxies = []string{"10.0.0.0/33"}
+			},
+			issue:       "The trusted proxy 10.0.0.0/33 is not a valid IP or CIDR",
+			expectIssue: true,
+		},
+		{
+			name: "expect HTTP trusted proxy issue for a hostname",
+			beforeWork: func() {
+				testConfig.HTTP.TrustedProxies = []string{"traefik"}
+			},
+			issue:       "The trusted proxy traefik is not a valid IP or CIDR",
+			expectIssue: true,
+		},
 		// HTTP: CORS Allowed Origins
 		{
 			name:        "expect no HTTP CORS issue with * allowed",
@@ -214,6 +395,192 @@ func TestHTTPVerify(t *testing.T) {
 			issue:       "The allowed origin apid.compsoc.i is invalid",
 			expectIssue: true,
 		},
+		{
+			name: "expect no HTTP CORS issue with origin patterns",
+			beforeWork: func() {
+				testConfig.HTTP.CORS.AllowedOrigins = []string{"https://*.compsoc.ie", "*.compsoc.ie", "http://localhost:3000"}
+			},
+			issue:       "The allowed origin https://*.compsoc.ie is invalid",
+			expectIssue: false,
+		},
+		{
+			name: "expect HTTP CORS issue when credentials are allowed from every origin",
+			beforeWork: func() {
+				testConfig.HTTP.CORS.AllowCredentials = true
+			},
+			issue:       "Credentials can't be allowed from every origin, list the allowed origins instead of '*'",
+			expectIssue: true,
+		},
+		{
+			name: "expect HTTP CORS issue for an invalid method",
+			beforeWork: func() {
+				testConfig.HTTP.CORS.AllowedMethods = []string{"get"}
+			},
+			issue:       "The allowed method get is invalid",
+			expectIssue: true,
+		},
+		{
+			name: "expect HTTP CORS issue for an invalid header",
+			beforeWork: func() {
+				testConfig.HTTP.CORS.AllowedHeaders = []string{"If Match"}
+			},
+			issue:       "The allowed header If Match is invalid",
+			expectIssue: true,
+		},
+		{
+			name: "expect HTTP CORS issue for exposing every header",
+			beforeWork: func() {
+				testConfig.HTTP.CORS.ExposedHeaders = []string{"*"}
+			},
+			issue:       "The exposed header * is invalid",
+			expectIssue: true,
+		},
+		{
+			name: "expect HTTP CORS issue for a negative max age",
+			beforeWork: func() {
+				testConfig.HTTP.CORS.MaxAge = -time.Second
+			},
+			issue:       "The CORS max age cannot be negative",
+			expectIssue: true,
+		},
+		{
+			name: "expect HTTP CORS issue for an unknown group",
+			beforeWork: func() {
+				testConfig.HTTP.CORS.Groups = map[string]CORSOverride{"admin": {}}
+			},
+			issue:       "The CORS group admin is unknown, use one of users, docs",
+			expectIssue: true,
+		},
+		{
+			name: "expect HTTP CORS issue for a group allowing credentials from every origin",
+			beforeWork: func() {
+				allow := true
+				testConfig.HTTP.CORS.Groups = map[string]CORSOverride{CORSGroupUsers: {AllowCredentials: &allow}}
+			},
+			issue:       "Credentials can't be allowed from every origin, list the allowed origins instead of '*' in the CORS group users",
+			expectIssue: true,
+		},
+		{
+			name: "expect no HTTP security issue for a preloaded HSTS",
+			beforeWork: func() {
+				testConfig.HTTP.Security.HSTS = HSTS{MaxAge: 2 * DefaultHSTSMaxAge, IncludeSubdomains: true, Preload: true}
+			},
+			issue:       "HSTS preload needs include_subdomains and a max age of at least a year",
+			expectIssue: false,
+		},
+		{
+			name: "expect HTTP security issue for a negative HSTS max age",
+			beforeWork: func() {
+				testConfig.HTTP.Security.HSTS.MaxAge = -time.Second
+			},
+			issue:       "The HSTS max age cannot be negative",
+			expectIssue: true,
+		},
+		{
+			name: "expect HTTP security issue for HSTS preload without subdomains",
+			beforeWork: func() {
+				testConfig.HTTP.Security.HSTS = HSTS{Preload: true}
+			},
+			issue:       "HSTS preload needs include_subdomains and a max age of at least a year",
+			expectIssue: true,
+		},
+		{
+			name: "expect HTTP security issue for HSTS preload with a short max age",
+			beforeWork: func() {
+				testConfig.HTTP.Security.HSTS = HSTS{MaxAge: time.Hour, IncludeSubdomains: true, Preload: true}
+			},
+			issue:       "HSTS preload needs include_subdomains and a max age of at least a year",
+			expectIssue: true,
+		},
+		{
+			name: "expect HTTP security issue for invalid frame options",
+			beforeWork: func() {
+				testConfig.HTTP.Security.FrameOptions = "ALLOW-FROM https://compsoc.ie"
+			},
+			issue:       "The frame options ALLOW-FROM https://compsoc.ie are invalid, use DENY or SAMEORIGIN",
+			expectIssue: true,
+		},
+		{
+			name: "expect HTTP security issue for an invalid referrer policy",
+			beforeWork: func() {
+				testConfig.HTTP.Security.ReferrerPolicy = "never"
+			},
+			issue: "The referrer policy never is invalid, use one of no-referrer, no-referrer-when-downgrade, origin, " +
+				"origin-when-cross-origin, same-origin, strict-origin, strict-origin-when-cross-origin, unsafe-url",
+			expectIssue: true,
+		},
+		{
+			name: "expect HTTP security issue for a content security policy over two lines",
+			beforeWork: func() {
+				testConfig.HTTP.Security.ContentSecurityPolicy = "default-src 'none';\r\nX-Injected: true"
+			},
+			issue:       "The content security policy must be on one line",
+			expectIssue: true,
+		},
+		{
+			name: "expect HTTP security issue for a docs content security policy over two lines",
+			beforeWork: func() {
+				testConfig.HTTP.Security.DocsContentSecurityPolicy = "default-src 'self';\nX-Injected: true"
+			},
+			issue:       "The docs content security policy must be on one line",
+			expectIssue: true,
+		},
+		{
+			name: "expect no HTTP TLS issue for client certificates",
+			beforeWork: func() {
+				testConfig.HTTP.TLS = TLS{CertFile: "tls.crt", KeyFile: "tls.key", ClientCAFile: "ca.crt", ClientAuth: ClientAuthRequire}
+			},
+			issue:       "TLS client certificates can't be verified without a client CA file",
+			expectIssue: false,
+		},
+		{
+			name: "expect HTTP TLS issue for a cert file without a key file",
+			beforeWork: func() {
+				testConfig.HTTP.TLS = TLS{CertFile: "tls.crt"}
+			},
+			issue:       "TLS needs both a cert file and a key file",
+			expectIssue: true,
+		},
+		{
+			name: "expect HTTP TLS issue for a key file without a cert file",
+			beforeWork: func() {
+				testConfig.HTTP.TLS = TLS{KeyFile: "tls.key"}
+			},
+			issue:       "TLS needs both a cert file and a key file",
+			expectIssue: true,
+		},
+		{
+			name: "expect HTTP TLS issue for an unused client CA file",
+			beforeWork: func() {
+				testConfig.HTTP.TLS = TLS{CertFile: "tls.crt", KeyFile: "tls.key", ClientCAFile: "ca.crt"}
+			},
+			issue:       "A TLS client CA file is only used when client_auth is optional or require",
+			expectIssue: true,
+		},
+		{
+			name: "expect HTTP TLS issue for client certificates without a client CA file",
+			beforeWork: func() {
+				testConfig.HTTP.TLS = TLS{CertFile: "tls.crt", KeyFile: "tls.key", ClientAuth: ClientAuthOptional}
+			},
+			issue:       "TLS client certificates can't be verified without a client CA file",
+			expectIssue: true,
+		},
+		{
+			name: "expect HTTP TLS issue for client certificates without TLS",
+			beforeWork: func() {
+				testConfig.HTTP.TLS = TLS{ClientCAFile: "ca.crt", ClientAuth: ClientAuthRequire}
+			},
+			issue:       "TLS client certificates can only be verified when TLS is enabled",
+			expectIssue: true,
+		},
+		{
+			name: "expect HTTP TLS issue for an invalid client auth",
+			beforeWork: func() {
+				testConfig.HTTP.TLS = TLS{CertFile: "tls.crt", KeyFile: "tls.key", ClientAuth: "always"}
+			},
+			issue:       "The TLS client auth always is invalid, use one of none, optional, require",
+			expectIssue: true,
+		},
 	}
 
 	for _, run := range runs {
@@ -225,6 +592,34 @@ func TestHTTPVerify(t *testing.T) {
 	}
 }
 
+func TestCORSPolicy(t *testing.T) {
+	allow := true
+	cors := CORS{
+		AllowedOrigins: []string{"https://compsoc.ie"},
+		ExposedHeaders: []string{"ETag"},
+		MaxAge:         time.Minute,
+		Groups: map[string]CORSOverride{
+			CORSGroupUsers: {AllowedOrigins: []string{"https://dashboard.compsoc.ie"}, AllowCredentials: &allow},
+		},
+	}
+
+	policy := cors.Policy("")
+	assert.Equal(t, []string{"https://compsoc.ie"}, policy.AllowedOrigins, "expected the configured origins")
+	assert.Equal(t, DefaultCORSAllowedMethods, policy.AllowedMethods, "expected the default methods")
+	assert.Equal(t, DefaultCORSAllowedHeaders, policy.AllowedHeaders, "expected the default headers")
+	assert.Equal(t, []string{"ETag"}, policy.ExposedHeaders, "expected the configured exposed headers")
+	assert.False(t, policy.AllowCredentials, "expected credentials not to be allowed")
+	assert.Nil(t, policy.Groups, "expected no groups in a policy")
+
+	policy = cors.Policy(CORSGroupUsers)
+	assert.Equal(t, []string{"https://dashboard.compsoc.ie"}, policy.AllowedOrigins, "expected the group's origins")
+	assert.True(t, policy.AllowCredentials, "expected the group to allow credentials")
+	assert.Equal(t, []string{"ETag"}, policy.ExposedHeaders, "expected the exposed headers to be inherited")
+	assert.Equal(t, time.Minute, policy.MaxAge, "expected the max age to be inherited")
+
+	assert.Equal(t, cors.Policy(""), cors.Policy(CORSGroupDocs), "expected a group without overrides to have the policy")
+}
+
 func TestDatabaseVerify(t *testing.T) {
 	var testConfig Config
 
@@ -335,6 +730,419 @@ func TestDatabaseVerify(t *testing.T) {
 	}
 }
 
+func TestTracingVerify(t *testing.T) {
+	var testConfig Config
+
+	runs := []Run{
+		{
+			name:        "expect no tracing exporter issue when not given",
+			beforeWork:  func() {},
+			issue:       "The tracing exporter  is invalid, use otlp, stdout or none",
+			expectIssue: false,
+		},
+		{
+			name: "expect no tracing exporter issue for stdout",
+			beforeWork: func() {
+				testConfig.Tracing.Exporter = "stdout"
+			},
+			issue:       "The tracing exporter stdout is invalid, use otlp, stdout or none",
+			expectIssue: false,
+		},
+		{
+			name: "expect tracing exporter issue when unknown",
+			beforeWork: func() {
+				testConfig.Tracing.Exporter = "jaeger"
+			},
+			issue:       "The tracing exporter jaeger is invalid, use otlp, stdout or none",
+			expectIssue: true,
+		},
+		{
+			name: "expect tracing endpoint issue for otlp without an endpoint",
+			beforeWork: func() {
+				testConfig.Tracing.Exporter = "otlp"
+			},
+			issue:       "Tracing endpoint must be in the form 'HOST:PORT' when exporting with otlp",
+			expectIssue: true,
+		},
+		{
+			name: "expect no tracing endpoint issue for otlp with an endpoint",
+			beforeWork: func() {
+				testConfig.Tracing.Exporter = "otlp"
+				testConfig.Tracing.Endpoint = "otel-collector:4318"
+			},
+			issue:       "Tracing endpoint must be in the form 'HOST:PORT' when exporting with otlp",
+			expectIssue: false,
+		},
+	}
+
+	for _, run := range runs {
+		t.Run(run.name, func(t *testing.T) {
+			testConfig = validConfig
+			run.verifyFunc = testConfig.Tracing.Verify
+			run.verifyIssuesAndError(t)
+		})
+	}
+}
+
+func TestLoggingVerify(t *testing.T) {
+	var testConfig Config
+
+	runs := []Run{
+		{
+			name:        "expect no log format issue when not given",
+			beforeWork:  func() {},
+			issue:       "The log format  is invalid, use json or console",
+			expectIssue: false,
+		},
+		{
+			name: "expect no log format issue for console",
+			beforeWork: func() {
+				testConfig.Logging.Format = "console"
+			},
+			issue:       "The log format console is invalid, use json or console",
+			expectIssue: false,
+		},
+		{
+			name: "expect log format issue when unknown",
+			beforeWork: func() {
+				testConfig.Logging.Format = "xml"
+			},
+			issue:       "The log format xml is invalid, use json or console",
+			expectIssue: true,
+		},
+		{
+			name: "expect log file issue when a rotation limit is negative",
+			beforeWork: func() {
+				testConfig.Logging.File = LogFile{Path: "/var/log/apid.log", MaxBackups: -1}
+			},
+			issue:       "The log file rotation limits cannot be negative",
+			expectIssue: true,
+		},
+		{
+			name: "expect no log subsystem issue for a known subsystem",
+			beforeWork: func() {
+				testConfig.Logging.Subsystems = map[string]string{"database": "debug"}
+			},
+			issue:       "The log level debug of the database subsystem is invalid",
+			expectIssue: false,
+		},
+		{
+			name: "expect log subsystem issue when unknown",
+			beforeWork: func() {
+				testConfig.Logging.Subsystems = map[string]string{"mongo": "debug"}
+			},
+			issue:       "The log subsystem mongo is unknown, use one of http, auth, database",
+			expectIssue: true,
+		},
+		{
+			name: "expect log subsystem issue when its level is invalid",
+			beforeWork: func() {
+				testConfig.Logging.Subsystems = map[string]string{"http": "loud"}
+			},
+			issue:       "The log level loud of the http subsystem is invalid",
+			expectIssue: true,
+		},
+	}
+
+	for _, run := range runs {
+		t.Run(run.name, func(t *testing.T) {
+			testConfig = validConfig
+			run.verifyFunc = testConfig.Logging.Verify
+			run.verifyIssuesAndError(t)
+		})
+	}
+}
+
+func TestRateLimitsVerify(t *testing.T) {
+	var testConfig Config
+
+	runs := []Run{
+		{
+			name:        "expect no rate limit store issue when not given",
+			beforeWork:  func() {},
+			issue:       "The rate limit store  is invalid, use memory or database",
+			expectIssue: false,
+		},
+		{
+			name: "expect rate limit store issue when unknown",
+			beforeWork: func() {
+				testConfig.RateLimits.Store = "redis"
+			},
+			issue:       "The rate limit store redis is invalid, use memory or database",
+			expectIssue: true,
+		},
+		{
+			name: "expect no rate limit group issue for a known group",
+			beforeWork: func() {
+				testConfig.RateLimits.Groups = map[string]RateLimit{"users": {Requests: 10, Period: time.Minute, Key: "user"}}
+			},
+			issue:       "The rate limit group users is unknown, use one of default, users",
+			expectIssue: false,
+		},
+		{
+			name: "expect rate limit group issue when unknown",
+			beforeWork: func() {
+				testConfig.RateLimits.Groups = map[string]RateLimit{"login": {Requests: 10, Period: time.Minute}}
+			},
+			issue:       "The rate limit group login is unknown, use one of default, users",
+			expectIssue: true,
+		},
+		{
+			name: "expect rate limit issue when no requests are allowed",
+			beforeWork: func() {
+				testConfig.RateLimits.Groups = map[string]RateLimit{"default": {Period: time.Minute}}
+			},
+			issue:       "The rate limit of the default group must allow at least one request per period, e.g. 'requests: 10' and 'period: 1m'",
+			expectIssue: true,
+		},
+		{
+			name: "expect rate limit issue when no period is given",
+			beforeWork: func() {
+				testConfig.RateLimits.Groups = map[string]RateLimit{"default": {Requests: 10}}
+			},
+			issue:       "The rate limit of the default group must allow at least one request per period, e.g. 'requests: 10' and 'period: 1m'",
+			expectIssue: true,
+		},
+		{
+			name: "expect rate limit burst issue when negative",
+			beforeWork: func() {
+				testConfig.RateLimits.Groups = map[string]RateLimit{"default": {Requests: 10, Period: time.Minute, Burst: -1}}
+			},
+			issue:       "The rate limit burst of the default group cannot be negative",
+			expectIssue: true,
+		},
+		{
+			name: "expect rate limit key issue when unknown",
+			beforeWork: func() {
+				testConfig.RateLimits.Groups = map[string]RateLimit{"default": {Requests: 10, Period: time.Minute, Key: "cookie"}}
+			},
+			issue:       "The rate limit key cookie of the default group is invalid, use ip, user or token",
+			expectIssue: true,
+		},
+	}
+
+	for _, run := range runs {
+		t.Run(run.name, func(t *testing.T) {
+			testConfig = validConfig
+			run.verifyFunc = testConfig.RateLimits.Verify
+			run.verifyIssuesAndError(t)
+		})
+	}
+}
+
+func TestIdempotencyVerify(t *testing.T) {
+	var testConfig Config
+
+	runs := []Run{
+		{
+			name:        "expect no idempotency TTL issue when not given",
+			beforeWork:  func() {},
+			issue:       "The idempotency TTL cannot be negative",
+			expectIssue: false,
+		},
+		{
+			name: "expect idempotency TTL issue when negative",
+			beforeWork: func() {
+				testConfig.Idempotency.TTL = -time.Hour
+			},
+			issue:       "The idempotency TTL cannot be negative",
+			expectIssue: true,
+		},
+	}
+
+	for _, run := range runs {
+		t.Run(run.name, func(t *testing.T) {
+			testConfig = validConfig
+			run.verifyFunc = testConfig.Idempotency.Verify
+			run.verifyIssuesAndError(t)
+		})
+	}
+
+	t.Run("expect the default TTL when not given", func(t *testing.T) {
+		i := Idempotency{}
+		assert.Equal(t, DefaultIdempotencyTTL, i.GetTTL(), "expected the default TTL")
+		i.TTL = time.Hour
+		assert.Equal(t, time.Hour, i.GetTTL(), "expected the configured TTL")
+	})
+}
+
+func TestRequestsVerify(t *testing.T) {
+	var testConfig Config
+
+	runs := []Run{
+		{
+			name: "expect no request issue for configured limits",
+			beforeWork: func() {
+				testConfig.Requests = Requests{
+					Timeout:     10 * time.Second,
+					MaxBodySize: 1 << 16,
+					Groups:      map[string]RequestLimit{RequestGroupHealth: {Timeout: time.Second}},
+				}
+			},
+			issue:       "The request timeout cannot be negative",
+			expectIssue: false,
+		},
+		{
+			name: "expect request issue for a negative timeout",
+			beforeWork: func() {
+				testConfig.Requests.Timeout = -time.Second
+			},
+			issue:       "The request timeout cannot be negative",
+			expectIssue: true,
+		},
+		{
+			name: "expect request issue for a negative max body size",
+			beforeWork: func() {
+				testConfig.Requests.MaxBodySize = -1
+			},
+			issue:       "The request max body size cannot be negative",
+			expectIssue: true,
+		},
+		{
+			name: "expect request issue for an unknown group",
+			beforeWork: func() {
+				testConfig.Requests.Groups = map[string]RequestLimit{"admin": {}}
+			},
+			issue:       "The request group admin is unknown, use one of health, users",
+			expectIssue: true,
+		},
+		{
+			name: "expect request issue for a negative group timeout",
+			beforeWork: func() {
+				testConfig.Requests.Groups = map[string]RequestLimit{RequestGroupUsers: {Timeout: -time.Second}}
+			},
+			issue:       "The request timeout of the users group cannot be negative",
+			expectIssue: true,
+		},
+		{
+			name: "expect request issue for a negative group max body size",
+			beforeWork: func() {
+				testConfig.Requests.Groups = map[string]RequestLimit{RequestGroupUsers: {MaxBodySize: -1}}
+			},
+			issue:       "The request max body size of the users group cannot be negative",
+			expectIssue: true,
+		},
+	}
+
+	for _, run := range runs {
+		t.Run(run.name, func(t *testing.T) {
+			testConfig = validConfig
+			run.verifyFunc = testConfig.Requests.Verify
+			run.verifyIssuesAndError(t)
+		})
+	}
+}
+
+func TestRequestsLimit(t *testing.T) {
+	r := Requests{
+		MaxBodySize: 1 << 10,
+		Groups: map[string]RequestLimit{
+			RequestGroupUsers: {Timeout: time.Minute},
+		},
+	}
+
+	limit := r.Limit("")
+	assert.Equal(t, DefaultRequestTimeout, limit.Timeout, "expected the default timeout")
+	assert.Equal(t, int64(1<<10), limit.MaxBodySize, "expected the configured max body size")
+
+	limit = r.Limit(RequestGroupUsers)
+	assert.Equal(t, time.Minute, limit.Timeout, "expected the group timeout")
+	assert.Equal(t, int64(1<<10), limit.MaxBodySize, "expected the max body size of every request")
+
+	limit = Requests{}.Limit(RequestGroupHealth)
+	assert.Equal(t, RequestLimit{Timeout: DefaultRequestTimeout, MaxBodySize: DefaultRequestMaxBodySize}, limit, "expected the defaults")
+}
+
+func TestMaintenanceVerify(t *testing.T) {
+	var testConfig Config
+
+	runs := []Run{
+		{
+			name: "expect no maintenance issue for a configured mode",
+			beforeWork: func() {
+				testConfig.Maintenance = Maintenance{
+					Enabled:    true,
+					Message:    "upgrading mongo",
+					RetryAfter: 10 * time.Minute,
+					Groups:     []string{MaintenanceGroupUsers},
+				}
+			},
+			issue:       "The maintenance retry after cannot be negative",
+			expectIssue: false,
+		},
+		{
+			name: "expect maintenance issue for a negative retry after",
+			beforeWork: func() {
+				testConfig.Maintenance.RetryAfter = -time.Minute
+			},
+			issue:       "The maintenance retry after cannot be negative",
+			expectIssue: true,
+		},
+		{
+			name: "expect maintenance issue for an unknown group",
+			beforeWork: func() {
+				testConfig.Maintenance.Groups = []string{"events"}
+			},
+			issue:       "The maintenance group events is unknown, use one of users",
+			expectIssue: true,
+		},
+	}
+
+	for _, run := range runs {
+		t.Run(run.name, func(t *testing.T) {
+			testConfig = validConfig
+			run.verifyFunc = testConfig.Maintenance.Verify
+			run.verifyIssuesAndError(t)
+		})
+	}
+}
+
+func TestMaintenanceReadOnly(t *testing.T) {
+	m := Maintenance{}
+	assert.False(t, m.ReadOnly(""), "expected nothing to be read-only when disabled")
+	assert.Equal(t, DefaultMaintenanceMessage, m.GetMessage(), "expected the default message")
+	assert.Equal(t, DefaultMaintenanceRetryAfter, m.GetRetryAfter(), "expected the default retry after")
+
+	m.Enabled = true
+	assert.True(t, m.ReadOnly(""), "expected every route to be read-only without groups")
+	assert.False(t, m.ReadOnly(MaintenanceGroupUsers), "expected the group to be covered by every route")
+
+	m.Groups = []string{MaintenanceGroupUsers}
+	assert.False(t, m.ReadOnly(""), "expected only the groups to be read-only")
+	assert.True(t, m.ReadOnly(MaintenanceGroupUsers), "expected the users group to be read-only")
+}
+
+func TestFeatureFlagsVerify(t *testing.T) {
+	var testConfig Config
+
+	runs := []Run{
+		{
+			name: "expect no feature flag issue for a known flag",
+			beforeWork: func() {
+				testConfig.FeatureFlags = FeatureFlags{FeatureFlagElections: {Enabled: true, Description: "Vote in society elections"}}
+			},
+			issue:       "The feature flag elections is unknown, use one of elections, vm_provisioning",
+			expectIssue: false,
+		},
+		{
+			name: "expect feature flag issue for an unknown flag",
+			beforeWork: func() {
+				testConfig.FeatureFlags = FeatureFlags{"voting": {Enabled: true}}
+			},
+			issue:       "The feature flag voting is unknown, use one of elections, vm_provisioning",
+			expectIssue: true,
+		},
+	}
+
+	for _, run := range runs {
+		t.Run(run.name, func(t *testing.T) {
+			testConfig = validConfig
+			run.verifyFunc = testConfig.FeatureFlags.Verify
+			run.verifyIssuesAndError(t)
+		})
+	}
+}
+
 func TestConfig(t *testing.T) {
 	var testConfig Config
 
@@ -406,6 +1214,15 @@ func TestConfig(t *testing.T) {
 			issue:       "Mongo database name is not long enough",
 			expectIssue: true,
 		},
+		{
+			name: "expect no database issue in development mode",
+			beforeWork: func() {
+				testConfig.Database = Database{}
+				testConfig.Dev.Enabled = true
+			},
+			issue:       "Mongo host is not valid",
+			expectIssue: false,
+		},
 	}
 
 	for _, run := range runs {
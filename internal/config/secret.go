@@ -0,0 +1,96 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// Redacted is shown in place of a secret's value
+const Redacted = "********"
+
+// Secret is a string that should never be shown, such as a password. It is
+// masked when marshalled to JSON, which is how zerolog logs it, and when
+// formatted. It is not masked when marshalled to YAML so that config files
+// can be written, use Config.Redacted before printing a config instead.
+type Secret string
+
+// Value returns the secret itself
+func (s Secret) Value() string {
+	return string(s)
+}
+
+func (s Secret) masked() string {
+	if s == "" {
+		return ""
+	}
+	return Redacted
+}
+
+func (s Secret) String() string {
+	return s.masked()
+}
+
+func (s Secret) GoString() string {
+	return s.masked()
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.masked())
+}
+
+var secretType = reflect.TypeOf(Secret(""))
+
+// Redacted returns a copy of the config with every Secret masked, the config
+// itself is left untouched
+func (c Config) Redacted() Config {
+	redact(reflect.ValueOf(&c).Elem())
+	return c
+}
+
+// redact masks every Secret within v, copying any slices, maps and pointers
+// on the way so that the original value is not modified through them
+func redact(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.String:
+		if v.Type() == secretType && v.Len() != 0 {
+			v.SetString(Redacted)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Field(i).CanSet() {
+				redact(v.Field(i))
+			}
+		}
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+		elem := reflect.New(v.Elem().Type())
+		elem.Elem().Set(v.Elem())
+		redact(elem.Elem())
+		v.Set(elem)
+	case reflect.Slice:
+		if v.IsNil() {
+			return
+		}
+		slice := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(slice, v)
+		for i := 0; i < slice.Len(); i++ {
+			redact(slice.Index(i))
+		}
+		v.Set(slice)
+	case reflect.Map:
+		if v.IsNil() {
+			return
+		}
+		m := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(iter.Value())
+			redact(value)
+			m.SetMapIndex(iter.Key(), value)
+		}
+		v.Set(m)
+	}
+}
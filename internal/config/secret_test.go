@@ -0,0 +1,115 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestSecret(t *testing.T) {
+	t.Run("masks the secret when formatted or marshalled to JSON", func(t *testing.T) {
+		s := Secret("hunter2")
+		assert.Equal(t, "hunter2", s.Value(), "expected the value to be revealed")
+		assert.Equal(t, Redacted, s.String(), "expected the string to be masked")
+		assert.NotContains(t, fmt.Sprintf("%v %s %#v", s, s, s), "hunter2", "expected formatting to be masked")
+		b, err := json.Marshal(s)
+		assert.NoError(t, err, "expected no error marshalling the secret")
+		assert.Equal(t, `"********"`, string(b), "expected the JSON to be masked")
+	})
+
+	t.Run("leaves an empty secret empty", func(t *testing.T) {
+		s := Secret("")
+		assert.Equal(t, "", s.String(), "expected an empty string")
+		b, err := json.Marshal(s)
+		assert.NoError(t, err, "expected no error marshalling the secret")
+		assert.Equal(t, `""`, string(b), "expected an empty JSON string")
+	})
+
+	t.Run("is masked when the config is logged", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		logger := zerolog.New(buf)
+		logger.Info().Any("config", validConfig).Msg("config")
+		assert.NotContains(t, buf.String(), "test_username", "expected the username to be masked")
+		assert.NotContains(t, buf.String(), "test_password", "expected the password to be masked")
+		assert.Contains(t, buf.String(), `"Password":"********"`, "expected the password to be shown masked")
+	})
+
+	t.Run("is not masked when marshalled to YAML", func(t *testing.T) {
+		b, err := yaml.Marshal(validConfig)
+		assert.NoError(t, err, "expected no error marshalling the config")
+		assert.Contains(t, string(b), "password: test_password", "expected the password to be written")
+
+		c := Config{}
+		err = yaml.Unmarshal(b, &c)
+		assert.NoError(t, err, "expected no error unmarshalling the config")
+		assert.Equal(t, Secret("test_password"), c.Database.Password, "expected the password to be read")
+	})
+
+	t.Run("is decoded from a string by viper", func(t *testing.T) {
+		v := viper.New()
+		v.Set("database.password", "test_password")
+		c := Config{}
+		err := v.Unmarshal(&c)
+		assert.NoError(t, err, "expected no error decoding the config")
+		assert.Equal(t, Secret("test_password"), c.Database.Password, "expected the password to be decoded")
+	})
+}
+
+func TestRedacted(t *testing.T) {
+	t.Run("masks every secret and leaves the config untouched", func(t *testing.T) {
+		c := validConfig
+		redacted := c.Redacted()
+		assert.Equal(t, Secret(Redacted), redacted.Database.Username, "expected the username to be masked")
+		assert.Equal(t, Secret(Redacted), redacted.Database.Password, "expected the password to be masked")
+		assert.Equal(t, c.Database.Host, redacted.Database.Host, "expected other fields to be kept")
+		assert.Equal(t, Secret("test_password"), c.Database.Password, "expected the original to be untouched")
+	})
+
+	t.Run("masks secrets nested in pointers, slices and maps", func(t *testing.T) {
+		type nested struct {
+			Token Secret
+		}
+		type holder struct {
+			Ptr    *nested
+			Slice  []Secret
+			Map    map[string]Secret
+			Plain  string
+			hidden Secret
+		}
+		h := holder{
+			Ptr:    &nested{Token: "a"},
+			Slice:  []Secret{"b", ""},
+			Map:    map[string]Secret{"key": "c"},
+			Plain:  "d",
+			hidden: "e",
+		}
+		redact(reflect.ValueOf(&h).Elem())
+		assert.Equal(t, Secret(Redacted), h.Ptr.Token, "expected the pointer's secret to be masked")
+		assert.Equal(t, []Secret{Redacted, ""}, h.Slice, "expected the slice's secrets to be masked")
+		assert.Equal(t, Secret(Redacted), h.Map["key"], "expected the map's secret to be masked")
+		assert.Equal(t, "d", h.Plain, "expected plain strings to be kept")
+		assert.Equal(t, Secret("e"), h.hidden, "expected unexported fields to be skipped")
+	})
+
+	t.Run("does not modify shared pointers, slices or maps", func(t *testing.T) {
+		ptr := &struct{ Token Secret }{Token: "a"}
+		slice := []Secret{"b"}
+		m := map[string]Secret{"key": "c"}
+		h := struct {
+			Ptr   *struct{ Token Secret }
+			Slice []Secret
+			Map   map[string]Secret
+		}{ptr, slice, m}
+		redact(reflect.ValueOf(&h).Elem())
+		assert.Equal(t, Secret("a"), ptr.Token, "expected the original pointer to be untouched")
+		assert.Equal(t, Secret("b"), slice[0], "expected the original slice to be untouched")
+		assert.Equal(t, Secret("c"), m["key"], "expected the original map to be untouched")
+	})
+}
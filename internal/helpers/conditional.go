@@ -0,0 +1,79 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ugcompsoc/apid/internal/services/database"
+)
+
+// ETag returns the entity tag of a document, which changes every time the
+// document is updated. The ID is part of it as the same URL can return
+// different documents, e.g. /v2/users/me.
+func ETag(m database.Model) string {
+	meta := m.GetMeta()
+	return fmt.Sprintf(`"%s.%d"`, meta.ID, meta.Version)
+}
+
+// SetETag sets the ETag header of the response to the entity tag of the
+// document
+func SetETag(c *gin.Context, m database.Model) {
+	c.Header("ETag", ETag(m))
+}
+
+// CheckPreconditions evaluates the If-Match and If-None-Match headers of the
+// request against the document, following RFC 7232. It returns false if the
+// request shouldn't go ahead, having responded with 304 Not Modified to a GET
+// or HEAD for a document the client already has, or with 412 Precondition
+// Failed otherwise. Handlers that change the document should update the
+// version that was checked, so a change made in the meantime is caught too.
+func CheckPreconditions(c *gin.Context, m database.Model) bool {
+	etag := ETag(m)
+	if ifMatch := c.GetHeader("If-Match"); ifMatch != "" && !matchesETag(ifMatch, etag, false) {
+		RespondWithPreconditionFailed(c)
+		return false
+	}
+	if ifNoneMatch := c.GetHeader("If-None-Match"); ifNoneMatch != "" && matchesETag(ifNoneMatch, etag, true) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead:
+			c.Header("ETag", etag)
+			c.Status(http.StatusNotModified)
+			c.Writer.WriteHeaderNow()
+		default:
+			RespondWithPreconditionFailed(c)
+		}
+		return false
+	}
+	return true
+}
+
+// RespondWithPreconditionFailed responds that the document has changed since
+// the client read it, which is also what database.ErrVersionMismatch means
+func RespondWithPreconditionFailed(c *gin.Context) {
+	RespondWithError(c, errors.New("the resource has been changed since it was read, get it again and retry"), http.StatusPreconditionFailed)
+}
+
+// matchesETag reports whether the list of entity tags in an If-Match or
+// If-None-Match header has the one given. Weak tags only match with the weak
+// comparison If-None-Match uses.
+func matchesETag(header, etag string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				continue
+			}
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package helpers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/ugcompsoc/apid/internal/services/database"
+	"github.com/ugcompsoc/apid/internal/services/database/memory"
+)
+
+func TestCheckPreconditions(t *testing.T) {
+	doc := &database.Meta{ID: "doc", Version: 2}
+	runs := []struct {
+		name        string
+		method      string
+		ifMatch     string
+		ifNoneMatch string
+		proceed     bool
+		status      int
+	}{
+		{name: "no preconditions", method: http.MethodPut, proceed: true},
+		{name: "if match the current version", method: http.MethodPut, ifMatch: `"doc.2"`, proceed: true},
+		{name: "if match one of the versions", method: http.MethodDelete, ifMatch: `"doc.1", "doc.2"`, proceed: true},
+		{name: "if match any version", method: http.MethodPut, ifMatch: "*", proceed: true},
+		{name: "if match an old version", method: http.MethodPut, ifMatch: `"doc.1"`, status: http.StatusPreconditionFailed},
+		{name: "if match an old version on a delete", method: http.MethodDelete, ifMatch: `"doc.1"`, status: http.StatusPreconditionFailed},
+		{name: "if match a weak tag", method: http.MethodPut, ifMatch: `W/"doc.2"`, status: http.StatusPreconditionFailed},
+		{name: "if none match the current version", method: http.MethodGet, ifNoneMatch: `"doc.2"`, status: http.StatusNotModified},
+		{name: "if none match a weak tag", method: http.MethodHead, ifNoneMatch: `W/"doc.2"`, status: http.StatusNotModified},
+		{name: "if none match an old version", method: http.MethodGet, ifNoneMatch: `"doc.1"`, proceed: true},
+		{name: "if none match any version on a write", method: http.MethodPut, ifNoneMatch: "*", status: http.StatusPreconditionFailed},
+	}
+
+	for _, run := range runs {
+		run := run
+		t.Run(run.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(run.method, "/docs/doc", nil)
+			if run.ifMatch != "" {
+				c.Request.Header.Set("If-Match", run.ifMatch)
+			}
+			if run.ifNoneMatch != "" {
+				c.Request.Header.Set("If-None-Match", run.ifNoneMatch)
+			}
+			assert.Equal(t, run.proceed, CheckPreconditions(c, doc), "unexpected result")
+			if !run.proceed {
+				assert.Equal(t, run.status, w.Code, "unexpected status code")
+			}
+		})
+	}
+}
+
+func TestConditionalDelete(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	users := store.Users()
+	// changed is called between the preconditions being checked and the
+	// user being deleted, like a request changing it in the meantime
+	var changed func()
+	r := gin.New()
+	r.DELETE("/users/:id", func(c *gin.Context) {
+		user, err := users.Get(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			RespondWithError(c, err, http.StatusNotFound)
+			return
+		}
+		if !CheckPreconditions(c, user) {
+			return
+		}
+		if changed != nil {
+			changed()
+		}
+		err = users.Delete(c.Request.Context(), user.ID, user.Version)
+		if errors.Is(err, database.ErrVersionMismatch) {
+			RespondWithPreconditionFailed(c)
+			return
+		}
+		assert.NoError(t, err, "could not delete user")
+		c.Status(http.StatusNoContent)
+	})
+	serve := func(ifMatch string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodDelete, "/users/lucy", nil)
+		req.Header.Set("If-Match", ifMatch)
+		r.ServeHTTP(w, req)
+		return w
+	}
+	user := &database.User{Meta: database.Meta{ID: "lucy"}, Username: "lucy", Email: "lucy@compsoc.ie"}
+	assert.NoError(t, users.Create(ctx, user), "could not create user")
+	assert.NoError(t, users.Update(ctx, user), "could not update user")
+
+	t.Run("check a stale version isn't deleted", func(t *testing.T) {
+		w := serve(`"lucy.1"`)
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code, "expected status 412")
+		_, err := users.Get(ctx, "lucy")
+		assert.NoError(t, err, "expected the user to be kept")
+	})
+
+	t.Run("check a version changed after the check isn't deleted", func(t *testing.T) {
+		changed = func() {
+			assert.NoError(t, users.Update(ctx, user), "could not update user")
+		}
+		defer func() { changed = nil }()
+		w := serve(`"lucy.2"`)
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code, "expected status 412")
+		_, err := users.Get(ctx, "lucy")
+		assert.NoError(t, err, "expected the user to be kept")
+	})
+
+	t.Run("check the current version is deleted", func(t *testing.T) {
+		w := serve(`"lucy.3"`)
+		assert.Equal(t, http.StatusNoContent, w.Code, "expected status 204")
+		_, err := users.Get(ctx, "lucy")
+		assert.ErrorIs(t, err, database.ErrNotFound, "expected the user to be deleted")
+	})
+}
@@ -0,0 +1,169 @@
+package helpers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// The media types PATCH requests can have, RFC 7396 and RFC 6902
+const (
+	MergePatchContentType = "application/merge-patch+json"
+	JSONPatchContentType  = "application/json-patch+json"
+)
+
+// maxPatchCopySize caps how much a JSON patch can grow a resource by with copy
+// operations, so a small patch can't make a huge resource
+const maxPatchCopySize = 1 << 20
+
+// PatchError is why a patch couldn't be applied to a resource. Fields lists
+// the fields the patch changed that it isn't allowed to.
+type PatchError struct {
+	Status int
+	Detail string
+	Fields []ProblemField
+}
+
+func (e *PatchError) Error() string {
+	return e.Detail
+}
+
+// BindPatch applies the patch in the body of the request to the resource, as
+// clients see it, and binds the patched resource to editable. Editable is a
+// pointer to a struct of the fields that can be changed, which is validated
+// like a body bound by gin. A patch that changes any other field, such as the
+// ID or the roles of a user, is rejected with a PatchError, as is a patch with
+// a media type other than merge-patch or json-patch.
+func BindPatch(c *gin.Context, resource interface{}, editable interface{}) error {
+	original, err := json.Marshal(resource)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the resource: %w", err)
+	}
+	body, err := c.GetRawData()
+	if limit, ok := BodyTooLarge(err); ok {
+		return &PatchError{Status: http.StatusRequestEntityTooLarge, Detail: fmt.Sprintf("the body must be at most %d bytes", limit)}
+	}
+	if err != nil {
+		return &PatchError{Status: http.StatusBadRequest, Detail: "the body could not be read"}
+	}
+
+	var patched []byte
+	switch c.ContentType() {
+	case MergePatchContentType:
+		patched, err = jsonpatch.MergePatch(original, body)
+	case JSONPatchContentType:
+		var patch jsonpatch.Patch
+		patch, err = jsonpatch.DecodePatch(body)
+		if err == nil {
+			options := jsonpatch.NewApplyOptions()
+			options.AccumulatedCopySizeLimit = maxPatchCopySize
+			patched, err = patch.ApplyWithOptions(original, options)
+		}
+	default:
+		c.Header("Accept-Patch", MergePatchContentType+", "+JSONPatchContentType)
+		return &PatchError{
+			Status: http.StatusUnsupportedMediaType,
+			Detail: fmt.Sprintf("the patch must be %s or %s", MergePatchContentType, JSONPatchContentType),
+		}
+	}
+	if errors.Is(err, jsonpatch.ErrTestFailed) {
+		return &PatchError{Status: http.StatusConflict, Detail: "a test operation of the patch failed"}
+	}
+	if err != nil {
+		return &PatchError{Status: http.StatusBadRequest, Detail: "the patch could not be applied: " + err.Error()}
+	}
+
+	var before, after map[string]interface{}
+	if err := json.Unmarshal(original, &before); err != nil {
+		return fmt.Errorf("failed to unmarshal the resource: %w", err)
+	}
+	if err := json.Unmarshal(patched, &after); err != nil {
+		return &PatchError{Status: http.StatusBadRequest, Detail: "the patched resource must be an object"}
+	}
+
+	// only the editable fields are bound, every other field must be left as
+	// it was
+	fields := editableFields(editable)
+	changed := map[string]interface{}{}
+	var readOnly []ProblemField
+	for _, name := range patchedNames(before, after) {
+		value, ok := after[name]
+		if fields[name] {
+			if ok {
+				changed[name] = value
+			}
+			continue
+		}
+		if !reflect.DeepEqual(before[name], value) {
+			readOnly = append(readOnly, ProblemField{Field: name, Reason: "readonly", Message: name + " can't be changed"})
+		}
+	}
+	if len(readOnly) != 0 {
+		return &PatchError{Status: http.StatusBadRequest, Detail: "the patch changes fields that can't be changed", Fields: readOnly}
+	}
+
+	raw, err := json.Marshal(changed)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the patched resource: %w", err)
+	}
+	// a field the patch removed is left empty
+	value := reflect.ValueOf(editable).Elem()
+	value.Set(reflect.Zero(value.Type()))
+	if err := json.Unmarshal(raw, editable); err != nil {
+		return err
+	}
+	return binding.Validator.ValidateStruct(editable)
+}
+
+// RespondWithPatchError responds with a problem describing why a patch could
+// not be bound
+func RespondWithPatchError(c *gin.Context, err error) {
+	var patchErr *PatchError
+	if !errors.As(err, &patchErr) {
+		RespondWithBindingError(c, err)
+		return
+	}
+	if len(patchErr.Fields) != 0 {
+		p := NewValidationProblem(patchErr.Fields...)
+		p.Detail = patchErr.Detail
+		RespondWithProblem(c, p)
+		return
+	}
+	RespondWithError(c, patchErr, patchErr.Status)
+}
+
+// editableFields returns the JSON names of the fields of the struct pointed
+// to
+func editableFields(editable interface{}) map[string]bool {
+	fields := map[string]bool{}
+	t := reflect.TypeOf(editable).Elem()
+	for i := 0; i < t.NumField(); i++ {
+		if name := jsonFieldName(t.Field(i)); name != "" {
+			fields[name] = true
+		}
+	}
+	return fields
+}
+
+// patchedNames returns the sorted names of the fields of the resource before
+// and after it was patched
+func patchedNames(before, after map[string]interface{}) []string {
+	names := []string{}
+	for name := range before {
+		names = append(names, name)
+	}
+	for name := range after {
+		if _, ok := before[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,164 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+type patchTestResource struct {
+	ID    string   `json:"id"`
+	Name  string   `json:"name"`
+	Size  int      `json:"size"`
+	Roles []string `json:"roles"`
+}
+
+type patchTestEditable struct {
+	Name string `json:"name" binding:"required,max=10"`
+	Size int    `json:"size" binding:"min=1"`
+}
+
+func TestBindPatch(t *testing.T) {
+	resource := patchTestResource{ID: "thing", Name: "thing", Size: 1, Roles: []string{"member"}}
+	bind := func(contentType, patch string) (patchTestEditable, *httptest.ResponseRecorder, error) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPatch, "/things/thing", bytes.NewBufferString(patch))
+		c.Request.Header.Set("Content-Type", contentType)
+		var editable patchTestEditable
+		err := BindPatch(c, resource, &editable)
+		return editable, w, err
+	}
+
+	runs := []struct {
+		name        string
+		contentType string
+		patch       string
+		editable    patchTestEditable
+	}{
+		{
+			name:        "merge patch",
+			contentType: MergePatchContentType,
+			patch:       `{"name":"renamed"}`,
+			editable:    patchTestEditable{Name: "renamed", Size: 1},
+		},
+		{
+			name:        "merge patch with a charset",
+			contentType: MergePatchContentType + "; charset=utf-8",
+			patch:       `{"size":3}`,
+			editable:    patchTestEditable{Name: "thing", Size: 3},
+		},
+		{
+			name:        "merge patch that sets read only fields to what they are",
+			contentType: MergePatchContentType,
+			patch:       `{"id":"thing","roles":["member"],"name":"renamed"}`,
+			editable:    patchTestEditable{Name: "renamed", Size: 1},
+		},
+		{
+			name:        "json patch",
+			contentType: JSONPatchContentType,
+			patch:       `[{"op":"test","path":"/id","value":"thing"},{"op":"replace","path":"/name","value":"renamed"},{"op":"copy","from":"/size","path":"/size"}]`,
+			editable:    patchTestEditable{Name: "renamed", Size: 1},
+		},
+	}
+
+	for _, run := range runs {
+		run := run
+		t.Run(run.name, func(t *testing.T) {
+			editable, _, err := bind(run.contentType, run.patch)
+			assert.NoError(t, err, "expected the patch to be bound")
+			assert.Equal(t, run.editable, editable, "unexpected patched fields")
+		})
+	}
+
+	errorRuns := []struct {
+		name        string
+		contentType string
+		patch       string
+		status      int
+		fields      []string
+	}{
+		{name: "another media type", contentType: "application/json", patch: `{"name":"renamed"}`, status: http.StatusUnsupportedMediaType},
+		{name: "a merge patch of read only fields", contentType: MergePatchContentType, patch: `{"id":"other","roles":null,"extra":1}`, status: http.StatusBadRequest, fields: []string{"extra", "id", "roles"}},
+		{name: "a json patch of a read only field", contentType: JSONPatchContentType, patch: `[{"op":"add","path":"/roles/-","value":"admin"}]`, status: http.StatusBadRequest, fields: []string{"roles"}},
+		{name: "a json patch with a failed test", contentType: JSONPatchContentType, patch: `[{"op":"test","path":"/name","value":"other"}]`, status: http.StatusConflict},
+		{name: "a json patch of a missing path", contentType: JSONPatchContentType, patch: `[{"op":"remove","path":"/missing"}]`, status: http.StatusBadRequest},
+		{name: "a json patch that isn't a list", contentType: JSONPatchContentType, patch: `{"op":"remove"}`, status: http.StatusBadRequest},
+		{name: "a merge patch that isn't JSON", contentType: MergePatchContentType, patch: `{`, status: http.StatusBadRequest},
+		{name: "a merge patch that replaces the resource", contentType: MergePatchContentType, patch: `"thing"`, status: http.StatusBadRequest},
+	}
+
+	for _, run := range errorRuns {
+		run := run
+		t.Run("rejects "+run.name, func(t *testing.T) {
+			_, _, err := bind(run.contentType, run.patch)
+			var patchErr *PatchError
+			if assert.ErrorAs(t, err, &patchErr, "expected the patch to be rejected") {
+				assert.Equal(t, run.status, patchErr.Status, "unexpected status")
+				fields := []string{}
+				for _, field := range patchErr.Fields {
+					fields = append(fields, field.Field)
+				}
+				if run.fields == nil {
+					run.fields = []string{}
+				}
+				assert.Equal(t, run.fields, fields, "unexpected read only fields")
+			}
+		})
+	}
+
+	t.Run("rejects a body over the limit", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPatch, "/things/thing", bytes.NewBufferString(`{"name":"renamed"}`))
+		c.Request.Header.Set("Content-Type", MergePatchContentType)
+		c.Request.Body = http.MaxBytesReader(w, c.Request.Body, 8)
+		var editable patchTestEditable
+		var patchErr *PatchError
+		if assert.ErrorAs(t, BindPatch(c, resource, &editable), &patchErr, "expected the patch to be rejected") {
+			assert.Equal(t, http.StatusRequestEntityTooLarge, patchErr.Status, "unexpected status")
+		}
+	})
+
+	t.Run("patched fields are validated", func(t *testing.T) {
+		_, _, err := bind(MergePatchContentType, `{"name":null,"size":0}`)
+		var validationErrs validator.ValidationErrors
+		if assert.ErrorAs(t, err, &validationErrs, "expected the patched fields to be invalid") {
+			assert.Len(t, validationErrs, 2, "expected both fields to be invalid")
+		}
+		_, _, err = bind(MergePatchContentType, `{"size":"big"}`)
+		var typeErr *json.UnmarshalTypeError
+		assert.ErrorAs(t, err, &typeErr, "expected the size to have the wrong type")
+	})
+
+	t.Run("responds with problems", func(t *testing.T) {
+		_, w, err := bind("application/json", `{}`)
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPatch, "/things/thing", nil)
+		RespondWithPatchError(c, err)
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code, "unexpected status code")
+		assert.Equal(t, MergePatchContentType+", "+JSONPatchContentType, w.Header().Get("Accept-Patch"), "expected the accepted media types")
+
+		w = httptest.NewRecorder()
+		c, _ = gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPatch, "/things/thing", nil)
+		RespondWithPatchError(c, &PatchError{Status: http.StatusBadRequest, Detail: "read only", Fields: []ProblemField{{Field: "id", Reason: "readonly"}}})
+		var problem Problem
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem), "could not unmarshal problem")
+		assert.Equal(t, ProblemTypeValidation, problem.Type, "expected a validation problem")
+		assert.Len(t, problem.Errors, 1, "expected the read only field")
+
+		w = httptest.NewRecorder()
+		c, _ = gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPatch, "/things/thing", nil)
+		RespondWithPatchError(c, errors.New("bad"))
+		assert.Equal(t, http.StatusBadRequest, w.Code, "expected other errors to be binding errors")
+	})
+}
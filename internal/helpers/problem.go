@@ -0,0 +1,209 @@
+package helpers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/ugcompsoc/apid/internal/logging"
+)
+
+// ProblemContentType is the media type of problem details, RFC 7807
+const ProblemContentType = "application/problem+json"
+
+// ProblemTypeBase prefixes the type of every problem. Types identify the kind
+// of problem so clients can tell them apart, they aren't meant to be fetched.
+const ProblemTypeBase = "https://compsoc.ie/apid/problems/"
+
+const (
+	ProblemTypeValidation         = ProblemTypeBase + "validation"
+	ProblemTypeBadRequest         = ProblemTypeBase + "bad-request"
+	ProblemTypeUnauthorized       = ProblemTypeBase + "unauthorized"
+	ProblemTypeForbidden          = ProblemTypeBase + "forbidden"
+	ProblemTypeNotFound           = ProblemTypeBase + "not-found"
+	ProblemTypeConflict           = ProblemTypeBase + "conflict"
+	ProblemTypePreconditionFailed = ProblemTypeBase + "precondition-failed"
+	ProblemTypeTooLarge           = ProblemTypeBase + "too-large"
+	ProblemTypeRateLimited        = ProblemTypeBase + "rate-limited"
+	ProblemTypeInternal           = ProblemTypeBase + "internal"
+	ProblemTypeUnavailable        = ProblemTypeBase + "unavailable"
+	// ProblemTypeBlank is used for statuses without a type of their own, the
+	// status says all there is to say about them
+	ProblemTypeBlank = "about:blank"
+)
+
+var problemTypes = map[int]string{
+	http.StatusBadRequest:            ProblemTypeBadRequest,
+	http.StatusUnauthorized:          ProblemTypeUnauthorized,
+	http.StatusForbidden:             ProblemTypeForbidden,
+	http.StatusNotFound:              ProblemTypeNotFound,
+	http.StatusConflict:              ProblemTypeConflict,
+	http.StatusPreconditionFailed:    ProblemTypePreconditionFailed,
+	http.StatusRequestEntityTooLarge: ProblemTypeTooLarge,
+	http.StatusTooManyRequests:       ProblemTypeRateLimited,
+	http.StatusInternalServerError:   ProblemTypeInternal,
+	http.StatusServiceUnavailable:    ProblemTypeUnavailable,
+}
+
+// Problem describes why a request failed, following RFC 7807
+type Problem struct {
+	Type   string `json:"type" example:"https://compsoc.ie/apid/problems/validation"`
+	Title  string `json:"title" example:"Validation Failed"`
+	Status int    `json:"status" example:"400"`
+	Detail string `json:"detail,omitempty" example:"the request has invalid fields"`
+	// Instance is the path of the request that failed
+	Instance string `json:"instance,omitempty" example:"/v2/users/me"`
+	// ContextID is the context ID of the request, which its logs carry too
+	ContextID string         `json:"context_id,omitempty" example:"0b4c2f3e-5d6a-4b7c-8d9e-0f1a2b3c4d5e"`
+	Errors    []ProblemField `json:"errors,omitempty"`
+	// RetryAfter is how many seconds until a rate limited request can be
+	// retried
+	RetryAfter int `json:"retry_after,omitempty" example:"30"`
+}
+
+// ProblemField describes why a single field of a request is invalid
+type ProblemField struct {
+	// Field is the path of the field, named as it is in the request
+	Field string `json:"field" example:"level"`
+	// Reason is the check the field failed, e.g. required or email
+	Reason  string `json:"reason" example:"required"`
+	Message string `json:"message" example:"level is required"`
+}
+
+func init() {
+	// name fields in validation errors as clients know them, by their JSON
+	// names rather than the names of the struct fields
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(jsonFieldName)
+	}
+}
+
+func jsonFieldName(field reflect.StructField) string {
+	name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// NewProblem returns a problem with the status given, and the type and title
+// that go with it
+func NewProblem(status int, detail string) *Problem {
+	problemType, ok := problemTypes[status]
+	if !ok {
+		problemType = ProblemTypeBlank
+	}
+	return &Problem{
+		Type:   problemType,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// RespondWithProblem responds with the problem, adding the path and context ID
+// of the request to it
+func RespondWithProblem(c *gin.Context, p *Problem) {
+	if c.Request != nil {
+		if p.Instance == "" {
+			p.Instance = c.Request.URL.Path
+		}
+		if p.ContextID == "" {
+			p.ContextID = logging.ContextID(c.Request.Context())
+		}
+	}
+	c.Header("Content-Type", ProblemContentType)
+	c.JSON(p.Status, p)
+}
+
+// NewValidationProblem returns a problem listing the fields of a request that
+// are invalid
+func NewValidationProblem(fields ...ProblemField) *Problem {
+	return &Problem{
+		Type:   ProblemTypeValidation,
+		Title:  "Validation Failed",
+		Status: http.StatusBadRequest,
+		Detail: "the request has invalid fields",
+		Errors: fields,
+	}
+}
+
+// BindingProblem returns a validation problem describing why a request could
+// not be bound by gin, listing every invalid field
+func BindingProblem(err error) *Problem {
+	p := NewValidationProblem()
+	var validationErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	var queryErr *InvalidQueryError
+	switch {
+	case errors.As(err, &queryErr):
+		p.Errors = queryErr.Fields
+	case errors.As(err, &validationErrs):
+		for _, fieldErr := range validationErrs {
+			p.Errors = append(p.Errors, problemField(fieldErr))
+		}
+	case errors.As(err, &typeErr):
+		p.Errors = []ProblemField{{
+			Field:   typeErr.Field,
+			Reason:  "type",
+			Message: fmt.Sprintf("%s must be of type %s", typeErr.Field, typeErr.Type),
+		}}
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		p.Detail = "the body is not valid JSON"
+	case errors.Is(err, io.EOF):
+		p.Detail = "a body is required"
+	default:
+		p.Detail = err.Error()
+	}
+	return p
+}
+
+// problemField describes a field that failed validation
+func problemField(fieldErr validator.FieldError) ProblemField {
+	// the namespace starts with the name of the struct being bound, which
+	// means nothing to clients
+	field := fieldErr.Namespace()
+	if i := strings.Index(field, "."); i != -1 {
+		field = field[i+1:]
+	}
+
+	var reason string
+	switch fieldErr.Tag() {
+	case "required":
+		reason = "is required"
+	case "email":
+		reason = "must be an email address"
+	case "alphanum":
+		reason = "must only have letters and numbers"
+	case "url":
+		reason = "must be a URL"
+	case "uuid", "uuid4":
+		reason = "must be a UUID"
+	case "min", "gte":
+		reason = "must be at least " + fieldErr.Param()
+	case "max", "lte":
+		reason = "must be at most " + fieldErr.Param()
+	case "len":
+		reason = "must have a length of " + fieldErr.Param()
+	case "oneof":
+		reason = "must be one of " + strings.Join(strings.Fields(fieldErr.Param()), ", ")
+	default:
+		reason = "failed the " + fieldErr.Tag() + " check"
+	}
+	return ProblemField{
+		Field:   field,
+		Reason:  fieldErr.Tag(),
+		Message: field + " " + reason,
+	}
+}
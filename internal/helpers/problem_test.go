@@ -0,0 +1,164 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/ugcompsoc/apid/internal/logging"
+)
+
+func TestNewProblem(t *testing.T) {
+	runs := []struct {
+		name   string
+		status int
+		typ    string
+		title  string
+	}{
+		{
+			name:   "status with a type",
+			status: http.StatusConflict,
+			typ:    ProblemTypeConflict,
+			title:  "Conflict",
+		},
+		{
+			name:   "status without a type",
+			status: http.StatusTeapot,
+			typ:    ProblemTypeBlank,
+			title:  "I'm a teapot",
+		},
+	}
+
+	for _, run := range runs {
+		run := run
+		t.Run(run.name, func(t *testing.T) {
+			p := NewProblem(run.status, "detail")
+			assert.Equal(t, run.typ, p.Type, "unexpected type")
+			assert.Equal(t, run.title, p.Title, "unexpected title")
+			assert.Equal(t, run.status, p.Status, "unexpected status")
+			assert.Equal(t, "detail", p.Detail, "unexpected detail")
+		})
+	}
+}
+
+func TestRespondWithProblem(t *testing.T) {
+	t.Run("adds the path and context ID of the request", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		_, engine := gin.CreateTestContext(w)
+		engine.GET("/things", func(c *gin.Context) {
+			RespondWithProblem(c, NewProblem(http.StatusNotFound, "no such thing"))
+		})
+		req := httptest.NewRequest(http.MethodGet, "/things?page=2", nil)
+		req = req.WithContext(logging.WithContextID(req.Context(), "context-id"))
+		engine.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code, "unexpected status code")
+		assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"), "expected a problem")
+		assert.JSONEq(t, `{
+			"type": "https://compsoc.ie/apid/problems/not-found",
+			"title": "Not Found",
+			"status": 404,
+			"detail": "no such thing",
+			"instance": "/things",
+			"context_id": "context-id"
+		}`, w.Body.String(), "unexpected problem")
+	})
+}
+
+type bindingTestBody struct {
+	Name    string `json:"name" binding:"required"`
+	Email   string `json:"email" binding:"omitempty,email"`
+	Age     int    `json:"age" binding:"omitempty,min=18"`
+	Role    string `json:"role" binding:"omitempty,oneof=member admin"`
+	Address struct {
+		City string `json:"city" binding:"required"`
+	} `json:"address"`
+}
+
+func TestBindingProblem(t *testing.T) {
+	runs := []struct {
+		name   string
+		body   string
+		detail string
+		errors []ProblemField
+	}{
+		{
+			name:   "fields failing validation are listed by their JSON names",
+			body:   `{"email":"nope","age":12,"role":"owner"}`,
+			detail: "the request has invalid fields",
+			errors: []ProblemField{
+				{Field: "name", Reason: "required", Message: "name is required"},
+				{Field: "email", Reason: "email", Message: "email must be an email address"},
+				{Field: "age", Reason: "min", Message: "age must be at least 18"},
+				{Field: "role", Reason: "oneof", Message: "role must be one of member, admin"},
+				{Field: "address.city", Reason: "required", Message: "address.city is required"},
+			},
+		},
+		{
+			name:   "fields of the wrong type are listed",
+			body:   `{"name":"jo","age":"old"}`,
+			detail: "the request has invalid fields",
+			errors: []ProblemField{
+				{Field: "age", Reason: "type", Message: "age must be of type int"},
+			},
+		},
+		{
+			name:   "malformed body",
+			body:   `{"name":`,
+			detail: "the body is not valid JSON",
+		},
+		{
+			name:   "invalid body",
+			body:   `name=jo`,
+			detail: "the body is not valid JSON",
+		},
+		{
+			name:   "missing body",
+			body:   ``,
+			detail: "a body is required",
+		},
+	}
+
+	for _, run := range runs {
+		run := run
+		t.Run(run.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(run.body))
+			var body bindingTestBody
+			err := c.ShouldBindJSON(&body)
+			assert.Error(t, err, "expected the body to be rejected")
+
+			p := BindingProblem(err)
+			assert.Equal(t, ProblemTypeValidation, p.Type, "unexpected type")
+			assert.Equal(t, http.StatusBadRequest, p.Status, "unexpected status")
+			assert.Equal(t, run.detail, p.Detail, "unexpected detail")
+			assert.Equal(t, run.errors, p.Errors, "unexpected invalid fields")
+		})
+	}
+
+	t.Run("other errors are given as the detail", func(t *testing.T) {
+		p := BindingProblem(errors.New("the body is too large"))
+		assert.Equal(t, "the body is too large", p.Detail, "unexpected detail")
+		assert.Empty(t, p.Errors, "expected no invalid fields")
+	})
+}
+
+func TestRespondWithBindingError(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{}`))
+	var body bindingTestBody
+	RespondWithBindingError(c, c.ShouldBindJSON(&body))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code, "unexpected status code")
+	assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"), "expected a problem")
+	var p Problem
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &p), "expected a problem body")
+	assert.Len(t, p.Errors, 2, "expected the name and city to be invalid")
+}
@@ -0,0 +1,370 @@
+package helpers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ugcompsoc/apid/internal/services/database"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// The query parameters of list endpoints. Filters are given as
+// filter[field]=value, or filter[field][op]=value for operators other than eq.
+const (
+	LimitParam  = "limit"
+	SortParam   = "sort"
+	CursorParam = "cursor"
+	FilterParam = "filter"
+)
+
+// The types of the fields clients can filter on, which decide how values are
+// parsed and the operators that can be used
+const (
+	FieldString = "string"
+	FieldInt    = "int"
+	FieldBool   = "bool"
+	FieldTime   = "time"
+)
+
+var fieldOps = map[string][]string{
+	FieldString: {database.FilterEq, database.FilterNe, database.FilterIn, database.FilterPrefix},
+	FieldInt:    {database.FilterEq, database.FilterNe, database.FilterIn, database.FilterLt, database.FilterLte, database.FilterGt, database.FilterGte},
+	FieldBool:   {database.FilterEq, database.FilterNe},
+	FieldTime:   {database.FilterEq, database.FilterNe, database.FilterLt, database.FilterLte, database.FilterGt, database.FilterGte},
+}
+
+// QueryField is a field of the documents of a list that clients can filter or
+// sort on
+type QueryField struct {
+	// Field is the name of the field in the stored documents
+	Field string
+	Type  string
+	// Filter and Sort say what clients can do with the field
+	Filter bool
+	Sort   bool
+}
+
+// ListQuery describes the query parameters a list endpoint accepts. Fields
+// are named as clients know them, so only the fields in it can be filtered or
+// sorted on.
+type ListQuery struct {
+	Fields map[string]QueryField
+	// DefaultSort is used when the client gives none, e.g. "-created_at"
+	DefaultSort  string
+	DefaultLimit int
+	MaxLimit     int
+}
+
+// InvalidQueryError lists the query parameters of a request that are invalid,
+// it is turned into a validation problem by RespondWithBindingError
+type InvalidQueryError struct {
+	Fields []ProblemField
+}
+
+func (e *InvalidQueryError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Message
+	}
+	return "invalid query parameters: " + strings.Join(messages, ", ")
+}
+
+// ListParams are the query parameters every list endpoint takes, so they can
+// be documented with `@Param query query helpers.ListParams false "List"`.
+// Filters depend on the endpoint and are described by it.
+type ListParams struct {
+	Limit int `form:"limit" example:"20" minimum:"1"`
+	// Sort is a list of fields, descending when they start with a '-'
+	Sort string `form:"sort" example:"-created_at,username"`
+	// Cursor is the next_cursor of the previous page
+	Cursor string `form:"cursor"`
+}
+
+// Paginated is a page of a list, the next page is got by passing its
+// next_cursor as the cursor. The Link header of the response has the URL of
+// the next page too.
+type Paginated[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty" example:"eyJzIjoiLWNyZWF0ZWRfYXQifQ"`
+}
+
+// cursor is what a cursor given to clients holds, the order it was made for
+// so it can't be used with another
+type cursor struct {
+	Order  string          `bson:"o"`
+	Values []bson.RawValue `bson:"v"`
+}
+
+// Parse returns the database query described by the query parameters of the
+// request, or an InvalidQueryError listing the parameters that are invalid
+func (l ListQuery) Parse(c *gin.Context) (database.Query, error) {
+	params := c.Request.URL.Query()
+	var q database.Query
+	var invalid []ProblemField
+
+	q.Limit = l.DefaultLimit
+	if limit := params.Get(LimitParam); limit != "" {
+		n, err := strconv.Atoi(limit)
+		switch {
+		case err != nil:
+			invalid = append(invalid, ProblemField{Field: LimitParam, Reason: "type", Message: "limit must be a number"})
+		case n < 1:
+			invalid = append(invalid, ProblemField{Field: LimitParam, Reason: "min", Message: "limit must be at least 1"})
+		case l.MaxLimit > 0 && n > l.MaxLimit:
+			invalid = append(invalid, ProblemField{Field: LimitParam, Reason: "max", Message: fmt.Sprintf("limit must be at most %d", l.MaxLimit)})
+		default:
+			q.Limit = n
+		}
+	}
+
+	sortBy := params.Get(SortParam)
+	if sortBy == "" {
+		sortBy = l.DefaultSort
+	}
+	for _, name := range strings.Split(sortBy, ",") {
+		if name == "" {
+			continue
+		}
+		descending := strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(name, "-")
+		field, ok := l.Fields[name]
+		if !ok || !field.Sort {
+			invalid = append(invalid, ProblemField{
+				Field:   SortParam,
+				Reason:  "oneof",
+				Message: "sort must be a list of " + strings.Join(l.names(func(f QueryField) bool { return f.Sort }), ", "),
+			})
+			break
+		}
+		q.Sort = append(q.Sort, database.SortField{Field: field.Field, Descending: descending})
+	}
+
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if key != FilterParam && !strings.HasPrefix(key, FilterParam+"[") {
+			continue
+		}
+		filter, problem := l.parseFilter(key, params.Get(key))
+		if problem != nil {
+			invalid = append(invalid, *problem)
+			continue
+		}
+		q.Filters = append(q.Filters, filter)
+	}
+
+	if encoded := params.Get(CursorParam); encoded != "" {
+		after, ok := decodeCursor(encoded, q)
+		if !ok {
+			invalid = append(invalid, ProblemField{Field: CursorParam, Reason: "cursor", Message: "cursor must be the next_cursor of a page with the same sort"})
+		}
+		q.After = after
+	}
+
+	if len(invalid) != 0 {
+		return database.Query{}, &InvalidQueryError{Fields: invalid}
+	}
+	return q, nil
+}
+
+// parseFilter parses a filter given as filter[field] or filter[field][op]
+func (l ListQuery) parseFilter(key, value string) (database.Filter, *ProblemField) {
+	name, op, ok := parseFilterKey(key)
+	if !ok {
+		return database.Filter{}, &ProblemField{
+			Field:   key,
+			Reason:  "filter",
+			Message: key + " must be in the form filter[field] or filter[field][op]",
+		}
+	}
+	field, ok := l.Fields[name]
+	if !ok || !field.Filter {
+		return database.Filter{}, &ProblemField{
+			Field:   key,
+			Reason:  "oneof",
+			Message: "only " + strings.Join(l.names(func(f QueryField) bool { return f.Filter }), ", ") + " can be filtered on",
+		}
+	}
+	ops := fieldOps[field.Type]
+	if !contains(ops, op) {
+		return database.Filter{}, &ProblemField{
+			Field:   key,
+			Reason:  "oneof",
+			Message: fmt.Sprintf("%s can only be filtered with %s", name, strings.Join(ops, ", ")),
+		}
+	}
+
+	filter := database.Filter{Field: field.Field, Op: op}
+	if op == database.FilterIn {
+		values := bson.A{}
+		for _, v := range strings.Split(value, ",") {
+			parsed, err := parseFieldValue(field.Type, v)
+			if err != nil {
+				return database.Filter{}, &ProblemField{Field: key, Reason: "type", Message: fmt.Sprintf("%s must be a comma separated list, each %s", key, err)}
+			}
+			values = append(values, parsed)
+		}
+		filter.Value = values
+		return filter, nil
+	}
+	parsed, err := parseFieldValue(field.Type, value)
+	if err != nil {
+		return database.Filter{}, &ProblemField{Field: key, Reason: "type", Message: fmt.Sprintf("%s must be %s", key, err)}
+	}
+	filter.Value = parsed
+	return filter, nil
+}
+
+// parseFilterKey returns the field and operator of a filter[field][op] key,
+// the operator being eq if it isn't given
+func parseFilterKey(key string) (string, string, bool) {
+	rest := strings.TrimPrefix(key, FilterParam)
+	parts := []string{}
+	for rest != "" {
+		end := strings.Index(rest, "]")
+		if !strings.HasPrefix(rest, "[") || end < 2 {
+			return "", "", false
+		}
+		parts = append(parts, rest[1:end])
+		rest = rest[end+1:]
+	}
+	switch len(parts) {
+	case 1:
+		return parts[0], database.FilterEq, true
+	case 2:
+		return parts[0], parts[1], true
+	}
+	return "", "", false
+}
+
+// parseFieldValue parses the value of a filter, the error describes what the
+// value should have been
+func parseFieldValue(fieldType, value string) (interface{}, error) {
+	switch fieldType {
+	case FieldInt:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, errors.New("a whole number")
+		}
+		return n, nil
+	case FieldBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, errors.New("true or false")
+		}
+		return b, nil
+	case FieldTime:
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, errors.New("an RFC 3339 time, e.g. 2023-07-01T12:00:00Z")
+		}
+		return t, nil
+	}
+	return value, nil
+}
+
+// names returns the sorted names of the fields that the function is true for
+func (l ListQuery) names(allowed func(QueryField) bool) []string {
+	names := []string{}
+	for name, field := range l.Fields {
+		if allowed(field) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// orderKey describes the order of a query, so a cursor can be tied to it
+func orderKey(q database.Query) string {
+	fields := []string{}
+	for _, field := range q.Order() {
+		if field.Descending {
+			fields = append(fields, "-"+field.Field)
+		} else {
+			fields = append(fields, field.Field)
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+// EncodeCursor returns the cursor clients are given for the page after the
+// one the values are from
+func EncodeCursor(q database.Query, values []bson.RawValue) (string, error) {
+	raw, err := bson.Marshal(cursor{Order: orderKey(q), Values: values})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func decodeCursor(encoded string, q database.Query) ([]bson.RawValue, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, false
+	}
+	var c cursor
+	if err := bson.Unmarshal(raw, &c); err != nil {
+		return nil, false
+	}
+	if c.Order != orderKey(q) || len(c.Values) != len(q.Order()) {
+		return nil, false
+	}
+	return c.Values, true
+}
+
+// RespondWithPage responds with the page in a Paginated envelope, linking to
+// the first page and to the next page if there is one
+func RespondWithPage[T any](c *gin.Context, q database.Query, page *database.Page[T]) {
+	body := Paginated[T]{Items: page.Items}
+	if body.Items == nil {
+		body.Items = []T{}
+	}
+
+	links := []string{pageLink(c.Request, "", "first")}
+	if page.Next != nil {
+		next, err := EncodeCursor(q, page.Next)
+		if err != nil {
+			RespondWithError(c, errors.New("failed to encode the cursor of the next page"), http.StatusInternalServerError)
+			return
+		}
+		body.NextCursor = next
+		links = append(links, pageLink(c.Request, next, "next"))
+	}
+	c.Header("Link", strings.Join(links, ", "))
+	c.JSON(http.StatusOK, body)
+}
+
+// pageLink returns a link to the page of the request with the cursor given,
+// which is relative to the request so it is right behind a proxy too
+func pageLink(r *http.Request, cursor, rel string) string {
+	params := r.URL.Query()
+	params.Del(CursorParam)
+	if cursor != "" {
+		params.Set(CursorParam, cursor)
+	}
+	link := r.URL.Path
+	if query := params.Encode(); query != "" {
+		link += "?" + query
+	}
+	return fmt.Sprintf("<%s>; rel=%q", link, rel)
+}
@@ -0,0 +1,203 @@
+package helpers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/ugcompsoc/apid/internal/services/database"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var testListQuery = ListQuery{
+	Fields: map[string]QueryField{
+		"name":       {Field: "name", Type: FieldString, Filter: true, Sort: true},
+		"age":        {Field: "details.age", Type: FieldInt, Filter: true},
+		"active":     {Field: "active", Type: FieldBool, Filter: true},
+		"created_at": {Field: "created_at", Type: FieldTime, Filter: true, Sort: true},
+		"secret":     {Field: "secret", Type: FieldString},
+	},
+	DefaultSort:  "name",
+	DefaultLimit: 20,
+	MaxLimit:     100,
+}
+
+func parseTestQuery(t *testing.T, rawQuery string) (database.Query, error) {
+	t.Helper()
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/things?"+rawQuery, nil)
+	return testListQuery.Parse(c)
+}
+
+func TestListQueryParse(t *testing.T) {
+	created := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+	runs := []struct {
+		name     string
+		rawQuery string
+		query    database.Query
+	}{
+		{
+			name:  "defaults",
+			query: database.Query{Sort: []database.SortField{{Field: "name"}}, Limit: 20},
+		},
+		{
+			name:     "limit and sort",
+			rawQuery: "limit=5&sort=-created_at,name",
+			query: database.Query{
+				Sort:  []database.SortField{{Field: "created_at", Descending: true}, {Field: "name"}},
+				Limit: 5,
+			},
+		},
+		{
+			name:     "filters of every type",
+			rawQuery: "filter[name]=bob&filter[age][gte]=18&filter[active][ne]=false&filter[created_at][lt]=2023-07-01T12:00:00Z",
+			query: database.Query{
+				Filters: []database.Filter{
+					{Field: "active", Op: database.FilterNe, Value: false},
+					{Field: "details.age", Op: database.FilterGte, Value: int64(18)},
+					{Field: "created_at", Op: database.FilterLt, Value: created},
+					{Field: "name", Op: database.FilterEq, Value: "bob"},
+				},
+				Sort:  []database.SortField{{Field: "name"}},
+				Limit: 20,
+			},
+		},
+		{
+			name:     "in filters are comma separated",
+			rawQuery: "filter[age][in]=18,21",
+			query: database.Query{
+				Filters: []database.Filter{{Field: "details.age", Op: database.FilterIn, Value: bson.A{int64(18), int64(21)}}},
+				Sort:    []database.SortField{{Field: "name"}},
+				Limit:   20,
+			},
+		},
+		{
+			name:     "other parameters are ignored",
+			rawQuery: "page=2&filtered=yes",
+			query:    database.Query{Sort: []database.SortField{{Field: "name"}}, Limit: 20},
+		},
+	}
+
+	for _, run := range runs {
+		run := run
+		t.Run(run.name, func(t *testing.T) {
+			q, err := parseTestQuery(t, run.rawQuery)
+			assert.NoError(t, err, "expected the query to be parsed")
+			assert.Equal(t, run.query, q, "unexpected query")
+		})
+	}
+
+	invalidRuns := []struct {
+		name     string
+		rawQuery string
+		field    string
+		reason   string
+	}{
+		{name: "limit that is not a number", rawQuery: "limit=ten", field: "limit", reason: "type"},
+		{name: "limit that is too small", rawQuery: "limit=0", field: "limit", reason: "min"},
+		{name: "limit that is too large", rawQuery: "limit=101", field: "limit", reason: "max"},
+		{name: "sort on an unknown field", rawQuery: "sort=colour", field: "sort", reason: "oneof"},
+		{name: "sort on a field that can't be sorted on", rawQuery: "sort=age", field: "sort", reason: "oneof"},
+		{name: "filter on a field that can't be filtered on", rawQuery: "filter[secret]=x", field: "filter[secret]", reason: "oneof"},
+		{name: "filter with an operator the type doesn't have", rawQuery: "filter[active][gt]=true", field: "filter[active][gt]", reason: "oneof"},
+		{name: "filter with an unknown operator", rawQuery: "filter[name][like]=bob", field: "filter[name][like]", reason: "oneof"},
+		{name: "filter without a field", rawQuery: "filter=bob", field: "filter", reason: "filter"},
+		{name: "filter with too many parts", rawQuery: "filter[name][eq][x]=bob", field: "filter[name][eq][x]", reason: "filter"},
+		{name: "filter with an invalid number", rawQuery: "filter[age]=old", field: "filter[age]", reason: "type"},
+		{name: "filter with an invalid time", rawQuery: "filter[created_at][gt]=yesterday", field: "filter[created_at][gt]", reason: "type"},
+		{name: "in filter with an invalid value", rawQuery: "filter[age][in]=18,old", field: "filter[age][in]", reason: "type"},
+		{name: "cursor that isn't a cursor", rawQuery: "cursor=nope", field: "cursor", reason: "cursor"},
+	}
+
+	for _, run := range invalidRuns {
+		run := run
+		t.Run("rejects "+run.name, func(t *testing.T) {
+			_, err := parseTestQuery(t, run.rawQuery)
+			var queryErr *InvalidQueryError
+			if assert.ErrorAs(t, err, &queryErr, "expected the query to be rejected") &&
+				assert.Len(t, queryErr.Fields, 1, "expected one invalid parameter") {
+				assert.Equal(t, run.field, queryErr.Fields[0].Field, "unexpected invalid parameter")
+				assert.Equal(t, run.reason, queryErr.Fields[0].Reason, "unexpected reason")
+			}
+		})
+	}
+
+	t.Run("every invalid parameter is listed", func(t *testing.T) {
+		_, err := parseTestQuery(t, "limit=0&sort=colour&filter[age]=old")
+		var queryErr *InvalidQueryError
+		if assert.ErrorAs(t, err, &queryErr, "expected the query to be rejected") {
+			assert.Len(t, queryErr.Fields, 3, "expected every invalid parameter")
+		}
+		p := BindingProblem(err)
+		assert.Equal(t, ProblemTypeValidation, p.Type, "expected a validation problem")
+		assert.Len(t, p.Errors, 3, "expected every invalid parameter in the problem")
+	})
+}
+
+func TestCursor(t *testing.T) {
+	q, err := parseTestQuery(t, "sort=-created_at")
+	assert.NoError(t, err, "expected the query to be parsed")
+	created := rawTestValue(t, time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC))
+	id := rawTestValue(t, "id")
+	cursor, err := EncodeCursor(q, []bson.RawValue{created, id})
+	assert.NoError(t, err, "expected the cursor to be encoded")
+
+	t.Run("is decoded for the same sort", func(t *testing.T) {
+		q, err := parseTestQuery(t, "sort=-created_at&filter[name]=bob&cursor="+cursor)
+		assert.NoError(t, err, "expected the cursor to be accepted")
+		assert.Equal(t, []bson.RawValue{created, id}, q.After, "unexpected values to start after")
+	})
+
+	t.Run("is rejected for another sort", func(t *testing.T) {
+		_, err := parseTestQuery(t, "sort=created_at&cursor="+cursor)
+		var queryErr *InvalidQueryError
+		if assert.ErrorAs(t, err, &queryErr, "expected the cursor to be rejected") {
+			assert.Equal(t, CursorParam, queryErr.Fields[0].Field, "expected the cursor to be invalid")
+		}
+	})
+}
+
+func rawTestValue(t *testing.T, v interface{}) bson.RawValue {
+	t.Helper()
+	valueType, data, err := bson.MarshalValue(v)
+	assert.NoError(t, err, "could not marshal value")
+	return bson.RawValue{Type: valueType, Value: data}
+}
+
+func TestRespondWithPage(t *testing.T) {
+	serve := func(page *database.Page[string]) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		_, engine := gin.CreateTestContext(w)
+		engine.GET("/things", func(c *gin.Context) {
+			RespondWithPage(c, database.Query{Sort: []database.SortField{{Field: "name"}}, Limit: 2}, page)
+		})
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/things?limit=2&cursor=old&sort=name", nil))
+		return w
+	}
+
+	t.Run("last page", func(t *testing.T) {
+		w := serve(&database.Page[string]{})
+		assert.Equal(t, http.StatusOK, w.Code, "unexpected status code")
+		assert.JSONEq(t, `{"items":[]}`, w.Body.String(), "expected an empty page")
+		assert.Equal(t, `</things?limit=2&sort=name>; rel="first"`, w.Header().Get("Link"), "unexpected links")
+	})
+
+	t.Run("page with a next page", func(t *testing.T) {
+		w := serve(&database.Page[string]{
+			Items: []string{"a", "b"},
+			Next:  []bson.RawValue{rawTestValue(t, "b"), rawTestValue(t, "id")},
+		})
+		assert.Equal(t, http.StatusOK, w.Code, "unexpected status code")
+		var body Paginated[string]
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body), "expected a page")
+		assert.Equal(t, []string{"a", "b"}, body.Items, "unexpected items")
+		assert.NotEmpty(t, body.NextCursor, "expected a next cursor")
+		assert.Equal(t,
+			`</things?limit=2&sort=name>; rel="first", </things?cursor=`+body.NextCursor+`&limit=2&sort=name>; rel="next"`,
+			w.Header().Get("Link"), "unexpected links")
+	})
+}
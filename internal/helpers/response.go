@@ -2,15 +2,63 @@ package helpers
 
 import (
 	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// RespondWithError responds with a problem of the status given, detailed by
+// the error
 func RespondWithError(c *gin.Context, err error, statusCode int) {
 	if err == nil || len(err.Error()) == 0 {
 		err = errors.New("unknown error")
 	}
-	c.JSON(statusCode, Error{Error: err.Error()})
+	RespondWithProblem(c, NewProblem(statusCode, err.Error()))
+}
+
+// RespondWithBindingError responds with a validation problem describing why
+// the request could not be bound, or that its body is too large
+func RespondWithBindingError(c *gin.Context, err error) {
+	if limit, ok := BodyTooLarge(err); ok {
+		RespondWithBodyTooLarge(c, limit)
+		return
+	}
+	RespondWithProblem(c, BindingProblem(err))
+}
+
+// BodyTooLarge reports whether reading the body failed as it is larger than
+// the request is allowed, returning the limit in bytes
+func BodyTooLarge(err error) (int64, bool) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return maxBytesErr.Limit, true
+	}
+	return 0, false
+}
+
+// RespondWithBodyTooLarge responds that the body of the request is larger
+// than the limit in bytes
+func RespondWithBodyTooLarge(c *gin.Context, limit int64) {
+	RespondWithError(c, fmt.Errorf("the body must be at most %d bytes", limit), http.StatusRequestEntityTooLarge)
+}
+
+// RespondWithRateLimited responds that the client has made too many requests
+// and when they can try again, rounded up to the second
+func RespondWithRateLimited(c *gin.Context, retryAfter time.Duration) {
+	p := NewProblem(http.StatusTooManyRequests, "too many requests, try again later")
+	p.RetryAfter = int(math.Ceil(retryAfter.Seconds()))
+	RespondWithProblem(c, p)
+}
+
+// RespondWithUnavailable responds that the request can't be handled right
+// now and when it can be retried, rounded up to the second
+func RespondWithUnavailable(c *gin.Context, detail string, retryAfter time.Duration) {
+	p := NewProblem(http.StatusServiceUnavailable, detail)
+	p.RetryAfter = int(math.Ceil(retryAfter.Seconds()))
+	RespondWithProblem(c, p)
 }
 
 func RespondWithString(c *gin.Context, message string, statusCode int) {
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -30,7 +31,8 @@ func TestRespondWithError(t *testing.T) {
 		engine.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusInternalServerError, w.Code, "expected status code 500 was not received")
-		assert.Equal(t, "{\"error\":\"testing\"}", w.Body.String(), "expected error message not in response")
+		assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"), "expected a problem")
+		assert.Equal(t, "{\"type\":\"https://compsoc.ie/apid/problems/internal\",\"title\":\"Internal Server Error\",\"status\":500,\"detail\":\"testing\"}", w.Body.String(), "expected error message not in response")
 	})
 
 	t.Run("error message is empty string", func(t *testing.T) {
@@ -44,7 +46,8 @@ func TestRespondWithError(t *testing.T) {
 		engine.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusInternalServerError, w.Code, "expected status code 500 was not received")
-		assert.Equal(t, "{\"error\":\"unknown error\"}", w.Body.String(), "expected error message not in response")
+		assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"), "expected a problem")
+		assert.Equal(t, "{\"type\":\"https://compsoc.ie/apid/problems/internal\",\"title\":\"Internal Server Error\",\"status\":500,\"detail\":\"unknown error\"}", w.Body.String(), "expected error message not in response")
 	})
 
 	t.Run("error is nil", func(t *testing.T) {
@@ -59,7 +62,7 @@ func TestRespondWithError(t *testing.T) {
 
 		assert.Equal(t, http.StatusInternalServerError, w.Code, "expected status code 500 was not received")
 		assert.NoError(t, err, "expected there to be no error marshalling response")
-		assert.Equal(t, "{\"error\":\"unknown error\"}", w.Body.String(), "expected error message not in response")
+		assert.Equal(t, "{\"type\":\"https://compsoc.ie/apid/problems/internal\",\"title\":\"Internal Server Error\",\"status\":500,\"detail\":\"unknown error\"}", w.Body.String(), "expected error message not in response")
 	})
 }
 
@@ -78,3 +81,37 @@ func TestRespondWithString(t *testing.T) {
 		assert.Equal(t, "{\"message\":\"testing\"}", w.Body.String(), "expected error message not in response")
 	})
 }
+
+func TestRespondWithRateLimited(t *testing.T) {
+	t.Run("retry after is rounded up to the second", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		ctx, engine := gin.CreateTestContext(w)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/", new(bytes.Buffer))
+		engine.GET("/", func(c *gin.Context) {
+			RespondWithRateLimited(ctx, 1500*time.Millisecond)
+		})
+		assert.NoError(t, err, "could not create http request")
+		engine.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusTooManyRequests, w.Code, "expected status code 429 was not received")
+		assert.Equal(t, "{\"type\":\"https://compsoc.ie/apid/problems/rate-limited\",\"title\":\"Too Many Requests\",\"status\":429,\"detail\":\"too many requests, try again later\",\"retry_after\":2}", w.Body.String(), "expected rate limited body not in response")
+	})
+}
+
+func TestRespondWithBodyTooLarge(t *testing.T) {
+	t.Run("a body over the limit is too large", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		ctx, engine := gin.CreateTestContext(w)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/", bytes.NewBufferString(`{"name":"too long"}`))
+		engine.POST("/", func(c *gin.Context) {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, 8)
+			var body map[string]string
+			RespondWithBindingError(c, c.ShouldBindJSON(&body))
+		})
+		assert.NoError(t, err, "could not create http request")
+		engine.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code, "expected status code 413 was not received")
+		assert.Equal(t, "{\"type\":\"https://compsoc.ie/apid/problems/too-large\",\"title\":\"Request Entity Too Large\",\"status\":413,\"detail\":\"the body must be at most 8 bytes\",\"instance\":\"/\"}", w.Body.String(), "expected too large body not in response")
+	})
+}
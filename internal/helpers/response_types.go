@@ -1,5 +1,7 @@
 package helpers
 
+import "time"
+
 type Empty struct {
 }
 
@@ -7,10 +9,90 @@ type ErrorsArray struct {
 	Errors []string `json:"errors" example:"cannot ping database,scheduler offline"`
 }
 
-type Error struct {
-	Error string `json:"error" example:"a server error was encountered"`
-}
-
 type Message struct {
 	Message string `json:"message" example:"i just wanted to say hi"`
 }
+
+type ComponentHealth struct {
+	Name      string    `json:"name" example:"database"`
+	Status    string    `json:"status" example:"up"`
+	LatencyNs int64     `json:"latency_ns" example:"1250000"`
+	LastError string    `json:"last_error,omitempty" example:"cannot ping database"`
+	CheckedAt time.Time `json:"checked_at" example:"2023-07-01T12:00:00Z"`
+}
+
+type HealthReport struct {
+	Status      string            `json:"status" example:"up"`
+	Components  []ComponentHealth `json:"components,omitempty"`
+	Maintenance *Maintenance      `json:"maintenance,omitempty"`
+}
+
+// Healthcheck lists the errors of the components that are down, and whether
+// the API is read-only for maintenance
+type Healthcheck struct {
+	Errors      []string     `json:"errors,omitempty" example:"cannot ping database,scheduler offline"`
+	Maintenance *Maintenance `json:"maintenance,omitempty"`
+}
+
+// Maintenance describes whether the API is read-only for maintenance
+type Maintenance struct {
+	Enabled bool   `json:"enabled" example:"true"`
+	Message string `json:"message,omitempty" example:"APId is read-only while the database is upgraded"`
+	// RetryAfter is how long clients are told to wait before retrying
+	RetryAfter string `json:"retry_after,omitempty" example:"5m0s"`
+	// Groups are the route groups that are read-only, every /v2 route is if
+	// none are given
+	Groups []string `json:"groups,omitempty"`
+	// Source is config, or admin if it was set through the admin listener
+	Source string `json:"source,omitempty" example:"config"`
+}
+
+// FeatureFlag describes whether a feature is enabled for everyone, and the
+// users and roles it is turned on or off for
+type FeatureFlag struct {
+	Name        string `json:"name" example:"elections"`
+	Description string `json:"description,omitempty" example:"Vote in society elections"`
+	Enabled     bool   `json:"enabled" example:"false"`
+	// Users are the overrides of the flag by user ID
+	Users map[string]bool `json:"users,omitempty"`
+	// Roles are the overrides of the flag by role
+	Roles map[string]bool `json:"roles,omitempty"`
+}
+
+// FeatureFlagOverride turns a feature flag on or off for a user or role
+type FeatureFlagOverride struct {
+	Enabled *bool `json:"enabled" binding:"required" example:"true"`
+}
+
+// UserUpdate is the fields of a user that they can change themselves
+type UserUpdate struct {
+	Username string `json:"username" binding:"required,alphanum,max=32" example:"jbloggs"`
+	Email    string `json:"email" binding:"required,email" example:"j.bloggs1@universityofgalway.ie"`
+	Name     string `json:"name" binding:"required,max=100" example:"Joe Bloggs"`
+}
+
+type LogLevel struct {
+	Level string `json:"level" binding:"required" example:"debug"`
+	// TTL is how long a level set through the admin listener lasts for
+	TTL        string            `json:"ttl,omitempty" example:"15m"`
+	Configured string            `json:"configured,omitempty" example:"info"`
+	Subsystems map[string]string `json:"subsystems,omitempty"`
+	ExpiresAt  *time.Time        `json:"expires_at,omitempty" example:"2023-07-01T12:15:00Z"`
+}
+
+type BuildInfo struct {
+	Path      string `json:"path" example:"github.com/ugcompsoc/apid"`
+	Version   string `json:"version" example:"(devel)"`
+	GoVersion string `json:"go_version" example:"go1.19"`
+	Revision  string `json:"revision,omitempty" example:"b204d7e"`
+	Time      string `json:"time,omitempty" example:"2023-07-01T12:00:00Z"`
+	Modified  bool   `json:"modified"`
+}
+
+type ReloadStatus struct {
+	ConfigFile   string     `json:"config_file,omitempty" example:"/run/config/apid.yml"`
+	Reloads      int        `json:"reloads" example:"1"`
+	LastReloadAt time.Time  `json:"last_reload_at" example:"2023-07-01T12:00:00Z"`
+	LastError    string     `json:"last_error,omitempty" example:"failed to parse configuration"`
+	LastErrorAt  *time.Time `json:"last_error_at,omitempty" example:"2023-07-01T12:00:00Z"`
+}
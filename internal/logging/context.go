@@ -0,0 +1,58 @@
+package logging
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+type contextIDKey struct{}
+type loggerKey struct{}
+
+// contextIDRegex limits the context IDs accepted from clients, so they can't
+// inject anything odd into logs or response headers
+var contextIDRegex = regexp.MustCompile("^[A-Za-z0-9._:-]{1,128}$")
+
+// ValidContextID reports whether an ID given by a client can be used as the
+// context ID of its request
+func ValidContextID(id string) bool {
+	return contextIDRegex.MatchString(id)
+}
+
+// NewContextID returns a new, random context ID
+func NewContextID() string {
+	return uuid.New().String()
+}
+
+// WithContextID returns a context carrying the context ID and a logger that
+// adds it to every event
+func WithContextID(ctx context.Context, id string) context.Context {
+	logger := FromContext(ctx).With().Str("context_id", id).Logger()
+	ctx = context.WithValue(ctx, contextIDKey{}, id)
+	return WithLogger(ctx, logger)
+}
+
+// WithLogger returns a context carrying the logger given
+func WithLogger(ctx context.Context, logger zerolog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, &logger)
+}
+
+// ContextID returns the context ID of the context, or an empty string if it
+// has none
+func ContextID(ctx context.Context) string {
+	id, _ := ctx.Value(contextIDKey{}).(string)
+	return id
+}
+
+// FromContext returns the logger in the context. The global logger is
+// returned if the context has none, so code can always log through the
+// context whether or not it was called from a request.
+func FromContext(ctx context.Context) *zerolog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*zerolog.Logger); ok {
+		return logger
+	}
+	return &log.Logger
+}
@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidContextID(t *testing.T) {
+	runs := []struct {
+		id    string
+		valid bool
+	}{
+		{id: NewContextID(), valid: true},
+		{id: "traefik-7f3a.1:2", valid: true},
+		{id: "", valid: false},
+		{id: "has spaces", valid: false},
+		{id: "new\nline", valid: false},
+		{id: strings.Repeat("a", 128), valid: true},
+		{id: strings.Repeat("a", 129), valid: false},
+	}
+
+	for _, run := range runs {
+		assert.Equal(t, run.valid, ValidContextID(run.id), "unexpected validity for %q", run.id)
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	t.Run("global logger is returned without a logger in the context", func(t *testing.T) {
+		assert.Equal(t, &log.Logger, FromContext(context.Background()), "expected the global logger")
+	})
+
+	t.Run("context ID is carried by the context and its logger", func(t *testing.T) {
+		var buf bytes.Buffer
+		ctx := WithLogger(context.Background(), zerolog.New(&buf))
+		ctx = WithContextID(ctx, "abc")
+		assert.Equal(t, "abc", ContextID(ctx), "expected context id to be carried")
+
+		FromContext(ctx).Info().Msg("hello")
+		assert.Contains(t, buf.String(), `"context_id":"abc"`, "expected context id to be logged")
+	})
+
+	t.Run("context ID is empty without one in the context", func(t *testing.T) {
+		assert.Equal(t, "", ContextID(context.Background()), "expected no context id")
+	})
+}
@@ -0,0 +1,150 @@
+package logging
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// levels holds the log levels in effect. Loggers set up by Configure don't
+// carry a level themselves, instead their sampler asks for the level of their
+// subsystem whenever an event is logged. This lets levels be changed at any
+// time without replacing the loggers already in use.
+type levels struct {
+	mu         sync.RWMutex
+	base       zerolog.Level
+	subsystems map[string]zerolog.Level
+	temporary  *zerolog.Level
+	expiresAt  time.Time
+	// generation is bumped on every change, so a timer reverting a temporary
+	// level that has since been replaced does nothing
+	generation int
+}
+
+var current = &levels{base: zerolog.TraceLevel}
+
+// LevelStatus describes the log levels in effect
+type LevelStatus struct {
+	// Level is the level in effect outside of the subsystems
+	Level zerolog.Level
+	// Configured is the level given in the config
+	Configured zerolog.Level
+	Subsystems map[string]zerolog.Level
+	// ExpiresAt is when a temporary level will be reverted, it is nil if
+	// there is none
+	ExpiresAt *time.Time
+}
+
+// SetLevels sets the configured log level and the subsystems that override
+// it, ending any temporary level
+func SetLevels(base zerolog.Level, subsystems map[string]zerolog.Level) {
+	current.mu.Lock()
+	defer current.mu.Unlock()
+	current.base = base
+	current.subsystems = make(map[string]zerolog.Level, len(subsystems))
+	for subsystem, level := range subsystems {
+		current.subsystems[subsystem] = level
+	}
+	current.temporary = nil
+	current.generation++
+	current.apply()
+}
+
+// SetTemporaryLevel sets the log level of every subsystem until ttl has
+// passed, when the configured levels are reverted to. It returns when the
+// level will be reverted.
+func SetTemporaryLevel(level zerolog.Level, ttl time.Duration) time.Time {
+	current.mu.Lock()
+	defer current.mu.Unlock()
+	current.temporary = &level
+	current.expiresAt = time.Now().Add(ttl).UTC()
+	current.generation++
+	current.apply()
+
+	generation := current.generation
+	time.AfterFunc(ttl, func() {
+		current.mu.Lock()
+		defer current.mu.Unlock()
+		if current.generation != generation {
+			return
+		}
+		current.temporary = nil
+		current.generation++
+		current.apply()
+	})
+	return current.expiresAt
+}
+
+// ResetLevel reverts a temporary log level now
+func ResetLevel() {
+	current.mu.Lock()
+	defer current.mu.Unlock()
+	current.temporary = nil
+	current.generation++
+	current.apply()
+}
+
+// Status returns the log levels in effect
+func Status() LevelStatus {
+	current.mu.RLock()
+	defer current.mu.RUnlock()
+	status := LevelStatus{
+		Level:      current.levelFor(""),
+		Configured: current.base,
+		Subsystems: make(map[string]zerolog.Level, len(current.subsystems)),
+	}
+	for subsystem := range current.subsystems {
+		status.Subsystems[subsystem] = current.levelFor(subsystem)
+	}
+	if current.temporary != nil {
+		expiresAt := current.expiresAt
+		status.ExpiresAt = &expiresAt
+	}
+	return status
+}
+
+// levelFor returns the level in effect for the subsystem, the empty subsystem
+// being everything else. The lock must be held.
+func (l *levels) levelFor(subsystem string) zerolog.Level {
+	if l.temporary != nil {
+		return *l.temporary
+	}
+	if level, ok := l.subsystems[subsystem]; ok {
+		return level
+	}
+	return l.base
+}
+
+// apply sets the global level to the most verbose level in effect, so that
+// zerolog doesn't drop events a subsystem wants before its sampler is asked.
+// The lock must be held.
+func (l *levels) apply() {
+	global := l.levelFor("")
+	for subsystem := range l.subsystems {
+		if level := l.levelFor(subsystem); level < global {
+			global = level
+		}
+	}
+	zerolog.SetGlobalLevel(global)
+}
+
+// levelSampler drops events below the level in effect for its subsystem
+type levelSampler struct {
+	subsystem string
+}
+
+func (s levelSampler) Sample(level zerolog.Level) bool {
+	current.mu.RLock()
+	defer current.mu.RUnlock()
+	return level >= current.levelFor(s.subsystem)
+}
+
+// Subsystem returns the logger in the context for the subsystem named. Its
+// events carry the subsystem and are logged at the subsystem's level.
+func Subsystem(ctx context.Context, subsystem string) *zerolog.Logger {
+	logger := FromContext(ctx).With().Str("subsystem", subsystem).Logger().
+		Sample(levelSampler{subsystem: subsystem})
+	return &logger
+}
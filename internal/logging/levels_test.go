@@ -0,0 +1,132 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/ugcompsoc/apid/internal/config"
+)
+
+// configureForTest configures logging to write into the buffer returned,
+// restoring the global logger and levels once the test is done
+func configureForTest(t *testing.T, c *config.Config) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	previousLogger, previousLevel, previousStderr := log.Logger, zerolog.GlobalLevel(), stderr
+	t.Cleanup(func() {
+		SetLevels(zerolog.TraceLevel, nil)
+		log.Logger, stderr = previousLogger, previousStderr
+		zerolog.SetGlobalLevel(previousLevel)
+	})
+	stderr = buf
+	assert.NoError(t, Configure(c), "expected no error configuring logging")
+	return buf
+}
+
+func TestSubsystem(t *testing.T) {
+	buf := configureForTest(t, &config.Config{
+		LogLevel: "info",
+		Logging: config.Logging{
+			Subsystems: map[string]string{
+				config.LogSubsystemDatabase: "debug",
+				config.LogSubsystemAuth:     "error",
+			},
+		},
+	})
+	ctx := context.Background()
+
+	runs := []struct {
+		name    string
+		logger  *zerolog.Logger
+		level   zerolog.Level
+		written bool
+	}{
+		{name: "base debug", logger: &log.Logger, level: zerolog.DebugLevel, written: false},
+		{name: "base info", logger: &log.Logger, level: zerolog.InfoLevel, written: true},
+		{name: "database debug", logger: Subsystem(ctx, config.LogSubsystemDatabase), level: zerolog.DebugLevel, written: true},
+		{name: "database trace", logger: Subsystem(ctx, config.LogSubsystemDatabase), level: zerolog.TraceLevel, written: false},
+		{name: "auth warn", logger: Subsystem(ctx, config.LogSubsystemAuth), level: zerolog.WarnLevel, written: false},
+		{name: "auth error", logger: Subsystem(ctx, config.LogSubsystemAuth), level: zerolog.ErrorLevel, written: true},
+		{name: "http debug", logger: Subsystem(ctx, config.LogSubsystemHTTP), level: zerolog.DebugLevel, written: false},
+		{name: "http info", logger: Subsystem(ctx, config.LogSubsystemHTTP), level: zerolog.InfoLevel, written: true},
+	}
+
+	for _, run := range runs {
+		run := run
+		t.Run(run.name, func(t *testing.T) {
+			buf.Reset()
+			run.logger.WithLevel(run.level).Msg("hello")
+			if run.written {
+				assert.Contains(t, buf.String(), "hello", "expected the event to be written")
+			} else {
+				assert.Empty(t, buf.String(), "expected the event to be dropped")
+			}
+		})
+	}
+
+	t.Run("events carry their subsystem", func(t *testing.T) {
+		buf.Reset()
+		Subsystem(ctx, config.LogSubsystemDatabase).Info().Msg("hello")
+		assert.Contains(t, buf.String(), `"subsystem":"database"`, "expected the subsystem to be logged")
+	})
+
+	t.Run("global level allows the most verbose subsystem", func(t *testing.T) {
+		assert.Equal(t, zerolog.DebugLevel, zerolog.GlobalLevel(), "unexpected global level")
+	})
+}
+
+func TestSetTemporaryLevel(t *testing.T) {
+	buf := configureForTest(t, &config.Config{
+		LogLevel: "info",
+		Logging: config.Logging{
+			Subsystems: map[string]string{config.LogSubsystemAuth: "error"},
+		},
+	})
+	ctx := context.Background()
+
+	t.Run("applies to every subsystem until it expires", func(t *testing.T) {
+		expiresAt := SetTemporaryLevel(zerolog.DebugLevel, 50*time.Millisecond)
+		assert.WithinDuration(t, time.Now().Add(50*time.Millisecond), expiresAt, time.Second, "unexpected expiry")
+
+		buf.Reset()
+		log.Debug().Msg("base")
+		Subsystem(ctx, config.LogSubsystemAuth).Debug().Msg("auth")
+		assert.Contains(t, buf.String(), "base", "expected base debug events to be written")
+		assert.Contains(t, buf.String(), "auth", "expected auth debug events to be written")
+
+		status := Status()
+		assert.Equal(t, zerolog.DebugLevel, status.Level, "unexpected level")
+		assert.Equal(t, zerolog.InfoLevel, status.Configured, "unexpected configured level")
+		assert.NotNil(t, status.ExpiresAt, "expected an expiry")
+
+		assert.Eventually(t, func() bool {
+			return Status().Level == zerolog.InfoLevel
+		}, time.Second, 10*time.Millisecond, "expected the level to be reverted")
+		assert.Nil(t, Status().ExpiresAt, "expected no expiry once reverted")
+		assert.Equal(t, zerolog.ErrorLevel, Status().Subsystems[config.LogSubsystemAuth], "expected the subsystem level to be reverted")
+
+		buf.Reset()
+		log.Debug().Msg("base")
+		assert.Empty(t, buf.String(), "expected base debug events to be dropped")
+	})
+
+	t.Run("is not reverted by the timer of an earlier level", func(t *testing.T) {
+		SetTemporaryLevel(zerolog.WarnLevel, 20*time.Millisecond)
+		SetTemporaryLevel(zerolog.DebugLevel, time.Minute)
+		time.Sleep(50 * time.Millisecond)
+		assert.Equal(t, zerolog.DebugLevel, Status().Level, "expected the later level to be kept")
+		ResetLevel()
+		assert.Equal(t, zerolog.InfoLevel, Status().Level, "expected the level to be reset")
+	})
+
+	t.Run("is ended by the config being applied", func(t *testing.T) {
+		SetTemporaryLevel(zerolog.DebugLevel, time.Minute)
+		SetLevels(zerolog.WarnLevel, nil)
+		assert.Equal(t, zerolog.WarnLevel, Status().Level, "expected the configured level")
+		assert.Nil(t, Status().ExpiresAt, "expected no expiry")
+	})
+}
@@ -0,0 +1,78 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/ugcompsoc/apid/internal/config"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+var (
+	// stderr is where logs are written, it is only replaced by tests
+	stderr io.Writer = os.Stderr
+
+	fileMu sync.Mutex
+	// file is the log file currently written to, if any
+	file *lumberjack.Logger
+)
+
+// Configure replaces the global logger with one writing as the config
+// describes and sets the configured log levels, ending any temporary level
+func Configure(c *config.Config) error {
+	base := c.GetZeroLogLevel()
+	if base == zerolog.NoLevel {
+		return fmt.Errorf("the log level %s is invalid", c.LogLevel)
+	}
+	subsystems := map[string]zerolog.Level{}
+	for subsystem, name := range c.Logging.Subsystems {
+		level := config.ZeroLogLevel(name)
+		if level == zerolog.NoLevel {
+			return fmt.Errorf("the log level %s of the %s subsystem is invalid", name, subsystem)
+		}
+		subsystems[subsystem] = level
+	}
+
+	var writer io.Writer
+	switch c.Logging.Format {
+	case "", config.LogFormatJSON:
+		writer = stderr
+	case config.LogFormatConsole:
+		writer = zerolog.ConsoleWriter{Out: stderr, TimeFormat: time.RFC3339}
+	default:
+		return fmt.Errorf("the log format %s is invalid", c.Logging.Format)
+	}
+
+	var newFile *lumberjack.Logger
+	if c.Logging.File.Path != "" {
+		// the file is opened on the first write, and is always JSON so it can
+		// be shipped somewhere
+		newFile = &lumberjack.Logger{
+			Filename:   c.Logging.File.Path,
+			MaxSize:    c.Logging.File.MaxSizeMB,
+			MaxBackups: c.Logging.File.MaxBackups,
+			MaxAge:     c.Logging.File.MaxAgeDays,
+			Compress:   c.Logging.File.Compress,
+		}
+		writer = zerolog.MultiLevelWriter(writer, newFile)
+	}
+
+	log.Logger = zerolog.New(writer).With().Timestamp().Logger().Sample(levelSampler{})
+	SetLevels(base, subsystems)
+
+	fileMu.Lock()
+	previous := file
+	file = newFile
+	fileMu.Unlock()
+	if previous != nil {
+		if err := previous.Close(); err != nil {
+			log.Error().Err(err).Msg("failed to close the previous log file")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/ugcompsoc/apid/internal/config"
+)
+
+func TestConfigure(t *testing.T) {
+	t.Run("writes JSON by default", func(t *testing.T) {
+		buf := configureForTest(t, &config.Config{LogLevel: "info"})
+		log.Info().Str("key", "value").Msg("hello")
+		assert.Contains(t, buf.String(), `"key":"value"`, "expected a JSON event")
+		assert.Contains(t, buf.String(), `"time":`, "expected a timestamp")
+	})
+
+	t.Run("writes the console format", func(t *testing.T) {
+		buf := configureForTest(t, &config.Config{
+			LogLevel: "info",
+			Logging:  config.Logging{Format: config.LogFormatConsole},
+		})
+		log.Info().Str("key", "value").Msg("hello")
+		assert.NotContains(t, buf.String(), `"key":"value"`, "expected no JSON event")
+		assert.Contains(t, buf.String(), "INF", "expected a console event")
+		assert.Contains(t, buf.String(), "hello", "expected the message")
+	})
+
+	t.Run("writes to a file as well", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "logs", "apid.log")
+		buf := configureForTest(t, &config.Config{
+			LogLevel: "info",
+			Logging: config.Logging{
+				Format: config.LogFormatConsole,
+				File:   config.LogFile{Path: path, MaxSizeMB: 1, MaxBackups: 2},
+			},
+		})
+		log.Info().Str("key", "value").Msg("hello")
+		assert.Contains(t, buf.String(), "hello", "expected the event on stderr")
+		contents, err := os.ReadFile(path)
+		assert.NoError(t, err, "expected the log file to be written")
+		assert.Contains(t, string(contents), `"key":"value"`, "expected a JSON event in the file")
+
+		// configuring again without a file closes it
+		assert.NoError(t, Configure(&config.Config{LogLevel: "info"}), "expected no error configuring logging")
+		fileMu.Lock()
+		defer fileMu.Unlock()
+		assert.Nil(t, file, "expected no log file")
+	})
+
+	runs := []struct {
+		name   string
+		config config.Config
+		err    string
+	}{
+		{
+			name:   "invalid level",
+			config: config.Config{LogLevel: "loud"},
+			err:    "the log level loud is invalid",
+		},
+		{
+			name: "invalid subsystem level",
+			config: config.Config{LogLevel: "info", Logging: config.Logging{
+				Subsystems: map[string]string{config.LogSubsystemHTTP: "loud"},
+			}},
+			err: "the log level loud of the http subsystem is invalid",
+		},
+		{
+			name:   "invalid format",
+			config: config.Config{LogLevel: "info", Logging: config.Logging{Format: "xml"}},
+			err:    "the log format xml is invalid",
+		},
+	}
+
+	for _, run := range runs {
+		run := run
+		t.Run("rejects an "+run.name, func(t *testing.T) {
+			previous := log.Logger
+			err := Configure(&run.config)
+			assert.EqualError(t, err, run.err, "unexpected error")
+			assert.Equal(t, previous, log.Logger, "expected the logger to be unchanged")
+		})
+	}
+}
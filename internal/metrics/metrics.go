@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+const namespace = "apid"
+
+// unmatchedRoute is used as the route label of requests that did not match a
+// route, so that arbitrary paths can't blow up the number of series
+const unmatchedRoute = "unmatched"
+
+// Metrics holds the collectors exposed at /metrics. Each Metrics has its own
+// registry, as a server is created every time the config is reloaded and
+// collectors can only be registered once per registry.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	RequestsTotal        *prometheus.CounterVec
+	RequestDuration      *prometheus.HistogramVec
+	RequestsInFlight     prometheus.Gauge
+	MongoCommandDuration *prometheus.HistogramVec
+	JobQueueDepth        *prometheus.GaugeVec
+}
+
+// New returns Metrics with every collector registered, including the Go
+// runtime and process collectors
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		RequestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "Number of HTTP requests handled, by method, route template and status.",
+		}, []string{"method", "route", "status"}),
+		RequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of HTTP requests, by method, route template and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		RequestsInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_in_flight",
+			Help:      "Number of HTTP requests currently being handled.",
+		}),
+		MongoCommandDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "mongo",
+			Name:      "command_duration_seconds",
+			Help:      "Latency of Mongo commands, by command name and outcome.",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"command", "outcome"}),
+		JobQueueDepth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "jobs",
+			Name:      "queue_depth",
+			Help:      "Number of jobs waiting in each queue.",
+		}, []string{"queue"}),
+	}
+	m.Registry.MustRegister(
+		m.RequestsTotal,
+		m.RequestDuration,
+		m.RequestsInFlight,
+		m.MongoCommandDuration,
+		m.JobQueueDepth,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Handler serves the registry in the Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+}
+
+/*
+ * This middleware counts requests and observes their latency by route template, so /v2/users/:id is one
+ * series regardless of the ID requested.
+ */
+func (m *Metrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		m.RequestsInFlight.Inc()
+		defer m.RequestsInFlight.Dec()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		m.RequestsTotal.WithLabelValues(c.Request.Method, route, status).Inc()
+		m.RequestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// CommandMonitor returns a Mongo driver monitor that observes the latency of
+// every command sent to the database
+func (m *Metrics) CommandMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			m.MongoCommandDuration.WithLabelValues(e.CommandName, "success").Observe(time.Duration(e.DurationNanos).Seconds())
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			m.MongoCommandDuration.WithLabelValues(e.CommandName, "failure").Observe(time.Duration(e.DurationNanos).Seconds())
+		},
+	}
+}
+
+// SetJobQueueDepth records the number of jobs waiting in the queue given
+func (m *Metrics) SetJobQueueDepth(queue string, depth int) {
+	m.JobQueueDepth.WithLabelValues(queue).Set(float64(depth))
+}
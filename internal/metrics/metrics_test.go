@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := New()
+	r := gin.New()
+	r.Use(m.Middleware())
+	r.GET("/users/:id", func(c *gin.Context) {
+		assert.Equal(t, float64(1), testutil.ToFloat64(m.RequestsInFlight), "expected request to be in flight")
+		c.Status(http.StatusOK)
+	})
+
+	for _, path := range []string{"/users/a", "/users/b", "/nowhere"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	t.Run("requests are counted by route template", func(t *testing.T) {
+		count := testutil.ToFloat64(m.RequestsTotal.WithLabelValues(http.MethodGet, "/users/:id", "200"))
+		assert.Equal(t, float64(2), count, "expected both users requests to share a series")
+	})
+
+	t.Run("unmatched requests share a series", func(t *testing.T) {
+		count := testutil.ToFloat64(m.RequestsTotal.WithLabelValues(http.MethodGet, unmatchedRoute, "404"))
+		assert.Equal(t, float64(1), count, "expected unmatched request to be counted")
+	})
+
+	t.Run("latency is observed", func(t *testing.T) {
+		assert.Equal(t, 2, testutil.CollectAndCount(m.RequestDuration), "expected a histogram per route and status")
+	})
+
+	t.Run("in flight requests are released", func(t *testing.T) {
+		assert.Equal(t, float64(0), testutil.ToFloat64(m.RequestsInFlight), "expected no requests in flight")
+	})
+}
+
+func TestCommandMonitor(t *testing.T) {
+	m := New()
+	monitor := m.CommandMonitor()
+	ctx := context.Background()
+	monitor.Succeeded(ctx, &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", DurationNanos: 1000}})
+	monitor.Succeeded(ctx, &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", DurationNanos: 2000}})
+	monitor.Failed(ctx, &event.CommandFailedEvent{CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "insert", DurationNanos: 1000}})
+
+	assert.Equal(t, 2, testutil.CollectAndCount(m.MongoCommandDuration), "expected a histogram per command and outcome")
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+	assert.Contains(t, body, `apid_mongo_command_duration_seconds_count{command="find",outcome="success"} 2`, "expected successful finds to be observed")
+	assert.Contains(t, body, `apid_mongo_command_duration_seconds_sum{command="find",outcome="success"} 3e-06`, "expected find latency to be observed")
+	assert.Contains(t, body, `apid_mongo_command_duration_seconds_count{command="insert",outcome="failure"} 1`, "expected failed insert to be observed")
+}
+
+func TestHandler(t *testing.T) {
+	m := New()
+	m.SetJobQueueDepth("mail", 3)
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code, "expected metrics to be served")
+
+	body := w.Body.String()
+	for _, metric := range []string{
+		`apid_jobs_queue_depth{queue="mail"} 3`,
+		"apid_http_requests_in_flight 0",
+		"go_goroutines",
+		"process_start_time_seconds",
+	} {
+		assert.Contains(t, body, metric, "expected metric to be exposed")
+	}
+}
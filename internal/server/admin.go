@@ -0,0 +1,354 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/ugcompsoc/apid/internal/config"
+	h "github.com/ugcompsoc/apid/internal/helpers"
+	"github.com/ugcompsoc/apid/internal/logging"
+	"github.com/ugcompsoc/apid/internal/services/database"
+)
+
+const (
+	// DefaultLogLevelTTL is how long a log level set through the admin
+	// listener lasts for if no TTL is given
+	DefaultLogLevelTTL = 15 * time.Minute
+	MaxLogLevelTTL     = 24 * time.Hour
+)
+
+// ReloadStatus records the config reloads of the process. It outlives any
+// single Server, as a new one is created every time the config is reloaded.
+type ReloadStatus struct {
+	mu     sync.Mutex
+	status h.ReloadStatus
+}
+
+// Record notes a reload of the config file given, err is the reason the
+// reload failed, if it did
+func (r *ReloadStatus) Record(file string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now().UTC()
+	r.status.ConfigFile = file
+	if err != nil {
+		r.status.LastError = err.Error()
+		r.status.LastErrorAt = &now
+		return
+	}
+	r.status.Reloads++
+	r.status.LastReloadAt = now
+}
+
+// Status returns a copy of the reload status
+func (r *ReloadStatus) Status() h.ReloadStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+// newAdminServer returns the HTTP server for operational endpoints, which is
+// kept off the public listener. Nil is returned if no admin listen address is
+// configured.
+func (s *Server) newAdminServer() *http.Server {
+	if s.Config.HTTP.AdminListenAddress == "" {
+		return nil
+	}
+	return &http.Server{
+		Addr:    s.Config.HTTP.AdminListenAddress,
+		Handler: s.adminRouter(),
+	}
+}
+
+// adminRouter returns the routes served on the admin listener
+func (s *Server) adminRouter() *gin.Engine {
+	r := gin.New()
+	r.Use(gin.CustomRecovery(RecoveryMiddlware))
+
+	r.GET("/metrics", gin.WrapH(s.Metrics.Handler()))
+	r.GET("/loglevel", s.AdminLogLevelGet)
+	r.PUT("/loglevel", s.AdminLogLevelPut)
+	r.DELETE("/loglevel", s.AdminLogLevelDelete)
+	r.GET("/buildinfo", s.AdminBuildInfoGet)
+	r.GET("/reload", s.AdminReloadGet)
+	r.GET("/maintenance", s.AdminMaintenanceGet)
+	r.PUT("/maintenance", s.AdminMaintenancePut)
+	r.DELETE("/maintenance", s.AdminMaintenanceDelete)
+	r.GET("/featureflags", s.AdminFeatureFlagsGet)
+	r.PUT("/featureflags/:flag/:kind/:subject", s.AdminFeatureFlagOverridePut)
+	r.DELETE("/featureflags/:flag/:kind/:subject", s.AdminFeatureFlagOverrideDelete)
+
+	pprofGroup := r.Group("/debug/pprof")
+	pprofGroup.GET("/", gin.WrapF(pprof.Index))
+	pprofGroup.GET("/cmdline", gin.WrapF(pprof.Cmdline))
+	pprofGroup.GET("/profile", gin.WrapF(pprof.Profile))
+	pprofGroup.GET("/symbol", gin.WrapF(pprof.Symbol))
+	pprofGroup.POST("/symbol", gin.WrapF(pprof.Symbol))
+	pprofGroup.GET("/trace", gin.WrapF(pprof.Trace))
+	// named profiles such as heap and goroutine are served by the index
+	pprofGroup.GET("/:profile", gin.WrapF(pprof.Index))
+
+	return r
+}
+
+// AdminLogLevelGet returns the log levels in effect
+func (s *Server) AdminLogLevelGet(c *gin.Context) {
+	c.JSON(http.StatusOK, logLevelResponse())
+}
+
+// AdminLogLevelPut sets the log level of every subsystem for a while, the
+// configured levels are reverted to once the TTL has passed or the config is
+// reloaded
+func (s *Server) AdminLogLevelPut(c *gin.Context) {
+	var body h.LogLevel
+	if err := c.ShouldBindJSON(&body); err != nil {
+		h.RespondWithBindingError(c, err)
+		return
+	}
+	level := config.ZeroLogLevel(body.Level)
+	if level == zerolog.NoLevel {
+		h.RespondWithProblem(c, h.NewValidationProblem(h.ProblemField{
+			Field:   "level",
+			Reason:  "oneof",
+			Message: "level must be one of trace, debug, info, warn, error, fatal, panic",
+		}))
+		return
+	}
+	ttl := DefaultLogLevelTTL
+	if body.TTL != "" {
+		var err error
+		ttl, err = time.ParseDuration(body.TTL)
+		if err != nil || ttl <= 0 || ttl > MaxLogLevelTTL {
+			h.RespondWithProblem(c, h.NewValidationProblem(h.ProblemField{
+				Field:   "ttl",
+				Reason:  "duration",
+				Message: fmt.Sprintf("ttl must be a duration of at most %s, e.g. '15m'", MaxLogLevelTTL),
+			}))
+			return
+		}
+	}
+	previous := logging.Status().Level
+	expiresAt := logging.SetTemporaryLevel(level, ttl)
+	log.Warn().Str("from", previous.String()).Str("to", level.String()).Time("expires_at", expiresAt).
+		Msg("log level changed through the admin listener")
+	c.JSON(http.StatusOK, logLevelResponse())
+}
+
+// AdminLogLevelDelete reverts a log level set through the admin listener now
+func (s *Server) AdminLogLevelDelete(c *gin.Context) {
+	logging.ResetLevel()
+	log.Warn().Msg("log level reverted through the admin listener")
+	c.JSON(http.StatusOK, logLevelResponse())
+}
+
+func logLevelResponse() h.LogLevel {
+	status := logging.Status()
+	response := h.LogLevel{
+		Level:      status.Level.String(),
+		Configured: status.Configured.String(),
+		ExpiresAt:  status.ExpiresAt,
+	}
+	if len(status.Subsystems) != 0 {
+		response.Subsystems = map[string]string{}
+		for subsystem, level := range status.Subsystems {
+			response.Subsystems[subsystem] = level.String()
+		}
+	}
+	return response
+}
+
+// AdminBuildInfoGet returns the module version and VCS details the binary was
+// built with
+func (s *Server) AdminBuildInfoGet(c *gin.Context) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		h.RespondWithError(c, errors.New("build info is not available"), http.StatusNotFound)
+		return
+	}
+	build := h.BuildInfo{
+		Path:      info.Main.Path,
+		Version:   info.Main.Version,
+		GoVersion: info.GoVersion,
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			build.Revision = setting.Value
+		case "vcs.time":
+			build.Time = setting.Value
+		case "vcs.modified":
+			build.Modified = setting.Value == "true"
+		}
+	}
+	c.JSON(http.StatusOK, build)
+}
+
+// AdminReloadGet returns when the config was last reloaded and whether the
+// last reload failed
+func (s *Server) AdminReloadGet(c *gin.Context) {
+	if s.Reloads == nil {
+		c.JSON(http.StatusOK, h.ReloadStatus{})
+		return
+	}
+	c.JSON(http.StatusOK, s.Reloads.Status())
+}
+
+// AdminMaintenanceGet returns the maintenance mode in effect
+func (s *Server) AdminMaintenanceGet(c *gin.Context) {
+	c.JSON(http.StatusOK, s.Maintenance.Status())
+}
+
+// AdminMaintenancePut sets the maintenance mode, overriding the configured one
+// until it is reverted or the config is reloaded
+func (s *Server) AdminMaintenancePut(c *gin.Context) {
+	var body h.Maintenance
+	if err := c.ShouldBindJSON(&body); err != nil {
+		h.RespondWithBindingError(c, err)
+		return
+	}
+	maintenance := config.Maintenance{Enabled: body.Enabled, Message: body.Message, Groups: body.Groups}
+	if body.RetryAfter != "" {
+		retryAfter, err := time.ParseDuration(body.RetryAfter)
+		if err != nil || retryAfter <= 0 {
+			h.RespondWithProblem(c, h.NewValidationProblem(h.ProblemField{
+				Field:   "retry_after",
+				Reason:  "duration",
+				Message: "retry_after must be a positive duration, e.g. '5m'",
+			}))
+			return
+		}
+		maintenance.RetryAfter = retryAfter
+	}
+	for _, group := range body.Groups {
+		known := false
+		for _, g := range config.MaintenanceGroups {
+			known = known || g == group
+		}
+		if !known {
+			h.RespondWithProblem(c, h.NewValidationProblem(h.ProblemField{
+				Field:   "groups",
+				Reason:  "oneof",
+				Message: "groups must be one of " + strings.Join(config.MaintenanceGroups, ", "),
+			}))
+			return
+		}
+	}
+	s.Maintenance.Set(maintenance)
+	log.Warn().Bool("enabled", maintenance.Enabled).Strs("groups", maintenance.Groups).
+		Msg("maintenance mode changed through the admin listener")
+	c.JSON(http.StatusOK, s.Maintenance.Status())
+}
+
+// AdminMaintenanceDelete reverts to the configured maintenance mode now
+func (s *Server) AdminMaintenanceDelete(c *gin.Context) {
+	s.Maintenance.Reset()
+	log.Warn().Msg("maintenance mode reverted through the admin listener")
+	c.JSON(http.StatusOK, s.Maintenance.Status())
+}
+
+// featureFlagOverrideKinds are the kinds of feature flag overrides by the path
+// they are set under
+var featureFlagOverrideKinds = map[string]string{
+	"users": database.FeatureFlagOverrideUser,
+	"roles": database.FeatureFlagOverrideRole,
+}
+
+// AdminFeatureFlagsGet returns every feature flag with the users and roles it
+// is overridden for
+func (s *Server) AdminFeatureFlagsGet(c *gin.Context) {
+	flags, err := s.FeatureFlags.Status(c.Request.Context())
+	if err != nil {
+		h.RespondWithError(c, err, http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, flags)
+}
+
+// AdminFeatureFlagOverridePut turns a feature flag on or off for a user, by
+// ID, or a role. Overrides are kept in the store, so they outlive reloads and
+// apply to every replica.
+func (s *Server) AdminFeatureFlagOverridePut(c *gin.Context) {
+	flag, kind, subject, ok := s.featureFlagOverride(c)
+	if !ok {
+		return
+	}
+	var body h.FeatureFlagOverride
+	if err := c.ShouldBindJSON(&body); err != nil {
+		h.RespondWithBindingError(c, err)
+		return
+	}
+	// users are only checked here, so the overrides of removed users can
+	// still be deleted
+	if kind == database.FeatureFlagOverrideUser {
+		_, err := s.Store.Users().Get(c.Request.Context(), subject)
+		if errors.Is(err, database.ErrNotFound) {
+			h.RespondWithError(c, fmt.Errorf("the user %s doesn't exist", subject), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			h.RespondWithError(c, err, http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := s.FeatureFlags.Set(c.Request.Context(), flag, kind, subject, *body.Enabled); err != nil {
+		h.RespondWithError(c, err, http.StatusInternalServerError)
+		return
+	}
+	log.Warn().Str("flag", flag).Str(kind, subject).Bool("enabled", *body.Enabled).
+		Msg("feature flag overridden through the admin listener")
+	s.AdminFeatureFlagsGet(c)
+}
+
+// AdminFeatureFlagOverrideDelete removes the override of a feature flag for a
+// user or role
+func (s *Server) AdminFeatureFlagOverrideDelete(c *gin.Context) {
+	flag, kind, subject, ok := s.featureFlagOverride(c)
+	if !ok {
+		return
+	}
+	err := s.FeatureFlags.Delete(c.Request.Context(), flag, kind, subject)
+	if errors.Is(err, database.ErrNotFound) {
+		h.RespondWithError(c, fmt.Errorf("the feature flag %s isn't overridden for the %s %s", flag, kind, subject), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.RespondWithError(c, err, http.StatusInternalServerError)
+		return
+	}
+	log.Warn().Str("flag", flag).Str(kind, subject).Msg("feature flag override removed through the admin listener")
+	s.AdminFeatureFlagsGet(c)
+}
+
+// featureFlagOverride returns the flag, kind and subject of the override in
+// the path, responding with a 404 if the flag, kind or role doesn't exist
+func (s *Server) featureFlagOverride(c *gin.Context) (string, string, string, bool) {
+	flag, subject := c.Param("flag"), c.Param("subject")
+	known := false
+	for _, name := range config.FeatureFlagNames {
+		known = known || name == flag
+	}
+	if !known {
+		h.RespondWithError(c, fmt.Errorf("the feature flag %s is unknown", flag), http.StatusNotFound)
+		return "", "", "", false
+	}
+	kind, ok := featureFlagOverrideKinds[c.Param("kind")]
+	if !ok {
+		h.RespondWithError(c, errors.New("feature flags can only be overridden for users and roles"), http.StatusNotFound)
+		return "", "", "", false
+	}
+	if kind == database.FeatureFlagOverrideRole &&
+		subject != database.RoleAdmin && subject != database.RoleCommittee && subject != database.RoleMember {
+		h.RespondWithError(c, fmt.Errorf("the role %s is unknown", subject), http.StatusNotFound)
+		return "", "", "", false
+	}
+	return flag, kind, subject, true
+}
@@ -0,0 +1,303 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/ugcompsoc/apid/internal/config"
+	h "github.com/ugcompsoc/apid/internal/helpers"
+	"github.com/ugcompsoc/apid/internal/logging"
+	"github.com/ugcompsoc/apid/internal/metrics"
+	"github.com/ugcompsoc/apid/internal/services/database"
+	"github.com/ugcompsoc/apid/internal/services/database/memory"
+)
+
+func serveAdmin(s *Server, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	s.adminRouter().ServeHTTP(w, req)
+	return w
+}
+
+func TestAdminRouter(t *testing.T) {
+	s := &Server{Metrics: metrics.New()}
+
+	runs := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{name: "metrics", path: "/metrics", status: http.StatusOK},
+		{name: "pprof index", path: "/debug/pprof/", status: http.StatusOK},
+		{name: "pprof cmdline", path: "/debug/pprof/cmdline", status: http.StatusOK},
+		{name: "pprof named profile", path: "/debug/pprof/goroutine", status: http.StatusOK},
+		{name: "pprof unknown profile", path: "/debug/pprof/nope", status: http.StatusNotFound},
+		{name: "build info", path: "/buildinfo", status: http.StatusOK},
+		{name: "reload status", path: "/reload", status: http.StatusOK},
+		{name: "maintenance mode", path: "/maintenance", status: http.StatusOK},
+	}
+
+	for _, run := range runs {
+		t.Run(run.name+" is served", func(t *testing.T) {
+			w := serveAdmin(s, http.MethodGet, run.path, "")
+			assert.Equal(t, run.status, w.Code, "unexpected status code")
+		})
+	}
+}
+
+func TestAdminLogLevel(t *testing.T) {
+	s := &Server{Metrics: metrics.New()}
+	previous := zerolog.GlobalLevel()
+	defer func() {
+		logging.SetLevels(zerolog.TraceLevel, nil)
+		zerolog.SetGlobalLevel(previous)
+	}()
+	logging.SetLevels(zerolog.InfoLevel, map[string]zerolog.Level{config.LogSubsystemDatabase: zerolog.WarnLevel})
+
+	t.Run("returns the current level", func(t *testing.T) {
+		w := serveAdmin(s, http.MethodGet, "/loglevel", "")
+		assert.Equal(t, http.StatusOK, w.Code, "unexpected status code")
+		assert.JSONEq(t, `{"level":"info","configured":"info","subsystems":{"database":"warn"}}`, w.Body.String(), "unexpected log level")
+	})
+
+	runs := []struct {
+		name   string
+		body   string
+		detail string
+		// field is the field reported as invalid, if any
+		field string
+	}{
+		{
+			name:   "malformed body",
+			body:   `level=debug`,
+			detail: "the body is not valid JSON",
+		},
+		{
+			name:   "missing level",
+			body:   `{"ttl":"10m"}`,
+			detail: "the request has invalid fields",
+			field:  "level",
+		},
+		{
+			name:   "level that is not a string",
+			body:   `{"level":5}`,
+			detail: "the request has invalid fields",
+			field:  "level",
+		},
+		{
+			name:   "unknown level",
+			body:   `{"level":"loud"}`,
+			detail: "the request has invalid fields",
+			field:  "level",
+		},
+		{
+			name:   "malformed ttl",
+			body:   `{"level":"debug","ttl":"ten minutes"}`,
+			detail: "the request has invalid fields",
+			field:  "ttl",
+		},
+		{
+			name:   "negative ttl",
+			body:   `{"level":"debug","ttl":"-1m"}`,
+			detail: "the request has invalid fields",
+			field:  "ttl",
+		},
+		{
+			name:   "ttl that is too long",
+			body:   `{"level":"debug","ttl":"48h"}`,
+			detail: "the request has invalid fields",
+			field:  "ttl",
+		},
+	}
+
+	for _, run := range runs {
+		run := run
+		t.Run("rejects "+run.name, func(t *testing.T) {
+			w := serveAdmin(s, http.MethodPut, "/loglevel", run.body)
+			assert.Equal(t, http.StatusBadRequest, w.Code, "unexpected status code")
+			assert.Equal(t, h.ProblemContentType, w.Header().Get("Content-Type"), "expected a problem")
+			var body h.Problem
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body), "expected a problem body")
+			assert.Equal(t, h.ProblemTypeValidation, body.Type, "unexpected problem type")
+			assert.Equal(t, run.detail, body.Detail, "unexpected detail")
+			if run.field == "" {
+				assert.Empty(t, body.Errors, "expected no invalid fields")
+			} else if assert.Len(t, body.Errors, 1, "expected one invalid field") {
+				assert.Equal(t, run.field, body.Errors[0].Field, "unexpected invalid field")
+			}
+			assert.Equal(t, zerolog.InfoLevel, logging.Status().Level, "expected level to be unchanged")
+		})
+	}
+
+	t.Run("changes the level for a while", func(t *testing.T) {
+		w := serveAdmin(s, http.MethodPut, "/loglevel", `{"level":"debug","ttl":"10m"}`)
+		assert.Equal(t, http.StatusOK, w.Code, "unexpected status code")
+		var body h.LogLevel
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body), "expected a log level body")
+		assert.Equal(t, "debug", body.Level, "expected level to be changed")
+		assert.Equal(t, "info", body.Configured, "expected the configured level to be kept")
+		assert.Equal(t, map[string]string{"database": "debug"}, body.Subsystems, "expected subsystems to be changed")
+		if assert.NotNil(t, body.ExpiresAt, "expected an expiry") {
+			assert.WithinDuration(t, time.Now().Add(10*time.Minute), *body.ExpiresAt, time.Minute, "unexpected expiry")
+		}
+		assert.Equal(t, zerolog.DebugLevel, zerolog.GlobalLevel(), "expected global level to be changed")
+	})
+
+	t.Run("reverts the level", func(t *testing.T) {
+		w := serveAdmin(s, http.MethodDelete, "/loglevel", "")
+		assert.Equal(t, http.StatusOK, w.Code, "unexpected status code")
+		assert.JSONEq(t, `{"level":"info","configured":"info","subsystems":{"database":"warn"}}`, w.Body.String(), "expected level to be reverted")
+		assert.Equal(t, zerolog.InfoLevel, zerolog.GlobalLevel(), "expected global level to be reverted")
+	})
+}
+
+func TestAdminReloadGet(t *testing.T) {
+	reloads := &ReloadStatus{}
+	s := &Server{Metrics: metrics.New(), Reloads: reloads}
+
+	t.Run("successful reloads are counted", func(t *testing.T) {
+		reloads.Record("apid.yml", nil)
+		reloads.Record("apid.yml", nil)
+		var body h.ReloadStatus
+		w := serveAdmin(s, http.MethodGet, "/reload", "")
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body), "expected a reload status body")
+		assert.Equal(t, "apid.yml", body.ConfigFile, "unexpected config file")
+		assert.Equal(t, 2, body.Reloads, "expected two reloads")
+		assert.False(t, body.LastReloadAt.IsZero(), "expected last reload time")
+		assert.Nil(t, body.LastErrorAt, "expected no reload error")
+	})
+
+	t.Run("failed reloads are recorded", func(t *testing.T) {
+		reloads.Record("apid.yml", errors.New("failed to parse configuration"))
+		var body h.ReloadStatus
+		w := serveAdmin(s, http.MethodGet, "/reload", "")
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body), "expected a reload status body")
+		assert.Equal(t, 2, body.Reloads, "expected failed reload to not be counted")
+		assert.Equal(t, "failed to parse configuration", body.LastError, "unexpected reload error")
+		assert.NotNil(t, body.LastErrorAt, "expected reload error time")
+	})
+}
+
+func TestAdminMaintenance(t *testing.T) {
+	s := &Server{Metrics: metrics.New(), Maintenance: NewMaintenanceMode(config.Maintenance{})}
+
+	t.Run("returns the configured mode", func(t *testing.T) {
+		w := serveAdmin(s, http.MethodGet, "/maintenance", "")
+		assert.Equal(t, http.StatusOK, w.Code, "unexpected status code")
+		assert.JSONEq(t, `{"enabled":false,"source":"config"}`, w.Body.String(), "unexpected maintenance mode")
+	})
+
+	runs := []struct {
+		name  string
+		body  string
+		field string
+	}{
+		{name: "enabled that is not a bool", body: `{"enabled":"yes"}`, field: "enabled"},
+		{name: "malformed retry after", body: `{"enabled":true,"retry_after":"soon"}`, field: "retry_after"},
+		{name: "negative retry after", body: `{"enabled":true,"retry_after":"-5m"}`, field: "retry_after"},
+		{name: "unknown group", body: `{"enabled":true,"groups":["events"]}`, field: "groups"},
+	}
+
+	for _, run := range runs {
+		run := run
+		t.Run("rejects "+run.name, func(t *testing.T) {
+			w := serveAdmin(s, http.MethodPut, "/maintenance", run.body)
+			assert.Equal(t, http.StatusBadRequest, w.Code, "unexpected status code")
+			var body h.Problem
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body), "expected a problem body")
+			if assert.Len(t, body.Errors, 1, "expected one invalid field") {
+				assert.Equal(t, run.field, body.Errors[0].Field, "unexpected invalid field")
+			}
+			maintenance, _ := s.Maintenance.Get()
+			assert.False(t, maintenance.Enabled, "expected maintenance mode to be unchanged")
+		})
+	}
+
+	t.Run("enables maintenance mode", func(t *testing.T) {
+		w := serveAdmin(s, http.MethodPut, "/maintenance", `{"enabled":true,"message":"upgrading mongo","retry_after":"10m","groups":["users"]}`)
+		assert.Equal(t, http.StatusOK, w.Code, "unexpected status code")
+		assert.JSONEq(t, `{"enabled":true,"message":"upgrading mongo","retry_after":"10m0s","groups":["users"],"source":"admin"}`,
+			w.Body.String(), "unexpected maintenance mode")
+		maintenance, source := s.Maintenance.Get()
+		assert.True(t, maintenance.ReadOnly(config.MaintenanceGroupUsers), "expected the users group to be read-only")
+		assert.Equal(t, MaintenanceSourceAdmin, source, "expected the mode to be set through the admin listener")
+	})
+
+	t.Run("reverts maintenance mode", func(t *testing.T) {
+		w := serveAdmin(s, http.MethodDelete, "/maintenance", "")
+		assert.Equal(t, http.StatusOK, w.Code, "unexpected status code")
+		assert.JSONEq(t, `{"enabled":false,"source":"config"}`, w.Body.String(), "expected maintenance mode to be reverted")
+	})
+}
+
+func TestAdminFeatureFlags(t *testing.T) {
+	store := memory.NewStore()
+	err := store.Users().Create(context.Background(), &database.User{Meta: database.Meta{ID: "1"}, Username: "jbloggs"})
+	assert.NoError(t, err, "could not create user")
+	s := &Server{
+		Metrics: metrics.New(),
+		Store:   store,
+		FeatureFlags: NewFeatureFlagSet(config.FeatureFlags{
+			config.FeatureFlagElections: {Description: "Vote in society elections"},
+		}, store.FeatureFlags()),
+	}
+
+	t.Run("returns the configured flags", func(t *testing.T) {
+		w := serveAdmin(s, http.MethodGet, "/featureflags", "")
+		assert.Equal(t, http.StatusOK, w.Code, "unexpected status code")
+		assert.JSONEq(t, `[{"name":"elections","description":"Vote in society elections","enabled":false},{"name":"vm_provisioning","enabled":false}]`,
+			w.Body.String(), "unexpected feature flags")
+	})
+
+	runs := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{name: "unknown flag", method: http.MethodPut, path: "/featureflags/voting/roles/member", body: `{"enabled":true}`, status: http.StatusNotFound},
+		{name: "unknown kind", method: http.MethodPut, path: "/featureflags/elections/societies/compsoc", body: `{"enabled":true}`, status: http.StatusNotFound},
+		{name: "unknown role", method: http.MethodPut, path: "/featureflags/elections/roles/treasurer", body: `{"enabled":true}`, status: http.StatusNotFound},
+		{name: "unknown user", method: http.MethodPut, path: "/featureflags/elections/users/2", body: `{"enabled":true}`, status: http.StatusNotFound},
+		{name: "missing enabled", method: http.MethodPut, path: "/featureflags/elections/users/1", body: `{}`, status: http.StatusBadRequest},
+		{name: "missing override", method: http.MethodDelete, path: "/featureflags/elections/users/1", status: http.StatusNotFound},
+	}
+
+	for _, run := range runs {
+		run := run
+		t.Run("rejects "+run.name, func(t *testing.T) {
+			w := serveAdmin(s, run.method, run.path, run.body)
+			assert.Equal(t, run.status, w.Code, "unexpected status code")
+			assert.Equal(t, h.ProblemContentType, w.Header().Get("Content-Type"), "expected a problem")
+		})
+	}
+
+	t.Run("overrides a flag", func(t *testing.T) {
+		w := serveAdmin(s, http.MethodPut, "/featureflags/elections/roles/committee", `{"enabled":true}`)
+		assert.Equal(t, http.StatusOK, w.Code, "unexpected status code")
+		w = serveAdmin(s, http.MethodPut, "/featureflags/elections/users/1", `{"enabled":false}`)
+		assert.Equal(t, http.StatusOK, w.Code, "unexpected status code")
+		assert.JSONEq(t, `[{"name":"elections","description":"Vote in society elections","enabled":false,"users":{"1":false},"roles":{"committee":true}},{"name":"vm_provisioning","enabled":false}]`,
+			w.Body.String(), "expected the overrides")
+		assert.True(t, s.FeatureFlags.Enabled(context.Background(), config.FeatureFlagElections, &database.User{Roles: []string{database.RoleCommittee}}),
+			"expected the flag to be on for the committee")
+	})
+
+	t.Run("removes an override", func(t *testing.T) {
+		w := serveAdmin(s, http.MethodDelete, "/featureflags/elections/roles/committee", "")
+		assert.Equal(t, http.StatusOK, w.Code, "unexpected status code")
+		assert.JSONEq(t, `[{"name":"elections","description":"Vote in society elections","enabled":false,"users":{"1":false}},{"name":"vm_provisioning","enabled":false}]`,
+			w.Body.String(), "expected the override to be removed")
+		assert.False(t, s.FeatureFlags.Enabled(context.Background(), config.FeatureFlagElections, &database.User{Roles: []string{database.RoleCommittee}}),
+			"expected the flag to be off for the committee")
+	})
+}
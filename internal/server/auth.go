@@ -0,0 +1,118 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ugcompsoc/apid/internal/config"
+	h "github.com/ugcompsoc/apid/internal/helpers"
+	"github.com/ugcompsoc/apid/internal/logging"
+	"github.com/ugcompsoc/apid/internal/services/database"
+)
+
+const (
+	userContextKey  = "user"
+	tokenContextKey = "token"
+)
+
+/*
+ * This middleware resolves the user from a bearer token, if one was given. Requests without a token
+ * continue anonymously, RequireRole should be used on routes that need a user. Failed authentications are
+ * rate limited by client IP, see limitFailedAuthentication.
+ */
+func (s *Server) AuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if header == "" {
+			c.Next()
+			return
+		}
+		secret := strings.TrimPrefix(header, "Bearer ")
+		if secret == header || secret == "" {
+			s.rejectToken(c, errors.New("authorization header must be in the form 'Bearer {token}'"))
+			return
+		}
+
+		ctx := c.Request.Context()
+		token, err := s.Store.Tokens().Get(ctx, database.HashToken(secret))
+		if errors.Is(err, database.ErrNotFound) || (err == nil && token.Expired()) {
+			s.rejectToken(c, errors.New("invalid or expired token"))
+			return
+		}
+		if err != nil {
+			logging.Subsystem(ctx, config.LogSubsystemAuth).Error().Err(err).Msg("failed to get token")
+			h.RespondWithError(c, errors.New("a server error was encountered"), http.StatusInternalServerError)
+			c.Abort()
+			return
+		}
+		user, err := s.Store.Users().Get(ctx, token.UserID)
+		if errors.Is(err, database.ErrNotFound) {
+			s.rejectToken(c, errors.New("invalid or expired token"))
+			return
+		}
+		if err != nil {
+			logging.Subsystem(ctx, config.LogSubsystemAuth).Error().Err(err).Msg("failed to get token user")
+			h.RespondWithError(c, errors.New("a server error was encountered"), http.StatusInternalServerError)
+			c.Abort()
+			return
+		}
+
+		c.Set(userContextKey, user)
+		c.Set(tokenContextKey, token)
+		c.Next()
+	}
+}
+
+// rejectToken responds with a 401 to a request whose token couldn't be
+// authenticated, or with a 429 once its client has failed too often
+func (s *Server) rejectToken(c *gin.Context, err error) {
+	if s.limitFailedAuthentication(c) {
+		h.RespondWithError(c, err, http.StatusUnauthorized)
+		c.Abort()
+	}
+}
+
+/*
+ * This middleware rejects requests that are not authenticated, or whose user does not have the role given.
+ * An empty role only requires the request to be authenticated.
+ */
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := CurrentUser(c)
+		if user == nil {
+			h.RespondWithError(c, errors.New("authentication is required"), http.StatusUnauthorized)
+			c.Abort()
+			return
+		}
+		if role != "" && !user.HasRole(role) {
+			h.RespondWithError(c, errors.New("you do not have permission to do this"), http.StatusForbidden)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// CurrentUser returns the user resolved by AuthMiddleware, or nil if the
+// request is anonymous
+func CurrentUser(c *gin.Context) *database.User {
+	value, ok := c.Get(userContextKey)
+	if !ok {
+		return nil
+	}
+	user, _ := value.(*database.User)
+	return user
+}
+
+// CurrentToken returns the token the request was authenticated with, or nil
+// if the request is anonymous
+func CurrentToken(c *gin.Context) *database.Token {
+	value, ok := c.Get(tokenContextKey)
+	if !ok {
+		return nil
+	}
+	token, _ := value.(*database.Token)
+	return token
+}
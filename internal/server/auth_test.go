@@ -0,0 +1,173 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/ugcompsoc/apid/internal/services/database"
+	"github.com/ugcompsoc/apid/internal/services/database/memory"
+)
+
+// newAuthTestServer returns a server with a member and an admin, each with a
+// token named after them, and an expired token belonging to the member
+func newAuthTestServer(t *testing.T) *Server {
+	t.Helper()
+	ctx := context.Background()
+	s := &Server{Store: memory.NewStore()}
+	users := []*database.User{
+		{Meta: database.Meta{ID: "member"}, Username: "member", Email: "member@compsoc.ie", Roles: []string{database.RoleMember}},
+		{Meta: database.Meta{ID: "admin"}, Username: "admin", Email: "admin@compsoc.ie", Roles: []string{database.RoleAdmin}},
+	}
+	for _, u := range users {
+		assert.NoError(t, s.Store.Users().Create(ctx, u), "could not create user")
+		err := s.Store.Tokens().Create(ctx, &database.Token{
+			Meta:   database.Meta{ID: database.HashToken(u.ID + "-token")},
+			UserID: u.ID,
+		})
+		assert.NoError(t, err, "could not create token")
+	}
+	err := s.Store.Tokens().Create(ctx, &database.Token{
+		Meta:      database.Meta{ID: database.HashToken("expired-token")},
+		UserID:    "member",
+		ExpiresAt: time.Now().Add(-time.Hour),
+	})
+	assert.NoError(t, err, "could not create token")
+	err = s.Store.Tokens().Create(ctx, &database.Token{
+		Meta:   database.Meta{ID: database.HashToken("orphaned-token")},
+		UserID: "deleted",
+	})
+	assert.NoError(t, err, "could not create token")
+	return s
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	runs := []struct {
+		name          string
+		authorization string
+		role          string
+		status        int
+		body          string
+	}{
+		{
+			name:   "anonymous requests continue",
+			status: http.StatusOK,
+			body:   "anonymous",
+		},
+		{
+			name:          "valid token resolves the user",
+			authorization: "Bearer member-token",
+			status:        http.StatusOK,
+			body:          "member",
+		},
+		{
+			name:          "header without bearer prefix is rejected",
+			authorization: "member-token",
+			status:        http.StatusUnauthorized,
+			body:          "{\"type\":\"https://compsoc.ie/apid/problems/unauthorized\",\"title\":\"Unauthorized\",\"status\":401,\"detail\":\"authorization header must be in the form 'Bearer {token}'\",\"instance\":\"/\"}",
+		},
+		{
+			name:          "unknown token is rejected",
+			authorization: "Bearer unknown-token",
+			status:        http.StatusUnauthorized,
+			body:          "{\"type\":\"https://compsoc.ie/apid/problems/unauthorized\",\"title\":\"Unauthorized\",\"status\":401,\"detail\":\"invalid or expired token\",\"instance\":\"/\"}",
+		},
+		{
+			name:          "expired token is rejected",
+			authorization: "Bearer expired-token",
+			status:        http.StatusUnauthorized,
+			body:          "{\"type\":\"https://compsoc.ie/apid/problems/unauthorized\",\"title\":\"Unauthorized\",\"status\":401,\"detail\":\"invalid or expired token\",\"instance\":\"/\"}",
+		},
+		{
+			name:          "token of a deleted user is rejected",
+			authorization: "Bearer orphaned-token",
+			status:        http.StatusUnauthorized,
+			body:          "{\"type\":\"https://compsoc.ie/apid/problems/unauthorized\",\"title\":\"Unauthorized\",\"status\":401,\"detail\":\"invalid or expired token\",\"instance\":\"/\"}",
+		},
+	}
+
+	for _, run := range runs {
+		t.Run(run.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ctx, engine := gin.CreateTestContext(w)
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/", nil)
+			assert.NoError(t, err, "could not create http request")
+			if run.authorization != "" {
+				req.Header.Set("Authorization", run.authorization)
+			}
+			s := newAuthTestServer(t)
+			engine.Use(s.AuthMiddleware())
+			engine.GET("/", func(c *gin.Context) {
+				user := CurrentUser(c)
+				if user == nil {
+					c.String(http.StatusOK, "anonymous")
+					return
+				}
+				c.String(http.StatusOK, user.ID)
+			})
+			engine.ServeHTTP(w, req)
+			assert.Equal(t, run.status, w.Code, "unexpected status from middleware")
+			assert.Equal(t, run.body, w.Body.String(), "unexpected response")
+		})
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	runs := []struct {
+		name          string
+		authorization string
+		role          string
+		status        int
+		body          string
+	}{
+		{
+			name:   "anonymous requests are rejected",
+			status: http.StatusUnauthorized,
+			body:   "{\"type\":\"https://compsoc.ie/apid/problems/unauthorized\",\"title\":\"Unauthorized\",\"status\":401,\"detail\":\"authentication is required\",\"instance\":\"/\"}",
+		},
+		{
+			name:          "any user is allowed when no role is required",
+			authorization: "Bearer member-token",
+			status:        http.StatusOK,
+			body:          "ok",
+		},
+		{
+			name:          "user without the role is forbidden",
+			authorization: "Bearer member-token",
+			role:          database.RoleAdmin,
+			status:        http.StatusForbidden,
+			body:          "{\"type\":\"https://compsoc.ie/apid/problems/forbidden\",\"title\":\"Forbidden\",\"status\":403,\"detail\":\"you do not have permission to do this\",\"instance\":\"/\"}",
+		},
+		{
+			name:          "user with the role is allowed",
+			authorization: "Bearer admin-token",
+			role:          database.RoleAdmin,
+			status:        http.StatusOK,
+			body:          "ok",
+		},
+	}
+
+	for _, run := range runs {
+		t.Run(run.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ctx, engine := gin.CreateTestContext(w)
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/", nil)
+			assert.NoError(t, err, "could not create http request")
+			if run.authorization != "" {
+				req.Header.Set("Authorization", run.authorization)
+			}
+			s := newAuthTestServer(t)
+			engine.Use(s.AuthMiddleware())
+			engine.GET("/", RequireRole(run.role), func(c *gin.Context) {
+				c.String(http.StatusOK, "ok")
+			})
+			engine.ServeHTTP(w, req)
+			assert.Equal(t, run.status, w.Code, "unexpected status from middleware")
+			assert.Equal(t, run.body, w.Body.String(), "unexpected response")
+		})
+	}
+}
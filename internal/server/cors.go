@@ -0,0 +1,219 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ugcompsoc/apid/internal/config"
+	"github.com/ugcompsoc/apid/internal/logging"
+)
+
+// corsGroupPaths are the paths of the route groups that can have their own
+// CORS policy. Preflights don't match a route, so the group of a request is
+// found from its path rather than from the route.
+var corsGroupPaths = map[string]string{
+	"/v2/users": config.CORSGroupUsers,
+	"/docs":     config.CORSGroupDocs,
+}
+
+// corsGroup returns the CORS group of the path, or an empty string if it
+// isn't in one
+func corsGroup(path string) string {
+	return pathGroup(corsGroupPaths, path)
+}
+
+// corsPolicy is a CORS policy from config, ready to be applied to requests
+type corsPolicy struct {
+	anyOrigin     bool
+	origins       []originPattern
+	methods       map[string]bool
+	allowMethods  string
+	anyHeader     bool
+	headers       map[string]bool
+	allowHeaders  string
+	exposeHeaders string
+	credentials   bool
+	maxAge        string
+}
+
+// originPattern is an allowed origin, matching its subdomains rather than
+// itself if it started with '*.'
+type originPattern struct {
+	// scheme is empty to match both http and https
+	scheme     string
+	host       string
+	subdomains bool
+}
+
+func newCORSPolicy(c config.CORS) *corsPolicy {
+	p := &corsPolicy{
+		methods:       map[string]bool{},
+		allowMethods:  strings.Join(c.AllowedMethods, ", "),
+		headers:       map[string]bool{},
+		allowHeaders:  strings.Join(c.AllowedHeaders, ", "),
+		exposeHeaders: strings.Join(c.ExposedHeaders, ", "),
+		credentials:   c.AllowCredentials,
+	}
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			p.anyOrigin = true
+			continue
+		}
+		p.origins = append(p.origins, parseOriginPattern(origin))
+	}
+	for _, method := range c.AllowedMethods {
+		p.methods[method] = true
+	}
+	for _, header := range c.AllowedHeaders {
+		if header == "*" {
+			p.anyHeader = true
+		}
+		p.headers[strings.ToLower(header)] = true
+	}
+	if c.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(int(c.MaxAge.Seconds()))
+	}
+	return p
+}
+
+func parseOriginPattern(origin string) originPattern {
+	var p originPattern
+	if i := strings.Index(origin, "://"); i != -1 {
+		p.scheme = strings.ToLower(origin[:i])
+		origin = origin[i+len("://"):]
+	}
+	if strings.HasPrefix(origin, "*.") {
+		p.subdomains = true
+		// keep the dot, so that only whole labels match
+		origin = origin[1:]
+	}
+	p.host = strings.ToLower(origin)
+	return p
+}
+
+func (p originPattern) matches(scheme, host string) bool {
+	if p.scheme == "" && scheme != "http" && scheme != "https" {
+		return false
+	}
+	if p.scheme != "" && p.scheme != scheme {
+		return false
+	}
+	if p.subdomains {
+		return strings.HasSuffix(host, p.host) && len(host) > len(p.host)
+	}
+	return host == p.host
+}
+
+// allowsOrigin reports whether requests from the origin are allowed
+func (p *corsPolicy) allowsOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	scheme, host := strings.ToLower(u.Scheme), strings.ToLower(u.Host)
+	for _, pattern := range p.origins {
+		if pattern.matches(scheme, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsHeaders reports whether the headers of an
+// Access-Control-Request-Headers header are allowed
+func (p *corsPolicy) allowsHeaders(requested string) bool {
+	if p.anyHeader {
+		return true
+	}
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.ToLower(strings.TrimSpace(header))
+		if header != "" && !p.headers[header] {
+			return false
+		}
+	}
+	return true
+}
+
+// allowOrigin sets the headers that let the origin read the response. The
+// origin is echoed rather than '*' when credentials are allowed, as browsers
+// don't send credentials to '*'.
+func (p *corsPolicy) allowOrigin(header http.Header, origin string) {
+	if p.anyOrigin && !p.credentials {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.credentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+/*
+ * This middleware applies the configured CORS policy, with the overrides of the route group the request is in.
+ * Preflights are answered here with 204 No Content, with the Access-Control-Allow-* headers only if the origin, method
+ * and headers are allowed. Other requests from allowed origins are told which response headers they can read.
+ * Requests without an Origin header aren't cross-origin, so they are let through untouched.
+ */
+func (s *Server) CORSMiddleware() gin.HandlerFunc {
+	policies := map[string]*corsPolicy{"": newCORSPolicy(s.Config.HTTP.CORS.Policy(""))}
+	for _, group := range config.CORSGroups {
+		policies[group] = policies[""]
+		if _, ok := s.Config.HTTP.CORS.Groups[group]; ok {
+			policies[group] = newCORSPolicy(s.Config.HTTP.CORS.Policy(group))
+		}
+	}
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		policy := policies[corsGroup(c.Request.URL.Path)]
+		header := c.Writer.Header()
+		header.Add("Vary", "Origin")
+
+		requestMethod := c.GetHeader("Access-Control-Request-Method")
+		if c.Request.Method != http.MethodOptions || requestMethod == "" {
+			if policy.allowsOrigin(origin) {
+				policy.allowOrigin(header, origin)
+				if policy.exposeHeaders != "" {
+					header.Set("Access-Control-Expose-Headers", policy.exposeHeaders)
+				}
+			}
+			c.Next()
+			return
+		}
+
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+		requestHeaders := c.GetHeader("Access-Control-Request-Headers")
+		if !policy.allowsOrigin(origin) || !policy.methods[requestMethod] || !policy.allowsHeaders(requestHeaders) {
+			logging.Subsystem(c.Request.Context(), config.LogSubsystemHTTP).Debug().Str("origin", origin).
+				Str("method", requestMethod).Str("headers", requestHeaders).Msg("CORS preflight rejected")
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		policy.allowOrigin(header, origin)
+		header.Set("Access-Control-Allow-Methods", policy.allowMethods)
+		if policy.anyHeader {
+			// '*' isn't a wildcard when credentials are allowed, so the
+			// headers asked for are allowed by name
+			if requestHeaders != "" {
+				header.Set("Access-Control-Allow-Headers", requestHeaders)
+			}
+		} else {
+			header.Set("Access-Control-Allow-Headers", policy.allowHeaders)
+		}
+		if policy.maxAge != "" {
+			header.Set("Access-Control-Max-Age", policy.maxAge)
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
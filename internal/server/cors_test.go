@@ -0,0 +1,150 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/ugcompsoc/apid/internal/config"
+)
+
+func newCORSTestRouter(cors config.CORS) *gin.Engine {
+	s := &Server{Config: config.Config{HTTP: config.HTTP{CORS: cors}}}
+	r := gin.New()
+	r.Use(s.CORSMiddleware())
+	handler := func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	}
+	r.GET("/v2/ping", handler)
+	r.GET("/v2/users/me", handler)
+	return r
+}
+
+func serveCORS(r *gin.Engine, method, path, origin string, header map[string]string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	allowCredentials := true
+	r := newCORSTestRouter(config.CORS{
+		AllowedOrigins: []string{"https://compsoc.ie", "*.compsoc.ie", "http://localhost:3000"},
+		MaxAge:         10 * time.Minute,
+		Groups: map[string]config.CORSOverride{
+			config.CORSGroupUsers: {
+				AllowedOrigins:   []string{"https://dashboard.compsoc.ie"},
+				AllowedHeaders:   []string{"*"},
+				AllowCredentials: &allowCredentials,
+			},
+		},
+	})
+
+	origins := []struct {
+		origin  string
+		allowed bool
+	}{
+		{origin: "https://compsoc.ie", allowed: true},
+		{origin: "http://compsoc.ie", allowed: false},
+		{origin: "https://events.compsoc.ie", allowed: true},
+		{origin: "http://a.b.compsoc.ie", allowed: true},
+		{origin: "https://evilcompsoc.ie", allowed: false},
+		{origin: "https://compsoc.ie.evil.com", allowed: false},
+		{origin: "https://events.compsoc.ie:8443", allowed: false},
+		{origin: "http://localhost:3000", allowed: true},
+		{origin: "null", allowed: false},
+	}
+	for _, run := range origins {
+		run := run
+		t.Run("origin "+run.origin, func(t *testing.T) {
+			w := serveCORS(r, http.MethodGet, "/v2/ping", run.origin, nil)
+			assert.Equal(t, http.StatusOK, w.Code, "expected the request to be handled whatever its origin")
+			assert.Equal(t, "Origin", w.Header().Get("Vary"), "expected the response to vary by origin")
+			if run.allowed {
+				assert.Equal(t, run.origin, w.Header().Get("Access-Control-Allow-Origin"), "expected the origin to be allowed")
+				assert.Contains(t, w.Header().Get("Access-Control-Expose-Headers"), "ETag", "expected the default exposed headers")
+				assert.Contains(t, w.Header().Get("Access-Control-Expose-Headers"), "X-Request-ID", "expected the request ID to be exposed")
+			} else {
+				assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"), "expected the origin not to be allowed")
+			}
+			assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"), "expected credentials not to be allowed")
+		})
+	}
+
+	t.Run("requests without an origin are untouched", func(t *testing.T) {
+		w := serveCORS(r, http.MethodGet, "/v2/ping", "", nil)
+		assert.Equal(t, http.StatusOK, w.Code, "expected the request to be handled")
+		assert.Empty(t, w.Header().Get("Vary"), "expected no vary header")
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"), "expected no CORS headers")
+	})
+
+	preflights := []struct {
+		name    string
+		path    string
+		origin  string
+		method  string
+		headers string
+		allowed bool
+	}{
+		{name: "allowed", path: "/v2/ping", origin: "https://compsoc.ie", method: http.MethodPut, headers: "Content-Type, If-Match", allowed: true},
+		{name: "with the request ID", path: "/v2/ping", origin: "https://compsoc.ie", method: http.MethodGet, headers: "X-Request-ID", allowed: true},
+		{name: "of a route without the method", path: "/v2/ping", origin: "https://compsoc.ie", method: http.MethodDelete, allowed: true},
+		{name: "of a path without a route", path: "/v2/missing", origin: "https://compsoc.ie", method: http.MethodGet, allowed: true},
+		{name: "from another origin", path: "/v2/ping", origin: "https://example.com", method: http.MethodGet},
+		{name: "with another method", path: "/v2/ping", origin: "https://compsoc.ie", method: "PURGE"},
+		{name: "with another header", path: "/v2/ping", origin: "https://compsoc.ie", method: http.MethodGet, headers: "X-Secret"},
+	}
+	for _, run := range preflights {
+		run := run
+		t.Run("preflight "+run.name, func(t *testing.T) {
+			w := serveCORS(r, http.MethodOptions, run.path, run.origin, map[string]string{
+				"Access-Control-Request-Method":  run.method,
+				"Access-Control-Request-Headers": run.headers,
+			})
+			assert.Equal(t, http.StatusNoContent, w.Code, "expected the preflight to be answered")
+			assert.Equal(t, []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}, w.Header().Values("Vary"), "unexpected vary headers")
+			if run.allowed {
+				assert.Equal(t, run.origin, w.Header().Get("Access-Control-Allow-Origin"), "expected the origin to be allowed")
+				assert.Equal(t, "HEAD, GET, POST, PUT, PATCH, DELETE", w.Header().Get("Access-Control-Allow-Methods"), "expected the default methods")
+				assert.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), "If-Match", "expected the default headers")
+				assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"), "expected the max age in seconds")
+			} else {
+				assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"), "expected the preflight to be rejected")
+				assert.Empty(t, w.Header().Get("Access-Control-Allow-Methods"), "expected the preflight to be rejected")
+			}
+		})
+	}
+
+	t.Run("groups override the policy", func(t *testing.T) {
+		w := serveCORS(r, http.MethodOptions, "/v2/users/me", "https://dashboard.compsoc.ie", map[string]string{
+			"Access-Control-Request-Method":  http.MethodPatch,
+			"Access-Control-Request-Headers": "X-Anything",
+		})
+		assert.Equal(t, "https://dashboard.compsoc.ie", w.Header().Get("Access-Control-Allow-Origin"), "expected the group's origin to be allowed")
+		assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"), "expected the group to allow credentials")
+		assert.Equal(t, "X-Anything", w.Header().Get("Access-Control-Allow-Headers"), "expected the headers asked for to be allowed")
+		assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"), "expected the max age to be inherited")
+
+		w = serveCORS(r, http.MethodGet, "/v2/users/me", "https://compsoc.ie", nil)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"), "expected origins outside the group's to be rejected")
+	})
+
+	t.Run("any origin", func(t *testing.T) {
+		r := newCORSTestRouter(config.CORS{AllowedOrigins: []string{"*"}})
+		w := serveCORS(r, http.MethodGet, "/v2/ping", "https://example.com", nil)
+		assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"), "expected every origin to be allowed")
+		w = serveCORS(r, http.MethodOptions, "/v2/ping", "https://example.com", map[string]string{"Access-Control-Request-Method": http.MethodGet})
+		assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"), "expected every origin to be allowed")
+		assert.Empty(t, w.Header().Get("Access-Control-Max-Age"), "expected no max age")
+	})
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ugcompsoc/apid/internal/config"
+	"github.com/ugcompsoc/apid/internal/services/database"
+	"github.com/ugcompsoc/apid/internal/services/database/memory"
+)
+
+const (
+	// DevAdminToken is the fixed token of the admin user in development mode,
+	// it must never be accepted outside of development mode
+	DevAdminToken  = "apid-dev-admin-token"
+	devAdminUserID = "dev-admin"
+)
+
+// newDevStore returns an in-memory store seeded with the fixtures given, along
+// with an admin user that can be authenticated with DevAdminToken
+func newDevStore(ctx context.Context, dev config.Dev) (database.Store, error) {
+	store := memory.NewStore()
+	if dev.Fixtures != "" {
+		fixtures, err := database.LoadFixtures(dev.Fixtures)
+		if err != nil {
+			return nil, err
+		}
+		if err := fixtures.Seed(ctx, store); err != nil {
+			return nil, err
+		}
+	}
+
+	admin, err := store.Users().Get(ctx, devAdminUserID)
+	if errors.Is(err, database.ErrNotFound) {
+		admin = &database.User{
+			Meta:     database.Meta{ID: devAdminUserID},
+			Username: "admin",
+			Email:    "admin@compsoc.ie",
+			Name:     "Dev Admin",
+			Roles:    []string{database.RoleAdmin},
+		}
+		err = store.Users().Create(ctx, admin)
+	} else if err == nil && !admin.HasRole(database.RoleAdmin) {
+		admin.Roles = append(admin.Roles, database.RoleAdmin)
+		err = store.Users().Update(ctx, admin)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dev admin user: %w", err)
+	}
+
+	err = store.Tokens().Create(ctx, &database.Token{
+		Meta:   database.Meta{ID: database.HashToken(DevAdminToken)},
+		UserID: admin.ID,
+		Name:   "dev admin",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dev admin token: %w", err)
+	}
+	return store, nil
+}
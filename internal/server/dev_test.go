@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ugcompsoc/apid/internal/config"
+	"github.com/ugcompsoc/apid/internal/services/database"
+)
+
+func TestNewDevStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("seeds the repository fixtures", func(t *testing.T) {
+		store, err := newDevStore(ctx, config.Dev{Enabled: true, Fixtures: "../../fixtures.yml"})
+		assert.NoError(t, err, "expected no error creating dev store")
+		users, err := store.Users().List(ctx)
+		assert.NoError(t, err, "expected no error listing users")
+		assert.Len(t, users, 3, "expected the fixture users")
+		events, err := store.Events().List(ctx)
+		assert.NoError(t, err, "expected no error listing events")
+		assert.Len(t, events, 2, "expected the fixture events")
+
+		token, err := store.Tokens().Get(ctx, database.HashToken(DevAdminToken))
+		assert.NoError(t, err, "expected the dev admin token to exist")
+		admin, err := store.Users().Get(ctx, token.UserID)
+		assert.NoError(t, err, "expected the dev admin user to exist")
+		assert.True(t, admin.HasRole(database.RoleAdmin), "expected the dev admin to be an admin")
+	})
+
+	t.Run("creates an admin without fixtures", func(t *testing.T) {
+		store, err := newDevStore(ctx, config.Dev{Enabled: true})
+		assert.NoError(t, err, "expected no error creating dev store")
+		admin, err := store.Users().Get(ctx, devAdminUserID)
+		assert.NoError(t, err, "expected the dev admin user to exist")
+		assert.Equal(t, []string{database.RoleAdmin}, admin.Roles, "expected the dev admin to be an admin")
+	})
+
+	t.Run("promotes a fixture dev admin without the admin role", func(t *testing.T) {
+		fixtures := filepath.Join(t.TempDir(), "fixtures.yml")
+		err := os.WriteFile(fixtures, []byte("users:\n  - id: dev-admin\n    username: admin\n    roles: [member]\n"), 0644)
+		assert.NoError(t, err, "could not write fixtures")
+		store, err := newDevStore(ctx, config.Dev{Enabled: true, Fixtures: fixtures})
+		assert.NoError(t, err, "expected no error creating dev store")
+		admin, err := store.Users().Get(ctx, devAdminUserID)
+		assert.NoError(t, err, "expected the dev admin user to exist")
+		assert.Equal(t, []string{database.RoleMember, database.RoleAdmin}, admin.Roles, "expected the dev admin to be promoted")
+	})
+
+	t.Run("missing fixtures file", func(t *testing.T) {
+		_, err := newDevStore(ctx, config.Dev{Enabled: true, Fixtures: "missing.yml"})
+		assert.Error(t, err, "expected an error reading fixtures")
+	})
+}
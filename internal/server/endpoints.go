@@ -1,12 +1,14 @@
 package server
 
 import (
-	"context"
 	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/ugcompsoc/apid/internal/config"
 	"github.com/ugcompsoc/apid/internal/helpers"
+	"github.com/ugcompsoc/apid/internal/logging"
+	"github.com/ugcompsoc/apid/internal/services/database"
 )
 
 // RootGet					godoc
@@ -26,6 +28,7 @@ func (s *Server) RootGet(c *gin.Context) {
 // @Tags					V2
 // @Produce					json
 // @Success					200	{object}	helpers.Message
+// @Failure					429	{object}	helpers.Problem
 // @Router					/v2	[get]
 func (s *Server) RootV2Get(c *gin.Context) {
 	c.JSON(http.StatusOK, helpers.Message{Message: "Root V2"})
@@ -39,33 +42,105 @@ func (s *Server) RootV2Get(c *gin.Context) {
 
 // MiscV2HealthcheckGet		godoc
 // @Summary					Get health of API
-// @Description				Responds with any service errors
+// @Description				Responds with any service errors, and the maintenance mode if the API is read-only
 // @Tags					V2
 // @Produce					json
-// @Success					200	{object}	helpers.Empty
-// @Success					503	{object}	helpers.ErrorsArray
-// @Failure					500	{object}	helpers.Error
+// @Success					200	{object}	helpers.Healthcheck
+// @Success					503	{object}	helpers.Healthcheck
+// @Failure					500	{object}	helpers.Problem
 // @Router					/v2/healthcheck [get]
 func (s *Server) MiscV2HealthcheckGet(c *gin.Context) {
 	var errs []string = []string{}
-	err := s.Datastore.Client.Ping(context.TODO(), nil)
-	if err != nil {
-		errs = append(errs, "cannot ping database")
+	report := s.Health.Run(c.Request.Context(), ProbeReadiness)
+	for _, component := range report.Components {
+		if component.Status != HealthStatusUp {
+			errs = append(errs, component.LastError)
+		}
 	}
+	healthcheck := helpers.Healthcheck{Errors: errs, Maintenance: s.Maintenance.enabledStatus()}
 	if len(errs) == 0 {
-		c.JSON(http.StatusOK, helpers.Empty{})
+		c.JSON(http.StatusOK, healthcheck)
 		return
 	}
-	c.JSON(http.StatusServiceUnavailable, helpers.ErrorsArray{Errors: errs})
+	c.JSON(http.StatusServiceUnavailable, healthcheck)
 	return
 }
 
+// MiscV2HealthGet			godoc
+// @Summary					Get detailed health of API
+// @Description				Responds with the status, latency and last error of every component, and the maintenance mode if the API is read-only
+// @Tags					V2
+// @Produce					json
+// @Success					200	{object}	helpers.HealthReport
+// @Success					503	{object}	helpers.HealthReport
+// @Router					/v2/health [get]
+func (s *Server) MiscV2HealthGet(c *gin.Context) {
+	report := s.Health.Run(c.Request.Context(), ProbeLiveness|ProbeReadiness|ProbeStartup)
+	report.Maintenance = s.Maintenance.enabledStatus()
+	respondWithHealthReport(c, report)
+	return
+}
+
+// MiscV2HealthLiveGet		godoc
+// @Summary					Liveness probe
+// @Description				Responds with 200 if the API is alive and should not be restarted
+// @Tags					V2
+// @Produce					json
+// @Success					200	{object}	helpers.HealthReport
+// @Success					503	{object}	helpers.HealthReport
+// @Router					/v2/health/live [get]
+func (s *Server) MiscV2HealthLiveGet(c *gin.Context) {
+	report := s.Health.Run(c.Request.Context(), ProbeLiveness)
+	report.Components = nil
+	respondWithHealthReport(c, report)
+	return
+}
+
+// MiscV2HealthReadyGet		godoc
+// @Summary					Readiness probe
+// @Description				Responds with 200 if the API is ready to receive traffic
+// @Tags					V2
+// @Produce					json
+// @Success					200	{object}	helpers.HealthReport
+// @Success					503	{object}	helpers.HealthReport
+// @Router					/v2/health/ready [get]
+func (s *Server) MiscV2HealthReadyGet(c *gin.Context) {
+	report := s.Health.Run(c.Request.Context(), ProbeReadiness)
+	report.Components = nil
+	respondWithHealthReport(c, report)
+	return
+}
+
+// MiscV2HealthStartupGet	godoc
+// @Summary					Startup probe
+// @Description				Responds with 200 once the API has finished starting up
+// @Tags					V2
+// @Produce					json
+// @Success					200	{object}	helpers.HealthReport
+// @Success					503	{object}	helpers.HealthReport
+// @Router					/v2/health/startup [get]
+func (s *Server) MiscV2HealthStartupGet(c *gin.Context) {
+	report := s.Health.Run(c.Request.Context(), ProbeStartup)
+	report.Components = nil
+	respondWithHealthReport(c, report)
+	return
+}
+
+func respondWithHealthReport(c *gin.Context, report helpers.HealthReport) {
+	if report.Status != HealthStatusUp {
+		c.JSON(http.StatusServiceUnavailable, report)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
 // MiscV2BrewGet			godoc
 // @Summary					Brew coffee
 // @Description				Responds with refusal to brew coffee
 // @Tags					V2
 // @Produce					json
-// @Success					200	{object}	helpers.Error
+// @Failure					418	{object}	helpers.Problem
+// @Failure					429	{object}	helpers.Problem
 // @Router					/v2/brew [get]
 func (s *Server) MiscV2BrewGet(c *gin.Context) {
 	helpers.RespondWithError(c, errors.New("I refuse to brew coffee because I am, permanently, a teapot."), http.StatusTeapot)
@@ -78,8 +153,177 @@ func (s *Server) MiscV2BrewGet(c *gin.Context) {
 // @Tags					V2
 // @Produce					json
 // @Success					200	{object}	helpers.Message
+// @Failure					429	{object}	helpers.Problem
 // @Router					/v2/ping [get]
 func (s *Server) MiscV2PingGet(c *gin.Context) {
 	helpers.RespondWithString(c, "Pong!", http.StatusOK)
 	return
 }
+
+/****************************
+ *
+ * === USERS V2 ENDPOINTS ===
+ *
+ ****************************/
+
+// UsersV2MeGet				godoc
+// @Summary					Get the current user
+// @Description				Responds with the user the bearer token belongs to, or with 304 if it matches the If-None-Match header
+// @Tags					Users
+// @Produce					json
+// @Security				BearerToken
+// @Param					If-None-Match	header	string	false	"The ETag of the user the client has"
+// @Success					200	{object}	database.User
+// @Header					200	{string}	ETag	"The version of the user"
+// @Success					304
+// @Failure					401	{object}	helpers.Problem
+// @Failure					429	{object}	helpers.Problem
+// @Failure					503	{object}	helpers.Problem
+// @Router					/v2/users/me [get]
+func (s *Server) UsersV2MeGet(c *gin.Context) {
+	user := CurrentUser(c)
+	if !helpers.CheckPreconditions(c, user) {
+		return
+	}
+	helpers.SetETag(c, user)
+	c.JSON(http.StatusOK, user)
+}
+
+// UsersV2MePut				godoc
+// @Summary					Update the current user
+// @Description				Changes the username, email and name of the user the bearer token belongs to. Send the ETag of the user in If-Match so changes made since it was read aren't overwritten.
+// @Tags					Users
+// @Accept					json
+// @Produce					json
+// @Security				BearerToken
+// @Param					If-Match	header	string	false	"The ETag of the user being changed"
+// @Param					user	body	helpers.UserUpdate	true	"The user"
+// @Success					200	{object}	database.User
+// @Header					200	{string}	ETag	"The new version of the user"
+// @Failure					400	{object}	helpers.Problem
+// @Failure					401	{object}	helpers.Problem
+// @Failure					409	{object}	helpers.Problem
+// @Failure					412	{object}	helpers.Problem
+// @Failure					413	{object}	helpers.Problem
+// @Failure					429	{object}	helpers.Problem
+// @Failure					503	{object}	helpers.Problem
+// @Router					/v2/users/me [put]
+func (s *Server) UsersV2MePut(c *gin.Context) {
+	user := CurrentUser(c)
+	if !helpers.CheckPreconditions(c, user) {
+		return
+	}
+	var body helpers.UserUpdate
+	if err := c.ShouldBindJSON(&body); err != nil {
+		helpers.RespondWithBindingError(c, err)
+		return
+	}
+	s.updateCurrentUser(c, user, body)
+}
+
+// UsersV2MePatch			godoc
+// @Summary					Patch the current user
+// @Description				Changes the username, email or name of the user the bearer token belongs to with a JSON merge patch (RFC 7396) or a JSON patch (RFC 6902) of the user. Patches that change any other field are rejected. Send the ETag of the user in If-Match so changes made since it was read aren't overwritten.
+// @Tags					Users
+// @Accept					application/merge-patch+json,application/json-patch+json
+// @Produce					json
+// @Security				BearerToken
+// @Param					If-Match	header	string	false	"The ETag of the user being changed"
+// @Param					patch	body	object	true	"The patch"
+// @Success					200	{object}	database.User
+// @Header					200	{string}	ETag	"The new version of the user"
+// @Failure					400	{object}	helpers.Problem
+// @Failure					401	{object}	helpers.Problem
+// @Failure					409	{object}	helpers.Problem
+// @Failure					412	{object}	helpers.Problem
+// @Failure					413	{object}	helpers.Problem
+// @Failure					415	{object}	helpers.Problem
+// @Failure					429	{object}	helpers.Problem
+// @Failure					503	{object}	helpers.Problem
+// @Router					/v2/users/me [patch]
+func (s *Server) UsersV2MePatch(c *gin.Context) {
+	user := CurrentUser(c)
+	if !helpers.CheckPreconditions(c, user) {
+		return
+	}
+	var body helpers.UserUpdate
+	if err := helpers.BindPatch(c, user, &body); err != nil {
+		helpers.RespondWithPatchError(c, err)
+		return
+	}
+	s.updateCurrentUser(c, user, body)
+}
+
+// updateCurrentUser stores the changes to the current user and responds with
+// it. The user was read when the request was authenticated, so the update is
+// rejected if it has changed since.
+func (s *Server) updateCurrentUser(c *gin.Context, user *database.User, body helpers.UserUpdate) {
+	updated := *user
+	updated.Username = body.Username
+	updated.Email = body.Email
+	updated.Name = body.Name
+	ctx := c.Request.Context()
+	err := s.Store.Users().Update(ctx, &updated)
+	switch {
+	case errors.Is(err, database.ErrVersionMismatch):
+		helpers.RespondWithPreconditionFailed(c)
+		return
+	case errors.Is(err, database.ErrNotFound):
+		helpers.RespondWithError(c, errors.New("the user no longer exists"), http.StatusNotFound)
+		return
+	case errors.Is(err, database.ErrConflict):
+		helpers.RespondWithError(c, errors.New("the username or email is already taken"), http.StatusConflict)
+		return
+	case err != nil:
+		logging.Subsystem(ctx, config.LogSubsystemDatabase).Error().Err(err).Msg("failed to update user")
+		helpers.RespondWithError(c, errors.New("a server error was encountered"), http.StatusInternalServerError)
+		return
+	}
+	helpers.SetETag(c, &updated)
+	c.JSON(http.StatusOK, updated)
+}
+
+// usersQuery is what users can be filtered and sorted by
+var usersQuery = helpers.ListQuery{
+	Fields: map[string]helpers.QueryField{
+		"username":   {Field: "username", Type: helpers.FieldString, Filter: true, Sort: true},
+		"email":      {Field: "email", Type: helpers.FieldString, Filter: true, Sort: true},
+		"name":       {Field: "name", Type: helpers.FieldString, Filter: true, Sort: true},
+		"roles":      {Field: "roles", Type: helpers.FieldString, Filter: true},
+		"created_at": {Field: "created_at", Type: helpers.FieldTime, Filter: true, Sort: true},
+	},
+	DefaultSort:  "username",
+	DefaultLimit: 20,
+	MaxLimit:     100,
+}
+
+// UsersV2Get				godoc
+// @Summary					List users
+// @Description				Responds with a page of users. Filter with filter[field]=value or filter[field][op]=value, on username, email, name (eq, ne, in, prefix), roles (eq, ne, in) or created_at (eq, ne, lt, lte, gt, gte). Sort on username, email, name or created_at.
+// @Tags					Users
+// @Produce					json
+// @Security				BearerToken
+// @Param					query	query	helpers.ListParams	false	"Pagination and sorting"
+// @Success					200	{object}	helpers.Paginated[database.User]
+// @Header					200	{string}	Link	"The first and next pages"
+// @Failure					400	{object}	helpers.Problem
+// @Failure					401	{object}	helpers.Problem
+// @Failure					403	{object}	helpers.Problem
+// @Failure					429	{object}	helpers.Problem
+// @Failure					503	{object}	helpers.Problem
+// @Router					/v2/users [get]
+func (s *Server) UsersV2Get(c *gin.Context) {
+	q, err := usersQuery.Parse(c)
+	if err != nil {
+		helpers.RespondWithBindingError(c, err)
+		return
+	}
+	ctx := c.Request.Context()
+	page, err := s.Store.Users().Find(ctx, q)
+	if err != nil {
+		logging.Subsystem(ctx, config.LogSubsystemDatabase).Error().Err(err).Msg("failed to find users")
+		helpers.RespondWithError(c, errors.New("a server error was encountered"), http.StatusInternalServerError)
+		return
+	}
+	helpers.RespondWithPage(c, q, page)
+}
@@ -2,84 +2,21 @@ package server
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
-	"strconv"
 	"testing"
 
-	"github.com/ugcompsoc/apid/internal/services/database"
-	db_utils "github.com/ugcompsoc/apid/internal/services/database_test_utils"
-
-	"context"
-	"log"
-	"os"
-	"time"
-
 	"github.com/gin-gonic/gin"
-	"github.com/ory/dockertest/v3"
 	"github.com/stretchr/testify/assert"
-
 	"github.com/ugcompsoc/apid/internal/config"
-
-	"github.com/containers/common/pkg/retry"
+	"github.com/ugcompsoc/apid/internal/helpers"
+	"github.com/ugcompsoc/apid/internal/services/database"
+	"github.com/ugcompsoc/apid/internal/services/database/memory"
 )
 
-var dockerPool *dockertest.Pool
-var dockerDefaultResource *dockertest.Resource
-var dockerResourcesToPurge []*dockertest.Resource
-var ds *database.Datastore
-
-func TestMain(m *testing.M) {
-	// Recover from panic so that container can be purged
-	defer func() {
-		db_utils.PurgeDockerResources(dockerPool, dockerResourcesToPurge)
-		if err := recover(); err != nil {
-			log.Fatal(err)
-		}
-	}()
-	// Setup
-	var err error
-	dockerPool, err = db_utils.SetupDockerPool()
-	if err != nil {
-		log.Fatalf("could not connect to docker: %s", err)
-	}
-	config := &config.Config{}
-	port, err := db_utils.GetFreePort()
-	if err != nil {
-		log.Fatalf("issue resolving a free port: %s", err)
-	}
-	config.Database.Host = "mongodb://localhost:" + strconv.Itoa(port)
-	config.Database.Name = "test_database"
-	config.Database.Username = "test_username"
-	config.Database.Password = "test_password"
-	dockerDefaultResource, err = db_utils.SetupMongoDocker(config, dockerPool)
-	if err != nil {
-		log.Fatalf("could not create mongo docker %s", err)
-	}
-	dockerResourcesToPurge = append(dockerResourcesToPurge, dockerDefaultResource)
-	err = retry.RetryIfNecessary(context.Background(), func() error {
-		var err error
-		ds, err = database.NewDatastore(config)
-		return err
-	}, &retry.Options{
-		MaxRetry: 3,
-		Delay:    2 * time.Second,
-	})
-	if err != nil {
-		log.Fatalf("could not connect to docker: %s", err)
-	}
-
-	// Run tests
-	exitCode := m.Run()
-
-	// Teardown
-	// purge all resources
-	db_utils.PurgeDockerResources(dockerPool, dockerResourcesToPurge)
-
-	// Exit
-	os.Exit(exitCode)
-}
-
 func TestRootGet(t *testing.T) {
 	t.Run("happy path", func(t *testing.T) {
 		w := httptest.NewRecorder()
@@ -117,8 +54,11 @@ func TestMiscV2HealthcheckGet(t *testing.T) {
 		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/v2/healthcheck", new(bytes.Buffer))
 		assert.NoError(t, err, "could not create http request")
 		s := &Server{
-			Datastore: ds,
+			Store:  memory.NewStore(),
+			Health: NewHealthRegistry(),
 		}
+		err = s.registerHealthChecks()
+		assert.NoError(t, err, "could not register health checks")
 		engine.GET("/v2/healthcheck", s.MiscV2HealthcheckGet)
 		engine.ServeHTTP(w, req)
 
@@ -132,9 +72,12 @@ func TestMiscV2HealthcheckGet(t *testing.T) {
 		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/v2/healthcheck", new(bytes.Buffer))
 		assert.NoError(t, err, "could not create http request")
 		s := &Server{
-			Datastore: ds,
+			Store:  memory.NewStore(),
+			Health: NewHealthRegistry(),
 		}
-		err = s.Datastore.Client.Disconnect(context.TODO())
+		err = s.registerHealthChecks()
+		assert.NoError(t, err, "could not register health checks")
+		err = s.Store.Close(context.TODO())
 		assert.NoError(t, err, "could not disconnect from database")
 		engine.GET("/v2/healthcheck", s.MiscV2HealthcheckGet)
 		engine.ServeHTTP(w, req)
@@ -142,6 +85,135 @@ func TestMiscV2HealthcheckGet(t *testing.T) {
 		assert.Equal(t, http.StatusServiceUnavailable, w.Code, "expected status 503 from endpoint")
 		assert.Equal(t, "{\"errors\":[\"cannot ping database\"]}", w.Body.String(), "expected empty errors array")
 	})
+
+	t.Run("expect maintenance mode", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		ctx, engine := gin.CreateTestContext(w)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/v2/healthcheck", new(bytes.Buffer))
+		assert.NoError(t, err, "could not create http request")
+		s := &Server{
+			Store:       memory.NewStore(),
+			Health:      NewHealthRegistry(),
+			Maintenance: NewMaintenanceMode(config.Maintenance{Enabled: true}),
+		}
+		err = s.registerHealthChecks()
+		assert.NoError(t, err, "could not register health checks")
+		engine.GET("/v2/healthcheck", s.MiscV2HealthcheckGet)
+		engine.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code, "expected status 200 from endpoint while read-only")
+		assert.JSONEq(t, `{"maintenance":{"enabled":true,"message":"`+config.DefaultMaintenanceMessage+`","retry_after":"5m0s","source":"config"}}`,
+			w.Body.String(), "expected the maintenance mode")
+	})
+}
+
+func TestMiscV2HealthProbes(t *testing.T) {
+	newServer := func(t *testing.T, readyErr error) *Server {
+		s := &Server{Health: NewHealthRegistry()}
+		err := s.Health.Register(HealthCheck{
+			Name:   "process",
+			Probes: ProbeLiveness,
+			Check:  func(ctx context.Context) error { return nil },
+		})
+		assert.NoError(t, err, "could not register liveness check")
+		err = s.Health.Register(HealthCheck{
+			Name:   "scheduler",
+			Probes: ProbeReadiness,
+			Check:  func(ctx context.Context) error { return readyErr },
+		})
+		assert.NoError(t, err, "could not register readiness check")
+		return s
+	}
+
+	runs := []struct {
+		name     string
+		path     string
+		started  bool
+		readyErr error
+		status   int
+		body     string
+	}{
+		{
+			name:   "liveness is up",
+			path:   "/v2/health/live",
+			status: http.StatusOK,
+			body:   "{\"status\":\"up\"}",
+		},
+		{
+			name:     "liveness ignores readiness checks",
+			path:     "/v2/health/live",
+			readyErr: errors.New("scheduler offline"),
+			status:   http.StatusOK,
+			body:     "{\"status\":\"up\"}",
+		},
+		{
+			name:   "readiness is up",
+			path:   "/v2/health/ready",
+			status: http.StatusOK,
+			body:   "{\"status\":\"up\"}",
+		},
+		{
+			name:     "readiness is down",
+			path:     "/v2/health/ready",
+			readyErr: errors.New("scheduler offline"),
+			status:   http.StatusServiceUnavailable,
+			body:     "{\"status\":\"down\"}",
+		},
+		{
+			name:   "startup is down before the server has started",
+			path:   "/v2/health/startup",
+			status: http.StatusServiceUnavailable,
+			body:   "{\"status\":\"down\"}",
+		},
+		{
+			name:    "startup is up after the server has started",
+			path:    "/v2/health/startup",
+			started: true,
+			status:  http.StatusOK,
+			body:    "{\"status\":\"up\"}",
+		},
+	}
+
+	for _, run := range runs {
+		t.Run(run.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ctx, engine := gin.CreateTestContext(w)
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, run.path, new(bytes.Buffer))
+			assert.NoError(t, err, "could not create http request")
+			s := newServer(t, run.readyErr)
+			if run.started {
+				s.Health.MarkStarted()
+			}
+			engine.GET("/v2/health/live", s.MiscV2HealthLiveGet)
+			engine.GET("/v2/health/ready", s.MiscV2HealthReadyGet)
+			engine.GET("/v2/health/startup", s.MiscV2HealthStartupGet)
+			engine.ServeHTTP(w, req)
+			assert.Equal(t, run.status, w.Code, "unexpected status from endpoint")
+			assert.Equal(t, run.body, w.Body.String(), "unexpected response")
+		})
+	}
+
+	t.Run("detailed view includes every component", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		ctx, engine := gin.CreateTestContext(w)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/v2/health", new(bytes.Buffer))
+		assert.NoError(t, err, "could not create http request")
+		s := newServer(t, errors.New("scheduler offline"))
+		s.Health.MarkStarted()
+		engine.GET("/v2/health", s.MiscV2HealthGet)
+		engine.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code, "expected status 503 from endpoint")
+		var report helpers.HealthReport
+		err = json.Unmarshal(w.Body.Bytes(), &report)
+		assert.NoError(t, err, "could not unmarshal health report")
+		assert.Equal(t, HealthStatusDown, report.Status, "expected overall status to be down")
+		assert.Len(t, report.Components, 2, "expected both components in the report")
+		assert.Equal(t, "process", report.Components[0].Name, "expected process component first")
+		assert.Equal(t, HealthStatusUp, report.Components[0].Status, "expected process to be up")
+		assert.Equal(t, "scheduler", report.Components[1].Name, "expected scheduler component second")
+		assert.Equal(t, HealthStatusDown, report.Components[1].Status, "expected scheduler to be down")
+		assert.Equal(t, "scheduler offline", report.Components[1].LastError, "expected last error of scheduler")
+	})
 }
 
 func TestBrewV2Get(t *testing.T) {
@@ -155,7 +227,7 @@ func TestBrewV2Get(t *testing.T) {
 		engine.ServeHTTP(w, req)
 
 		assert.Equal(t, http.StatusTeapot, w.Code, "expected status 418 from endpoint")
-		assert.Equal(t, "{\"error\":\"I refuse to brew coffee because I am, permanently, a teapot.\"}", w.Body.String(), "unexpected response")
+		assert.Equal(t, "{\"type\":\"about:blank\",\"title\":\"I'm a teapot\",\"status\":418,\"detail\":\"I refuse to brew coffee because I am, permanently, a teapot.\",\"instance\":\"/v2/brew\"}", w.Body.String(), "unexpected response")
 	})
 }
 
@@ -173,3 +245,227 @@ func TestMiscV2Get(t *testing.T) {
 		assert.Equal(t, "{\"message\":\"Pong!\"}", w.Body.String(), "unexpected response")
 	})
 }
+
+func TestUsersV2MeGet(t *testing.T) {
+	t.Run("happy path", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		ctx, engine := gin.CreateTestContext(w)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/v2/users/me", nil)
+		assert.NoError(t, err, "could not create http request")
+		req.Header.Set("Authorization", "Bearer member-token")
+		s := newAuthTestServer(t)
+		engine.GET("/v2/users/me", s.AuthMiddleware(), RequireRole(""), s.UsersV2MeGet)
+		engine.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, "expected status 200 from endpoint")
+		var user database.User
+		err = json.Unmarshal(w.Body.Bytes(), &user)
+		assert.NoError(t, err, "could not unmarshal user")
+		assert.Equal(t, "member", user.Username, "expected the token's user")
+		assert.Equal(t, `"member.1"`, w.Header().Get("ETag"), "expected the version of the user")
+	})
+
+	t.Run("not modified", func(t *testing.T) {
+		s := newAuthTestServer(t)
+		engine := gin.New()
+		engine.GET("/v2/users/me", s.AuthMiddleware(), RequireRole(""), s.UsersV2MeGet)
+		serve := func(ifNoneMatch string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/v2/users/me", nil)
+			req.Header.Set("Authorization", "Bearer member-token")
+			req.Header.Set("If-None-Match", ifNoneMatch)
+			engine.ServeHTTP(w, req)
+			return w
+		}
+		w := serve(`"member.1"`)
+		assert.Equal(t, http.StatusNotModified, w.Code, "expected status 304 for the current version")
+		assert.Empty(t, w.Body.String(), "expected no body")
+		assert.Equal(t, `"member.1"`, w.Header().Get("ETag"), "expected the version of the user")
+		w = serve(`"admin.1"`)
+		assert.Equal(t, http.StatusOK, w.Code, "expected status 200 for another user's version")
+	})
+}
+
+func TestUsersV2MePut(t *testing.T) {
+	s := newAuthTestServer(t)
+	engine := gin.New()
+	engine.PUT("/v2/users/me", s.AuthMiddleware(), RequireRole(""), s.UsersV2MePut)
+	serve := func(ifMatch, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, "/v2/users/me", bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer member-token")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		engine.ServeHTTP(w, req)
+		return w
+	}
+	problemType := func(t *testing.T, w *httptest.ResponseRecorder) string {
+		var problem helpers.Problem
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem), "could not unmarshal problem")
+		return problem.Type
+	}
+
+	t.Run("updates the user at the version given", func(t *testing.T) {
+		w := serve(`"member.1"`, `{"username":"member","email":"member@compsoc.ie","name":"Member"}`)
+		assert.Equal(t, http.StatusOK, w.Code, "expected status 200 from endpoint")
+		assert.Equal(t, `"member.2"`, w.Header().Get("ETag"), "expected the new version of the user")
+		var user database.User
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &user), "could not unmarshal user")
+		assert.Equal(t, "Member", user.Name, "expected the name to be changed")
+		assert.Equal(t, []string{database.RoleMember}, user.Roles, "expected the roles to be kept")
+	})
+
+	t.Run("rejects a stale version", func(t *testing.T) {
+		w := serve(`"member.1"`, `{"username":"member","email":"member@compsoc.ie","name":"Stale"}`)
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code, "expected status 412 from endpoint")
+		assert.Equal(t, helpers.ProblemTypePreconditionFailed, problemType(t, w), "unexpected problem")
+		user, err := s.Store.Users().Get(context.Background(), "member")
+		assert.NoError(t, err, "could not get user")
+		assert.Equal(t, "Member", user.Name, "expected the stale update not to be stored")
+	})
+
+	t.Run("updates without a version", func(t *testing.T) {
+		w := serve("", `{"username":"member","email":"member@compsoc.ie","name":"Member Again"}`)
+		assert.Equal(t, http.StatusOK, w.Code, "expected status 200 from endpoint")
+		assert.Equal(t, `"member.3"`, w.Header().Get("ETag"), "expected the new version of the user")
+	})
+
+	t.Run("rejects a taken username", func(t *testing.T) {
+		w := serve("", `{"username":"admin","email":"member@compsoc.ie","name":"Member"}`)
+		assert.Equal(t, http.StatusConflict, w.Code, "expected status 409 from endpoint")
+	})
+
+	t.Run("rejects invalid fields", func(t *testing.T) {
+		w := serve("", `{"username":"mem ber","email":"member","name":"Member"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code, "expected status 400 from endpoint")
+		assert.Equal(t, helpers.ProblemTypeValidation, problemType(t, w), "expected a validation problem")
+	})
+}
+
+func TestUsersV2Get(t *testing.T) {
+	s := newAuthTestServer(t)
+	for _, username := range []string{"alice", "bob", "carol"} {
+		err := s.Store.Users().Create(context.Background(), &database.User{
+			Username: username,
+			Email:    username + "@compsoc.ie",
+			Roles:    []string{database.RoleMember},
+		})
+		assert.NoError(t, err, "could not create user")
+	}
+	engine := gin.New()
+	engine.GET("/v2/users", s.AuthMiddleware(), RequireRole(database.RoleAdmin), s.UsersV2Get)
+	serve := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		engine.ServeHTTP(w, req)
+		return w
+	}
+	usernames := func(t *testing.T, w *httptest.ResponseRecorder) ([]string, string) {
+		var body helpers.Paginated[database.User]
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body), "could not unmarshal page")
+		usernames := []string{}
+		for _, user := range body.Items {
+			usernames = append(usernames, user.Username)
+		}
+		return usernames, body.NextCursor
+	}
+
+	t.Run("pages through users by username", func(t *testing.T) {
+		w := serve("/v2/users?limit=3")
+		assert.Equal(t, http.StatusOK, w.Code, "expected status 200 from endpoint")
+		page, next := usernames(t, w)
+		assert.Equal(t, []string{"admin", "alice", "bob"}, page, "unexpected first page")
+		assert.Contains(t, w.Header().Get("Link"), `rel="next"`, "expected a link to the next page")
+
+		w = serve("/v2/users?limit=3&cursor=" + next)
+		assert.Equal(t, http.StatusOK, w.Code, "expected status 200 from endpoint")
+		page, next = usernames(t, w)
+		assert.Equal(t, []string{"carol", "member"}, page, "unexpected last page")
+		assert.Empty(t, next, "expected no next page")
+	})
+
+	t.Run("filters and sorts users", func(t *testing.T) {
+		w := serve("/v2/users?filter[roles]=member&filter[username][ne]=member&sort=-username")
+		assert.Equal(t, http.StatusOK, w.Code, "expected status 200 from endpoint")
+		page, _ := usernames(t, w)
+		assert.Equal(t, []string{"carol", "bob", "alice"}, page, "unexpected users")
+	})
+
+	t.Run("rejects invalid query parameters", func(t *testing.T) {
+		w := serve("/v2/users?filter[password]=hunter2")
+		assert.Equal(t, http.StatusBadRequest, w.Code, "expected status 400 from endpoint")
+		var problem helpers.Problem
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem), "could not unmarshal problem")
+		assert.Equal(t, helpers.ProblemTypeValidation, problem.Type, "expected a validation problem")
+		if assert.Len(t, problem.Errors, 1, "expected one invalid parameter") {
+			assert.Equal(t, "filter[password]", problem.Errors[0].Field, "unexpected invalid parameter")
+		}
+	})
+}
+
+func TestUsersV2MePatch(t *testing.T) {
+	s := newAuthTestServer(t)
+	engine := gin.New()
+	engine.PATCH("/v2/users/me", s.AuthMiddleware(), RequireRole(""), s.UsersV2MePatch)
+	serve := func(contentType, ifMatch, patch string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPatch, "/v2/users/me", bytes.NewBufferString(patch))
+		req.Header.Set("Authorization", "Bearer member-token")
+		req.Header.Set("Content-Type", contentType)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		engine.ServeHTTP(w, req)
+		return w
+	}
+	stored := func(t *testing.T) *database.User {
+		user, err := s.Store.Users().Get(context.Background(), "member")
+		assert.NoError(t, err, "could not get user")
+		return user
+	}
+
+	t.Run("merge patch", func(t *testing.T) {
+		w := serve(helpers.MergePatchContentType, `"member.1"`, `{"name":"Merged"}`)
+		assert.Equal(t, http.StatusOK, w.Code, "expected status 200 from endpoint")
+		assert.Equal(t, `"member.2"`, w.Header().Get("ETag"), "expected the new version of the user")
+		user := stored(t)
+		assert.Equal(t, "Merged", user.Name, "expected the name to be changed")
+		assert.Equal(t, "member", user.Username, "expected the username to be kept")
+	})
+
+	t.Run("json patch", func(t *testing.T) {
+		w := serve(helpers.JSONPatchContentType, "", `[{"op":"test","path":"/name","value":"Merged"},{"op":"replace","path":"/email","value":"patched@compsoc.ie"}]`)
+		assert.Equal(t, http.StatusOK, w.Code, "expected status 200 from endpoint")
+		assert.Equal(t, "patched@compsoc.ie", stored(t).Email, "expected the email to be changed")
+	})
+
+	t.Run("rejects a stale version", func(t *testing.T) {
+		w := serve(helpers.MergePatchContentType, `"member.1"`, `{"name":"Stale"}`)
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code, "expected status 412 from endpoint")
+	})
+
+	t.Run("rejects changes to the roles", func(t *testing.T) {
+		w := serve(helpers.JSONPatchContentType, "", `[{"op":"add","path":"/roles/-","value":"admin"}]`)
+		assert.Equal(t, http.StatusBadRequest, w.Code, "expected status 400 from endpoint")
+		var problem helpers.Problem
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem), "could not unmarshal problem")
+		if assert.Len(t, problem.Errors, 1, "expected one read only field") {
+			assert.Equal(t, "roles", problem.Errors[0].Field, "expected the roles to be read only")
+		}
+		assert.False(t, stored(t).HasRole(database.RoleAdmin), "expected the user not to become an admin")
+	})
+
+	t.Run("rejects invalid fields", func(t *testing.T) {
+		w := serve(helpers.MergePatchContentType, "", `{"email":"not an email","username":null}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code, "expected status 400 from endpoint")
+		var problem helpers.Problem
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem), "could not unmarshal problem")
+		assert.Len(t, problem.Errors, 2, "expected both fields to be invalid")
+	})
+
+	t.Run("rejects other media types", func(t *testing.T) {
+		w := serve("application/json", "", `{"name":"Json"}`)
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code, "expected status 415 from endpoint")
+	})
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ugcompsoc/apid/internal/config"
+	h "github.com/ugcompsoc/apid/internal/helpers"
+	"github.com/ugcompsoc/apid/internal/logging"
+	"github.com/ugcompsoc/apid/internal/services/database"
+)
+
+// featureFlagsRefreshInterval is how long the overrides are kept before they
+// are loaded from the store again, so those set through the admin listener of
+// another replica take effect
+const featureFlagsRefreshInterval = 30 * time.Second
+
+// FeatureFlagSet decides whether features are enabled for a user, from the
+// configured flags and the overrides kept in the store. A user's own override
+// wins over those of their roles, and a role turning a flag on wins over
+// another turning it off.
+type FeatureFlagSet struct {
+	configured config.FeatureFlags
+	store      database.FeatureFlagRepository
+
+	// refreshing is held while the overrides are loaded, so only one
+	// request loads them at a time
+	refreshing sync.Mutex
+	mu         sync.RWMutex
+	overrides  map[string]bool
+	loadedAt   time.Time
+}
+
+// NewFeatureFlagSet returns the flags described by config, with the overrides
+// kept in the store given
+func NewFeatureFlagSet(c config.FeatureFlags, store database.FeatureFlagRepository) *FeatureFlagSet {
+	return &FeatureFlagSet{configured: c, store: store}
+}
+
+// Enabled reports whether the flag is enabled for the user, which is nil for
+// anonymous requests. A nil FeatureFlagSet has every flag disabled. The
+// overrides last loaded are used if they can't be loaded again.
+func (f *FeatureFlagSet) Enabled(ctx context.Context, flag string, user *database.User) bool {
+	if f == nil {
+		return false
+	}
+	overrides := f.load(ctx)
+	if user != nil {
+		if enabled, ok := overrides[database.FeatureFlagOverrideID(flag, database.FeatureFlagOverrideUser, user.ID)]; ok {
+			return enabled
+		}
+		overridden := false
+		for _, role := range user.Roles {
+			if enabled, ok := overrides[database.FeatureFlagOverrideID(flag, database.FeatureFlagOverrideRole, role)]; ok {
+				if enabled {
+					return true
+				}
+				overridden = true
+			}
+		}
+		if overridden {
+			return false
+		}
+	}
+	return f.configured[flag].Enabled
+}
+
+// load returns the overrides by ID, loading them from the store if they are
+// older than featureFlagsRefreshInterval
+func (f *FeatureFlagSet) load(ctx context.Context) map[string]bool {
+	f.mu.RLock()
+	overrides, loadedAt := f.overrides, f.loadedAt
+	f.mu.RUnlock()
+	if time.Since(loadedAt) < featureFlagsRefreshInterval {
+		return overrides
+	}
+
+	f.refreshing.Lock()
+	defer f.refreshing.Unlock()
+	f.mu.RLock()
+	overrides, loadedAt = f.overrides, f.loadedAt
+	f.mu.RUnlock()
+	if time.Since(loadedAt) < featureFlagsRefreshInterval {
+		// loaded by another request while this one waited
+		return overrides
+	}
+	if err := f.Refresh(ctx); err != nil {
+		logging.Subsystem(ctx, config.LogSubsystemDatabase).Error().Err(err).
+			Msg("failed to load feature flag overrides, using the last ones loaded")
+		// the store isn't tried again until the next refresh, rather than by
+		// every request while it is down
+		f.mu.Lock()
+		f.loadedAt = time.Now()
+		f.mu.Unlock()
+		return overrides
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.overrides
+}
+
+// Refresh loads the overrides from the store now
+func (f *FeatureFlagSet) Refresh(ctx context.Context) error {
+	list, err := f.store.List(ctx)
+	if err != nil {
+		return err
+	}
+	overrides := make(map[string]bool, len(list))
+	for _, override := range list {
+		overrides[override.ID] = override.Enabled
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.overrides = overrides
+	f.loadedAt = time.Now()
+	return nil
+}
+
+// invalidate has the overrides loaded again by the next request
+func (f *FeatureFlagSet) invalidate() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.loadedAt = time.Time{}
+}
+
+// Set turns the flag on or off for the subject, a user ID or role
+func (f *FeatureFlagSet) Set(ctx context.Context, flag, kind, subject string, enabled bool) error {
+	override := &database.FeatureFlagOverride{Flag: flag, Kind: kind, Subject: subject, Enabled: enabled}
+	if err := f.store.Set(ctx, override); err != nil {
+		return err
+	}
+	f.invalidate()
+	return nil
+}
+
+// Delete removes the override of the flag for the subject, it returns
+// database.ErrNotFound if there isn't one
+func (f *FeatureFlagSet) Delete(ctx context.Context, flag, kind, subject string) error {
+	if err := f.store.Delete(ctx, flag, kind, subject); err != nil {
+		return err
+	}
+	f.invalidate()
+	return nil
+}
+
+// Status returns every flag with its overrides, loaded from the store now
+func (f *FeatureFlagSet) Status(ctx context.Context) ([]h.FeatureFlag, error) {
+	list, err := f.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	flags := make([]h.FeatureFlag, 0, len(config.FeatureFlagNames))
+	byName := map[string]*h.FeatureFlag{}
+	for _, name := range config.FeatureFlagNames {
+		flags = append(flags, h.FeatureFlag{
+			Name:        name,
+			Description: f.configured[name].Description,
+			Enabled:     f.configured[name].Enabled,
+		})
+		byName[name] = &flags[len(flags)-1]
+	}
+	for _, override := range list {
+		flag, ok := byName[override.Flag]
+		if !ok {
+			// left behind by a flag that has since been removed
+			continue
+		}
+		switch override.Kind {
+		case database.FeatureFlagOverrideUser:
+			if flag.Users == nil {
+				flag.Users = map[string]bool{}
+			}
+			flag.Users[override.Subject] = override.Enabled
+		case database.FeatureFlagOverrideRole:
+			if flag.Roles == nil {
+				flag.Roles = map[string]bool{}
+			}
+			flag.Roles[override.Subject] = override.Enabled
+		}
+	}
+	return flags, nil
+}
+
+// FeatureEnabled reports whether the flag is enabled for the user making the
+// request, so handlers can branch on it
+func (s *Server) FeatureEnabled(c *gin.Context, flag string) bool {
+	return s.FeatureFlags.Enabled(c.Request.Context(), flag, CurrentUser(c))
+}
+
+/*
+ * This middleware hides routes behind a feature flag. Requests from users the flag is disabled for get the same 404 as
+ * a route that doesn't exist, so features can be shipped before they are announced. It must be used after
+ * AuthMiddleware so the flag can be overridden for the user and their roles.
+ */
+func (s *Server) FeatureFlagMiddleware(flag string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.FeatureEnabled(c, flag) {
+			c.Next()
+			return
+		}
+		// the response gin gives requests that don't match a route
+		c.Header("Content-Type", "text/plain")
+		c.String(http.StatusNotFound, "404 page not found")
+		c.Abort()
+	}
+}
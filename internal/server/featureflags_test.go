@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/ugcompsoc/apid/internal/config"
+	"github.com/ugcompsoc/apid/internal/services/database"
+	"github.com/ugcompsoc/apid/internal/services/database/memory"
+)
+
+func TestFeatureFlagSet(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	flags := NewFeatureFlagSet(config.FeatureFlags{
+		config.FeatureFlagVMProvisioning: {Enabled: true},
+	}, store.FeatureFlags())
+	set := func(flag, kind, subject string, enabled bool) {
+		assert.NoError(t, flags.Set(ctx, flag, kind, subject, enabled), "could not set override")
+	}
+	set(config.FeatureFlagElections, database.FeatureFlagOverrideRole, database.RoleCommittee, true)
+	set(config.FeatureFlagElections, database.FeatureFlagOverrideRole, database.RoleMember, false)
+	set(config.FeatureFlagElections, database.FeatureFlagOverrideUser, "3", false)
+	set(config.FeatureFlagVMProvisioning, database.FeatureFlagOverrideUser, "2", false)
+
+	runs := []struct {
+		name     string
+		flag     string
+		user     *database.User
+		expected bool
+	}{
+		{name: "configured flag for an anonymous request", flag: config.FeatureFlagVMProvisioning, expected: true},
+		{name: "flag that isn't configured", flag: config.FeatureFlagElections, expected: false},
+		{name: "flag turned on for a role", flag: config.FeatureFlagElections, user: &database.User{Meta: database.Meta{ID: "1"}, Roles: []string{database.RoleCommittee}}, expected: true},
+		{name: "role turning the flag on over another turning it off", flag: config.FeatureFlagElections, user: &database.User{Meta: database.Meta{ID: "1"}, Roles: []string{database.RoleMember, database.RoleCommittee}}, expected: true},
+		{name: "flag turned off for a role", flag: config.FeatureFlagElections, user: &database.User{Meta: database.Meta{ID: "1"}, Roles: []string{database.RoleMember}}, expected: false},
+		{name: "user override over their roles", flag: config.FeatureFlagElections, user: &database.User{Meta: database.Meta{ID: "3"}, Roles: []string{database.RoleCommittee}}, expected: false},
+		{name: "user override over config", flag: config.FeatureFlagVMProvisioning, user: &database.User{Meta: database.Meta{ID: "2"}}, expected: false},
+		{name: "configured flag for a user without overrides", flag: config.FeatureFlagVMProvisioning, user: &database.User{Meta: database.Meta{ID: "1"}}, expected: true},
+	}
+
+	for _, run := range runs {
+		run := run
+		t.Run("check "+run.name, func(t *testing.T) {
+			assert.Equal(t, run.expected, flags.Enabled(ctx, run.flag, run.user), "unexpected flag state")
+		})
+	}
+
+	t.Run("check removed overrides are no longer used", func(t *testing.T) {
+		assert.NoError(t, flags.Delete(ctx, config.FeatureFlagVMProvisioning, database.FeatureFlagOverrideUser, "2"), "could not delete override")
+		assert.True(t, flags.Enabled(ctx, config.FeatureFlagVMProvisioning, &database.User{Meta: database.Meta{ID: "2"}}), "expected the configured state")
+		err := flags.Delete(ctx, config.FeatureFlagVMProvisioning, database.FeatureFlagOverrideUser, "2")
+		assert.ErrorIs(t, err, database.ErrNotFound, "expected a missing override not to be found")
+	})
+
+	t.Run("check overrides set by another replica are loaded once stale", func(t *testing.T) {
+		user := &database.User{Meta: database.Meta{ID: "4"}}
+		assert.False(t, flags.Enabled(ctx, config.FeatureFlagElections, user), "expected the flag to be off")
+		override := &database.FeatureFlagOverride{Flag: config.FeatureFlagElections, Kind: database.FeatureFlagOverrideUser, Subject: "4", Enabled: true}
+		assert.NoError(t, store.FeatureFlags().Set(ctx, override), "could not set override")
+		assert.False(t, flags.Enabled(ctx, config.FeatureFlagElections, user), "expected the loaded overrides to be used")
+		flags.loadedAt = flags.loadedAt.Add(-featureFlagsRefreshInterval)
+		assert.True(t, flags.Enabled(ctx, config.FeatureFlagElections, user), "expected the overrides to be loaded again")
+	})
+
+	t.Run("check the last overrides are used when the store is down", func(t *testing.T) {
+		assert.NoError(t, store.Close(ctx), "could not close store")
+		flags.loadedAt = time.Time{}
+		user := &database.User{Meta: database.Meta{ID: "1"}, Roles: []string{database.RoleCommittee}}
+		assert.True(t, flags.Enabled(ctx, config.FeatureFlagElections, user), "expected the last overrides loaded")
+		assert.WithinDuration(t, time.Now(), flags.loadedAt, time.Second, "expected the store not to be tried again until the next refresh")
+	})
+
+	t.Run("check a nil set has every flag disabled", func(t *testing.T) {
+		var missing *FeatureFlagSet
+		assert.False(t, missing.Enabled(ctx, config.FeatureFlagVMProvisioning, nil), "expected the flag to be off")
+	})
+}
+
+func TestFeatureFlagMiddleware(t *testing.T) {
+	store := memory.NewStore()
+	s := &Server{FeatureFlags: NewFeatureFlagSet(config.FeatureFlags{}, store.FeatureFlags())}
+	err := s.FeatureFlags.Set(context.Background(), config.FeatureFlagElections, database.FeatureFlagOverrideRole, database.RoleCommittee, true)
+	assert.NoError(t, err, "could not set override")
+
+	newRouter := func(user *database.User) *gin.Engine {
+		r := gin.New()
+		r.Use(func(c *gin.Context) {
+			if user != nil {
+				c.Set(userContextKey, user)
+			}
+		})
+		r.GET("/v2/elections", s.FeatureFlagMiddleware(config.FeatureFlagElections), func(c *gin.Context) {
+			c.String(http.StatusOK, "elections")
+		})
+		r.GET("/v2/events", func(c *gin.Context) {
+			if s.FeatureEnabled(c, config.FeatureFlagElections) {
+				c.String(http.StatusOK, "events and elections")
+				return
+			}
+			c.String(http.StatusOK, "events")
+		})
+		return r
+	}
+	missing := httptest.NewRecorder()
+	newRouter(nil).ServeHTTP(missing, httptest.NewRequest(http.MethodGet, "/v2/unknown", nil))
+
+	runs := []struct {
+		name   string
+		user   *database.User
+		path   string
+		status int
+		body   string
+	}{
+		{name: "hidden route for an anonymous request", path: "/v2/elections", status: http.StatusNotFound, body: missing.Body.String()},
+		{name: "hidden route for a member", user: &database.User{Roles: []string{database.RoleMember}}, path: "/v2/elections", status: http.StatusNotFound, body: missing.Body.String()},
+		{name: "route for the committee", user: &database.User{Roles: []string{database.RoleCommittee}}, path: "/v2/elections", status: http.StatusOK, body: "elections"},
+		{name: "handler branching for a member", user: &database.User{Roles: []string{database.RoleMember}}, path: "/v2/events", status: http.StatusOK, body: "events"},
+		{name: "handler branching for the committee", user: &database.User{Roles: []string{database.RoleCommittee}}, path: "/v2/events", status: http.StatusOK, body: "events and elections"},
+	}
+
+	for _, run := range runs {
+		run := run
+		t.Run("check "+run.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			newRouter(run.user).ServeHTTP(w, httptest.NewRequest(http.MethodGet, run.path, nil))
+			assert.Equal(t, run.status, w.Code, "unexpected status")
+			assert.Equal(t, run.body, w.Body.String(), "unexpected body")
+			if run.status == http.StatusNotFound {
+				assert.Equal(t, missing.Header().Get("Content-Type"), w.Header().Get("Content-Type"), "expected the response of a missing route")
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ugcompsoc/apid/internal/helpers"
+)
+
+// Probe identifies which of the liveness, readiness and startup probes a
+// health check contributes to. A check can contribute to more than one probe.
+type Probe uint8
+
+const (
+	ProbeLiveness Probe = 1 << iota
+	ProbeReadiness
+	ProbeStartup
+)
+
+const (
+	HealthStatusUp   = "up"
+	HealthStatusDown = "down"
+)
+
+const (
+	defaultHealthCheckTimeout  = 2 * time.Second
+	defaultHealthCheckCacheTTL = 5 * time.Second
+)
+
+// HealthCheckFunc should return nil when the component is healthy. The context
+// given will be cancelled once the check's timeout has passed.
+type HealthCheckFunc func(ctx context.Context) error
+
+// HealthCheck describes a check a subsystem (datastore, job workers, mail,
+// provisioners, etc.) registers with the HealthRegistry
+type HealthCheck struct {
+	Name     string
+	Probes   Probe
+	Timeout  time.Duration
+	CacheTTL time.Duration
+	Check    HealthCheckFunc
+}
+
+type healthEntry struct {
+	check     HealthCheck
+	mu        sync.Mutex
+	result    helpers.ComponentHealth
+	lastError string
+}
+
+// HealthRegistry holds all of the registered health checks and caches their
+// results so that probes hammering the API don't hammer the subsystems too
+type HealthRegistry struct {
+	mu      sync.RWMutex
+	entries []*healthEntry
+	started atomic.Bool
+}
+
+// NewHealthRegistry returns an empty HealthRegistry
+func NewHealthRegistry() *HealthRegistry {
+	return &HealthRegistry{}
+}
+
+// Register adds a health check to the registry, a default timeout and cache
+// TTL is used if none are given
+func (r *HealthRegistry) Register(check HealthCheck) error {
+	if check.Name == "" {
+		return errors.New("health check must have a name")
+	}
+	if check.Check == nil {
+		return fmt.Errorf("health check %s has no check function", check.Name)
+	}
+	if check.Probes == 0 {
+		return fmt.Errorf("health check %s is not part of any probe", check.Name)
+	}
+	if check.Timeout <= 0 {
+		check.Timeout = defaultHealthCheckTimeout
+	}
+	if check.CacheTTL < 0 {
+		check.CacheTTL = 0
+	} else if check.CacheTTL == 0 {
+		check.CacheTTL = defaultHealthCheckCacheTTL
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range r.entries {
+		if e.check.Name == check.Name {
+			return fmt.Errorf("health check %s is already registered", check.Name)
+		}
+	}
+	r.entries = append(r.entries, &healthEntry{check: check})
+	return nil
+}
+
+// MarkStarted flags that the server has finished starting up, the startup
+// probe will fail until this is called
+func (r *HealthRegistry) MarkStarted() {
+	r.started.Store(true)
+}
+
+// Started reports whether MarkStarted has been called
+func (r *HealthRegistry) Started() bool {
+	return r.started.Load()
+}
+
+// Run executes (or returns the cached result of) every check in the probe
+// given. Checks are ran concurrently, each with their own timeout.
+func (r *HealthRegistry) Run(ctx context.Context, probe Probe) helpers.HealthReport {
+	r.mu.RLock()
+	entries := []*healthEntry{}
+	for _, e := range r.entries {
+		if e.check.Probes&probe != 0 {
+			entries = append(entries, e)
+		}
+	}
+	r.mu.RUnlock()
+
+	components := make([]helpers.ComponentHealth, len(entries))
+	var wg sync.WaitGroup
+	for i, e := range entries {
+		wg.Add(1)
+		go func(i int, e *healthEntry) {
+			defer wg.Done()
+			components[i] = e.run(ctx)
+		}(i, e)
+	}
+	wg.Wait()
+
+	report := helpers.HealthReport{
+		Status:     HealthStatusUp,
+		Components: components,
+	}
+	for _, c := range components {
+		if c.Status != HealthStatusUp {
+			report.Status = HealthStatusDown
+		}
+	}
+	if probe&ProbeStartup != 0 && !r.Started() {
+		report.Status = HealthStatusDown
+	}
+	return report
+}
+
+func (e *healthEntry) run(ctx context.Context) helpers.ComponentHealth {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.result.CheckedAt.IsZero() && time.Since(e.result.CheckedAt) < e.check.CacheTTL {
+		return e.result
+	}
+
+	// the check's deadline is its own rather than the request's, so a client
+	// with a shorter deadline can't fail the check before its timeout
+	checkCtx, cancel := context.WithTimeout(valuesContext{ctx}, e.check.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := runCheck(ctx, checkCtx, e.check.Check)
+	result := helpers.ComponentHealth{
+		Name:      e.check.Name,
+		Status:    HealthStatusUp,
+		LatencyNs: time.Since(start).Nanoseconds(),
+		CheckedAt: start,
+	}
+	if err != nil && ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		// the caller gave up waiting, which says nothing about the
+		// component, so the result is neither cached nor kept as its error
+		result.Status = HealthStatusDown
+		result.LastError = err.Error()
+		return result
+	}
+	if err != nil {
+		result.Status = HealthStatusDown
+		e.lastError = err.Error()
+	}
+	result.LastError = e.lastError
+	e.result = result
+	return result
+}
+
+// runCheck stops waiting on a check once its context is done, in case the
+// check itself does not respect the context, or once the caller's context is
+func runCheck(ctx, checkCtx context.Context, check HealthCheckFunc) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- check(checkCtx)
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-checkCtx.Done():
+		return fmt.Errorf("health check timed out: %w", checkCtx.Err())
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// valuesContext keeps the values of a context, such as its trace, without
+// its deadline or cancellation
+type valuesContext struct {
+	context.Context
+}
+
+func (valuesContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (valuesContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (valuesContext) Err() error {
+	return nil
+}
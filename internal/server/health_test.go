@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthRegistryRegister(t *testing.T) {
+	noop := func(ctx context.Context) error { return nil }
+
+	runs := []struct {
+		name  string
+		check HealthCheck
+		err   string
+	}{
+		{
+			name:  "check without a name",
+			check: HealthCheck{Probes: ProbeLiveness, Check: noop},
+			err:   "health check must have a name",
+		},
+		{
+			name:  "check without a function",
+			check: HealthCheck{Name: "database", Probes: ProbeLiveness},
+			err:   "health check database has no check function",
+		},
+		{
+			name:  "check without a probe",
+			check: HealthCheck{Name: "database", Check: noop},
+			err:   "health check database is not part of any probe",
+		},
+	}
+
+	for _, run := range runs {
+		t.Run(run.name, func(t *testing.T) {
+			r := NewHealthRegistry()
+			err := r.Register(run.check)
+			assert.EqualError(t, err, run.err, "unexpected registration error")
+		})
+	}
+
+	t.Run("check names must be unique", func(t *testing.T) {
+		r := NewHealthRegistry()
+		err := r.Register(HealthCheck{Name: "database", Probes: ProbeReadiness, Check: noop})
+		assert.NoError(t, err, "expected first registration to succeed")
+		err = r.Register(HealthCheck{Name: "database", Probes: ProbeReadiness, Check: noop})
+		assert.EqualError(t, err, "health check database is already registered", "expected duplicate to be rejected")
+	})
+
+	t.Run("defaults are applied", func(t *testing.T) {
+		r := NewHealthRegistry()
+		err := r.Register(HealthCheck{Name: "database", Probes: ProbeReadiness, Check: noop})
+		assert.NoError(t, err, "expected registration to succeed")
+		assert.Equal(t, defaultHealthCheckTimeout, r.entries[0].check.Timeout, "expected default timeout")
+		assert.Equal(t, defaultHealthCheckCacheTTL, r.entries[0].check.CacheTTL, "expected default cache TTL")
+	})
+}
+
+func TestHealthRegistryRun(t *testing.T) {
+	t.Run("only checks in the probe are ran", func(t *testing.T) {
+		r := NewHealthRegistry()
+		var calls int32
+		err := r.Register(HealthCheck{
+			Name:   "mail",
+			Probes: ProbeLiveness,
+			Check: func(ctx context.Context) error {
+				atomic.AddInt32(&calls, 1)
+				return nil
+			},
+		})
+		assert.NoError(t, err, "could not register check")
+		report := r.Run(context.Background(), ProbeReadiness)
+		assert.Equal(t, HealthStatusUp, report.Status, "expected empty probe to be up")
+		assert.Len(t, report.Components, 0, "expected no components in report")
+		assert.Equal(t, int32(0), atomic.LoadInt32(&calls), "expected check to not be ran")
+	})
+
+	t.Run("results are cached", func(t *testing.T) {
+		r := NewHealthRegistry()
+		var calls int32
+		err := r.Register(HealthCheck{
+			Name:     "database",
+			Probes:   ProbeReadiness,
+			CacheTTL: time.Minute,
+			Check: func(ctx context.Context) error {
+				atomic.AddInt32(&calls, 1)
+				return nil
+			},
+		})
+		assert.NoError(t, err, "could not register check")
+		r.Run(context.Background(), ProbeReadiness)
+		r.Run(context.Background(), ProbeReadiness)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "expected check to be ran once")
+	})
+
+	t.Run("negative cache TTL disables caching", func(t *testing.T) {
+		r := NewHealthRegistry()
+		var calls int32
+		err := r.Register(HealthCheck{
+			Name:     "database",
+			Probes:   ProbeReadiness,
+			CacheTTL: -1,
+			Check: func(ctx context.Context) error {
+				atomic.AddInt32(&calls, 1)
+				return nil
+			},
+		})
+		assert.NoError(t, err, "could not register check")
+		r.Run(context.Background(), ProbeReadiness)
+		r.Run(context.Background(), ProbeReadiness)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls), "expected check to be ran twice")
+	})
+
+	t.Run("checks that exceed their timeout are down", func(t *testing.T) {
+		r := NewHealthRegistry()
+		err := r.Register(HealthCheck{
+			Name:    "provisioner",
+			Probes:  ProbeReadiness,
+			Timeout: 10 * time.Millisecond,
+			Check: func(ctx context.Context) error {
+				time.Sleep(time.Second)
+				return nil
+			},
+		})
+		assert.NoError(t, err, "could not register check")
+		report := r.Run(context.Background(), ProbeReadiness)
+		assert.Equal(t, HealthStatusDown, report.Status, "expected probe to be down")
+		assert.Contains(t, report.Components[0].LastError, "health check timed out", "expected timeout error")
+	})
+
+	t.Run("callers giving up don't fail the check for others", func(t *testing.T) {
+		r := NewHealthRegistry()
+		err := r.Register(HealthCheck{
+			Name:     "database",
+			Probes:   ProbeReadiness,
+			Timeout:  time.Second,
+			CacheTTL: time.Minute,
+			Check: func(ctx context.Context) error {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(20 * time.Millisecond):
+					return nil
+				}
+			},
+		})
+		assert.NoError(t, err, "could not register check")
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		defer cancel()
+		report := r.Run(ctx, ProbeReadiness)
+		assert.Equal(t, HealthStatusDown, report.Status, "expected the caller that gave up to see the probe down")
+
+		report = r.Run(context.Background(), ProbeReadiness)
+		assert.Equal(t, HealthStatusUp, report.Status, "expected the result of the caller that gave up not to be cached")
+		assert.Empty(t, report.Components[0].LastError, "expected the caller giving up not to be kept as an error")
+	})
+
+	t.Run("checks keep the values of the request", func(t *testing.T) {
+		type key struct{}
+		r := NewHealthRegistry()
+		var value interface{}
+		err := r.Register(HealthCheck{
+			Name:   "database",
+			Probes: ProbeReadiness,
+			Check: func(ctx context.Context) error {
+				value = ctx.Value(key{})
+				return nil
+			},
+		})
+		assert.NoError(t, err, "could not register check")
+		r.Run(context.WithValue(context.Background(), key{}, "trace"), ProbeReadiness)
+		assert.Equal(t, "trace", value, "expected the check to have the request's values")
+	})
+
+	t.Run("last error is kept after recovery", func(t *testing.T) {
+		r := NewHealthRegistry()
+		var failing atomic.Bool
+		failing.Store(true)
+		err := r.Register(HealthCheck{
+			Name:     "database",
+			Probes:   ProbeReadiness,
+			CacheTTL: -1,
+			Check: func(ctx context.Context) error {
+				if failing.Load() {
+					return errors.New("cannot ping database")
+				}
+				return nil
+			},
+		})
+		assert.NoError(t, err, "could not register check")
+		report := r.Run(context.Background(), ProbeReadiness)
+		assert.Equal(t, HealthStatusDown, report.Components[0].Status, "expected component to be down")
+		failing.Store(false)
+		report = r.Run(context.Background(), ProbeReadiness)
+		assert.Equal(t, HealthStatusUp, report.Components[0].Status, "expected component to be up")
+		assert.Equal(t, "cannot ping database", report.Components[0].LastError, "expected last error to be kept")
+	})
+
+	t.Run("startup probe is down until started", func(t *testing.T) {
+		r := NewHealthRegistry()
+		report := r.Run(context.Background(), ProbeStartup)
+		assert.Equal(t, HealthStatusDown, report.Status, "expected startup probe to be down")
+		r.MarkStarted()
+		report = r.Run(context.Background(), ProbeStartup)
+		assert.Equal(t, HealthStatusUp, report.Status, "expected startup probe to be up")
+	})
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ugcompsoc/apid/internal/config"
+	h "github.com/ugcompsoc/apid/internal/helpers"
+	"github.com/ugcompsoc/apid/internal/logging"
+	"github.com/ugcompsoc/apid/internal/services/database"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+)
+
+// idempotencyRecordTimeout is how long the response to an idempotent request
+// has to be stored once the handler is done, or its key released
+var idempotencyRecordTimeout = 5 * time.Second
+
+// idempotencyHeaders are the headers of a response that are replayed with
+// it, the others describe the request they were sent for
+var idempotencyHeaders = []string{"Content-Type", "Location", "ETag", "Last-Modified"}
+
+// recordingWriter keeps a copy of the body written, so it can be stored
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+/*
+ * This middleware makes requests with an Idempotency-Key header safe to retry. The response to the first request with
+ * a key is kept for the configured TTL and replayed to later requests with it, so a client retrying a request that
+ * timed out doesn't have it done twice. Keys are scoped to the user, or to the client IP of anonymous requests.
+ * Reusing a key for another request, or while the first is still being handled, is a conflict. Server errors and
+ * rate limited responses aren't kept so the request can be retried. Safe methods and requests without the header
+ * are let through untouched.
+ */
+func (s *Server) IdempotencyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			key = ""
+		}
+		if key == "" {
+			c.Next()
+			return
+		}
+		if !validIdempotencyKey(key) {
+			h.RespondWithProblem(c, h.NewValidationProblem(h.ProblemField{
+				Field:   IdempotencyKeyHeader,
+				Reason:  "format",
+				Message: "Idempotency-Key must be at most 255 printable ASCII characters",
+			}))
+			c.Abort()
+			return
+		}
+
+		ctx := c.Request.Context()
+		logger := logging.Subsystem(ctx, config.LogSubsystemHTTP)
+		body, err := io.ReadAll(c.Request.Body)
+		if limit, ok := h.BodyTooLarge(err); ok {
+			h.RespondWithBodyTooLarge(c, limit)
+			c.Abort()
+			return
+		}
+		if err != nil {
+			h.RespondWithError(c, errors.New("the body could not be read"), http.StatusBadRequest)
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		now := database.Now()
+		record := &database.IdempotencyRecord{
+			Key:         rateLimitKey(c, config.RateLimitKeyUser) + ":" + key,
+			RequestHash: requestHash(c.Request, body),
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(s.Config.Idempotency.GetTTL()),
+		}
+		existing, created, err := s.Store.Idempotency().Begin(ctx, record)
+		if err != nil {
+			// the request can't be let through, as it may already have been
+			// done
+			logger.Error().Err(err).Msg("failed to begin an idempotent request")
+			h.RespondWithError(c, errors.New("the idempotency key could not be checked, try again later"), http.StatusServiceUnavailable)
+			c.Abort()
+			return
+		}
+		if !created {
+			replayIdempotent(c, existing, record.RequestHash)
+			c.Abort()
+			return
+		}
+
+		// the request is over once the handler is done, so it may have been
+		// cancelled by the time the record is stored. The timeout starts once
+		// the handler is done, however long it took.
+		release := func() {
+			storeCtx, cancel := context.WithTimeout(context.Background(), idempotencyRecordTimeout)
+			defer cancel()
+			if err := s.Store.Idempotency().Release(storeCtx, record.Key); err != nil {
+				logger.Error().Err(err).Msg("failed to release an idempotency key")
+			}
+		}
+
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		handled := false
+		defer func() {
+			// the handler panicked, so the key is released before the
+			// recovery middleware responds
+			if !handled {
+				release()
+			}
+		}()
+		c.Next()
+		handled = true
+		c.Writer = writer.ResponseWriter
+
+		status := writer.Status()
+		if status >= http.StatusInternalServerError || status == http.StatusTooManyRequests {
+			release()
+			return
+		}
+		record.Status = status
+		record.Header = map[string][]string{}
+		for _, name := range idempotencyHeaders {
+			if values := writer.Header().Values(name); len(values) != 0 {
+				record.Header[name] = values
+			}
+		}
+		record.Body = writer.body.Bytes()
+		storeCtx, cancel := context.WithTimeout(context.Background(), idempotencyRecordTimeout)
+		defer cancel()
+		if err := s.Store.Idempotency().Complete(storeCtx, record); err != nil {
+			logger.Error().Err(err).Msg("failed to store the response to an idempotent request")
+		}
+	}
+}
+
+// replayIdempotent responds to a request with a key that has been used, with
+// the response to the first request with it if it was the same request
+func replayIdempotent(c *gin.Context, record *database.IdempotencyRecord, hash string) {
+	if record.RequestHash != hash {
+		h.RespondWithError(c, errors.New("the idempotency key has already been used for a different request"), http.StatusConflict)
+		return
+	}
+	if !record.Completed {
+		h.RespondWithError(c, errors.New("a request with the idempotency key is still being handled, try again later"), http.StatusConflict)
+		return
+	}
+	header := c.Writer.Header()
+	for name, values := range record.Header {
+		header[name] = values
+	}
+	header.Set(IdempotentReplayedHeader, "true")
+	c.Writer.WriteHeader(record.Status)
+	c.Writer.Write(record.Body)
+}
+
+// validIdempotencyKey reports whether the key is short enough to store and
+// only has printable ASCII characters
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < ' ' || key[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// requestHash identifies a request by its method, path, query and body
+func requestHash(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	h "github.com/ugcompsoc/apid/internal/helpers"
+	"github.com/ugcompsoc/apid/internal/services/database"
+	"github.com/ugcompsoc/apid/internal/services/database/memory"
+)
+
+const panicStatus = -1
+
+type failingIdempotencyStore struct {
+	*memory.Store
+}
+
+func (failingIdempotencyStore) Idempotency() database.IdempotencyRepository {
+	return failingIdempotency{}
+}
+
+type failingIdempotency struct{}
+
+func (failingIdempotency) Begin(ctx context.Context, record *database.IdempotencyRecord) (*database.IdempotencyRecord, bool, error) {
+	return nil, false, errors.New("store is down")
+}
+
+func (failingIdempotency) Complete(ctx context.Context, record *database.IdempotencyRecord) error {
+	return errors.New("store is down")
+}
+
+func (failingIdempotency) Release(ctx context.Context, key string) error {
+	return errors.New("store is down")
+}
+
+// newIdempotencyTestRouter returns a router that counts the things created.
+// The first call fails with the status given if it isn't zero, or panics if
+// it is panicStatus.
+func newIdempotencyTestRouter(t *testing.T, failWith int) (*Server, *gin.Engine, *int) {
+	t.Helper()
+	s := newAuthTestServer(t)
+	calls, created := 0, 0
+	r := gin.New()
+	r.Use(gin.CustomRecovery(RecoveryMiddlware), s.AuthMiddleware(), s.IdempotencyMiddleware())
+	handler := func(c *gin.Context) {
+		calls++
+		if failWith == panicStatus && calls == 1 {
+			panic("failed to create thing")
+		}
+		if failWith != 0 && calls == 1 {
+			h.RespondWithError(c, errors.New("failed"), failWith)
+			return
+		}
+		created++
+		c.Header("Location", "/things/1")
+		c.Header("RateLimit-Remaining", "5")
+		c.String(http.StatusCreated, "created %d", created)
+	}
+	r.POST("/things", handler)
+	r.GET("/things", handler)
+	return s, r, &created
+}
+
+func serveIdempotent(r *gin.Engine, method, key, authorization, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, "/things", strings.NewReader(body))
+	req.RemoteAddr = "192.0.2.1:1234"
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	t.Run("requests without a key are not replayed", func(t *testing.T) {
+		_, r, created := newIdempotencyTestRouter(t, 0)
+		serveIdempotent(r, http.MethodPost, "", "", "{}")
+		serveIdempotent(r, http.MethodPost, "", "", "{}")
+		assert.Equal(t, 2, *created, "expected both requests to be handled")
+	})
+
+	t.Run("safe methods are not replayed", func(t *testing.T) {
+		_, r, created := newIdempotencyTestRouter(t, 0)
+		serveIdempotent(r, http.MethodGet, "key", "", "")
+		serveIdempotent(r, http.MethodGet, "key", "", "")
+		assert.Equal(t, 2, *created, "expected both requests to be handled")
+	})
+
+	t.Run("the first response is replayed", func(t *testing.T) {
+		_, r, created := newIdempotencyTestRouter(t, 0)
+		first := serveIdempotent(r, http.MethodPost, "key", "", `{"name":"vm"}`)
+		assert.Equal(t, http.StatusCreated, first.Code, "unexpected status code")
+		assert.Empty(t, first.Header().Get(IdempotentReplayedHeader), "expected the first response not to be a replay")
+
+		second := serveIdempotent(r, http.MethodPost, "key", "", `{"name":"vm"}`)
+		assert.Equal(t, 1, *created, "expected the thing to be created once")
+		assert.Equal(t, http.StatusCreated, second.Code, "expected the status to be replayed")
+		assert.Equal(t, "created 1", second.Body.String(), "expected the body to be replayed")
+		assert.Equal(t, "/things/1", second.Header().Get("Location"), "expected the location to be replayed")
+		assert.Equal(t, first.Header().Get("Content-Type"), second.Header().Get("Content-Type"), "expected the content type to be replayed")
+		assert.Empty(t, second.Header().Get("RateLimit-Remaining"), "expected headers about the request not to be replayed")
+		assert.Equal(t, "true", second.Header().Get(IdempotentReplayedHeader), "expected the response to be a replay")
+	})
+
+	t.Run("keys can't be reused for another request", func(t *testing.T) {
+		_, r, created := newIdempotencyTestRouter(t, 0)
+		serveIdempotent(r, http.MethodPost, "key", "", `{"name":"vm"}`)
+		w := serveIdempotent(r, http.MethodPost, "key", "", `{"name":"other"}`)
+		assert.Equal(t, http.StatusConflict, w.Code, "expected a conflict")
+		assert.Contains(t, w.Body.String(), "different request", "unexpected problem")
+		assert.Equal(t, 1, *created, "expected the other request not to be handled")
+	})
+
+	t.Run("keys in use are a conflict", func(t *testing.T) {
+		s, r, created := newIdempotencyTestRouter(t, 0)
+		_, _, err := s.Store.Idempotency().Begin(context.Background(), &database.IdempotencyRecord{
+			Key:         "ip:192.0.2.1:key",
+			RequestHash: requestHash(httptest.NewRequest(http.MethodPost, "/things", nil), []byte("{}")),
+			ExpiresAt:   time.Now().Add(time.Hour),
+		})
+		assert.NoError(t, err, "could not begin request")
+		w := serveIdempotent(r, http.MethodPost, "key", "", "{}")
+		assert.Equal(t, http.StatusConflict, w.Code, "expected a conflict")
+		assert.Contains(t, w.Body.String(), "still being handled", "unexpected problem")
+		assert.Equal(t, 0, *created, "expected the request not to be handled")
+	})
+
+	t.Run("keys are scoped to the user", func(t *testing.T) {
+		_, r, created := newIdempotencyTestRouter(t, 0)
+		serveIdempotent(r, http.MethodPost, "key", "Bearer member-token", "{}")
+		serveIdempotent(r, http.MethodPost, "key", "Bearer admin-token", "{}")
+		serveIdempotent(r, http.MethodPost, "key", "", "{}")
+		assert.Equal(t, 3, *created, "expected every user to have their own key")
+	})
+
+	failures := []struct {
+		name   string
+		status int
+	}{
+		{name: "server errors", status: http.StatusInternalServerError},
+		{name: "rate limited responses", status: http.StatusTooManyRequests},
+		{name: "panics", status: panicStatus},
+	}
+	for _, failure := range failures {
+		failure := failure
+		t.Run(failure.name+" can be retried", func(t *testing.T) {
+			_, r, created := newIdempotencyTestRouter(t, failure.status)
+			w := serveIdempotent(r, http.MethodPost, "key", "", "{}")
+			assert.NotEqual(t, http.StatusCreated, w.Code, "expected the first request to fail")
+			w = serveIdempotent(r, http.MethodPost, "key", "", "{}")
+			assert.Equal(t, http.StatusCreated, w.Code, "expected the retry to be handled")
+			assert.Equal(t, 1, *created, "expected the thing to be created once")
+		})
+	}
+
+	t.Run("handlers slower than the record timeout are kept", func(t *testing.T) {
+		defer func(timeout time.Duration) { idempotencyRecordTimeout = timeout }(idempotencyRecordTimeout)
+		idempotencyRecordTimeout = 20 * time.Millisecond
+		s := newAuthTestServer(t)
+		calls := 0
+		r := gin.New()
+		r.Use(gin.CustomRecovery(RecoveryMiddlware), s.AuthMiddleware(), s.IdempotencyMiddleware())
+		r.POST("/things", func(c *gin.Context) {
+			calls++
+			time.Sleep(50 * time.Millisecond)
+			if calls == 1 {
+				panic("failed to create thing")
+			}
+			c.String(http.StatusCreated, "created")
+		})
+
+		w := serveIdempotent(r, http.MethodPost, "key", "", "{}")
+		assert.Equal(t, http.StatusInternalServerError, w.Code, "expected the first request to panic")
+		w = serveIdempotent(r, http.MethodPost, "key", "", "{}")
+		assert.Equal(t, http.StatusCreated, w.Code, "expected the key to be released after a slow panic")
+		w = serveIdempotent(r, http.MethodPost, "key", "", "{}")
+		assert.Equal(t, "true", w.Header().Get(IdempotentReplayedHeader), "expected a slow response to be stored")
+		assert.Equal(t, 2, calls, "expected the stored response to be replayed")
+	})
+
+	t.Run("client errors are replayed", func(t *testing.T) {
+		_, r, created := newIdempotencyTestRouter(t, http.StatusBadRequest)
+		serveIdempotent(r, http.MethodPost, "key", "", "{}")
+		w := serveIdempotent(r, http.MethodPost, "key", "", "{}")
+		assert.Equal(t, http.StatusBadRequest, w.Code, "expected the error to be replayed")
+		assert.Equal(t, h.ProblemContentType, w.Header().Get("Content-Type"), "expected the problem to be replayed")
+		assert.Equal(t, 0, *created, "expected the retry not to be handled")
+	})
+
+	t.Run("invalid keys are rejected", func(t *testing.T) {
+		_, r, created := newIdempotencyTestRouter(t, 0)
+		w := serveIdempotent(r, http.MethodPost, strings.Repeat("k", 256), "", "{}")
+		assert.Equal(t, http.StatusBadRequest, w.Code, "expected a long key to be rejected")
+		w = serveIdempotent(r, http.MethodPost, "k\tey", "", "{}")
+		assert.Equal(t, http.StatusBadRequest, w.Code, "expected a key with a tab to be rejected")
+		assert.Equal(t, 0, *created, "expected the requests not to be handled")
+	})
+
+	t.Run("requests are turned away when the store fails", func(t *testing.T) {
+		s, r, created := newIdempotencyTestRouter(t, 0)
+		s.Store = failingIdempotencyStore{memory.NewStore()}
+		w := serveIdempotent(r, http.MethodPost, "key", "", "{}")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code, "expected the request to be turned away")
+		assert.Equal(t, 0, *created, "expected the request not to be handled")
+	})
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ugcompsoc/apid/internal/config"
+	h "github.com/ugcompsoc/apid/internal/helpers"
+	"github.com/ugcompsoc/apid/internal/logging"
+)
+
+// requestGroupPaths are the paths of the route groups that can have limits of
+// their own. Bodies are limited before routing, so the group of a request is
+// found from its path rather than from the route.
+var requestGroupPaths = map[string]string{
+	"/v2/healthcheck": config.RequestGroupHealth,
+	"/v2/health":      config.RequestGroupHealth,
+	"/v2/users":       config.RequestGroupUsers,
+}
+
+// deadlineWriter drops what is written once the deadline of the request has
+// passed, unless the response has already been started, so the request can be
+// responded to as having timed out instead
+type deadlineWriter struct {
+	gin.ResponseWriter
+	ctx     context.Context
+	dropped bool
+}
+
+// expired reports whether the response should be dropped
+func (w *deadlineWriter) expired() bool {
+	if !w.dropped && !w.ResponseWriter.Written() && errors.Is(w.ctx.Err(), context.DeadlineExceeded) {
+		w.dropped = true
+	}
+	return w.dropped
+}
+
+func (w *deadlineWriter) WriteHeaderNow() {
+	if !w.expired() {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *deadlineWriter) Write(data []byte) (int, error) {
+	if w.expired() {
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *deadlineWriter) WriteString(s string) (int, error) {
+	if w.expired() {
+		return len(s), nil
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+/*
+ * This middleware limits how long requests can take and how large their bodies can be, with the limits of the route
+ * group the request is in. The deadline is set on the request's context, so datastore calls made with
+ * c.Request.Context() are cancelled once it passes. Handlers must pass that context on and give up once it is done, as
+ * the middleware waits for them to return. A request whose deadline passes before the handler responds gets a 503
+ * Service Unavailable problem in place of whatever the handler responded with, including any headers set after this
+ * middleware, such as an ETag or Location. A body larger than the limit gets a 413 Request Entity Too Large problem,
+ * straight away if its Content-Length says so or once it is read otherwise.
+ */
+func (s *Server) RequestLimitsMiddleware() gin.HandlerFunc {
+	limits := map[string]config.RequestLimit{"": s.Config.Requests.Limit("")}
+	for _, group := range config.RequestGroups {
+		limits[group] = s.Config.Requests.Limit(group)
+	}
+
+	return func(c *gin.Context) {
+		limit := limits[pathGroup(requestGroupPaths, c.Request.URL.Path)]
+		if c.Request.ContentLength > limit.MaxBodySize {
+			h.RespondWithBodyTooLarge(c, limit.MaxBodySize)
+			c.Abort()
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit.MaxBodySize)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), limit.Timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		headers := c.Writer.Header().Clone()
+		writer := &deadlineWriter{ResponseWriter: c.Writer, ctx: ctx}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if writer.expired() {
+			// the headers set by the handler describe the response that was
+			// dropped, so only those set before it are kept
+			for key := range c.Writer.Header() {
+				delete(c.Writer.Header(), key)
+			}
+			for key, values := range headers {
+				c.Writer.Header()[key] = values
+			}
+			logging.Subsystem(ctx, config.LogSubsystemHTTP).Warn().Dur("timeout", limit.Timeout).Msg("request timed out")
+			h.RespondWithError(c, errors.New("the request took too long, try again later"), http.StatusServiceUnavailable)
+		}
+	}
+}
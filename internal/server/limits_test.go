@@ -0,0 +1,119 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/ugcompsoc/apid/internal/config"
+	h "github.com/ugcompsoc/apid/internal/helpers"
+)
+
+func newLimitsTestRouter(requests config.Requests) *gin.Engine {
+	s := &Server{Config: config.Config{Requests: requests}}
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Header("X-Request-ID", "1234")
+	})
+	r.Use(s.RequestLimitsMiddleware())
+	// waits for the deadline like a slow datastore call, and fails like a
+	// handler whose datastore call was cancelled
+	slow := func(c *gin.Context) {
+		c.Header("ETag", `"1"`)
+		c.Header("Location", "/v2/users/me")
+		select {
+		case <-c.Request.Context().Done():
+			h.RespondWithError(c, c.Request.Context().Err(), http.StatusInternalServerError)
+		case <-time.After(50 * time.Millisecond):
+			c.String(http.StatusOK, "ok")
+		}
+	}
+	r.GET("/v2/ping", slow)
+	r.GET("/v2/users/me", slow)
+	r.GET("/v2/health/live", slow)
+	r.GET("/v2/started", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+		c.Writer.WriteHeaderNow()
+		<-c.Request.Context().Done()
+		c.Writer.WriteString("late")
+	})
+	r.POST("/v2/users/me", func(c *gin.Context) {
+		var body map[string]interface{}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			h.RespondWithBindingError(c, err)
+			return
+		}
+		c.String(http.StatusOK, "ok")
+	})
+	return r
+}
+
+func TestRequestLimitsMiddleware(t *testing.T) {
+	r := newLimitsTestRouter(config.Requests{
+		Timeout:     20 * time.Millisecond,
+		MaxBodySize: 32,
+		Groups: map[string]config.RequestLimit{
+			config.RequestGroupUsers:  {Timeout: 5 * time.Second, MaxBodySize: 64},
+			config.RequestGroupHealth: {Timeout: 10 * time.Millisecond},
+		},
+	})
+	small := `{"name":"Lucy"}`
+	large := `{"name":"` + strings.Repeat("a", 100) + `"}`
+
+	runs := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		chunked  bool
+		status   int
+		problem  string
+		expected string
+	}{
+		{name: "request timing out", method: http.MethodGet, path: "/v2/ping", status: http.StatusServiceUnavailable, problem: h.ProblemTypeUnavailable},
+		{name: "group timing out", method: http.MethodGet, path: "/v2/health/live", status: http.StatusServiceUnavailable, problem: h.ProblemTypeUnavailable},
+		{name: "group with a longer timeout", method: http.MethodGet, path: "/v2/users/me", status: http.StatusOK, expected: "ok"},
+		{name: "response started before timing out", method: http.MethodGet, path: "/v2/started", status: http.StatusOK, expected: "late"},
+		{name: "body within the limit", method: http.MethodPost, path: "/v2/users/me", body: small, status: http.StatusOK, expected: "ok"},
+		{name: "body over the limit", method: http.MethodPost, path: "/v2/users/me", body: large, status: http.StatusRequestEntityTooLarge, problem: h.ProblemTypeTooLarge},
+		{name: "chunked body over the limit", method: http.MethodPost, path: "/v2/users/me", body: large, chunked: true, status: http.StatusRequestEntityTooLarge, problem: h.ProblemTypeTooLarge},
+	}
+
+	for _, run := range runs {
+		run := run
+		t.Run("check "+run.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			var body io.Reader = strings.NewReader(run.body)
+			if run.chunked {
+				// hides the length, so it can't be checked up front
+				body = io.MultiReader(body)
+			}
+			req := httptest.NewRequest(run.method, run.path, body)
+			req.Header.Set("Content-Type", "application/json")
+			if run.chunked {
+				req.ContentLength = -1
+			}
+			r.ServeHTTP(w, req)
+			assert.Equal(t, run.status, w.Code, "unexpected status")
+			if run.problem == "" {
+				assert.Equal(t, run.expected, w.Body.String(), "unexpected body")
+				return
+			}
+			var p h.Problem
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &p), "expected a problem")
+			assert.Equal(t, run.problem, p.Type, "unexpected problem type")
+			assert.Equal(t, h.ProblemContentType, w.Header().Get("Content-Type"), "expected a problem content type")
+			assert.Equal(t, "1234", w.Header().Get("X-Request-ID"), "expected headers set before the middleware to be kept")
+			if run.status == http.StatusServiceUnavailable {
+				assert.Empty(t, w.Header().Get("ETag"), "expected the handler's ETag to be dropped")
+				assert.Empty(t, w.Header().Get("Location"), "expected the handler's Location to be dropped")
+			}
+		})
+	}
+}
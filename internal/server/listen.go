@@ -0,0 +1,131 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ugcompsoc/apid/internal/config"
+)
+
+// systemdFirstFD is the first file descriptor systemd passes sockets from
+const systemdFirstFD = 3
+
+// systemdSocket is a socket passed by systemd, with its FileDescriptorName
+type systemdSocket struct {
+	name string
+	file *os.File
+}
+
+// systemdSockets are the sockets passed to the process by systemd. They are
+// found once and never closed, as listeners are made from copies of them, so
+// a server created when the config is reloaded can listen on them too.
+var systemdSockets struct {
+	once    sync.Once
+	sockets []systemdSocket
+	err     error
+}
+
+// listen returns a listener for the listen address, see
+// config.ParseListenAddress
+func (s *Server) listen(address string) (net.Listener, error) {
+	network, addr := config.ParseListenAddress(address)
+	switch network {
+	case config.NetworkUnix:
+		return listenUnix(addr, s.Config.HTTP.GetSocketMode(), s.Config.HTTP.SocketGroup)
+	case config.NetworkSystemd:
+		systemdSockets.once.Do(func() {
+			systemdSockets.sockets, systemdSockets.err = findSystemdSockets(os.Getenv, os.Getpid(), systemdFirstFD)
+		})
+		if systemdSockets.err != nil {
+			return nil, systemdSockets.err
+		}
+		return listenSystemd(systemdSockets.sockets, addr)
+	default:
+		return net.Listen("tcp", addr)
+	}
+}
+
+// listenUnix listens on a unix socket with the permissions given. A socket
+// left behind by a server that wasn't stopped cleanly is replaced, but one
+// that is still being listened on isn't.
+func listenUnix(path string, mode os.FileMode, group string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("the unix socket %s is already in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale unix socket: %w", err)
+		}
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("failed to set unix socket permissions: %w", err)
+	}
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			l.Close()
+			return nil, fmt.Errorf("failed to find unix socket group: %w", err)
+		}
+		gid, err := strconv.Atoi(g.Gid)
+		if err != nil {
+			l.Close()
+			return nil, fmt.Errorf("failed to parse unix socket group ID: %w", err)
+		}
+		if err := os.Chown(path, -1, gid); err != nil {
+			l.Close()
+			return nil, fmt.Errorf("failed to set unix socket group: %w", err)
+		}
+	}
+	return l, nil
+}
+
+// findSystemdSockets returns the sockets passed by systemd socket activation,
+// described by the LISTEN_PID, LISTEN_FDS and LISTEN_FDNAMES environment
+// variables
+func findSystemdSockets(getenv func(string) string, pid int, firstFD int) ([]systemdSocket, error) {
+	if getenv("LISTEN_PID") != strconv.Itoa(pid) {
+		return nil, errors.New("no sockets were passed by systemd, is the service socket activated?")
+	}
+	count, err := strconv.Atoi(getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, errors.New("no sockets were passed by systemd, LISTEN_FDS is not a positive number")
+	}
+	names := strings.Split(getenv("LISTEN_FDNAMES"), ":")
+	sockets := make([]systemdSocket, count)
+	for i := range sockets {
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+		sockets[i] = systemdSocket{name: name, file: os.NewFile(uintptr(firstFD+i), name)}
+	}
+	return sockets, nil
+}
+
+// listenSystemd returns a listener for the socket passed by systemd with the
+// name given, or for the first socket if no name is given
+func listenSystemd(sockets []systemdSocket, name string) (net.Listener, error) {
+	for _, socket := range sockets {
+		if name != "" && socket.name != name {
+			continue
+		}
+		l, err := net.FileListener(socket.file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen on systemd socket %s: %w", socket.name, err)
+		}
+		return l, nil
+	}
+	return nil, fmt.Errorf("systemd didn't pass a socket named %s", name)
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ugcompsoc/apid/internal/config"
+)
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "apid.sock")
+
+	t.Run("check the server is served on a unix socket", func(t *testing.T) {
+		s := &Server{
+			Config: config.Config{HTTP: config.HTTP{SocketMode: 0o600}},
+			HTTP: &http.Server{
+				Addr: "unix:" + path,
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusTeapot)
+				}),
+			},
+		}
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			info, err := os.Stat(path)
+			assert.NoError(t, err, "expected the socket to exist")
+			if err == nil {
+				assert.NotZero(t, info.Mode()&os.ModeSocket, "expected a socket")
+				assert.Equal(t, os.FileMode(0o600), info.Mode().Perm(), "expected the configured permissions")
+			}
+
+			_, err = listenUnix(path, config.DefaultSocketMode, "")
+			assert.ErrorContains(t, err, "already in use", "expected the socket in use not to be replaced")
+
+			client := &http.Client{Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, "unix", path)
+				},
+			}}
+			resp, err := client.Get("http://apid/")
+			assert.NoError(t, err, "expected the server to be served on the socket")
+			if err == nil {
+				assert.Equal(t, http.StatusTeapot, resp.StatusCode, "expected the handler to respond")
+				resp.Body.Close()
+			}
+			s.Stop(context.Background())
+		}()
+		err := s.Start(context.Background())
+		assert.NoError(t, err, "expected server to start without error")
+		_, err = os.Stat(path)
+		assert.True(t, os.IsNotExist(err), "expected the socket to be removed when stopped")
+	})
+
+	t.Run("check a stale socket is replaced", func(t *testing.T) {
+		l, err := net.Listen("unix", path)
+		assert.NoError(t, err, "could not listen on socket")
+		l.(*net.UnixListener).SetUnlinkOnClose(false)
+		l.Close()
+
+		l, err = listenUnix(path, config.DefaultSocketMode, "")
+		assert.NoError(t, err, "expected the stale socket to be replaced")
+		if err == nil {
+			l.Close()
+		}
+	})
+
+	t.Run("check an unknown group is an error", func(t *testing.T) {
+		_, err := listenUnix(path, config.DefaultSocketMode, "apid-no-such-group")
+		assert.ErrorContains(t, err, "failed to find unix socket group", "expected a group error")
+		_, err = os.Stat(path)
+		assert.True(t, os.IsNotExist(err), "expected the socket to be removed")
+	})
+}
+
+func TestSystemdSockets(t *testing.T) {
+	env := func(vars map[string]string) func(string) string {
+		return func(key string) string {
+			return vars[key]
+		}
+	}
+	pid := os.Getpid()
+
+	t.Run("check sockets passed to another process are ignored", func(t *testing.T) {
+		_, err := findSystemdSockets(env(map[string]string{"LISTEN_PID": strconv.Itoa(pid + 1), "LISTEN_FDS": "1"}), pid, systemdFirstFD)
+		assert.ErrorContains(t, err, "no sockets were passed by systemd", "expected no sockets")
+	})
+
+	t.Run("check an invalid socket count is an error", func(t *testing.T) {
+		_, err := findSystemdSockets(env(map[string]string{"LISTEN_PID": strconv.Itoa(pid), "LISTEN_FDS": "none"}), pid, systemdFirstFD)
+		assert.ErrorContains(t, err, "LISTEN_FDS is not a positive number", "expected a count error")
+	})
+
+	t.Run("check sockets are found with their names", func(t *testing.T) {
+		// the descriptors aren't open, only their numbers are checked
+		sockets, err := findSystemdSockets(env(map[string]string{
+			"LISTEN_PID": strconv.Itoa(pid), "LISTEN_FDS": "3", "LISTEN_FDNAMES": "web:admin",
+		}), pid, 1000)
+		assert.NoError(t, err, "expected sockets to be found")
+		assert.Len(t, sockets, 3, "expected 3 sockets")
+		for i, name := range []string{"web", "admin", ""} {
+			assert.Equal(t, name, sockets[i].name, "unexpected socket name")
+			assert.Equal(t, uintptr(1000+i), sockets[i].file.Fd(), "unexpected socket descriptor")
+		}
+	})
+
+	t.Run("check listeners are made from the passed sockets", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err, "could not listen")
+		defer l.Close()
+		file, err := l.(*net.TCPListener).File()
+		assert.NoError(t, err, "could not get listener file")
+		defer file.Close()
+		sockets := []systemdSocket{{name: "web", file: file}}
+
+		for _, name := range []string{"", "web"} {
+			inherited, err := listenSystemd(sockets, name)
+			assert.NoError(t, err, "expected a listener for the socket")
+			if err == nil {
+				assert.Equal(t, l.Addr().String(), inherited.Addr().String(), "expected the passed socket to be listened on")
+				inherited.Close()
+			}
+		}
+		_, err = listenSystemd(sockets, "admin")
+		assert.ErrorContains(t, err, "systemd didn't pass a socket named admin", "expected no socket to be found")
+	})
+}
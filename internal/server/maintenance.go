@@ -0,0 +1,103 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ugcompsoc/apid/internal/config"
+	h "github.com/ugcompsoc/apid/internal/helpers"
+)
+
+// Where the maintenance mode in effect was set
+const (
+	MaintenanceSourceConfig = "config"
+	MaintenanceSourceAdmin  = "admin"
+)
+
+// MaintenanceMode keeps whether the API is read-only. It starts as configured,
+// and a mode set through the admin listener overrides it until it is reset or
+// the config is reloaded.
+type MaintenanceMode struct {
+	mu         sync.RWMutex
+	configured config.Maintenance
+	override   *config.Maintenance
+}
+
+// NewMaintenanceMode returns the maintenance mode described by config
+func NewMaintenanceMode(c config.Maintenance) *MaintenanceMode {
+	return &MaintenanceMode{configured: c}
+}
+
+// Get returns the maintenance mode in effect and where it was set. A nil
+// MaintenanceMode is never enabled.
+func (m *MaintenanceMode) Get() (config.Maintenance, string) {
+	if m == nil {
+		return config.Maintenance{}, MaintenanceSourceConfig
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.override != nil {
+		return *m.override, MaintenanceSourceAdmin
+	}
+	return m.configured, MaintenanceSourceConfig
+}
+
+// Set overrides the configured maintenance mode
+func (m *MaintenanceMode) Set(c config.Maintenance) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.override = &c
+}
+
+// Reset reverts to the configured maintenance mode
+func (m *MaintenanceMode) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.override = nil
+}
+
+// Status returns the maintenance mode in effect as clients see it
+func (m *MaintenanceMode) Status() h.Maintenance {
+	maintenance, source := m.Get()
+	status := h.Maintenance{Enabled: maintenance.Enabled, Groups: maintenance.Groups, Source: source}
+	if maintenance.Enabled {
+		status.Message = maintenance.GetMessage()
+		status.RetryAfter = maintenance.GetRetryAfter().String()
+	}
+	return status
+}
+
+// enabledStatus returns the maintenance mode in effect if it is enabled, so
+// it is only shown by the health checks during maintenance
+func (m *MaintenanceMode) enabledStatus() *h.Maintenance {
+	status := m.Status()
+	if !status.Enabled {
+		return nil
+	}
+	return &status
+}
+
+/*
+ * This middleware turns away requests that would make changes to the route group while it is read-only for
+ * maintenance, with a 503 Service Unavailable problem carrying the maintenance message and a Retry-After header.
+ * GET, HEAD and OPTIONS requests keep working. The empty group is every /v2 route.
+ */
+func (s *Server) MaintenanceMiddleware(group string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		maintenance, _ := s.Maintenance.Get()
+		if !maintenance.ReadOnly(group) {
+			c.Next()
+			return
+		}
+		retryAfter := maintenance.GetRetryAfter()
+		c.Header(RetryAfterHeader, seconds(retryAfter))
+		h.RespondWithUnavailable(c, maintenance.GetMessage(), retryAfter)
+		c.Abort()
+	}
+}
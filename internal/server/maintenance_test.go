@@ -0,0 +1,95 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/ugcompsoc/apid/internal/config"
+	h "github.com/ugcompsoc/apid/internal/helpers"
+)
+
+func TestMaintenanceMiddleware(t *testing.T) {
+	s := &Server{Maintenance: NewMaintenanceMode(config.Maintenance{})}
+	r := gin.New()
+	v2 := r.Group("/v2", s.MaintenanceMiddleware(""))
+	users := v2.Group("/users", s.MaintenanceMiddleware(config.MaintenanceGroupUsers))
+	handler := func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	}
+	v2.GET("/ping", handler)
+	v2.POST("/ping", handler)
+	users.GET("/me", handler)
+	users.PUT("/me", handler)
+
+	runs := []struct {
+		name        string
+		maintenance config.Maintenance
+		method      string
+		path        string
+		status      int
+	}{
+		{name: "changes when not in maintenance", method: http.MethodPut, path: "/v2/users/me", status: http.StatusOK},
+		{name: "reads in maintenance", maintenance: config.Maintenance{Enabled: true}, method: http.MethodGet, path: "/v2/users/me", status: http.StatusOK},
+		{name: "changes in maintenance", maintenance: config.Maintenance{Enabled: true}, method: http.MethodPut, path: "/v2/users/me", status: http.StatusServiceUnavailable},
+		{name: "changes outside a group in maintenance", maintenance: config.Maintenance{Enabled: true}, method: http.MethodPost, path: "/v2/ping", status: http.StatusServiceUnavailable},
+		{name: "changes to a read-only group", maintenance: config.Maintenance{Enabled: true, Groups: []string{config.MaintenanceGroupUsers}}, method: http.MethodPut, path: "/v2/users/me", status: http.StatusServiceUnavailable},
+		{name: "changes outside the read-only groups", maintenance: config.Maintenance{Enabled: true, Groups: []string{config.MaintenanceGroupUsers}}, method: http.MethodPost, path: "/v2/ping", status: http.StatusOK},
+	}
+
+	for _, run := range runs {
+		run := run
+		t.Run("check "+run.name, func(t *testing.T) {
+			s.Maintenance.Set(run.maintenance)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(run.method, run.path, nil))
+			assert.Equal(t, run.status, w.Code, "unexpected status")
+			if run.status != http.StatusServiceUnavailable {
+				assert.Empty(t, w.Header().Get(RetryAfterHeader), "expected no Retry-After header")
+				return
+			}
+			assert.Equal(t, "300", w.Header().Get(RetryAfterHeader), "expected the default Retry-After")
+			var p h.Problem
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &p), "expected a problem")
+			assert.Equal(t, h.ProblemTypeUnavailable, p.Type, "unexpected problem type")
+			assert.Equal(t, config.DefaultMaintenanceMessage, p.Detail, "expected the default message")
+			assert.Equal(t, 300, p.RetryAfter, "expected the default retry after")
+		})
+	}
+
+	t.Run("check the configured message and retry after", func(t *testing.T) {
+		s.Maintenance.Set(config.Maintenance{Enabled: true, Message: "upgrading mongo", RetryAfter: 90 * time.Second})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/v2/users/me", nil))
+		assert.Equal(t, "90", w.Header().Get(RetryAfterHeader), "expected the configured Retry-After")
+		var p h.Problem
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &p), "expected a problem")
+		assert.Equal(t, "upgrading mongo", p.Detail, "expected the configured message")
+	})
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	m := NewMaintenanceMode(config.Maintenance{Enabled: true, Groups: []string{config.MaintenanceGroupUsers}})
+
+	status := m.Status()
+	assert.Equal(t, h.Maintenance{
+		Enabled:    true,
+		Message:    config.DefaultMaintenanceMessage,
+		RetryAfter: "5m0s",
+		Groups:     []string{config.MaintenanceGroupUsers},
+		Source:     MaintenanceSourceConfig,
+	}, status, "expected the configured mode")
+
+	m.Set(config.Maintenance{})
+	assert.Nil(t, m.enabledStatus(), "expected the mode set through the admin listener to override config")
+	m.Reset()
+	assert.NotNil(t, m.enabledStatus(), "expected the configured mode once reset")
+
+	var missing *MaintenanceMode
+	maintenance, _ := missing.Get()
+	assert.False(t, maintenance.Enabled, "expected no maintenance without a mode")
+}
@@ -6,39 +6,55 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
-	"github.com/rs/zerolog/log"
+	"github.com/ugcompsoc/apid/internal/config"
 	h "github.com/ugcompsoc/apid/internal/helpers"
+	"github.com/ugcompsoc/apid/internal/logging"
+	"github.com/ugcompsoc/apid/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ContextIDHeader = "context-id"
+	RequestIDHeader = "X-Request-ID"
 )
 
 /*
- * This middlware adds a context ID to the request so we can track all requests from this user through the logs
+ * This middlware adds a context ID to the request so we can track all requests from this user through the logs.
+ * An ID given by the client in the X-Request-ID or context-id headers is used if it is valid, otherwise a new
+ * one is generated. The ID and a logger carrying it are put in the request's context, and the ID is returned
+ * in the response headers.
  */
 func ContextMiddleware() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		// Set the context-id field if the user hasn't given us one (or its not valid)
-		_, err := uuid.Parse(ctx.Writer.Header().Get("context-id"))
-		if err != nil {
-			ctx.Writer.Header().Set("context-id", uuid.New().String())
+		id := ctx.Request.Header.Get(RequestIDHeader)
+		if !logging.ValidContextID(id) {
+			id = ctx.Request.Header.Get(ContextIDHeader)
 		}
-		// If this container is behind traefik we need to rely on the X-Real-Ip header to get the IP
-		if ctx.Request.Header.Get("X-Real-Ip") == "" {
-			ctx.Request.Header.Set("X-Real-Ip", ctx.RemoteIP())
+		if !logging.ValidContextID(id) {
+			id = logging.NewContextID()
 		}
+		ctx.Writer.Header().Set(ContextIDHeader, id)
+		ctx.Writer.Header().Set(RequestIDHeader, id)
+		ctx.Request = ctx.Request.WithContext(logging.WithContextID(ctx.Request.Context(), id))
 		ctx.Next()
 	}
 }
 
 /*
- * This middleware logs primarily the request path, method, response status and completion latency
+ * This middleware logs primarily the request path, method, response status and completion latency. The IP
+ * logged is the client IP, which is only taken from the X-Forwarded-For or X-Real-Ip headers when the peer
+ * is a trusted proxy.
  */
 func LoggingMiddleware() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		start := time.Now()
-		requestLog := log.With().Str("ip", ctx.Request.Header.Get("X-Real-Ip")).Logger().
+		requestLog := logging.Subsystem(ctx.Request.Context(), config.LogSubsystemHTTP).With().Str("ip", ctx.ClientIP()).Logger().
 			With().Str("method", ctx.Request.Method).Logger().
-			With().Str("path", ctx.Request.URL.Path).Logger().
-			With().Str("context_id", ctx.Writer.Header().Get("context-id")).Logger()
+			With().Str("path", ctx.Request.URL.Path).Logger()
 		ctx.Next()
 		requestLog = requestLog.With().Int64("latency_ns", time.Since(start).Nanoseconds()).Logger().
 			With().Int("status", ctx.Writer.Status()).Logger()
@@ -46,11 +62,50 @@ func LoggingMiddleware() gin.HandlerFunc {
 	}
 }
 
+/*
+ * This middleware starts a span for the request, continuing the trace from an incoming W3C traceparent
+ * header if one was given. The span is put in the request's context so datastore calls made with
+ * c.Request.Context() become its children.
+ */
+func TracingMiddleware(tp trace.TracerProvider) gin.HandlerFunc {
+	tracer := tp.Tracer(tracing.TracerName)
+	propagator := tracing.Propagator()
+	return func(ctx *gin.Context) {
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		reqCtx := propagator.Extract(ctx.Request.Context(), propagation.HeaderCarrier(ctx.Request.Header))
+		reqCtx, span := tracer.Start(reqCtx, ctx.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethodKey.String(ctx.Request.Method),
+				semconv.HTTPRouteKey.String(route),
+				semconv.HTTPTargetKey.String(ctx.Request.URL.Path),
+				attribute.String("context_id", logging.ContextID(ctx.Request.Context())),
+			),
+		)
+		defer span.End()
+		ctx.Request = ctx.Request.WithContext(reqCtx)
+
+		ctx.Next()
+
+		status := ctx.Writer.Status()
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(status))
+		for _, err := range ctx.Errors {
+			span.RecordError(err.Err)
+		}
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
+
 /*
  * This middleware prints a panic to the log and responds to the user with an error
  */
 func RecoveryMiddlware(ctx *gin.Context, recovered interface{}) {
-	log.Error().Any("error", recovered).Msg("recovery middleware")
+	logging.FromContext(ctx.Request.Context()).Error().Any("error", recovered).Msg("recovery middleware")
 	h.RespondWithError(ctx, errors.New("a server error was encountered"), http.StatusInternalServerError)
 	return
 }
@@ -2,16 +2,24 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/assert"
+	"github.com/ugcompsoc/apid/internal/config"
+	"github.com/ugcompsoc/apid/internal/logging"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func init() {
@@ -19,47 +27,84 @@ func init() {
 }
 
 func TestContextMiddleware(t *testing.T) {
-	t.Run("context ID should be added to the context", func(t *testing.T) {
+	serve := func(header http.Header) (*httptest.ResponseRecorder, string, string) {
 		w := httptest.NewRecorder()
-		ctx, engine := gin.CreateTestContext(w)
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/", nil)
+		_, engine := gin.CreateTestContext(w)
+		req, err := http.NewRequest(http.MethodGet, "/", nil)
 		assert.NoError(t, err, "could not create http request")
+		for key, values := range header {
+			req.Header[key] = values
+		}
 
+		var contextID string
+		var logged bytes.Buffer
 		engine.Use(ContextMiddleware())
+		engine.GET("/", func(c *gin.Context) {
+			contextID = logging.ContextID(c.Request.Context())
+			logger := logging.FromContext(c.Request.Context()).Output(&logged)
+			logger.Info().Msg("handler")
+		})
 		engine.ServeHTTP(w, req)
-		contextId := ctx.Writer.Header().Get("context-id")
-		_, err = uuid.Parse(contextId)
-		assert.NoError(t, err, "expected context id to exist/get parsed correctly")
-	})
-
-	t.Run("context ID should not be added if it already exists", func(t *testing.T) {
-		w := httptest.NewRecorder()
-		ctx, engine := gin.CreateTestContext(w)
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/", nil)
-		assert.NoError(t, err, "could not create http request")
+		return w, contextID, logged.String()
+	}
 
-		expectedContextId := uuid.New().String()
-		ctx.Writer.Header().Set("context-id", expectedContextId)
-		engine.Use(ContextMiddleware())
-		engine.ServeHTTP(w, req)
-		contextId := ctx.Writer.Header().Get("context-id")
-		actualContextId, err := uuid.Parse(contextId)
+	t.Run("context ID should be added to the context", func(t *testing.T) {
+		w, contextID, _ := serve(nil)
+		_, err := uuid.Parse(contextID)
 		assert.NoError(t, err, "expected context id to exist/get parsed correctly")
-		assert.Equal(t, expectedContextId, actualContextId.String(), "expected context id to equal the one previously set")
+		assert.Equal(t, contextID, w.Header().Get(ContextIDHeader), "expected context id to be returned")
+		assert.Equal(t, contextID, w.Header().Get(RequestIDHeader), "expected request id to be returned")
 	})
 
-	t.Run("context ID should be added if an invalid uuid is supplied", func(t *testing.T) {
-		w := httptest.NewRecorder()
-		ctx, engine := gin.CreateTestContext(w)
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/", nil)
-		assert.NoError(t, err, "could not create http request")
+	runs := []struct {
+		name   string
+		header http.Header
+		id     string
+	}{
+		{
+			name:   "context-id header",
+			header: http.Header{"Context-Id": []string{"0b1c5ab6-5d8f-4bb0-8e0b-1f3f2a6b0c11"}},
+			id:     "0b1c5ab6-5d8f-4bb0-8e0b-1f3f2a6b0c11",
+		},
+		{
+			name:   "X-Request-ID header",
+			header: http.Header{"X-Request-Id": []string{"traefik-7f3a.1"}},
+			id:     "traefik-7f3a.1",
+		},
+		{
+			name: "X-Request-ID header over the context-id header",
+			header: http.Header{
+				"X-Request-Id": []string{"request-id"},
+				"Context-Id":   []string{"context-id"},
+			},
+			id: "request-id",
+		},
+		{
+			name: "context-id header when X-Request-ID is invalid",
+			header: http.Header{
+				"X-Request-Id": []string{"i am an invalid id"},
+				"Context-Id":   []string{"context-id"},
+			},
+			id: "context-id",
+		},
+	}
 
-		ctx.Writer.Header().Set("context-id", "i am an invalid uuid")
-		engine.Use(ContextMiddleware())
-		engine.ServeHTTP(w, req)
-		contextId := ctx.Writer.Header().Get("context-id")
-		_, err = uuid.Parse(contextId)
-		assert.NoError(t, err, "expected context id to exist/get parsed correctly")
+	for _, run := range runs {
+		t.Run("context ID should be taken from the "+run.name, func(t *testing.T) {
+			w, contextID, logged := serve(run.header)
+			assert.Equal(t, run.id, contextID, "expected context id to equal the one given")
+			assert.Equal(t, run.id, w.Header().Get(ContextIDHeader), "expected context id to be returned")
+			assert.Equal(t, run.id, w.Header().Get(RequestIDHeader), "expected request id to be returned")
+			assert.Contains(t, logged, `"context_id":"`+run.id+`"`, "expected context logger to carry the context id")
+		})
+	}
+
+	t.Run("context ID should be added if an invalid ID is supplied", func(t *testing.T) {
+		for _, invalid := range []string{"i am an invalid uuid", strings.Repeat("a", 129), "a\nb"} {
+			_, contextID, _ := serve(http.Header{"Context-Id": []string{invalid}})
+			_, err := uuid.Parse(contextID)
+			assert.NoError(t, err, "expected a new context id to be generated")
+		}
 	})
 }
 
@@ -87,29 +132,78 @@ func TestLoggingMiddleware(t *testing.T) {
 		assert.Equal(t, "127.0.0.1", logResult["ip"], "expected ip to be logged")
 		assert.LessOrEqual(t, float64(0), logResult["latency_ns"], "expected latency_ns to be logged")
 		assert.Equal(t, float64(404), logResult["status"], "expected status to be logged")
+		assert.Equal(t, w.Header().Get(ContextIDHeader), logResult["context_id"], "expected context id to be logged")
 	})
 
-	t.Run("check X-Real-Ip header is used", func(t *testing.T) {
-		w := httptest.NewRecorder()
-		ctx, engine := gin.CreateTestContext(w)
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/v2", nil)
-		assert.NoError(t, err, "could not create http request")
+	runs := []struct {
+		name    string
+		trusted []string
+		peer    string
+		header  http.Header
+		ip      string
+	}{
+		{
+			name:    "X-Real-Ip header is used from a trusted proxy",
+			trusted: []string{"127.0.0.2"},
+			peer:    "127.0.0.2:80",
+			header:  http.Header{"X-Real-Ip": []string{"127.0.0.1"}},
+			ip:      "127.0.0.1",
+		},
+		{
+			name:    "X-Forwarded-For header is used from a trusted proxy",
+			trusted: []string{"10.0.0.0/8"},
+			peer:    "10.0.0.2:80",
+			header:  http.Header{"X-Forwarded-For": []string{"198.51.100.7, 10.0.0.3"}},
+			ip:      "198.51.100.7",
+		},
+		{
+			name:    "X-Forwarded-For header stops at the first untrusted hop",
+			trusted: []string{"10.0.0.0/8"},
+			peer:    "10.0.0.2:80",
+			header:  http.Header{"X-Forwarded-For": []string{"203.0.113.9, 198.51.100.7, 10.0.0.3"}},
+			ip:      "198.51.100.7",
+		},
+		{
+			name:    "X-Real-Ip header is ignored from an untrusted peer",
+			trusted: []string{"10.0.0.0/8"},
+			peer:    "127.0.0.2:80",
+			header:  http.Header{"X-Real-Ip": []string{"127.0.0.1"}},
+			ip:      "127.0.0.2",
+		},
+		{
+			name:   "X-Forwarded-For header is ignored when no proxies are trusted",
+			peer:   "127.0.0.2:80",
+			header: http.Header{"X-Forwarded-For": []string{"127.0.0.1"}},
+			ip:     "127.0.0.2",
+		},
+	}
 
-		var buf bytes.Buffer
-		writer := io.Writer(&buf)
-		log.Logger = log.Output(writer)
+	for _, run := range runs {
+		t.Run("check "+run.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			engine := SetupRouter(config.Security{})
+			err := engine.SetTrustedProxies(run.trusted)
+			assert.NoError(t, err, "could not set trusted proxies")
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/v2", nil)
+			assert.NoError(t, err, "could not create http request")
 
-		engine.Use(ContextMiddleware())
-		engine.Use(LoggingMiddleware())
-		req.RemoteAddr = "127.0.0.2:80"
-		req.Header.Set("X-Real-Ip", "127.0.0.1")
+			var buf bytes.Buffer
+			writer := io.Writer(&buf)
+			log.Logger = log.Output(writer)
 
-		engine.ServeHTTP(w, req)
-		var logResult map[string]interface{}
-		err = json.Unmarshal(buf.Bytes(), &logResult)
-		assert.NoError(t, err, "could not unmarshal logging result to interface")
-		assert.Equal(t, "127.0.0.1", logResult["ip"], "expected ip to be logged")
-	})
+			req.RemoteAddr = run.peer
+			for key, values := range run.header {
+				req.Header[key] = values
+			}
+
+			engine.ServeHTTP(w, req)
+			var logResult map[string]interface{}
+			err = json.Unmarshal(buf.Bytes(), &logResult)
+			assert.NoError(t, err, "could not unmarshal logging result to interface")
+			assert.Equal(t, run.ip, logResult["ip"], "expected client ip to be logged")
+		})
+	}
 }
 
 func TestRecoveryMiddlware(t *testing.T) {
@@ -135,3 +229,87 @@ func TestRecoveryMiddlware(t *testing.T) {
 		assert.Equal(t, "Oh no :(", logResult["error"], "expected panic message to be logged")
 	})
 }
+
+func TestTracingMiddleware(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer tp.Shutdown(context.Background())
+
+	engine := gin.New()
+	engine.Use(ContextMiddleware())
+	engine.Use(TracingMiddleware(tp))
+	engine.GET("/users/:id", func(c *gin.Context) {
+		// stands in for a datastore call made with the request's context
+		_, span := tp.Tracer("test").Start(c.Request.Context(), "datastore")
+		span.End()
+		c.Status(http.StatusOK)
+	})
+	engine.GET("/fail", func(c *gin.Context) {
+		c.Status(http.StatusInternalServerError)
+	})
+
+	serve := func(path string, header http.Header) {
+		exporter.Reset()
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		engine.ServeHTTP(w, req)
+	}
+	attributes := func(span tracetest.SpanStub) map[string]string {
+		values := map[string]string{}
+		for _, kv := range span.Attributes {
+			values[string(kv.Key)] = kv.Value.Emit()
+		}
+		return values
+	}
+
+	t.Run("span is named after the route template", func(t *testing.T) {
+		serve("/users/a", nil)
+		spans := exporter.GetSpans()
+		assert.Len(t, spans, 2, "expected a request span and a datastore span")
+		request := spans[1]
+		assert.Equal(t, "GET /users/:id", request.Name, "unexpected span name")
+		assert.Equal(t, trace.SpanKindServer, request.SpanKind, "expected a server span")
+		values := attributes(request)
+		assert.Equal(t, "/users/:id", values["http.route"], "unexpected route attribute")
+		assert.Equal(t, "200", values["http.status_code"], "unexpected status attribute")
+		_, err := uuid.Parse(values["context_id"])
+		assert.NoError(t, err, "expected context id attribute")
+	})
+
+	t.Run("datastore spans are children of the request span", func(t *testing.T) {
+		serve("/users/a", nil)
+		spans := exporter.GetSpans()
+		assert.Len(t, spans, 2, "expected a request span and a datastore span")
+		assert.Equal(t, spans[1].SpanContext.SpanID(), spans[0].Parent.SpanID(), "expected datastore span to be a child")
+		assert.Equal(t, spans[1].SpanContext.TraceID(), spans[0].SpanContext.TraceID(), "expected spans to share a trace")
+	})
+
+	t.Run("incoming traceparent is continued", func(t *testing.T) {
+		serve("/users/a", http.Header{
+			"Traceparent": []string{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		})
+		spans := exporter.GetSpans()
+		assert.Len(t, spans, 2, "expected a request span and a datastore span")
+		request := spans[1]
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", request.SpanContext.TraceID().String(), "expected trace to be continued")
+		assert.Equal(t, "00f067aa0ba902b7", request.Parent.SpanID().String(), "expected remote span to be the parent")
+		assert.True(t, request.Parent.IsRemote(), "expected parent to be remote")
+	})
+
+	t.Run("server errors mark the span as failed", func(t *testing.T) {
+		serve("/fail", nil)
+		spans := exporter.GetSpans()
+		assert.Len(t, spans, 1, "expected a request span")
+		assert.Equal(t, codes.Error, spans[0].Status.Code, "expected span to be marked as failed")
+	})
+
+	t.Run("unmatched requests share a span name", func(t *testing.T) {
+		serve("/nowhere", nil)
+		spans := exporter.GetSpans()
+		assert.Len(t, spans, 1, "expected a request span")
+		assert.Equal(t, "GET unmatched", spans[0].Name, "unexpected span name")
+	})
+}
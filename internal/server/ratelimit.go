@@ -0,0 +1,132 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ugcompsoc/apid/internal/config"
+	h "github.com/ugcompsoc/apid/internal/helpers"
+	"github.com/ugcompsoc/apid/internal/logging"
+	"github.com/ugcompsoc/apid/internal/services/database"
+)
+
+const (
+	RateLimitLimitHeader     = "RateLimit-Limit"
+	RateLimitRemainingHeader = "RateLimit-Remaining"
+	RateLimitResetHeader     = "RateLimit-Reset"
+	RateLimitPolicyHeader    = "RateLimit-Policy"
+	RetryAfterHeader         = "Retry-After"
+)
+
+/*
+ * This middleware limits how often each client can make requests to the routes of the group given, with a token
+ * bucket per client. Clients are told apart by the key configured for the group, and the RateLimit-* headers
+ * describe their bucket. When routes are in more than one limited group, the headers describe the innermost group.
+ * Requests are let through if the group is not limited, or if the bucket can't be got from the store, so an outage
+ * of the store doesn't take the API down with it.
+ */
+func (s *Server) RateLimitMiddleware(group string) gin.HandlerFunc {
+	limit, ok := s.Config.RateLimits.Groups[group]
+	if !ok {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+	rate, policy := rateLimitRate(limit)
+	return func(c *gin.Context) {
+		if s.takeRateLimitToken(c, group+":"+rateLimitKey(c, limit.Key), group, rate, policy) {
+			c.Next()
+		}
+	}
+}
+
+// limitFailedAuthentication takes a token from the bucket of failed
+// authentications of the client IP, which is limited like the default group
+// whatever key that has. Otherwise clients could guess tokens as fast as they
+// like, as a failed authentication never reaches the rate limit of a group.
+// It returns false once it has responded with a 429.
+func (s *Server) limitFailedAuthentication(c *gin.Context) bool {
+	limit, ok := s.Config.RateLimits.Groups[config.RateLimitGroupDefault]
+	if !ok {
+		return true
+	}
+	rate, policy := rateLimitRate(limit)
+	return s.takeRateLimitToken(c, "auth:ip:"+c.ClientIP(), config.RateLimitGroupDefault, rate, policy)
+}
+
+// rateLimitRate returns the token bucket of the limit, and the
+// RateLimit-Policy header describing it
+func rateLimitRate(limit config.RateLimit) (database.RateLimit, string) {
+	rate := database.RateLimit{Requests: limit.Requests, Period: limit.Period, Burst: limit.Burst}
+	policy := fmt.Sprintf("%d;w=%s", limit.Requests, seconds(limit.Period))
+	if limit.Burst != 0 {
+		policy += fmt.Sprintf(";burst=%d", limit.Burst)
+	}
+	return rate, policy
+}
+
+// takeRateLimitToken takes a token from the bucket with the key given and
+// sets the RateLimit-* headers. It returns false once it has responded with a
+// 429 as the bucket is empty. The request is let through if the bucket can't
+// be got from the store, but not if it is changing too often to take a token,
+// as that is what a client firing many requests at once looks like.
+func (s *Server) takeRateLimitToken(c *gin.Context, key, group string, rate database.RateLimit, policy string) bool {
+	ctx := c.Request.Context()
+	result, err := s.RateLimits.Take(ctx, key, rate)
+	if errors.Is(err, database.ErrRateLimitContention) {
+		logging.Subsystem(ctx, config.LogSubsystemHTTP).Warn().Err(err).Str("group", group).
+			Msg("rate limit bucket is contended, turning the request away")
+		// a token is added to the bucket every interval
+		retryAfter := rate.Period / time.Duration(rate.Requests)
+		c.Writer.Header().Set(RateLimitPolicyHeader, policy)
+		c.Writer.Header().Set(RetryAfterHeader, seconds(retryAfter))
+		h.RespondWithRateLimited(c, retryAfter)
+		c.Abort()
+		return false
+	}
+	if err != nil {
+		logging.Subsystem(ctx, config.LogSubsystemHTTP).Error().Err(err).Str("group", group).
+			Msg("failed to take a rate limit token, letting the request through")
+		return true
+	}
+
+	header := c.Writer.Header()
+	header.Set(RateLimitLimitHeader, strconv.Itoa(result.Limit))
+	header.Set(RateLimitRemainingHeader, strconv.Itoa(result.Remaining))
+	header.Set(RateLimitResetHeader, seconds(result.Reset))
+	header.Set(RateLimitPolicyHeader, policy)
+	if !result.Allowed {
+		header.Set(RetryAfterHeader, seconds(result.RetryAfter))
+		h.RespondWithRateLimited(c, result.RetryAfter)
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+// rateLimitKey returns what the client is told apart by. Anonymous requests
+// are told apart by the client IP whatever the key is, which is only taken
+// from the X-Forwarded-For or X-Real-Ip headers of trusted proxies.
+func rateLimitKey(c *gin.Context, key string) string {
+	switch key {
+	case config.RateLimitKeyUser:
+		if user := CurrentUser(c); user != nil {
+			return "user:" + user.ID
+		}
+	case config.RateLimitKeyToken:
+		if token := CurrentToken(c); token != nil {
+			return "token:" + token.ID
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// seconds returns the duration in whole seconds, rounded up so clients never
+// retry too early
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
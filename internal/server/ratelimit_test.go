@@ -0,0 +1,205 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/ugcompsoc/apid/internal/config"
+	"github.com/ugcompsoc/apid/internal/services/database"
+	"github.com/ugcompsoc/apid/internal/services/database/memory"
+)
+
+type failingRateLimits struct {
+	err error
+}
+
+func (f failingRateLimits) Take(ctx context.Context, key string, limit database.RateLimit) (*database.RateLimitResult, error) {
+	return nil, f.err
+}
+
+// newRateLimitTestRouter returns a router whose root is limited by the
+// default group, with the users and tokens of newAuthTestServer and a second
+// token for the member
+func newRateLimitTestRouter(t *testing.T, limit *config.RateLimit) (*Server, *gin.Engine) {
+	t.Helper()
+	s := newAuthTestServer(t)
+	err := s.Store.Tokens().Create(context.Background(), &database.Token{
+		Meta:   database.Meta{ID: database.HashToken("member-second-token")},
+		UserID: "member",
+	})
+	assert.NoError(t, err, "could not create token")
+	if limit != nil {
+		s.Config.RateLimits.Groups = map[string]config.RateLimit{config.RateLimitGroupDefault: *limit}
+	}
+	s.RateLimits = memory.NewRateLimitRepository()
+
+	r := gin.New()
+	r.Use(s.AuthMiddleware(), s.RateLimitMiddleware(config.RateLimitGroupDefault))
+	r.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	return s, r
+}
+
+func serveRateLimited(r *gin.Engine, ip, authorization string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = ip + ":1234"
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	t.Run("groups without a limit are not limited", func(t *testing.T) {
+		_, r := newRateLimitTestRouter(t, nil)
+		for i := 0; i < 5; i++ {
+			w := serveRateLimited(r, "192.0.2.1", "")
+			assert.Equal(t, http.StatusOK, w.Code, "expected the request to be let through")
+			assert.Empty(t, w.Header().Get(RateLimitLimitHeader), "expected no rate limit headers")
+		}
+	})
+
+	t.Run("clients are limited and told about their bucket", func(t *testing.T) {
+		_, r := newRateLimitTestRouter(t, &config.RateLimit{Requests: 2, Period: time.Minute})
+
+		w := serveRateLimited(r, "192.0.2.1", "")
+		assert.Equal(t, http.StatusOK, w.Code, "expected the first request to be let through")
+		assert.Equal(t, "2", w.Header().Get(RateLimitLimitHeader), "unexpected limit header")
+		assert.Equal(t, "1", w.Header().Get(RateLimitRemainingHeader), "unexpected remaining header")
+		assert.Equal(t, "30", w.Header().Get(RateLimitResetHeader), "unexpected reset header")
+		assert.Equal(t, "2;w=60", w.Header().Get(RateLimitPolicyHeader), "unexpected policy header")
+
+		w = serveRateLimited(r, "192.0.2.1", "")
+		assert.Equal(t, http.StatusOK, w.Code, "expected the second request to be let through")
+		assert.Equal(t, "0", w.Header().Get(RateLimitRemainingHeader), "unexpected remaining header")
+
+		w = serveRateLimited(r, "192.0.2.1", "")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code, "expected the third request to be limited")
+		assert.Equal(t, "30", w.Header().Get(RetryAfterHeader), "unexpected retry after header")
+		assert.JSONEq(t, `{"type":"https://compsoc.ie/apid/problems/rate-limited","title":"Too Many Requests","status":429,"detail":"too many requests, try again later","instance":"/","retry_after":30}`, w.Body.String(), "unexpected body")
+
+		w = serveRateLimited(r, "192.0.2.2", "")
+		assert.Equal(t, http.StatusOK, w.Code, "expected another IP to be let through")
+	})
+
+	t.Run("burst is given in the policy", func(t *testing.T) {
+		_, r := newRateLimitTestRouter(t, &config.RateLimit{Requests: 2, Period: time.Minute, Burst: 5})
+		w := serveRateLimited(r, "192.0.2.1", "")
+		assert.Equal(t, "5", w.Header().Get(RateLimitLimitHeader), "unexpected limit header")
+		assert.Equal(t, "2;w=60;burst=5", w.Header().Get(RateLimitPolicyHeader), "unexpected policy header")
+	})
+
+	runs := []struct {
+		name string
+		key  string
+		// second is the client of the second request, the first is always
+		// the member's first token from 192.0.2.1
+		secondIP            string
+		secondAuthorization string
+		limited             bool
+	}{
+		{
+			name:                "ip key shares a bucket between users of an IP",
+			key:                 config.RateLimitKeyIP,
+			secondIP:            "192.0.2.1",
+			secondAuthorization: "Bearer admin-token",
+			limited:             true,
+		},
+		{
+			name:                "user key shares a bucket between tokens of a user",
+			key:                 config.RateLimitKeyUser,
+			secondIP:            "192.0.2.2",
+			secondAuthorization: "Bearer member-second-token",
+			limited:             true,
+		},
+		{
+			name:                "user key separates users of an IP",
+			key:                 config.RateLimitKeyUser,
+			secondIP:            "192.0.2.1",
+			secondAuthorization: "Bearer admin-token",
+			limited:             false,
+		},
+		{
+			name:                "user key falls back to the IP for anonymous requests",
+			key:                 config.RateLimitKeyUser,
+			secondIP:            "192.0.2.1",
+			secondAuthorization: "",
+			limited:             false,
+		},
+		{
+			name:                "token key separates tokens of a user",
+			key:                 config.RateLimitKeyToken,
+			secondIP:            "192.0.2.1",
+			secondAuthorization: "Bearer member-second-token",
+			limited:             false,
+		},
+		{
+			name:                "token key shares a bucket between IPs using a token",
+			key:                 config.RateLimitKeyToken,
+			secondIP:            "192.0.2.2",
+			secondAuthorization: "Bearer member-token",
+			limited:             true,
+		},
+	}
+
+	for _, run := range runs {
+		run := run
+		t.Run(run.name, func(t *testing.T) {
+			_, r := newRateLimitTestRouter(t, &config.RateLimit{Requests: 1, Period: time.Minute, Key: run.key})
+			w := serveRateLimited(r, "192.0.2.1", "Bearer member-token")
+			assert.Equal(t, http.StatusOK, w.Code, "expected the first request to be let through")
+			w = serveRateLimited(r, run.secondIP, run.secondAuthorization)
+			if run.limited {
+				assert.Equal(t, http.StatusTooManyRequests, w.Code, "expected the second request to share a bucket")
+			} else {
+				assert.Equal(t, http.StatusOK, w.Code, "expected the second request to have its own bucket")
+			}
+		})
+	}
+
+	for _, key := range []string{config.RateLimitKeyIP, config.RateLimitKeyUser, config.RateLimitKeyToken} {
+		key := key
+		t.Run("failed authentications are limited by IP with the "+key+" key", func(t *testing.T) {
+			_, r := newRateLimitTestRouter(t, &config.RateLimit{Requests: 3, Period: time.Minute, Key: key})
+			for i := 0; i < 3; i++ {
+				w := serveRateLimited(r, "192.0.2.1", "Bearer guess-"+strconv.Itoa(i))
+				assert.Equal(t, http.StatusUnauthorized, w.Code, "expected the bad token to be rejected")
+			}
+			w := serveRateLimited(r, "192.0.2.1", "Bearer guess-3")
+			assert.Equal(t, http.StatusTooManyRequests, w.Code, "expected the client to be limited after too many bad tokens")
+			assert.Equal(t, "20", w.Header().Get(RetryAfterHeader), "unexpected retry after header")
+			w = serveRateLimited(r, "192.0.2.2", "Bearer guess-4")
+			assert.Equal(t, http.StatusUnauthorized, w.Code, "expected another IP to have its own bucket")
+		})
+	}
+
+	t.Run("requests are let through when the store fails", func(t *testing.T) {
+		s, r := newRateLimitTestRouter(t, &config.RateLimit{Requests: 1, Period: time.Minute})
+		s.RateLimits = failingRateLimits{err: errors.New("store is down")}
+		for i := 0; i < 3; i++ {
+			w := serveRateLimited(r, "192.0.2.1", "")
+			assert.Equal(t, http.StatusOK, w.Code, "expected the request to be let through")
+		}
+	})
+
+	t.Run("requests are turned away when the bucket is contended", func(t *testing.T) {
+		s, r := newRateLimitTestRouter(t, &config.RateLimit{Requests: 3, Period: time.Minute})
+		s.RateLimits = failingRateLimits{err: database.ErrRateLimitContention}
+		w := serveRateLimited(r, "192.0.2.1", "")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code, "expected the request to be turned away")
+		assert.Equal(t, "20", w.Header().Get(RetryAfterHeader), "expected to be told to retry once a token is added")
+
+		w = serveRateLimited(r, "192.0.2.1", "Bearer guessed-token")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code, "expected failed authentications to be turned away")
+	})
+}
@@ -1,32 +1,73 @@
 package server
 
 import (
+	"strings"
+
 	"github.com/gin-gonic/gin"
+	"github.com/ugcompsoc/apid/internal/config"
+	"github.com/ugcompsoc/apid/internal/services/database"
 )
 
 // Returns the routes associated with /v2
 func (s *Server) v2Router(r *gin.RouterGroup) {
-	r.GET("/", s.RootV2Get)
+	// bearer tokens are only issued in development mode, so tokens and the
+	// routes that need them aren't served outside of it
+	if s.Config.Dev.Enabled {
+		r.Use(s.AuthMiddleware())
+	}
+
+	// the health checks are registered before the rate limit is used so
+	// probes are never turned away
 	r.GET("/healthcheck", s.MiscV2HealthcheckGet)
+	r.GET("/health", s.MiscV2HealthGet)
+	r.GET("/health/live", s.MiscV2HealthLiveGet)
+	r.GET("/health/ready", s.MiscV2HealthReadyGet)
+	r.GET("/health/startup", s.MiscV2HealthStartupGet)
+
+	r.Use(s.MaintenanceMiddleware(""))
+	r.Use(s.RateLimitMiddleware(config.RateLimitGroupDefault))
+	r.Use(s.IdempotencyMiddleware())
+	r.GET("/", s.RootV2Get)
 	r.GET("/brew", s.MiscV2BrewGet)
 	r.GET("/ping", s.MiscV2PingGet)
+
+	if !s.Config.Dev.Enabled {
+		return
+	}
+	users := r.Group("/users", s.MaintenanceMiddleware(config.MaintenanceGroupUsers), s.RateLimitMiddleware(config.RateLimitGroupUsers))
+	users.GET("", RequireRole(database.RoleAdmin), s.UsersV2Get)
+	users.GET("/me", RequireRole(""), s.UsersV2MeGet)
+	users.PUT("/me", RequireRole(""), s.UsersV2MePut)
+	users.PATCH("/me", RequireRole(""), s.UsersV2MePatch)
 }
 
-func SetupRouter() *gin.Engine {
+// pathGroup returns the group of the path from the paths of the groups, or an
+// empty string if it isn't in one. It is used by middlewares that run before
+// routing, which can't use the route group of the request.
+func pathGroup(paths map[string]string, path string) string {
+	for prefix, group := range paths {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return group
+		}
+	}
+	return ""
+}
+
+// SetupRouter returns the engine with the middlewares every request goes
+// through, with the security headers from config
+func SetupRouter(security config.Security) *gin.Engine {
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
+	// no proxies are trusted until the server sets them from config, so the
+	// client IP can't be spoofed with X-Forwarded-For or X-Real-Ip
+	r.RemoteIPHeaders = []string{"X-Forwarded-For", "X-Real-Ip"}
+	r.SetTrustedProxies(nil)
 	r.Use(gin.CustomRecovery(RecoveryMiddlware))
 	r.Use(ContextMiddleware())
 	r.Use(LoggingMiddleware())
+	r.Use(SecurityHeadersMiddleware(security))
 	r.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Content-Type", "application/json")
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, GET, PUT, DELETE, UPDATE")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(200)
-		}
 		c.Next()
 	})
 	return r
@@ -4,12 +4,13 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/ugcompsoc/apid/internal/config"
 )
 
 func TestSetupRouter(t *testing.T) {
 	t.Run("check setup router", func(t *testing.T) {
-		r := SetupRouter()
-		assert.Len(t, r.Handlers, 4, "should include 4 middlewares from engine")
+		r := SetupRouter(config.Security{})
+		assert.Len(t, r.Handlers, 5, "should include 5 middlewares from engine")
 		assert.Equal(t, r.BasePath(), "/", "base path should be /")
 	})
 }
@@ -17,11 +18,19 @@ func TestSetupRouter(t *testing.T) {
 func TestV2Router(t *testing.T) {
 	t.Run("check V2 router defaults", func(t *testing.T) {
 		s := &Server{}
-		r := SetupRouter()
+		r := SetupRouter(config.Security{})
 		v2 := r.Group("v2")
-		assert.Len(t, v2.Handlers, 4, "should include 4 middlewares from engine")
+		assert.Len(t, v2.Handlers, 5, "should include 5 middlewares from engine")
 		assert.Equal(t, v2.BasePath(), "/v2", "base path should be v2")
 		s.v2Router(v2)
-		assert.Len(t, r.Routes(), 4, "v2 router should have added 4 routes to the API")
+		assert.Len(t, r.Routes(), 8, "v2 router should have added 8 routes to the API")
+	})
+
+	t.Run("check V2 router in development mode", func(t *testing.T) {
+		s := &Server{Config: config.Config{Dev: config.Dev{Enabled: true}}}
+		r := SetupRouter(config.Security{})
+		v2 := r.Group("v2")
+		s.v2Router(v2)
+		assert.Len(t, r.Routes(), 12, "v2 router should have added the users routes in development mode")
 	})
 }
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ugcompsoc/apid/internal/config"
+)
+
+// docsPath is where the swagger UI is served, which needs a CSP of its own
+const docsPath = "/docs"
+
+/*
+ * This middleware sets the security headers of every response from the security config: HSTS, X-Content-Type-Options,
+ * X-Frame-Options, Referrer-Policy and Content-Security-Policy. The API CSP allows nothing, as the API only serves JSON,
+ * so the swagger UI under /docs gets the docs CSP instead. Nothing is set when the headers are disabled.
+ */
+func SecurityHeadersMiddleware(security config.Security) gin.HandlerFunc {
+	if security.Disabled {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	hsts := ""
+	if !security.HSTS.Disabled {
+		hsts = "max-age=" + strconv.Itoa(int(security.HSTS.GetMaxAge().Seconds()))
+		if security.HSTS.IncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if security.HSTS.Preload {
+			hsts += "; preload"
+		}
+	}
+	frameOptions := security.GetFrameOptions()
+	referrerPolicy := security.GetReferrerPolicy()
+	csp := security.GetContentSecurityPolicy()
+	docsCSP := security.GetDocsContentSecurityPolicy()
+
+	return func(c *gin.Context) {
+		header := c.Writer.Header()
+		if hsts != "" {
+			header.Set("Strict-Transport-Security", hsts)
+		}
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("X-Frame-Options", frameOptions)
+		header.Set("Referrer-Policy", referrerPolicy)
+		path := c.Request.URL.Path
+		if path == docsPath || strings.HasPrefix(path, docsPath+"/") {
+			header.Set("Content-Security-Policy", docsCSP)
+		} else {
+			header.Set("Content-Security-Policy", csp)
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/ugcompsoc/apid/internal/config"
+)
+
+func serveSecurityHeaders(security config.Security, path string) http.Header {
+	r := gin.New()
+	r.Use(SecurityHeadersMiddleware(security))
+	r.GET(path, func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w.Header()
+}
+
+func TestSecurityHeadersMiddleware(t *testing.T) {
+	runs := []struct {
+		name     string
+		security config.Security
+		path     string
+		expected map[string]string
+	}{
+		{
+			name: "defaults",
+			path: "/v2/ping",
+			expected: map[string]string{
+				"Strict-Transport-Security": "max-age=31536000",
+				"X-Content-Type-Options":    "nosniff",
+				"X-Frame-Options":           config.DefaultFrameOptions,
+				"Referrer-Policy":           config.DefaultReferrerPolicy,
+				"Content-Security-Policy":   config.DefaultContentSecurityPolicy,
+			},
+		},
+		{
+			name: "docs CSP for the swagger UI",
+			path: "/docs/index.html",
+			expected: map[string]string{
+				"X-Content-Type-Options":  "nosniff",
+				"Content-Security-Policy": config.DefaultDocsContentSecurityPolicy,
+			},
+		},
+		{
+			name: "API CSP for paths starting with docs",
+			path: "/docsearch",
+			expected: map[string]string{
+				"Content-Security-Policy": config.DefaultContentSecurityPolicy,
+			},
+		},
+		{
+			name: "configured headers",
+			security: config.Security{
+				HSTS:                  config.HSTS{MaxAge: 2 * time.Hour, IncludeSubdomains: true, Preload: true},
+				FrameOptions:          "SAMEORIGIN",
+				ReferrerPolicy:        "strict-origin-when-cross-origin",
+				ContentSecurityPolicy: "default-src 'self'",
+			},
+			path: "/v2/ping",
+			expected: map[string]string{
+				"Strict-Transport-Security": "max-age=7200; includeSubDomains; preload",
+				"X-Frame-Options":           "SAMEORIGIN",
+				"Referrer-Policy":           "strict-origin-when-cross-origin",
+				"Content-Security-Policy":   "default-src 'self'",
+			},
+		},
+		{
+			name:     "HSTS disabled",
+			security: config.Security{HSTS: config.HSTS{Disabled: true}},
+			path:     "/v2/ping",
+			expected: map[string]string{
+				"Strict-Transport-Security": "",
+				"X-Content-Type-Options":    "nosniff",
+			},
+		},
+		{
+			name:     "disabled",
+			security: config.Security{Disabled: true},
+			path:     "/v2/ping",
+			expected: map[string]string{
+				"Strict-Transport-Security": "",
+				"X-Content-Type-Options":    "",
+				"X-Frame-Options":           "",
+				"Referrer-Policy":           "",
+				"Content-Security-Policy":   "",
+			},
+		},
+	}
+
+	for _, run := range runs {
+		run := run
+		t.Run("check "+run.name, func(t *testing.T) {
+			header := serveSecurityHeaders(run.security, run.path)
+			for name, value := range run.expected {
+				assert.Equal(t, value, header.Get(name), "unexpected "+name+" header")
+			}
+		})
+	}
+}
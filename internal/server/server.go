@@ -6,52 +6,117 @@ import (
 	"fmt"
 	"net/http"
 
-	"github.com/rs/cors"
 	"github.com/rs/zerolog/log"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 
 	"github.com/ugcompsoc/apid/internal/config"
+	"github.com/ugcompsoc/apid/internal/logging"
+	"github.com/ugcompsoc/apid/internal/metrics"
 	"github.com/ugcompsoc/apid/internal/services/database"
+	"github.com/ugcompsoc/apid/internal/services/database/memory"
+	"github.com/ugcompsoc/apid/internal/tracing"
 )
 
 type Server struct {
-	Config    config.Config
-	HTTP      *http.Server
-	Datastore *database.Datastore
+	Config config.Config
+	HTTP   *http.Server
+	Admin  *http.Server
+	Store  database.Store
+	// RateLimits keeps the buckets of rate limited clients, either in memory
+	// or in the store
+	RateLimits database.RateLimitRepository
+	Health     *HealthRegistry
+	Metrics    *metrics.Metrics
+	Tracing    *sdktrace.TracerProvider
+	Reloads    *ReloadStatus
+	// TLS is nil unless the API is served over HTTPS
+	TLS         *TLSCertificates
+	Maintenance *MaintenanceMode
+	// FeatureFlags decides which features are enabled, the store must be set
+	// first
+	FeatureFlags *FeatureFlagSet
 }
 
 // NewServer returns an initialized Server
 func NewServer(config config.Config) *Server {
-	corsMiddleware := cors.New(cors.Options{
-		AllowedOrigins: config.HTTP.CORS.AllowedOrigins,
-		AllowedMethods: []string{
-			http.MethodHead,
-			http.MethodGet,
-			http.MethodPost,
-			http.MethodPut,
-			http.MethodPatch,
-			http.MethodDelete,
-		},
-		AllowedHeaders:   []string{"*"},
-		AllowCredentials: true,
-	})
+	tp, err := tracing.NewProvider(context.Background(), config.Tracing)
+	if err != nil {
+		log.Fatal().Err(err).Msg("tracing")
+	}
+	// set globally too so that code without a Server, such as background
+	// jobs, continues the same traces
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(tracing.Propagator())
 
-	r := SetupRouter()
+	m := metrics.New()
+	r := SetupRouter(config.HTTP.Security)
+	if err := r.SetTrustedProxies(config.HTTP.TrustedProxies); err != nil {
+		log.Fatal().Err(err).Msg("trusted proxies")
+	}
+	r.Use(m.Middleware())
+	r.Use(TracingMiddleware(tp))
 	httpSrv := &http.Server{
 		Addr:    config.HTTP.ListenAddress,
-		Handler: corsMiddleware.Handler(r),
+		Handler: r,
 	}
 
 	s := &Server{
-		Config: config,
-		HTTP:   httpSrv,
+		Config:      config,
+		HTTP:        httpSrv,
+		Health:      NewHealthRegistry(),
+		Metrics:     m,
+		Tracing:     tp,
+		Maintenance: NewMaintenanceMode(config.Maintenance),
+	}
+	s.Admin = s.newAdminServer()
+	if config.HTTP.TLS.Enabled() {
+		s.TLS, err = NewTLSCertificates(config.HTTP.TLS)
+		if err != nil {
+			log.Fatal().Err(err).Msg("tls")
+		}
+		httpSrv.TLSConfig = s.TLS.Config()
+		if err := s.TLS.Watch(); err != nil {
+			log.Error().Err(err).Msg("certificates won't be reloaded")
+		}
 	}
+	// preflights don't match a route, so the policy is applied to every
+	// request rather than by route group
+	r.Use(s.CORSMiddleware())
+	r.Use(s.RequestLimitsMiddleware())
 
-	var err error
-	s.Datastore, err = database.NewDatastore(&s.Config)
-	if err != nil {
-		log.Fatal().Err(err).Msg("database")
+	if s.Config.Dev.Enabled {
+		ctx, cancel := context.WithTimeout(context.Background(), s.Config.Timeouts.Startup)
+		defer cancel()
+		s.Store, err = newDevStore(ctx, s.Config.Dev)
+		if err != nil {
+			log.Fatal().Err(err).Msg("dev datastore")
+		}
+		// the token itself isn't logged, as logs can be shipped elsewhere
+		log.Warn().Str("fixtures", s.Config.Dev.Fixtures).
+			Msg("development mode is enabled, using an in-memory datastore and the dev admin token from the README")
+	} else {
+		ds, err := database.NewDatastore(&s.Config,
+			database.WithMonitor(m.CommandMonitor()),
+			database.WithMonitor(otelmongo.NewMonitor(otelmongo.WithTracerProvider(tp))),
+		)
+		if err != nil {
+			log.Fatal().Err(err).Msg("database")
+		}
+		if s.Config.Database.AutoMigrate {
+			if err := s.migrate(ds); err != nil {
+				log.Fatal().Err(err).Msg("migrations")
+			}
+		}
+		s.Store = ds
+	}
+	s.RateLimits = s.newRateLimits()
+	s.FeatureFlags = NewFeatureFlagSet(s.Config.FeatureFlags, s.Store.FeatureFlags())
+	if err := s.registerHealthChecks(); err != nil {
+		log.Fatal().Err(err).Msg("health checks")
 	}
 
 	// root route
@@ -67,9 +132,77 @@ func NewServer(config config.Config) *Server {
 	return s
 }
 
+// newRateLimits returns where the buckets of rate limited clients are kept,
+// the store must be set first
+func (s *Server) newRateLimits() database.RateLimitRepository {
+	if s.Config.RateLimits.Store == config.RateLimitStoreDatabase {
+		return s.Store.RateLimits()
+	}
+	return memory.NewRateLimitRepository()
+}
+
+// migrate applies any pending migrations to the datastore
+func (s *Server) migrate(ds *database.Datastore) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Config.Timeouts.Startup)
+	defer cancel()
+	migrator, err := ds.Migrator()
+	if err != nil {
+		return err
+	}
+	applied, err := migrator.Up(ctx, 0)
+	if err != nil {
+		return err
+	}
+	log.Info().Int("count", len(applied)).Msg("applied pending migrations")
+	return nil
+}
+
+// registerHealthChecks adds the checks for the subsystems owned by the server
+func (s *Server) registerHealthChecks() error {
+	return s.Health.Register(HealthCheck{
+		Name:   "database",
+		Probes: ProbeReadiness | ProbeStartup,
+		Check: func(ctx context.Context) error {
+			if err := s.Store.Ping(ctx); err != nil {
+				logging.Subsystem(ctx, config.LogSubsystemDatabase).Debug().Err(err).Msg("database health check failed")
+				return errors.New("cannot ping database")
+			}
+			return nil
+		},
+	})
+}
+
 // Start begins listening
 func (s *Server) Start(ctx context.Context) error {
-	if err := s.HTTP.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+	if s.Admin != nil {
+		// listen before serving so a bad admin address fails startup rather
+		// than being logged and forgotten
+		l, err := s.listen(s.Admin.Addr)
+		if err != nil {
+			return fmt.Errorf("failed to start admin HTTP server: %w", err)
+		}
+		go func() {
+			if err := s.Admin.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+				log.Error().Err(err).Msg("admin HTTP server stopped")
+			}
+		}()
+	}
+	l, err := s.listen(s.HTTP.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to start HTTP server: %w", err)
+	}
+	// started once the listener is bound, so the startup probe doesn't pass
+	// while the API can't be reached
+	if s.Health != nil {
+		s.Health.MarkStarted()
+	}
+	if s.HTTP.TLSConfig != nil {
+		// the certificates come from the TLS config so they can be reloaded
+		err = s.HTTP.ServeTLS(l, "", "")
+	} else {
+		err = s.HTTP.Serve(l)
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
 		return fmt.Errorf("failed to start HTTP server: %w", err)
 	}
 	return nil
@@ -77,8 +210,28 @@ func (s *Server) Start(ctx context.Context) error {
 
 // Stop shuts down the server and listener
 func (s *Server) Stop(ctx context.Context) error {
+	if s.Admin != nil {
+		if err := s.Admin.Shutdown(ctx); err != nil {
+			return fmt.Errorf("failed to stop admin HTTP server: %w", err)
+		}
+	}
 	if err := s.HTTP.Shutdown(ctx); err != nil {
 		return fmt.Errorf("failed to stop HTTP server: %w", err)
 	}
+	if s.TLS != nil {
+		if err := s.TLS.Close(); err != nil {
+			return fmt.Errorf("failed to stop watching TLS certificates: %w", err)
+		}
+	}
+	if s.Store != nil {
+		if err := s.Store.Close(ctx); err != nil {
+			return fmt.Errorf("failed to close datastore: %w", err)
+		}
+	}
+	if s.Tracing != nil {
+		if err := s.Tracing.Shutdown(ctx); err != nil {
+			return fmt.Errorf("failed to flush traces: %w", err)
+		}
+	}
 	return nil
 }
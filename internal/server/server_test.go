@@ -2,12 +2,17 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"net"
 	"net/http"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/ugcompsoc/apid/internal/config"
+	"github.com/ugcompsoc/apid/internal/metrics"
 )
 
 func TestStop(t *testing.T) {
@@ -52,6 +57,38 @@ func TestStart(t *testing.T) {
 		assert.NoError(t, err, "expected server to start without error")
 	})
 
+	t.Run("server should serve HTTPS with a TLS config", func(t *testing.T) {
+		dir := t.TempDir()
+		c := config.TLS{CertFile: filepath.Join(dir, "tls.crt"), KeyFile: filepath.Join(dir, "tls.key")}
+		cert := newTestCert(t, "127.0.0.1", nil)
+		cert.write(t, c.CertFile, c.KeyFile)
+		certs, err := NewTLSCertificates(c)
+		assert.NoError(t, err, "could not load certificates")
+		s := &Server{
+			HTTP: &http.Server{
+				Addr:      "127.0.0.1:8088",
+				Handler:   http.NotFoundHandler(),
+				TLSConfig: certs.Config(),
+			},
+			TLS: certs,
+		}
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			roots := x509.NewCertPool()
+			roots.AddCert(cert.cert)
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}, ForceAttemptHTTP2: true}}
+			resp, err := client.Get("https://127.0.0.1:8088")
+			assert.NoError(t, err, "expected server to serve HTTPS")
+			if err == nil {
+				assert.Equal(t, 2, resp.ProtoMajor, "expected HTTP/2 to be negotiated")
+				resp.Body.Close()
+			}
+			s.Stop(context.Background())
+		}()
+		err = s.Start(context.Background())
+		assert.NoError(t, err, "expected server to start without error")
+	})
+
 	t.Run("server should not start", func(t *testing.T) {
 		s := &Server{
 			HTTP: &http.Server{
@@ -64,6 +101,77 @@ func TestStart(t *testing.T) {
 		err = s.Start(context.Background())
 		assert.Error(t, err, "expected server to start without error")
 	})
+
+	t.Run("server should not be started until it is listening", func(t *testing.T) {
+		s := &Server{
+			HTTP: &http.Server{
+				Addr: ":8089",
+			},
+			Health: NewHealthRegistry(),
+		}
+		l, err := net.Listen("tcp", ":8089")
+		assert.NoError(t, err, "expected to be able to listen on port")
+		defer l.Close()
+		err = s.Start(context.Background())
+		assert.Error(t, err, "expected server not to start")
+		assert.False(t, s.Health.Started(), "expected server not to be marked as started")
+	})
+}
+
+func TestAdminServer(t *testing.T) {
+	t.Run("admin server is not created without an address", func(t *testing.T) {
+		s := &Server{Metrics: metrics.New()}
+		assert.Nil(t, s.newAdminServer(), "expected no admin server")
+	})
+
+	t.Run("admin server serves metrics and is stopped with the server", func(t *testing.T) {
+		s := &Server{
+			Config: config.Config{
+				HTTP: config.HTTP{AdminListenAddress: "127.0.0.1:8085"},
+			},
+			HTTP: &http.Server{
+				Addr: ":8084",
+			},
+			Metrics: metrics.New(),
+		}
+		s.Admin = s.newAdminServer()
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			resp, err := http.Get("http://127.0.0.1:8085/metrics")
+			assert.NoError(t, err, "expected admin server to be running")
+			if err == nil {
+				assert.Equal(t, http.StatusOK, resp.StatusCode, "expected metrics to be served")
+				resp.Body.Close()
+			}
+			err = s.Stop(context.Background())
+			assert.NoError(t, err, "could not stop server")
+			l, err := net.Listen("tcp", "127.0.0.1:8085")
+			assert.NoError(t, err, "expected admin server to not be running on port")
+			if err == nil {
+				l.Close()
+			}
+		}()
+		err := s.Start(context.Background())
+		assert.NoError(t, err, "expected server to start without error")
+	})
+
+	t.Run("server should not start if the admin address is in use", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:8086")
+		assert.NoError(t, err, "expected to be able to listen on port")
+		defer l.Close()
+		s := &Server{
+			Config: config.Config{
+				HTTP: config.HTTP{AdminListenAddress: "127.0.0.1:8086"},
+			},
+			HTTP: &http.Server{
+				Addr: ":8087",
+			},
+			Metrics: metrics.New(),
+		}
+		s.Admin = s.newAdminServer()
+		err = s.Start(context.Background())
+		assert.ErrorContains(t, err, "failed to start admin HTTP server", "expected admin listen error")
+	})
 }
 
 // TODO
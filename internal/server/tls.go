@@ -0,0 +1,229 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"github.com/ugcompsoc/apid/internal/config"
+	h "github.com/ugcompsoc/apid/internal/helpers"
+)
+
+// tlsReloadDelay is how long to wait after a certificate file changes before
+// loading it, so a certificate and key rotated together are loaded once
+const tlsReloadDelay = 500 * time.Millisecond
+
+// TLSCertificates keeps the certificate the API is served with, and the CAs
+// client certificates are verified against, so they can be swapped for
+// rotated ones while the server is running
+type TLSCertificates struct {
+	config    config.TLS
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	watcher   *fsnotify.Watcher
+}
+
+// NewTLSCertificates loads the certificates described by the config
+func NewTLSCertificates(c config.TLS) (*TLSCertificates, error) {
+	t := &TLSCertificates{config: c}
+	if err := t.Reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Reload loads the certificates from their files again. The certificates in
+// use are kept if any of them can't be loaded, e.g. as the key has been
+// rotated but the certificate hasn't yet.
+func (t *TLSCertificates) Reload() error {
+	cert, err := tls.LoadX509KeyPair(t.config.CertFile, t.config.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	var clientCAs *x509.CertPool
+	if t.config.ClientCAFile != "" {
+		pem, err := os.ReadFile(t.config.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read TLS client CAs: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return errors.New("failed to load TLS client CAs: no certificates found")
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cert = &cert
+	t.clientCAs = clientCAs
+	return nil
+}
+
+// Watch reloads the certificates whenever their files change, until Close is
+// called. The directories are watched rather than the files, as rotating a
+// certificate usually replaces the file or, in Kubernetes, the symlink to it.
+func (t *TLSCertificates) Watch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create TLS watcher: %w", err)
+	}
+	watched := map[string]bool{}
+	for _, file := range t.Files() {
+		dir := filepath.Dir(file)
+		if watched[dir] {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return fmt.Errorf("failed to watch TLS directory %s: %w", dir, err)
+		}
+		watched[dir] = true
+	}
+	t.watcher = watcher
+	go t.handleEvents(watcher)
+	return nil
+}
+
+// handleEvents reloads the certificates once their directories have stopped
+// changing
+func (t *TLSCertificates) handleEvents(watcher *fsnotify.Watcher) {
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	for {
+		select {
+		case e, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if e.Op == fsnotify.Chmod {
+				continue
+			}
+			if timer == nil {
+				timer = time.AfterFunc(tlsReloadDelay, t.reloadChanged)
+			} else {
+				timer.Reset(tlsReloadDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Error().Err(err).Msg("TLS watcher error")
+		}
+	}
+}
+
+func (t *TLSCertificates) reloadChanged() {
+	if err := t.Reload(); err != nil {
+		log.Error().Err(err).Msg("failed to reload TLS certificates, keeping the current ones")
+		return
+	}
+	log.Info().Strs("files", t.Files()).Msg("reloaded TLS certificates")
+}
+
+// Close stops watching the files of the certificates
+func (t *TLSCertificates) Close() error {
+	if t.watcher == nil {
+		return nil
+	}
+	return t.watcher.Close()
+}
+
+// Files returns the files the certificates are loaded from
+func (t *TLSCertificates) Files() []string {
+	return t.config.Files()
+}
+
+// Config returns the TLS config of a server using the certificates. Every
+// handshake uses the certificates loaded last.
+func (t *TLSCertificates) Config() *tls.Config {
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// set here as the config given to handshakes replaces the one the
+		// server adds HTTP/2 to
+		NextProtos: []string{"h2", "http/1.1"},
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			t.mu.RLock()
+			defer t.mu.RUnlock()
+			return t.cert, nil
+		},
+	}
+	switch t.config.GetClientAuth() {
+	case config.ClientAuthOptional:
+		base.ClientAuth = tls.VerifyClientCertIfGiven
+	case config.ClientAuthRequire:
+		base.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return base
+	}
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		c := base.Clone()
+		c.GetConfigForClient = nil
+		t.mu.RLock()
+		defer t.mu.RUnlock()
+		c.ClientCAs = t.clientCAs
+		return c, nil
+	}
+	return base
+}
+
+// ClientCertificate returns the verified certificate the client of the request
+// presented, or nil if it didn't present one
+func ClientCertificate(c *gin.Context) *x509.Certificate {
+	if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 {
+		return nil
+	}
+	return c.Request.TLS.VerifiedChains[0][0]
+}
+
+/*
+ * This middleware rejects requests that didn't present a verified client certificate, for routes only other services
+ * should call. If names are given, the certificate must also have one of them as its common name or a DNS name. The
+ * certificate is only verified when http.tls.client_auth is optional or require.
+ */
+func RequireClientCert(names ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cert := ClientCertificate(c)
+		if cert == nil {
+			h.RespondWithError(c, errors.New("a client certificate is required"), http.StatusUnauthorized)
+			c.Abort()
+			return
+		}
+		if len(names) != 0 && !certificateHasName(cert, names) {
+			h.RespondWithError(c, errors.New("the client certificate is not allowed to use this route"), http.StatusForbidden)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// certificateHasName reports whether the certificate has any of the names as
+// its common name or one of its DNS names
+func certificateHasName(cert *x509.Certificate, names []string) bool {
+	for _, name := range names {
+		if strings.EqualFold(cert.Subject.CommonName, name) {
+			return true
+		}
+		for _, dnsName := range cert.DNSNames {
+			if strings.EqualFold(dnsName, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
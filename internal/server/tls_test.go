@@ -0,0 +1,211 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/ugcompsoc/apid/internal/config"
+)
+
+// testCert is a certificate for tests, signed by parent or self-signed if
+// parent is nil
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, name string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err, "could not generate key")
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	assert.NoError(t, err, "could not generate serial")
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	assert.NoError(t, err, "could not create certificate")
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err, "could not parse certificate")
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// write writes the certificate and key to the files given
+func (c *testCert) write(t *testing.T, certFile, keyFile string) {
+	err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0o600)
+	assert.NoError(t, err, "could not write certificate")
+	if keyFile == "" {
+		return
+	}
+	der, err := x509.MarshalECPrivateKey(c.key)
+	assert.NoError(t, err, "could not marshal key")
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600)
+	assert.NoError(t, err, "could not write key")
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+func TestTLSCertificates(t *testing.T) {
+	dir := t.TempDir()
+	c := config.TLS{CertFile: filepath.Join(dir, "tls.crt"), KeyFile: filepath.Join(dir, "tls.key")}
+
+	t.Run("check certificates can't be loaded without files", func(t *testing.T) {
+		_, err := NewTLSCertificates(c)
+		assert.Error(t, err, "expected an error loading missing files")
+	})
+
+	first := newTestCert(t, "first.compsoc.ie", nil)
+	first.write(t, c.CertFile, c.KeyFile)
+	certs, err := NewTLSCertificates(c)
+	assert.NoError(t, err, "could not load certificates")
+	served := func() string {
+		cert, err := certs.Config().GetCertificate(&tls.ClientHelloInfo{})
+		assert.NoError(t, err, "could not get certificate")
+		parsed, err := x509.ParseCertificate(cert.Certificate[0])
+		assert.NoError(t, err, "could not parse served certificate")
+		return parsed.Subject.CommonName
+	}
+	assert.Equal(t, "first.compsoc.ie", served(), "expected the first certificate to be served")
+	assert.Equal(t, []string{c.CertFile, c.KeyFile}, certs.Files(), "expected the certificate and key files")
+
+	t.Run("check a rotated certificate is served once reloaded", func(t *testing.T) {
+		newTestCert(t, "second.compsoc.ie", nil).write(t, c.CertFile, c.KeyFile)
+		assert.NoError(t, certs.Reload(), "could not reload certificates")
+		assert.Equal(t, "second.compsoc.ie", served(), "expected the rotated certificate to be served")
+	})
+
+	t.Run("check the certificate is kept when the key doesn't match", func(t *testing.T) {
+		newTestCert(t, "third.compsoc.ie", nil).write(t, c.CertFile, "")
+		assert.Error(t, certs.Reload(), "expected an error reloading a certificate without its key")
+		assert.Equal(t, "second.compsoc.ie", served(), "expected the previous certificate to be kept")
+	})
+
+	t.Run("check certificates are reloaded when their files change", func(t *testing.T) {
+		assert.NoError(t, certs.Watch(), "could not watch certificates")
+		defer certs.Close()
+		newTestCert(t, "fourth.compsoc.ie", nil).write(t, c.CertFile, c.KeyFile)
+		assert.Eventually(t, func() bool {
+			return served() == "fourth.compsoc.ie"
+		}, 5*time.Second, 50*time.Millisecond, "expected the changed certificate to be served")
+	})
+}
+
+func TestClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca.compsoc.ie", nil)
+	c := config.TLS{
+		CertFile:     filepath.Join(dir, "tls.crt"),
+		KeyFile:      filepath.Join(dir, "tls.key"),
+		ClientCAFile: filepath.Join(dir, "ca.crt"),
+		ClientAuth:   config.ClientAuthOptional,
+	}
+	newTestCert(t, "apid.compsoc.ie", ca).write(t, c.CertFile, c.KeyFile)
+	ca.write(t, c.ClientCAFile, "")
+	certs, err := NewTLSCertificates(c)
+	assert.NoError(t, err, "could not load certificates")
+
+	r := gin.New()
+	r.GET("/public", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	r.GET("/service", RequireClientCert(), func(c *gin.Context) {
+		c.String(http.StatusOK, ClientCertificate(c).Subject.CommonName)
+	})
+	r.GET("/ldap", RequireClientCert("ldap.compsoc.ie"), func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	srv := httptest.NewUnstartedServer(r)
+	srv.TLS = certs.Config()
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(client *testCert, path string) (int, error) {
+		config := &tls.Config{RootCAs: roots}
+		if client != nil {
+			// sent even when the server doesn't ask for its CA, so the server
+			// is the one rejecting it
+			config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				cert := client.tlsCertificate()
+				return &cert, nil
+			}
+		}
+		httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+		res, err := httpClient.Get(srv.URL + path)
+		if err != nil {
+			return 0, err
+		}
+		res.Body.Close()
+		return res.StatusCode, nil
+	}
+
+	runs := []struct {
+		name   string
+		client *testCert
+		path   string
+		status int
+	}{
+		{name: "public route without a client certificate", path: "/public", status: http.StatusOK},
+		{name: "service route without a client certificate", path: "/service", status: http.StatusUnauthorized},
+		{name: "service route with a client certificate", client: newTestCert(t, "ldap.compsoc.ie", ca), path: "/service", status: http.StatusOK},
+		{name: "named route with the name", client: newTestCert(t, "ldap.compsoc.ie", ca), path: "/ldap", status: http.StatusOK},
+		{name: "named route with another name", client: newTestCert(t, "events.compsoc.ie", ca), path: "/ldap", status: http.StatusForbidden},
+	}
+
+	for _, run := range runs {
+		run := run
+		t.Run("check "+run.name, func(t *testing.T) {
+			status, err := get(run.client, run.path)
+			assert.NoError(t, err, "could not make request")
+			assert.Equal(t, run.status, status, "unexpected status")
+		})
+	}
+
+	t.Run("check an untrusted client certificate is rejected", func(t *testing.T) {
+		_, err := get(newTestCert(t, "ldap.compsoc.ie", nil), "/service")
+		assert.Error(t, err, "expected the handshake to fail")
+	})
+
+	t.Run("check a rotated client CA is used once reloaded", func(t *testing.T) {
+		otherCA := newTestCert(t, "other-ca.compsoc.ie", nil)
+		otherCA.write(t, c.ClientCAFile, "")
+		assert.NoError(t, certs.Reload(), "could not reload certificates")
+		status, err := get(newTestCert(t, "ldap.compsoc.ie", otherCA), "/service")
+		assert.NoError(t, err, "could not make request")
+		assert.Equal(t, http.StatusOK, status, "expected the new CA to be trusted")
+		_, err = get(newTestCert(t, "ldap.compsoc.ie", ca), "/service")
+		assert.Error(t, err, "expected the old CA not to be trusted")
+	})
+}
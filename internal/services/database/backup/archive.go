@@ -0,0 +1,291 @@
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// FormatVersion is the version of the archive format written by Writer
+const FormatVersion = 1
+
+// maxLineSize is the largest line the Reader accepts, Mongo documents are at
+// most 16MiB of BSON which can grow when represented as Extended JSON
+const maxLineSize = 64 * 1024 * 1024
+
+var ErrChecksumMismatch = errors.New("backup checksum does not match its contents")
+
+/*
+ * An archive is a gzip compressed stream of JSON lines. The first line is a header, followed by a line
+ * holding the indexes of each collection and a line for every document in that collection. The last line
+ * is a footer holding a SHA-256 checksum of every line before it and the number of documents in each
+ * collection. Documents and indexes are canonical Extended JSON so that no type information is lost.
+ */
+
+type header struct {
+	Format    int       `json:"apid_backup"`
+	Database  string    `json:"database"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type line struct {
+	Collection string            `json:"collection,omitempty"`
+	Indexes    []json.RawMessage `json:"indexes,omitempty"`
+	Document   json.RawMessage   `json:"document,omitempty"`
+	Checksum   string            `json:"checksum,omitempty"`
+	Counts     map[string]int64  `json:"counts,omitempty"`
+}
+
+// Summary describes the contents of an archive
+type Summary struct {
+	Database    string
+	CreatedAt   time.Time
+	Checksum    string
+	Collections map[string]int64
+}
+
+// Entry is either the indexes of a collection or a single document
+type Entry struct {
+	Collection string
+	Indexes    []bson.Raw
+	Document   bson.Raw
+}
+
+// Writer writes an archive, Close must be called to write the footer
+type Writer struct {
+	gz      *gzip.Writer
+	hash    hash.Hash
+	out     io.Writer
+	summary Summary
+}
+
+// NewWriter writes the header of an archive for the database given
+func NewWriter(w io.Writer, database string) (*Writer, error) {
+	gz := gzip.NewWriter(w)
+	h := sha256.New()
+	writer := &Writer{
+		gz:   gz,
+		hash: h,
+		out:  io.MultiWriter(gz, h),
+		summary: Summary{
+			Database:    database,
+			CreatedAt:   time.Now().UTC(),
+			Collections: map[string]int64{},
+		},
+	}
+	err := writer.writeLine(header{
+		Format:    FormatVersion,
+		Database:  database,
+		CreatedAt: writer.summary.CreatedAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (w *Writer) writeLine(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.out.Write(append(b, '\n'))
+	return err
+}
+
+// WriteIndexes writes the index specifications of a collection, this should
+// be called for every collection even if it has no indexes
+func (w *Writer) WriteIndexes(collection string, indexes []bson.Raw) error {
+	l := line{Collection: collection, Indexes: []json.RawMessage{}}
+	for _, index := range indexes {
+		ext, err := bson.MarshalExtJSON(index, true, false)
+		if err != nil {
+			return fmt.Errorf("failed to marshal index of %s: %w", collection, err)
+		}
+		l.Indexes = append(l.Indexes, ext)
+	}
+	if _, ok := w.summary.Collections[collection]; !ok {
+		w.summary.Collections[collection] = 0
+	}
+	return w.writeLine(l)
+}
+
+// WriteDocument writes a single document of a collection
+func (w *Writer) WriteDocument(collection string, doc bson.Raw) error {
+	ext, err := bson.MarshalExtJSON(doc, true, false)
+	if err != nil {
+		return fmt.Errorf("failed to marshal document of %s: %w", collection, err)
+	}
+	w.summary.Collections[collection]++
+	return w.writeLine(line{Collection: collection, Document: ext})
+}
+
+// Close writes the footer and flushes the archive, it does not close the
+// underlying writer
+func (w *Writer) Close() (*Summary, error) {
+	w.summary.Checksum = hex.EncodeToString(w.hash.Sum(nil))
+	b, err := json.Marshal(line{Checksum: w.summary.Checksum, Counts: w.summary.Collections})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.gz.Write(append(b, '\n')); err != nil {
+		return nil, err
+	}
+	if err := w.gz.Close(); err != nil {
+		return nil, err
+	}
+	return &w.summary, nil
+}
+
+// Reader reads an archive. The checksum and document counts are verified
+// once the footer is reached, so entries should not be trusted until Next has
+// returned io.EOF.
+type Reader struct {
+	scanner *bufio.Scanner
+	hash    hash.Hash
+	summary Summary
+	counts  map[string]int64
+	done    bool
+}
+
+// NewReader reads the header of an archive
+func NewReader(r io.Reader) (*Reader, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("backup is not gzip compressed: %w", err)
+	}
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	reader := &Reader{
+		scanner: scanner,
+		hash:    sha256.New(),
+		counts:  map[string]int64{},
+	}
+
+	b, err := reader.readLine()
+	if err != nil {
+		return nil, err
+	}
+	var h header
+	if err := json.Unmarshal(b, &h); err != nil {
+		return nil, fmt.Errorf("backup header is malformed: %w", err)
+	}
+	if h.Format != FormatVersion {
+		return nil, fmt.Errorf("backup format version %d is not supported", h.Format)
+	}
+	reader.summary = Summary{
+		Database:  h.Database,
+		CreatedAt: h.CreatedAt,
+	}
+	return reader, nil
+}
+
+func (r *Reader) readLine() ([]byte, error) {
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read backup: %w", err)
+		}
+		return nil, fmt.Errorf("backup is truncated: %w", io.ErrUnexpectedEOF)
+	}
+	b := r.scanner.Bytes()
+	r.hash.Write(b)
+	r.hash.Write([]byte{'\n'})
+	return b, nil
+}
+
+// Next returns the next entry in the archive, or io.EOF once the footer has
+// been reached and verified
+func (r *Reader) Next() (*Entry, error) {
+	if r.done {
+		return nil, io.EOF
+	}
+	// the footer's checksum covers every line before it, so take the sum
+	// before the line is read
+	checksum := hex.EncodeToString(r.hash.Sum(nil))
+	b, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	var l line
+	if err := json.Unmarshal(b, &l); err != nil {
+		return nil, fmt.Errorf("backup line is malformed: %w", err)
+	}
+
+	if l.Checksum != "" {
+		if l.Checksum != checksum {
+			return nil, ErrChecksumMismatch
+		}
+		if len(l.Counts) != len(r.counts) {
+			return nil, ErrChecksumMismatch
+		}
+		for collection, count := range l.Counts {
+			if r.counts[collection] != count {
+				return nil, ErrChecksumMismatch
+			}
+		}
+		if r.scanner.Scan() {
+			return nil, errors.New("backup has data after its footer")
+		}
+		r.summary.Checksum = l.Checksum
+		r.summary.Collections = r.counts
+		r.done = true
+		return nil, io.EOF
+	}
+
+	if l.Collection == "" {
+		return nil, errors.New("backup line has no collection")
+	}
+	entry := &Entry{Collection: l.Collection}
+	if l.Document != nil {
+		if err := bson.UnmarshalExtJSON(l.Document, true, &entry.Document); err != nil {
+			return nil, fmt.Errorf("backup document of %s is malformed: %w", l.Collection, err)
+		}
+		r.counts[l.Collection]++
+		return entry, nil
+	}
+	entry.Indexes = []bson.Raw{}
+	for _, index := range l.Indexes {
+		var raw bson.Raw
+		if err := bson.UnmarshalExtJSON(index, true, &raw); err != nil {
+			return nil, fmt.Errorf("backup index of %s is malformed: %w", l.Collection, err)
+		}
+		entry.Indexes = append(entry.Indexes, raw)
+	}
+	if _, ok := r.counts[l.Collection]; !ok {
+		r.counts[l.Collection] = 0
+	}
+	return entry, nil
+}
+
+// Summary returns the summary of the archive, the checksum and document
+// counts are only set once Next has returned io.EOF
+func (r *Reader) Summary() Summary {
+	return r.summary
+}
+
+// Verify reads an entire archive and returns its summary if it is intact
+func Verify(r io.Reader) (*Summary, error) {
+	reader, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		_, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			summary := reader.Summary()
+			return &summary, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func mustRaw(t *testing.T, v interface{}) bson.Raw {
+	b, err := bson.Marshal(v)
+	assert.NoError(t, err, "expected no error marshalling document")
+	return b
+}
+
+func writeTestArchive(t *testing.T) []byte {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, "apid")
+	assert.NoError(t, err, "expected no error creating writer")
+
+	assert.NoError(t, w.WriteIndexes("societies", nil), "expected no error writing indexes")
+	assert.NoError(t, w.WriteIndexes("users", []bson.Raw{
+		mustRaw(t, bson.D{{Key: "v", Value: 2}, {Key: "key", Value: bson.D{{Key: "email", Value: 1}}}, {Key: "name", Value: "email_unique"}, {Key: "unique", Value: true}}),
+	}), "expected no error writing indexes")
+	assert.NoError(t, w.WriteDocument("users", mustRaw(t, bson.D{
+		{Key: "_id", Value: "a"},
+		{Key: "created_at", Value: time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)},
+		{Key: "count", Value: int64(1)},
+	})), "expected no error writing document")
+	assert.NoError(t, w.WriteDocument("users", mustRaw(t, bson.D{
+		{Key: "_id", Value: "b"},
+		{Key: "object_id", Value: primitive.NewObjectID()},
+		{Key: "count", Value: int32(2)},
+	})), "expected no error writing document")
+
+	summary, err := w.Close()
+	assert.NoError(t, err, "expected no error closing writer")
+	assert.Equal(t, map[string]int64{"societies": 0, "users": 2}, summary.Collections, "unexpected collection counts")
+	assert.Len(t, summary.Checksum, 64, "expected a hex encoded SHA-256 checksum")
+	return buf.Bytes()
+}
+
+// rewrite decompresses an archive, changes its lines and compresses it again
+func rewrite(t *testing.T, archive []byte, change func(lines []string) []string) []byte {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	assert.NoError(t, err, "expected no error decompressing archive")
+	b, err := ioutil.ReadAll(gz)
+	assert.NoError(t, err, "expected no error decompressing archive")
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	lines = change(lines)
+
+	buf := &bytes.Buffer{}
+	w := gzip.NewWriter(buf)
+	_, err = w.Write([]byte(strings.Join(lines, "\n") + "\n"))
+	assert.NoError(t, err, "expected no error compressing archive")
+	assert.NoError(t, w.Close(), "expected no error compressing archive")
+	return buf.Bytes()
+}
+
+func TestArchive(t *testing.T) {
+	archive := writeTestArchive(t)
+
+	t.Run("entries are read back in order without losing types", func(t *testing.T) {
+		r, err := NewReader(bytes.NewReader(archive))
+		assert.NoError(t, err, "expected no error creating reader")
+		assert.Equal(t, "apid", r.Summary().Database, "unexpected database name")
+
+		entries := []*Entry{}
+		for {
+			entry, err := r.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			assert.NoError(t, err, "expected no error reading entry")
+			if err != nil {
+				return
+			}
+			entries = append(entries, entry)
+		}
+		assert.Len(t, entries, 4, "expected two index entries and two documents")
+		assert.Equal(t, "societies", entries[0].Collection, "expected societies indexes first")
+		assert.Len(t, entries[0].Indexes, 0, "expected no societies indexes")
+		assert.Len(t, entries[1].Indexes, 1, "expected one users index")
+		assert.Equal(t, "email_unique", entries[1].Indexes[0].Lookup("name").StringValue(), "unexpected index name")
+
+		doc := entries[2].Document
+		assert.Equal(t, "a", doc.Lookup("_id").StringValue(), "unexpected document id")
+		assert.Equal(t, bson.TypeDateTime, doc.Lookup("created_at").Type, "expected date to remain a date")
+		assert.Equal(t, bson.TypeInt64, doc.Lookup("count").Type, "expected int64 to remain an int64")
+		doc = entries[3].Document
+		assert.Equal(t, bson.TypeObjectID, doc.Lookup("object_id").Type, "expected object id to remain an object id")
+		assert.Equal(t, bson.TypeInt32, doc.Lookup("count").Type, "expected int32 to remain an int32")
+
+		summary := r.Summary()
+		assert.Equal(t, map[string]int64{"societies": 0, "users": 2}, summary.Collections, "unexpected collection counts")
+	})
+
+	t.Run("verify accepts an intact archive", func(t *testing.T) {
+		summary, err := Verify(bytes.NewReader(archive))
+		assert.NoError(t, err, "expected no error verifying archive")
+		assert.Equal(t, int64(2), summary.Collections["users"], "unexpected users count")
+	})
+
+	runs := []struct {
+		name    string
+		archive []byte
+		err     string
+	}{
+		{
+			name:    "not compressed",
+			archive: []byte("{}\n"),
+			err:     "backup is not gzip compressed: unexpected EOF",
+		},
+		{
+			name: "unsupported format",
+			archive: rewrite(t, archive, func(lines []string) []string {
+				return []string{`{"apid_backup":2}`}
+			}),
+			err: "backup format version 2 is not supported",
+		},
+		{
+			name: "tampered document",
+			archive: rewrite(t, archive, func(lines []string) []string {
+				lines[3] = strings.Replace(lines[3], `"a"`, `"z"`, 1)
+				return lines
+			}),
+			err: ErrChecksumMismatch.Error(),
+		},
+		{
+			name: "removed document",
+			archive: rewrite(t, archive, func(lines []string) []string {
+				return append(lines[:3], lines[4:]...)
+			}),
+			err: ErrChecksumMismatch.Error(),
+		},
+		{
+			name: "truncated",
+			archive: rewrite(t, archive, func(lines []string) []string {
+				return lines[:len(lines)-1]
+			}),
+			err: "backup is truncated: unexpected EOF",
+		},
+		{
+			name: "data after footer",
+			archive: rewrite(t, archive, func(lines []string) []string {
+				return append(lines, lines[3])
+			}),
+			err: "backup has data after its footer",
+		},
+	}
+
+	for _, run := range runs {
+		t.Run("verify rejects "+run.name, func(t *testing.T) {
+			_, err := Verify(bytes.NewReader(run.archive))
+			assert.EqualError(t, err, run.err, "unexpected error verifying archive")
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// Extension is the file extension of backups written to a directory
+	Extension = ".jsonl.gz"
+	// ChecksumExtension is appended to a backup's filename for its sidecar
+	// holding the SHA-256 of the compressed file, in the format of sha256sum
+	ChecksumExtension = ".sha256"
+
+	restoreBatchSize = 1000
+	timestampFormat  = "20060102T150405.000Z"
+	// legacyTimestampFormat is that of backups taken before names had
+	// milliseconds, which are still pruned
+	legacyTimestampFormat = "20060102T150405Z"
+)
+
+// skippedCollections are not backed up as they only hold transient state
+var skippedCollections = map[string]bool{
+	"_migrations_lock": true,
+}
+
+var ErrDatabaseNotEmpty = errors.New("database is not empty")
+
+// Dump writes every collection of the database, along with its indexes, to an
+// archive. Documents are streamed from a cursor so the database is never held
+// in memory.
+func Dump(ctx context.Context, db *mongo.Database, w io.Writer) (*Summary, error) {
+	names, err := collectionNames(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	writer, err := NewWriter(w, db.Name())
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if err := dumpCollection(ctx, db.Collection(name), writer); err != nil {
+			return nil, err
+		}
+	}
+	return writer.Close()
+}
+
+func dumpCollection(ctx context.Context, coll *mongo.Collection, writer *Writer) error {
+	cursor, err := coll.Indexes().List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list indexes of %s: %w", coll.Name(), err)
+	}
+	indexes := []bson.Raw{}
+	for cursor.Next(ctx) {
+		// the _id index is created with the collection
+		if name, _ := cursor.Current.Lookup("name").StringValueOK(); name == "_id_" {
+			continue
+		}
+		indexes = append(indexes, cloneRaw(cursor.Current))
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to list indexes of %s: %w", coll.Name(), err)
+	}
+	cursor.Close(ctx)
+	if err := writer.WriteIndexes(coll.Name(), indexes); err != nil {
+		return err
+	}
+
+	cursor, err = coll.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", coll.Name(), err)
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		if err := writer.WriteDocument(coll.Name(), cursor.Current); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", coll.Name(), err)
+	}
+	return nil
+}
+
+// Restore reads an archive into the database, which must be empty. The
+// archive should be checked with Verify first, as documents are inserted as
+// they are read and the checksum is only known once the archive is finished.
+func Restore(ctx context.Context, db *mongo.Database, r io.Reader) (*Summary, error) {
+	names, err := collectionNames(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) != 0 {
+		return nil, fmt.Errorf("%w: %s has %d collection(s)", ErrDatabaseNotEmpty, db.Name(), len(names))
+	}
+
+	reader, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	batch := []interface{}{}
+	batchCollection := ""
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if _, err := db.Collection(batchCollection).InsertMany(ctx, batch); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", batchCollection, err)
+		}
+		batch = []interface{}{}
+		return nil
+	}
+
+	for {
+		entry, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if entry.Collection != batchCollection || len(batch) == restoreBatchSize {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			batchCollection = entry.Collection
+		}
+		if entry.Document != nil {
+			batch = append(batch, entry.Document)
+			continue
+		}
+		if err := restoreIndexes(ctx, db, entry.Collection, entry.Indexes); err != nil {
+			return nil, err
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	summary := reader.Summary()
+	return &summary, nil
+}
+
+// restoreIndexes creates the collection and its indexes, so that restoring
+// into a database does not depend on migrations having been run
+func restoreIndexes(ctx context.Context, db *mongo.Database, collection string, indexes []bson.Raw) error {
+	if err := db.CreateCollection(ctx, collection); err != nil {
+		return fmt.Errorf("failed to create %s: %w", collection, err)
+	}
+	if len(indexes) == 0 {
+		return nil
+	}
+	specs := bson.A{}
+	for _, index := range indexes {
+		elements, err := index.Elements()
+		if err != nil {
+			return fmt.Errorf("index of %s is malformed: %w", collection, err)
+		}
+		spec := bson.D{}
+		for _, e := range elements {
+			// the version and namespace are set by the server
+			if e.Key() == "v" || e.Key() == "ns" {
+				continue
+			}
+			spec = append(spec, bson.E{Key: e.Key(), Value: e.Value()})
+		}
+		specs = append(specs, spec)
+	}
+	command := bson.D{{Key: "createIndexes", Value: collection}, {Key: "indexes", Value: specs}}
+	if err := db.RunCommand(ctx, command).Err(); err != nil {
+		return fmt.Errorf("failed to create indexes of %s: %w", collection, err)
+	}
+	return nil
+}
+
+func collectionNames(ctx context.Context, db *mongo.Database) ([]string, error) {
+	names, err := db.ListCollectionNames(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+	filtered := []string{}
+	for _, name := range names {
+		if skippedCollections[name] || strings.HasPrefix(name, "system.") {
+			continue
+		}
+		filtered = append(filtered, name)
+	}
+	sort.Strings(filtered)
+	return filtered, nil
+}
+
+func cloneRaw(raw bson.Raw) bson.Raw {
+	clone := make(bson.Raw, len(raw))
+	copy(clone, raw)
+	return clone
+}
+
+// Filename returns the name of a backup of the database taken at the time
+// given, to the millisecond so backups taken in quick succession don't share
+// a name. Names sort in the order the backups were taken.
+func Filename(database string, at time.Time) string {
+	return fmt.Sprintf("%s-%s%s", database, at.UTC().Format(timestampFormat), Extension)
+}
+
+// Prune removes all but the most recent backups of the database in the
+// directory, along with their checksum sidecars. The paths removed are
+// returned. Files that do not look like backups of the database are ignored.
+func Prune(directory, database string, keep int) ([]string, error) {
+	if keep <= 0 {
+		return nil, fmt.Errorf("must keep at least one backup, got %d", keep)
+	}
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+	backups := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, database+"-") || !strings.HasSuffix(name, Extension) {
+			continue
+		}
+		timestamp := strings.TrimSuffix(strings.TrimPrefix(name, database+"-"), Extension)
+		if _, err := time.Parse(timestampFormat, timestamp); err != nil {
+			if _, err := time.Parse(legacyTimestampFormat, timestamp); err != nil {
+				continue
+			}
+		}
+		backups = append(backups, name)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+
+	removed := []string{}
+	for i := keep; i < len(backups); i++ {
+		path := filepath.Join(directory, backups[i])
+		if err := os.Remove(path); err != nil {
+			return removed, fmt.Errorf("failed to remove backup: %w", err)
+		}
+		removed = append(removed, path)
+		if err := os.Remove(path + ChecksumExtension); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return removed, fmt.Errorf("failed to remove backup checksum: %w", err)
+		}
+	}
+	return removed, nil
+}
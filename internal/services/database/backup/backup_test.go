@@ -0,0 +1,80 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilename(t *testing.T) {
+	at := time.Date(2023, 9, 1, 12, 30, 5, 0, time.FixedZone("IST", 3600))
+	assert.Equal(t, "apid-20230901T113005.000Z.jsonl.gz", Filename("apid", at), "unexpected backup filename")
+	later := at.Add(250 * time.Millisecond)
+	assert.Equal(t, "apid-20230901T113005.250Z.jsonl.gz", Filename("apid", later), "expected milliseconds in the filename")
+	assert.Less(t, Filename("apid", at), Filename("apid", later), "expected names to sort in the order backups were taken")
+}
+
+func TestPrune(t *testing.T) {
+	directory := t.TempDir()
+	start := time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		path := filepath.Join(directory, Filename("apid", start.Add(time.Duration(i)*time.Hour)))
+		assert.NoError(t, os.WriteFile(path, nil, 0644), "expected no error writing backup")
+		assert.NoError(t, os.WriteFile(path+ChecksumExtension, nil, 0644), "expected no error writing checksum")
+	}
+	others := []string{
+		Filename("other", start),
+		"apid-latest" + Extension,
+		"notes.txt",
+	}
+	for _, name := range others {
+		assert.NoError(t, os.WriteFile(filepath.Join(directory, name), nil, 0644), "expected no error writing file")
+	}
+
+	t.Run("keep must be positive", func(t *testing.T) {
+		_, err := Prune(directory, "apid", 0)
+		assert.EqualError(t, err, "must keep at least one backup, got 0", "unexpected error pruning")
+	})
+
+	t.Run("removes the oldest backups and their checksums", func(t *testing.T) {
+		removed, err := Prune(directory, "apid", 2)
+		assert.NoError(t, err, "expected no error pruning")
+		assert.Equal(t, []string{
+			filepath.Join(directory, Filename("apid", start.Add(time.Hour))),
+			filepath.Join(directory, Filename("apid", start)),
+		}, removed, "expected the two oldest backups to be removed")
+
+		entries, err := os.ReadDir(directory)
+		assert.NoError(t, err, "expected no error listing directory")
+		names := []string{}
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		assert.ElementsMatch(t, append([]string{
+			Filename("apid", start.Add(2*time.Hour)),
+			Filename("apid", start.Add(2*time.Hour)) + ChecksumExtension,
+			Filename("apid", start.Add(3*time.Hour)),
+			Filename("apid", start.Add(3*time.Hour)) + ChecksumExtension,
+		}, others...), names, "unexpected files left after pruning")
+	})
+
+	t.Run("backups named without milliseconds are pruned", func(t *testing.T) {
+		directory := t.TempDir()
+		names := []string{"apid-20230901T000000Z" + Extension, Filename("apid", start.Add(time.Hour))}
+		for _, name := range names {
+			assert.NoError(t, os.WriteFile(filepath.Join(directory, name), nil, 0644), "expected no error writing backup")
+		}
+		removed, err := Prune(directory, "apid", 1)
+		assert.NoError(t, err, "expected no error pruning")
+		assert.Equal(t, []string{filepath.Join(directory, names[0])}, removed, "expected the older backup to be removed")
+	})
+
+	t.Run("nothing is removed when under the limit", func(t *testing.T) {
+		removed, err := Prune(directory, "apid", 5)
+		assert.NoError(t, err, "expected no error pruning")
+		assert.Len(t, removed, 0, "expected nothing to be removed")
+	})
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ugcompsoc/apid/internal/services/database/backup"
+)
+
+func TestBackupRestore(t *testing.T) {
+	ctx := context.Background()
+	source := ds.Client.Database("test_backup_source")
+	target := ds.Client.Database("test_backup_target")
+	defer source.Drop(ctx)
+	defer target.Drop(ctx)
+
+	migrator, err := NewMigrator(source, Migrations)
+	assert.NoError(t, err, "expected no error creating migrator")
+	_, err = migrator.Up(ctx, 0)
+	assert.NoError(t, err, "expected no error applying migrations")
+	users := newMongoRepository[User](source, UsersCollection)
+	for _, user := range []*User{
+		{Meta: Meta{ID: "a"}, Username: "a", Email: "a@compsoc.ie", Roles: []string{RoleAdmin}},
+		{Meta: Meta{ID: "b"}, Username: "b", Email: "b@compsoc.ie"},
+	} {
+		assert.NoError(t, users.Create(ctx, user), "expected no error creating user")
+	}
+
+	buf := &bytes.Buffer{}
+	summary, err := backup.Dump(ctx, source, buf)
+	assert.NoError(t, err, "expected no error dumping database")
+	assert.Equal(t, int64(2), summary.Collections[UsersCollection.Name], "expected both users to be dumped")
+	assert.Equal(t, int64(1), summary.Collections["_migrations"], "expected the migration record to be dumped")
+
+	t.Run("restores documents and indexes", func(t *testing.T) {
+		_, err := backup.Restore(ctx, target, bytes.NewReader(buf.Bytes()))
+		assert.NoError(t, err, "expected no error restoring database")
+
+		restored := newMongoRepository[User](target, UsersCollection)
+		user, err := restored.Get(ctx, "a")
+		assert.NoError(t, err, "expected no error getting restored user")
+		assert.Equal(t, []string{RoleAdmin}, user.Roles, "expected restored user to keep its roles")
+
+		err = restored.Create(ctx, &User{Username: "a", Email: "c@compsoc.ie"})
+		assert.ErrorIs(t, err, ErrConflict, "expected unique indexes to be restored")
+
+		statuses, err := NewMigrator(target, Migrations)
+		assert.NoError(t, err, "expected no error creating migrator")
+		status, err := statuses.Status(ctx)
+		assert.NoError(t, err, "expected no error getting migration status")
+		assert.True(t, status[0].Applied, "expected migration records to be restored")
+	})
+
+	t.Run("refuses to restore into a database that is not empty", func(t *testing.T) {
+		_, err := backup.Restore(ctx, target, bytes.NewReader(buf.Bytes()))
+		assert.ErrorIs(t, err, backup.ErrDatabaseNotEmpty, "expected restore to be refused")
+	})
+}
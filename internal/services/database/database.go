@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/ugcompsoc/apid/internal/config"
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -12,40 +13,157 @@ import (
 type Datastore struct {
 	Client   *mongo.Client
 	Database *mongo.Database
+
+	users     Repository[User]
+	societies Repository[Society]
+	events    Repository[Event]
+	resources Repository[Resource]
+	tokens    Repository[Token]
+
+	rateLimits   RateLimitRepository
+	idempotency  IdempotencyRepository
+	featureFlags FeatureFlagRepository
 }
 
+var _ Store = &Datastore{}
+
 /*
  *	Database Setup
  */
 
-func NewDatastore(config *config.Config) (*Datastore, error) {
+// Option configures the Mongo client of a Datastore
+type Option func(*options.ClientOptions)
+
+// WithMonitor attaches a monitor that is called for every command the client
+// sends to the database. It can be given more than once, monitors are called
+// in the order they were given.
+func WithMonitor(monitor *event.CommandMonitor) Option {
+	return func(opts *options.ClientOptions) {
+		if opts.Monitor == nil {
+			opts.SetMonitor(monitor)
+			return
+		}
+		opts.SetMonitor(combineMonitors(opts.Monitor, monitor))
+	}
+}
+
+// combineMonitors returns a monitor that calls each of the monitors given, as
+// the driver only accepts one
+func combineMonitors(monitors ...*event.CommandMonitor) *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			for _, m := range monitors {
+				if m.Started != nil {
+					m.Started(ctx, e)
+				}
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			for _, m := range monitors {
+				if m.Succeeded != nil {
+					m.Succeeded(ctx, e)
+				}
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			for _, m := range monitors {
+				if m.Failed != nil {
+					m.Failed(ctx, e)
+				}
+			}
+		},
+	}
+}
+
+func NewDatastore(config *config.Config, opts ...Option) (*Datastore, error) {
 	datastore := &Datastore{}
-	if err := datastore.connect(config); err != nil {
+	if err := datastore.connect(config, opts); err != nil {
 		return nil, err
 	}
 	return datastore, nil
 }
 
-func (ds *Datastore) connect(config *config.Config) error {
+func (ds *Datastore) connect(config *config.Config, extraOpts []Option) error {
 	credential := options.Credential{
-		Username: config.Database.Username,
-		Password: config.Database.Password,
+		Username: config.Database.Username.Value(),
+		Password: config.Database.Password.Value(),
 	}
 	serverAPI := options.ServerAPI(options.ServerAPIVersion1)
 	opts := options.Client().ApplyURI(config.Database.Host).SetAuth(credential).SetServerAPIOptions(serverAPI)
+	for _, opt := range extraOpts {
+		opt(opts)
+	}
 
-	client, err := mongo.Connect(context.TODO(), opts)
+	ctx := context.Background()
+	if config.Timeouts.Startup > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Timeouts.Startup)
+		defer cancel()
+	}
+	client, err := mongo.Connect(ctx, opts)
 	if err != nil {
 		return fmt.Errorf("failed to connect to/create session with database host: %w", err)
 	}
 
-	err = client.Ping(context.TODO(), nil)
+	err = client.Ping(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("failed to ping the database host: %w", err)
 	}
 
 	ds.Client = client
 	ds.Database = client.Database(config.Database.Name)
+	ds.users = newMongoRepository[User](ds.Database, UsersCollection)
+	ds.societies = newMongoRepository[Society](ds.Database, SocietiesCollection)
+	ds.events = newMongoRepository[Event](ds.Database, EventsCollection)
+	ds.resources = newMongoRepository[Resource](ds.Database, ResourcesCollection)
+	ds.tokens = newMongoRepository[Token](ds.Database, TokensCollection)
+	ds.rateLimits = newMongoRateLimitRepository(ds.Database)
+	ds.idempotency = newMongoIdempotencyRepository(ds.Database)
+	ds.featureFlags = newMongoFeatureFlagRepository(ds.Database)
 
 	return err
 }
+
+/*
+ *	Store
+ */
+
+func (ds *Datastore) Ping(ctx context.Context) error {
+	return ds.Client.Ping(ctx, nil)
+}
+
+func (ds *Datastore) Close(ctx context.Context) error {
+	return ds.Client.Disconnect(ctx)
+}
+
+func (ds *Datastore) Users() Repository[User] {
+	return ds.users
+}
+
+func (ds *Datastore) Societies() Repository[Society] {
+	return ds.societies
+}
+
+func (ds *Datastore) Events() Repository[Event] {
+	return ds.events
+}
+
+func (ds *Datastore) Resources() Repository[Resource] {
+	return ds.resources
+}
+
+func (ds *Datastore) Tokens() Repository[Token] {
+	return ds.tokens
+}
+
+func (ds *Datastore) RateLimits() RateLimitRepository {
+	return ds.rateLimits
+}
+
+func (ds *Datastore) Idempotency() IdempotencyRepository {
+	return ds.idempotency
+}
+
+func (ds *Datastore) FeatureFlags() FeatureFlagRepository {
+	return ds.featureFlags
+}
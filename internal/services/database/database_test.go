@@ -13,6 +13,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/ugcompsoc/apid/internal/config"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"github.com/containers/common/pkg/retry"
 	"github.com/ory/dockertest/v3"
@@ -22,6 +24,7 @@ var dockerPool *dockertest.Pool
 var dockerDefaultResource *dockertest.Resource
 var dockerResourcesToPurge []*dockertest.Resource
 var ds *Datastore
+var testConfig *config.Config
 
 func TestMain(m *testing.M) {
 	// Recover from panic so that container can be purged
@@ -51,6 +54,7 @@ func TestMain(m *testing.M) {
 		log.Fatalf("could not create mongo docker %s", err)
 	}
 	dockerResourcesToPurge = append(dockerResourcesToPurge, dockerDefaultResource)
+	testConfig = config
 	err = retry.RetryIfNecessary(context.Background(), func() error {
 		var err error
 		ds, err = NewDatastore(config)
@@ -121,3 +125,22 @@ func TestNewDatastore(t *testing.T) {
 		assert.True(t, strings.Contains(err.Error(), "failed to ping the database host"), "could not connect to docker")
 	})
 }
+
+func TestWithMonitor(t *testing.T) {
+	calls := []string{}
+	monitor := func(name string) *event.CommandMonitor {
+		return &event.CommandMonitor{
+			Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+				calls = append(calls, name)
+			},
+		}
+	}
+	opts := options.Client()
+	WithMonitor(monitor("first"))(opts)
+	WithMonitor(monitor("second"))(opts)
+	WithMonitor(&event.CommandMonitor{})(opts)
+
+	opts.Monitor.Started(context.Background(), &event.CommandStartedEvent{})
+	opts.Monitor.Succeeded(context.Background(), &event.CommandSucceededEvent{})
+	assert.Equal(t, []string{"first", "second"}, calls, "expected every monitor to be called in order")
+}
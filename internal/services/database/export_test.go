@@ -0,0 +1,7 @@
+package database
+
+// NewTestDatastore connects a new client to the database created in TestMain
+// so that the external database_test package can use it
+func NewTestDatastore() (*Datastore, error) {
+	return NewDatastore(testConfig)
+}
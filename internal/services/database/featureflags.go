@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// What a feature flag override applies to
+const (
+	FeatureFlagOverrideUser = "user"
+	FeatureFlagOverrideRole = "role"
+)
+
+// FeatureFlagOverride turns a feature flag on or off for a single user or
+// role, whatever it is configured as
+type FeatureFlagOverride struct {
+	// ID is made from the flag, kind and subject, so a subject has one
+	// override of each flag
+	ID   string `bson:"_id"`
+	Flag string `bson:"flag"`
+	// Kind is FeatureFlagOverrideUser or FeatureFlagOverrideRole
+	Kind string `bson:"kind"`
+	// Subject is the ID of the user or the name of the role
+	Subject   string    `bson:"subject"`
+	Enabled   bool      `bson:"enabled"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+// FeatureFlagOverrideID returns the ID the override of the flag for the
+// subject is stored under
+func FeatureFlagOverrideID(flag, kind, subject string) string {
+	return flag + "/" + kind + "/" + subject
+}
+
+// FeatureFlagRepository keeps the overrides of feature flags
+type FeatureFlagRepository interface {
+	// List returns every override ordered by ID
+	List(ctx context.Context) ([]FeatureFlagOverride, error)
+	// Set stores the override, replacing the one the subject had for the
+	// flag. Its ID and updated timestamp are set.
+	Set(ctx context.Context, override *FeatureFlagOverride) error
+	// Delete removes the override of the flag for the subject, it returns
+	// ErrNotFound if there isn't one
+	Delete(ctx context.Context, flag, kind, subject string) error
+}
+
+// mongoFeatureFlagRepository implements FeatureFlagRepository on top of a
+// Mongo collection, so every replica sees the same overrides
+type mongoFeatureFlagRepository struct {
+	collection *mongo.Collection
+}
+
+func newMongoFeatureFlagRepository(db *mongo.Database) *mongoFeatureFlagRepository {
+	return &mongoFeatureFlagRepository{collection: db.Collection(FeatureFlagsCollection.Name)}
+}
+
+func (r *mongoFeatureFlagRepository) List(ctx context.Context) ([]FeatureFlagOverride, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list feature flag overrides: %w", err)
+	}
+	overrides := []FeatureFlagOverride{}
+	if err := cursor.All(ctx, &overrides); err != nil {
+		return nil, fmt.Errorf("failed to decode feature flag overrides: %w", err)
+	}
+	return overrides, nil
+}
+
+func (r *mongoFeatureFlagRepository) Set(ctx context.Context, override *FeatureFlagOverride) error {
+	override.ID = FeatureFlagOverrideID(override.Flag, override.Kind, override.Subject)
+	override.UpdatedAt = Now()
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"_id": override.ID}, override, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to set feature flag override: %w", err)
+	}
+	return nil
+}
+
+func (r *mongoFeatureFlagRepository) Delete(ctx context.Context, flag, kind, subject string) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": FeatureFlagOverrideID(flag, kind, subject)})
+	if err != nil {
+		return fmt.Errorf("failed to delete feature flag override: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Fixtures are documents used to seed a store, typically for local
+// development. They are read from YAML using the JSON field names of the
+// models so that fixtures look the same as API responses.
+type Fixtures struct {
+	Users     []User     `json:"users"`
+	Societies []Society  `json:"societies"`
+	Events    []Event    `json:"events"`
+	Resources []Resource `json:"resources"`
+}
+
+// LoadFixtures reads fixtures from the YAML file given
+func LoadFixtures(path string) (*Fixtures, error) {
+	file, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fixtures := &Fixtures{}
+	if err := yaml.UnmarshalStrict(file, fixtures); err != nil {
+		return nil, fmt.Errorf("failed to parse fixtures %s: %w", path, err)
+	}
+	return fixtures, nil
+}
+
+// Seed creates every fixture in the store given
+func (f *Fixtures) Seed(ctx context.Context, store Store) error {
+	if err := seed(ctx, store.Users(), f.Users); err != nil {
+		return fmt.Errorf("failed to seed users: %w", err)
+	}
+	if err := seed(ctx, store.Societies(), f.Societies); err != nil {
+		return fmt.Errorf("failed to seed societies: %w", err)
+	}
+	if err := seed(ctx, store.Events(), f.Events); err != nil {
+		return fmt.Errorf("failed to seed events: %w", err)
+	}
+	if err := seed(ctx, store.Resources(), f.Resources); err != nil {
+		return fmt.Errorf("failed to seed resources: %w", err)
+	}
+	return nil
+}
+
+func seed[T any](ctx context.Context, repo Repository[T], docs []T) error {
+	for i := range docs {
+		if err := repo.Create(ctx, &docs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadFixtures(t *testing.T) {
+	write := func(t *testing.T, contents string) string {
+		path := filepath.Join(t.TempDir(), "fixtures.yml")
+		err := os.WriteFile(path, []byte(contents), 0644)
+		assert.NoError(t, err, "could not write fixtures")
+		return path
+	}
+
+	t.Run("parses fixtures using json field names", func(t *testing.T) {
+		fixtures, err := LoadFixtures(write(t, `
+events:
+  - id: intro-to-go
+    society_id: compsoc
+    title: Intro to Go
+    starts_at: 2023-09-20T18:00:00Z
+`))
+		assert.NoError(t, err, "expected no error loading fixtures")
+		assert.Len(t, fixtures.Events, 1, "expected one event")
+		assert.Equal(t, "intro-to-go", fixtures.Events[0].ID, "expected id to be parsed")
+		assert.Equal(t, "compsoc", fixtures.Events[0].SocietyID, "expected society id to be parsed")
+		assert.Equal(t, time.Date(2023, 9, 20, 18, 0, 0, 0, time.UTC), fixtures.Events[0].StartsAt, "expected start to be parsed")
+	})
+
+	t.Run("rejects unknown fields", func(t *testing.T) {
+		_, err := LoadFixtures(write(t, "users:\n  - nickname: jb\n"))
+		assert.Error(t, err, "expected an error loading fixtures")
+	})
+
+	t.Run("the repository fixtures are valid", func(t *testing.T) {
+		_, err := LoadFixtures("../../../fixtures.yml")
+		assert.NoError(t, err, "expected no error loading fixtures")
+	})
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// IdempotencyRecord is the request made with an idempotency key, and its
+// response once it has one
+type IdempotencyRecord struct {
+	// Key is the idempotency key, scoped to the client that gave it
+	Key string `bson:"_id"`
+	// RequestHash identifies the request, so the key can't be reused for
+	// another
+	RequestHash string `bson:"request_hash"`
+	// Completed is false while the first request is being handled
+	Completed bool                `bson:"completed"`
+	Status    int                 `bson:"status,omitempty"`
+	Header    map[string][]string `bson:"header,omitempty"`
+	Body      []byte              `bson:"body,omitempty"`
+	CreatedAt time.Time           `bson:"created_at"`
+	// ExpiresAt is when the record can be removed, after which the key can be
+	// used again
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// IdempotencyRepository keeps the records of requests made with idempotency
+// keys
+type IdempotencyRepository interface {
+	// Begin stores the record if no request has been made with its key,
+	// otherwise it returns the stored record and false
+	Begin(ctx context.Context, record *IdempotencyRecord) (*IdempotencyRecord, bool, error)
+	// Complete stores the response of the request, it returns ErrNotFound if
+	// the record has expired or been released
+	Complete(ctx context.Context, record *IdempotencyRecord) error
+	// Release removes a record that hasn't been completed, so the request
+	// can be tried again with the same key
+	Release(ctx context.Context, key string) error
+}
+
+// mongoIdempotencyRepository implements IdempotencyRepository on top of a
+// Mongo collection, so every replica sees the same keys
+type mongoIdempotencyRepository struct {
+	collection *mongo.Collection
+}
+
+func newMongoIdempotencyRepository(db *mongo.Database) *mongoIdempotencyRepository {
+	return &mongoIdempotencyRepository{collection: db.Collection(IdempotencyCollection.Name)}
+}
+
+func (r *mongoIdempotencyRepository) Begin(ctx context.Context, record *IdempotencyRecord) (*IdempotencyRecord, bool, error) {
+	// the TTL index only removes expired records every minute or so, so
+	// they are ignored until it does
+	now := Now()
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": record.Key, "expires_at": bson.M{"$lte": now}})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to remove expired idempotency record: %w", err)
+	}
+	_, err = r.collection.InsertOne(ctx, record)
+	if err == nil {
+		return record, true, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil, false, fmt.Errorf("failed to create idempotency record: %w", err)
+	}
+	existing := &IdempotencyRecord{}
+	err = r.collection.FindOne(ctx, bson.M{"_id": record.Key}).Decode(existing)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// the record was released in the meantime
+		return r.Begin(ctx, record)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get idempotency record: %w", err)
+	}
+	return existing, false, nil
+}
+
+func (r *mongoIdempotencyRepository) Complete(ctx context.Context, record *IdempotencyRecord) error {
+	record.Completed = true
+	result, err := r.collection.ReplaceOne(ctx, bson.M{"_id": record.Key, "completed": false}, record)
+	if err != nil {
+		return fmt.Errorf("failed to complete idempotency record: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoIdempotencyRepository) Release(ctx context.Context, key string) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": key, "completed": false})
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency record: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/ugcompsoc/apid/internal/services/database"
+)
+
+// featureFlagRepository is an in-memory implementation of
+// database.FeatureFlagRepository
+type featureFlagRepository struct {
+	store     *Store
+	mu        sync.Mutex
+	overrides map[string]database.FeatureFlagOverride
+}
+
+func newFeatureFlagRepository(s *Store) *featureFlagRepository {
+	return &featureFlagRepository{store: s, overrides: map[string]database.FeatureFlagOverride{}}
+}
+
+// check returns an error if the store can not be used
+func (r *featureFlagRepository) check(ctx context.Context) error {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+	if r.store.closed {
+		return database.ErrClosed
+	}
+	return ctx.Err()
+}
+
+func (r *featureFlagRepository) List(ctx context.Context) ([]database.FeatureFlagOverride, error) {
+	if err := r.check(ctx); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	overrides := make([]database.FeatureFlagOverride, 0, len(r.overrides))
+	for _, override := range r.overrides {
+		overrides = append(overrides, override)
+	}
+	sort.Slice(overrides, func(i, j int) bool {
+		return overrides[i].ID < overrides[j].ID
+	})
+	return overrides, nil
+}
+
+func (r *featureFlagRepository) Set(ctx context.Context, override *database.FeatureFlagOverride) error {
+	if err := r.check(ctx); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	override.ID = database.FeatureFlagOverrideID(override.Flag, override.Kind, override.Subject)
+	override.UpdatedAt = database.Now()
+	r.overrides[override.ID] = *override
+	return nil
+}
+
+func (r *featureFlagRepository) Delete(ctx context.Context, flag, kind, subject string) error {
+	if err := r.check(ctx); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id := database.FeatureFlagOverrideID(flag, kind, subject)
+	if _, ok := r.overrides[id]; !ok {
+		return database.ErrNotFound
+	}
+	delete(r.overrides, id)
+	return nil
+}
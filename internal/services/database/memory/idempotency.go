@@ -0,0 +1,81 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ugcompsoc/apid/internal/services/database"
+)
+
+// idempotencyRepository is an in-memory implementation of
+// database.IdempotencyRepository
+type idempotencyRepository struct {
+	store   *Store
+	mu      sync.Mutex
+	records map[string]database.IdempotencyRecord
+}
+
+func newIdempotencyRepository(s *Store) *idempotencyRepository {
+	return &idempotencyRepository{store: s, records: map[string]database.IdempotencyRecord{}}
+}
+
+// check returns an error if the store can not be used
+func (r *idempotencyRepository) check(ctx context.Context) error {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+	if r.store.closed {
+		return database.ErrClosed
+	}
+	return ctx.Err()
+}
+
+func (r *idempotencyRepository) Begin(ctx context.Context, record *database.IdempotencyRecord) (*database.IdempotencyRecord, bool, error) {
+	if err := r.check(ctx); err != nil {
+		return nil, false, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := database.Now()
+	// expired records are removed as they are come across, as Mongo does with
+	// its TTL index
+	for key, existing := range r.records {
+		if !existing.ExpiresAt.After(now) {
+			delete(r.records, key)
+		}
+	}
+	if existing, ok := r.records[record.Key]; ok {
+		return &existing, false, nil
+	}
+	r.records[record.Key] = *record
+	return record, true, nil
+}
+
+func (r *idempotencyRepository) Complete(ctx context.Context, record *database.IdempotencyRecord) error {
+	if err := r.check(ctx); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.records[record.Key]
+	if !ok || existing.Completed {
+		return database.ErrNotFound
+	}
+	record.Completed = true
+	r.records[record.Key] = *record
+	return nil
+}
+
+func (r *idempotencyRepository) Release(ctx context.Context, key string) error {
+	if err := r.check(ctx); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.records[key]; ok && !existing.Completed {
+		delete(r.records, key)
+	}
+	return nil
+}
@@ -0,0 +1,328 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ugcompsoc/apid/internal/services/database"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Store is an in-memory implementation of database.Store. Documents are kept
+// BSON encoded so that they behave the same as they would in Mongo.
+type Store struct {
+	mu     sync.RWMutex
+	closed bool
+
+	users     *repository[database.User, *database.User]
+	societies *repository[database.Society, *database.Society]
+	events    *repository[database.Event, *database.Event]
+	resources *repository[database.Resource, *database.Resource]
+	tokens    *repository[database.Token, *database.Token]
+
+	rateLimits   *RateLimitRepository
+	idempotency  *idempotencyRepository
+	featureFlags *featureFlagRepository
+}
+
+var _ database.Store = &Store{}
+
+// NewStore returns an empty in-memory store
+func NewStore() *Store {
+	s := &Store{}
+	s.users = newRepository[database.User](s, database.UsersCollection)
+	s.societies = newRepository[database.Society](s, database.SocietiesCollection)
+	s.events = newRepository[database.Event](s, database.EventsCollection)
+	s.resources = newRepository[database.Resource](s, database.ResourcesCollection)
+	s.tokens = newRepository[database.Token](s, database.TokensCollection)
+	s.rateLimits = NewRateLimitRepository()
+	s.idempotency = newIdempotencyRepository(s)
+	s.featureFlags = newFeatureFlagRepository(s)
+	return s
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return database.ErrClosed
+	}
+	return ctx.Err()
+}
+
+func (s *Store) Close(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *Store) Users() database.Repository[database.User] {
+	return s.users
+}
+
+func (s *Store) Societies() database.Repository[database.Society] {
+	return s.societies
+}
+
+func (s *Store) Events() database.Repository[database.Event] {
+	return s.events
+}
+
+func (s *Store) Resources() database.Repository[database.Resource] {
+	return s.resources
+}
+
+func (s *Store) Tokens() database.Repository[database.Token] {
+	return s.tokens
+}
+
+func (s *Store) RateLimits() database.RateLimitRepository {
+	return s.rateLimits
+}
+
+func (s *Store) Idempotency() database.IdempotencyRepository {
+	return s.idempotency
+}
+
+func (s *Store) FeatureFlags() database.FeatureFlagRepository {
+	return s.featureFlags
+}
+
+type repository[T any, PT database.ModelPointer[T]] struct {
+	store      *Store
+	collection database.Collection
+	docs       map[string]bson.Raw
+}
+
+func newRepository[T any, PT database.ModelPointer[T]](s *Store, c database.Collection) *repository[T, PT] {
+	return &repository[T, PT]{
+		store:      s,
+		collection: c,
+		docs:       map[string]bson.Raw{},
+	}
+}
+
+// check returns an error if the store can not be used, the store lock must
+// be held by the caller
+func (r *repository[T, PT]) check(ctx context.Context) error {
+	if r.store.closed {
+		return database.ErrClosed
+	}
+	return ctx.Err()
+}
+
+// conflicts reports whether a document shares a unique field with any other
+// document, the store lock must be held by the caller
+func (r *repository[T, PT]) conflicts(id string, doc bson.Raw) bool {
+	for otherID, other := range r.docs {
+		if otherID == id {
+			continue
+		}
+		for _, field := range r.collection.Unique {
+			value, err := doc.LookupErr(field)
+			if err != nil {
+				continue
+			}
+			otherValue, err := other.LookupErr(field)
+			if err == nil && value.Equal(otherValue) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r *repository[T, PT]) Create(ctx context.Context, doc *T) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	if err := r.check(ctx); err != nil {
+		return err
+	}
+
+	database.PrepareCreate(PT(doc))
+	id := PT(doc).GetMeta().ID
+	if _, ok := r.docs[id]; ok {
+		return database.ErrConflict
+	}
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if r.conflicts(id, raw) {
+		return database.ErrConflict
+	}
+	r.docs[id] = raw
+	return nil
+}
+
+func (r *repository[T, PT]) Get(ctx context.Context, id string) (*T, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+	if err := r.check(ctx); err != nil {
+		return nil, err
+	}
+
+	raw, ok := r.docs[id]
+	if !ok {
+		return nil, database.ErrNotFound
+	}
+	doc := new(T)
+	if err := bson.Unmarshal(raw, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (r *repository[T, PT]) List(ctx context.Context) ([]T, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+	if err := r.check(ctx); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(r.docs))
+	for id := range r.docs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	docs := make([]T, len(ids))
+	for i, id := range ids {
+		if err := bson.Unmarshal(r.docs[id], &docs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return docs, nil
+}
+
+func (r *repository[T, PT]) Find(ctx context.Context, q database.Query) (*database.Page[T], error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	filters, err := newRawFilters(q.Filters)
+	if err != nil {
+		return nil, err
+	}
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+	if err := r.check(ctx); err != nil {
+		return nil, err
+	}
+
+	order := q.Order()
+	type found struct {
+		raw    bson.Raw
+		values []bson.RawValue
+	}
+	matched := []found{}
+next:
+	for _, raw := range r.docs {
+		for _, filter := range filters {
+			if !filter.matches(raw) {
+				continue next
+			}
+		}
+		values := database.CursorOf(raw, order)
+		if q.After != nil && compareOrder(values, q.After, order) <= 0 {
+			continue
+		}
+		matched = append(matched, found{raw: raw, values: values})
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return compareOrder(matched[i].values, matched[j].values, order) < 0
+	})
+	if q.Limit > 0 && len(matched) > q.Limit+1 {
+		matched = matched[:q.Limit+1]
+	}
+
+	docs := make([]T, len(matched))
+	for i, doc := range matched {
+		if err := bson.Unmarshal(doc.raw, &docs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return database.NewPage(docs, q)
+}
+
+func (r *repository[T, PT]) Update(ctx context.Context, doc *T) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	if err := r.check(ctx); err != nil {
+		return err
+	}
+
+	meta := PT(doc).GetMeta()
+	id := meta.ID
+	existing, ok := r.docs[id]
+	if !ok {
+		return database.ErrNotFound
+	}
+	version, err := storedVersion(existing)
+	if err != nil {
+		return err
+	}
+	if meta.Version != 0 && meta.Version != version {
+		return database.ErrVersionMismatch
+	}
+	fields, err := database.PrepareUpdate(PT(doc))
+	if err != nil {
+		return err
+	}
+	stored := bson.M{}
+	if err := bson.Unmarshal(existing, &stored); err != nil {
+		return err
+	}
+	for key, value := range fields {
+		stored[key] = value
+	}
+	stored["version"] = version + 1
+	raw, err := bson.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	if r.conflicts(id, raw) {
+		return database.ErrConflict
+	}
+	r.docs[id] = raw
+	return bson.Unmarshal(raw, doc)
+}
+
+func (r *repository[T, PT]) Delete(ctx context.Context, id string, version int64) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+	if err := r.check(ctx); err != nil {
+		return err
+	}
+
+	existing, ok := r.docs[id]
+	if !ok {
+		return database.ErrNotFound
+	}
+	if version != 0 {
+		stored, err := storedVersion(existing)
+		if err != nil {
+			return err
+		}
+		if stored != version {
+			return database.ErrVersionMismatch
+		}
+	}
+	delete(r.docs, id)
+	return nil
+}
+
+// storedVersion returns the version of a stored document, which is 0 if it
+// was stored without one
+func storedVersion(raw bson.Raw) (int64, error) {
+	value, err := raw.LookupErr("version")
+	if err != nil {
+		return 0, nil
+	}
+	version, ok := value.AsInt64OK()
+	if !ok {
+		return 0, fmt.Errorf("document %v has a version that isn't a number", raw.Lookup("_id"))
+	}
+	return version, nil
+}
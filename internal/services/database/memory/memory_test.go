@@ -0,0 +1,34 @@
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ugcompsoc/apid/internal/services/database"
+	"github.com/ugcompsoc/apid/internal/services/database_contract"
+)
+
+func TestStoreContract(t *testing.T) {
+	database_contract.RunStoreContractTests(t, func(t *testing.T) database.Store {
+		return NewStore()
+	})
+}
+
+func TestStoreCancelledContext(t *testing.T) {
+	t.Run("operations respect a cancelled context", func(t *testing.T) {
+		s := NewStore()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.ErrorIs(t, s.Ping(ctx), context.Canceled, "expected ping to be cancelled")
+		_, err := s.Users().List(ctx)
+		assert.ErrorIs(t, err, context.Canceled, "expected list to be cancelled")
+	})
+
+	t.Run("operations fail once closed", func(t *testing.T) {
+		s := NewStore()
+		assert.NoError(t, s.Close(context.Background()), "expected no error closing store")
+		_, err := s.Events().Get(context.Background(), "id")
+		assert.ErrorIs(t, err, database.ErrClosed, "expected get to fail on a closed store")
+	})
+}
@@ -0,0 +1,204 @@
+package memory
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/ugcompsoc/apid/internal/services/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// rawFilter is a filter with its values BSON encoded, so they can be compared
+// to the values of stored documents
+type rawFilter struct {
+	path   []string
+	op     string
+	values []bson.RawValue
+}
+
+func newRawFilters(filters []database.Filter) ([]rawFilter, error) {
+	raw := make([]rawFilter, len(filters))
+	for i, filter := range filters {
+		value, err := rawValue(filter.Value)
+		if err != nil {
+			return nil, err
+		}
+		values := []bson.RawValue{value}
+		if filter.Op == database.FilterIn {
+			values, err = value.Array().Values()
+			if err != nil {
+				return nil, err
+			}
+		}
+		raw[i] = rawFilter{path: strings.Split(filter.Field, "."), op: filter.Op, values: values}
+	}
+	return raw, nil
+}
+
+func rawValue(v interface{}) (bson.RawValue, error) {
+	t, data, err := bson.MarshalValue(v)
+	if err != nil {
+		return bson.RawValue{}, err
+	}
+	return bson.RawValue{Type: t, Value: data}, nil
+}
+
+// lookup returns the value of the field of a document, which is null if the
+// document does not have it
+func lookup(doc bson.Raw, path []string) bson.RawValue {
+	value, err := doc.LookupErr(path...)
+	if err != nil {
+		return bson.RawValue{Type: bsontype.Null}
+	}
+	return value
+}
+
+// matches reports whether the document matches the filter the way it would
+// in Mongo, where an array matches if any of its elements do and values are
+// only compared to values of the same type
+func (f rawFilter) matches(doc bson.Raw) bool {
+	value := lookup(doc, f.path)
+	candidates := []bson.RawValue{value}
+	if value.Type == bsontype.Array {
+		elements, err := value.Array().Values()
+		if err != nil {
+			return false
+		}
+		candidates = elements
+	}
+
+	if f.op == database.FilterNe {
+		equal := rawFilter{path: f.path, op: database.FilterEq, values: f.values}
+		return !equal.matches(doc)
+	}
+	for _, candidate := range candidates {
+		for _, want := range f.values {
+			if f.compare(candidate, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (f rawFilter) compare(value, want bson.RawValue) bool {
+	if f.op == database.FilterPrefix {
+		got, ok := value.StringValueOK()
+		return ok && strings.HasPrefix(got, want.StringValue())
+	}
+	if typeOrder(value.Type) != typeOrder(want.Type) {
+		return false
+	}
+	cmp := compareValues(value, want)
+	switch f.op {
+	case database.FilterEq, database.FilterIn:
+		return cmp == 0
+	case database.FilterLt:
+		return cmp < 0
+	case database.FilterLte:
+		return cmp <= 0
+	case database.FilterGt:
+		return cmp > 0
+	case database.FilterGte:
+		return cmp >= 0
+	}
+	return false
+}
+
+// compareOrder compares the values of two documents by the fields they are
+// ordered by
+func compareOrder(a, b []bson.RawValue, order []database.SortField) int {
+	for i, field := range order {
+		cmp := compareValues(a[i], b[i])
+		if field.Descending {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+// typeOrder returns where values of the type are ordered relative to values
+// of other types, following the BSON comparison order of Mongo
+func typeOrder(t bsontype.Type) int {
+	switch t {
+	case bsontype.MinKey:
+		return 0
+	case bsontype.Undefined, bsontype.Null:
+		return 1
+	case bsontype.Int32, bsontype.Int64, bsontype.Double, bsontype.Decimal128:
+		return 2
+	case bsontype.String, bsontype.Symbol:
+		return 3
+	case bsontype.EmbeddedDocument:
+		return 4
+	case bsontype.Array:
+		return 5
+	case bsontype.Binary:
+		return 6
+	case bsontype.ObjectID:
+		return 7
+	case bsontype.Boolean:
+		return 8
+	case bsontype.DateTime:
+		return 9
+	case bsontype.Timestamp:
+		return 10
+	case bsontype.Regex:
+		return 11
+	case bsontype.MaxKey:
+		return 13
+	}
+	return 12
+}
+
+func compareValues(a, b bson.RawValue) int {
+	if cmp := typeOrder(a.Type) - typeOrder(b.Type); cmp != 0 {
+		return cmp
+	}
+	switch typeOrder(a.Type) {
+	case 1:
+		return 0
+	case 2:
+		return compareFloats(number(a), number(b))
+	case 3:
+		return strings.Compare(a.StringValue(), b.StringValue())
+	case 8:
+		return compareFloats(boolNumber(a.Boolean()), boolNumber(b.Boolean()))
+	case 9:
+		return compareFloats(float64(a.DateTime()), float64(b.DateTime()))
+	}
+	return bytes.Compare(a.Value, b.Value)
+}
+
+func number(v bson.RawValue) float64 {
+	switch v.Type {
+	case bsontype.Int32:
+		return float64(v.Int32())
+	case bsontype.Int64:
+		return float64(v.Int64())
+	case bsontype.Double:
+		return v.Double()
+	}
+	return 0
+}
+
+func boolNumber(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
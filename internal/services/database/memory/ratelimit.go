@@ -0,0 +1,64 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ugcompsoc/apid/internal/services/database"
+)
+
+// rateLimitSweepInterval is how often buckets that are full again are removed
+const rateLimitSweepInterval = time.Minute
+
+// RateLimitRepository is an in-memory implementation of
+// database.RateLimitRepository. Its buckets are only shared within the
+// process, so it can be used with any store by a single replica.
+type RateLimitRepository struct {
+	mu      sync.Mutex
+	buckets map[string]database.RateLimitBucket
+	sweptAt time.Time
+}
+
+var _ database.RateLimitRepository = &RateLimitRepository{}
+
+// NewRateLimitRepository returns a repository without any buckets
+func NewRateLimitRepository() *RateLimitRepository {
+	return &RateLimitRepository{buckets: map[string]database.RateLimitBucket{}}
+}
+
+func (r *RateLimitRepository) Take(ctx context.Context, key string, limit database.RateLimit) (*database.RateLimitResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := database.Now()
+	r.sweep(now)
+	bucket, ok := r.buckets[key]
+	if !ok {
+		bucket = database.RateLimitBucket{Key: key}
+	}
+	result := database.TakeToken(&bucket, limit, now)
+	if result.Allowed {
+		bucket.Version++
+		r.buckets[key] = bucket
+	}
+	return &result, nil
+}
+
+// sweep removes the buckets that are full again, as Mongo does with its TTL
+// index, so clients that have gone away aren't kept forever. The lock must be
+// held by the caller.
+func (r *RateLimitRepository) sweep(now time.Time) {
+	if now.Sub(r.sweptAt) < rateLimitSweepInterval {
+		return
+	}
+	r.sweptAt = now
+	for key, bucket := range r.buckets {
+		if !bucket.ExpiresAt.After(now) {
+			delete(r.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ugcompsoc/apid/internal/services/database"
+)
+
+func TestRateLimitRepository(t *testing.T) {
+	limit := database.RateLimit{Requests: 1, Period: time.Hour}
+
+	t.Run("take respects a cancelled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := NewRateLimitRepository().Take(ctx, "client", limit)
+		assert.ErrorIs(t, err, context.Canceled, "expected take to be cancelled")
+	})
+
+	t.Run("buckets that are full again are swept", func(t *testing.T) {
+		r := NewRateLimitRepository()
+		_, err := r.Take(context.Background(), "full", limit)
+		assert.NoError(t, err, "expected no error taking a token")
+		_, err = r.Take(context.Background(), "empty", limit)
+		assert.NoError(t, err, "expected no error taking a token")
+
+		r.mu.Lock()
+		full := r.buckets["full"]
+		full.ExpiresAt = time.Now().Add(-time.Second)
+		r.buckets["full"] = full
+		r.sweptAt = time.Now().Add(-2 * rateLimitSweepInterval)
+		r.mu.Unlock()
+
+		_, err = r.Take(context.Background(), "other", limit)
+		assert.NoError(t, err, "expected no error taking a token")
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		assert.NotContains(t, r.buckets, "full", "expected the full bucket to be swept")
+		assert.Contains(t, r.buckets, "empty", "expected the empty bucket to be kept")
+	})
+}
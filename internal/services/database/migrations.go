@@ -0,0 +1,463 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ugcompsoc/apid/internal/config"
+	"github.com/ugcompsoc/apid/internal/logging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	migrationsCollection     = "_migrations"
+	migrationsLockCollection = "_migrations_lock"
+	migrationsLockID         = "migrations"
+	defaultMigrationLockTTL  = 5 * time.Minute
+	migrationLockRetryDelay  = 500 * time.Millisecond
+)
+
+var (
+	ErrMigrationLocked   = errors.New("migrations are locked by another process")
+	ErrMigrationLockLost = errors.New("the migration lock was lost to another process")
+)
+
+// Migration is a single, repeatable change to the schema of the datastore.
+// Versions must be unique and are applied in ascending order.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+	Down        func(ctx context.Context, db *mongo.Database) error
+}
+
+// Migrations is the list of every schema migration, new migrations should be
+// appended to the end of this list with the next version number
+var Migrations = []Migration{
+	{
+		Version:     1,
+		Description: "create unique indexes for users and societies",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			for _, c := range []Collection{UsersCollection, SocietiesCollection} {
+				if err := createUniqueIndexes(ctx, db, c); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			for _, c := range []Collection{UsersCollection, SocietiesCollection} {
+				if err := dropUniqueIndexes(ctx, db, c); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     2,
+		Description: "expire rate limit buckets once they are full again",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createExpiryIndex(ctx, db, RateLimitsCollection)
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return dropExpiryIndex(ctx, db, RateLimitsCollection)
+		},
+	},
+	{
+		Version:     3,
+		Description: "expire idempotency keys",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createExpiryIndex(ctx, db, IdempotencyCollection)
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return dropExpiryIndex(ctx, db, IdempotencyCollection)
+		},
+	},
+	{
+		Version:     4,
+		Description: "version documents",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			for _, c := range versionedCollections {
+				_, err := db.Collection(c.Name).UpdateMany(ctx,
+					bson.M{"version": bson.M{"$exists": false}},
+					bson.M{"$set": bson.M{"version": int64(1)}})
+				if err != nil {
+					return fmt.Errorf("failed to version documents in %s: %w", c.Name, err)
+				}
+			}
+			return nil
+		},
+		// documents keep their versions, as older releases ignore them
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return nil
+		},
+	},
+}
+
+type migrationRecord struct {
+	Version     int       `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"applied_at"`
+}
+
+// MigrationStatus describes whether a migration has been applied
+type MigrationStatus struct {
+	Version     int
+	Description string
+	Applied     bool
+	AppliedAt   time.Time
+}
+
+// Migrator applies and reverts migrations, recording the applied versions in
+// the _migrations collection. A lock is held in the _migrations_lock collection
+// while migrating so multiple replicas don't race each other.
+type Migrator struct {
+	Database   *mongo.Database
+	Migrations []Migration
+	LockTTL    time.Duration
+	owner      string
+}
+
+// NewMigrator returns a Migrator for the migrations given, which are sorted by
+// version. An error is returned if any versions are duplicated.
+func NewMigrator(db *mongo.Database, migrations []Migration) (*Migrator, error) {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+	for i, m := range sorted {
+		if m.Version <= 0 {
+			return nil, fmt.Errorf("migration %q has an invalid version %d", m.Description, m.Version)
+		}
+		if m.Up == nil || m.Down == nil {
+			return nil, fmt.Errorf("migration %d must have both an up and down function", m.Version)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, fmt.Errorf("migration version %d is duplicated", m.Version)
+		}
+	}
+
+	hostname, _ := os.Hostname()
+	return &Migrator{
+		Database:   db,
+		Migrations: sorted,
+		LockTTL:    defaultMigrationLockTTL,
+		owner:      hostname + "/" + uuid.New().String(),
+	}, nil
+}
+
+// Migrator returns a Migrator for the application's migrations
+func (ds *Datastore) Migrator() (*Migrator, error) {
+	return NewMigrator(ds.Database, Migrations)
+}
+
+// Status returns every known migration and whether it has been applied
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := []MigrationStatus{}
+	for _, migration := range m.Migrations {
+		status := MigrationStatus{
+			Version:     migration.Version,
+			Description: migration.Description,
+		}
+		if record, ok := applied[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = record.AppliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Up applies pending migrations in ascending order. If steps is zero or less
+// every pending migration is applied. The migrations applied are returned.
+func (m *Migrator) Up(ctx context.Context, steps int) ([]Migration, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.unlock(ctx)
+
+	ctx, release := m.hold(ctx)
+	done, err := m.up(ctx, steps)
+	if lockErr := release(); lockErr != nil {
+		return done, lockErr
+	}
+	return done, err
+}
+
+func (m *Migrator) up(ctx context.Context, steps int) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	done := []Migration{}
+	for _, migration := range m.Migrations {
+		if steps > 0 && len(done) == steps {
+			break
+		}
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		logging.Subsystem(ctx, config.LogSubsystemDatabase).Info().Int("version", migration.Version).Str("description", migration.Description).Msg("applying migration")
+		if err := migration.Up(ctx, m.Database); err != nil {
+			return done, fmt.Errorf("failed to apply migration %d: %w", migration.Version, err)
+		}
+		_, err := m.Database.Collection(migrationsCollection).InsertOne(ctx, migrationRecord{
+			Version:     migration.Version,
+			Description: migration.Description,
+			AppliedAt:   time.Now().UTC(),
+		})
+		if err != nil {
+			return done, fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Down reverts applied migrations in descending order. If steps is zero or
+// less only the latest migration is reverted. The migrations reverted are
+// returned.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if steps <= 0 {
+		steps = 1
+	}
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.unlock(ctx)
+
+	ctx, release := m.hold(ctx)
+	done, err := m.down(ctx, steps)
+	if lockErr := release(); lockErr != nil {
+		return done, lockErr
+	}
+	return done, err
+}
+
+func (m *Migrator) down(ctx context.Context, steps int) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	done := []Migration{}
+	for i := len(m.Migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := m.Migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		logging.Subsystem(ctx, config.LogSubsystemDatabase).Info().Int("version", migration.Version).Str("description", migration.Description).Msg("reverting migration")
+		if err := migration.Down(ctx, m.Database); err != nil {
+			return done, fmt.Errorf("failed to revert migration %d: %w", migration.Version, err)
+		}
+		_, err := m.Database.Collection(migrationsCollection).DeleteOne(ctx, bson.M{"_id": migration.Version})
+		if err != nil {
+			return done, fmt.Errorf("failed to unrecord migration %d: %w", migration.Version, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+func uniqueIndexName(field string) string {
+	return field + "_unique"
+}
+
+func createUniqueIndexes(ctx context.Context, db *mongo.Database, c Collection) error {
+	models := []mongo.IndexModel{}
+	for _, field := range c.Unique {
+		models = append(models, mongo.IndexModel{
+			Keys:    bson.D{{Key: field, Value: 1}},
+			Options: options.Index().SetName(uniqueIndexName(field)).SetUnique(true),
+		})
+	}
+	if len(models) == 0 {
+		return nil
+	}
+	_, err := db.Collection(c.Name).Indexes().CreateMany(ctx, models)
+	return err
+}
+
+func dropUniqueIndexes(ctx context.Context, db *mongo.Database, c Collection) error {
+	for _, field := range c.Unique {
+		if _, err := db.Collection(c.Name).Indexes().DropOne(ctx, uniqueIndexName(field)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func expiryIndexName(field string) string {
+	return field + "_expiry"
+}
+
+// createExpiryIndex creates a TTL index so documents are removed by Mongo once
+// the date in the collection's expiry field has passed
+func createExpiryIndex(ctx context.Context, db *mongo.Database, c Collection) error {
+	_, err := db.Collection(c.Name).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: c.Expiry, Value: 1}},
+		Options: options.Index().SetName(expiryIndexName(c.Expiry)).SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+func dropExpiryIndex(ctx context.Context, db *mongo.Database, c Collection) error {
+	_, err := db.Collection(c.Name).Indexes().DropOne(ctx, expiryIndexName(c.Expiry))
+	return err
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]migrationRecord, error) {
+	cursor, err := m.Database.Collection(migrationsCollection).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list applied migrations: %w", err)
+	}
+	records := []migrationRecord{}
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, fmt.Errorf("failed to decode applied migrations: %w", err)
+	}
+	applied := map[int]migrationRecord{}
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// lock blocks until the migration lock is acquired or the context is done. A
+// lock that has passed its expiry is considered abandoned and is taken over.
+func (m *Migrator) lock(ctx context.Context) error {
+	for {
+		err := m.tryLock(ctx)
+		if !errors.Is(err, ErrMigrationLocked) {
+			return err
+		}
+		logging.Subsystem(ctx, config.LogSubsystemDatabase).Debug().Msg("waiting on migration lock")
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %s", ErrMigrationLocked, ctx.Err())
+		case <-time.After(migrationLockRetryDelay):
+		}
+	}
+}
+
+func (m *Migrator) tryLock(ctx context.Context) error {
+	now := time.Now().UTC()
+	filter := bson.M{
+		"_id":        migrationsLockID,
+		"expires_at": bson.M{"$lt": now},
+	}
+	update := bson.M{"$set": bson.M{
+		"owner":      m.owner,
+		"expires_at": now.Add(m.LockTTL),
+	}}
+	_, err := m.Database.Collection(migrationsLockCollection).UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrMigrationLocked
+	}
+	if err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	return nil
+}
+
+// hold extends the migration lock every third of its TTL so that migrations
+// taking longer than the TTL aren't taken over. The context returned is
+// cancelled if the lock is lost, in which case release returns
+// ErrMigrationLockLost. release must be called once migrating is done.
+func (m *Migrator) hold(ctx context.Context) (context.Context, func() error) {
+	ctx, cancel := context.WithCancel(ctx)
+	interval := m.LockTTL / 3
+	if interval <= 0 {
+		return ctx, func() error {
+			cancel()
+			return nil
+		}
+	}
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	lost := make(chan error, 1)
+	go func() {
+		defer close(stopped)
+		logger := logging.Subsystem(ctx, config.LogSubsystemDatabase)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			err := m.extendLock(ctx)
+			if errors.Is(err, ErrMigrationLockLost) {
+				logger.Error().Msg("migration lock was lost, aborting migrations")
+				lost <- err
+				cancel()
+				return
+			}
+			if err != nil {
+				// the lock is still ours until it expires, so try again
+				logger.Warn().Err(err).Msg("failed to extend migration lock")
+			}
+		}
+	}()
+
+	return ctx, func() error {
+		close(stop)
+		<-stopped
+		cancel()
+		select {
+		case err := <-lost:
+			return err
+		default:
+			return nil
+		}
+	}
+}
+
+func (m *Migrator) extendLock(ctx context.Context) error {
+	filter := bson.M{
+		"_id":   migrationsLockID,
+		"owner": m.owner,
+	}
+	update := bson.M{"$set": bson.M{
+		"expires_at": time.Now().UTC().Add(m.LockTTL),
+	}}
+	result, err := m.Database.Collection(migrationsLockCollection).UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to extend migration lock: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrMigrationLockLost
+	}
+	return nil
+}
+
+func (m *Migrator) unlock(ctx context.Context) {
+	logger := logging.Subsystem(ctx, config.LogSubsystemDatabase)
+	// the context given to Up/Down may be done by now, so use a fresh one
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := m.Database.Collection(migrationsLockCollection).DeleteOne(ctx, bson.M{
+		"_id":   migrationsLockID,
+		"owner": m.owner,
+	})
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to release migration lock")
+	}
+}
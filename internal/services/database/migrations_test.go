@@ -0,0 +1,261 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func testMigrations() []Migration {
+	return []Migration{
+		{
+			Version:     2,
+			Description: "index widgets by colour",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				_, err := db.Collection("widgets").Indexes().CreateOne(ctx, mongo.IndexModel{
+					Keys:    bson.D{{Key: "colour", Value: 1}},
+					Options: options.Index().SetName("colour_1"),
+				})
+				return err
+			},
+			Down: func(ctx context.Context, db *mongo.Database) error {
+				_, err := db.Collection("widgets").Indexes().DropOne(ctx, "colour_1")
+				return err
+			},
+		},
+		{
+			Version:     1,
+			Description: "create widgets",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				return db.CreateCollection(ctx, "widgets")
+			},
+			Down: func(ctx context.Context, db *mongo.Database) error {
+				return db.Collection("widgets").Drop(ctx)
+			},
+		},
+	}
+}
+
+func TestNewMigrator(t *testing.T) {
+	noop := func(ctx context.Context, db *mongo.Database) error { return nil }
+
+	runs := []struct {
+		name       string
+		migrations []Migration
+		err        string
+	}{
+		{
+			name:       "invalid version",
+			migrations: []Migration{{Version: 0, Description: "zero", Up: noop, Down: noop}},
+			err:        "migration \"zero\" has an invalid version 0",
+		},
+		{
+			name:       "missing down function",
+			migrations: []Migration{{Version: 1, Up: noop}},
+			err:        "migration 1 must have both an up and down function",
+		},
+		{
+			name: "duplicated version",
+			migrations: []Migration{
+				{Version: 1, Up: noop, Down: noop},
+				{Version: 1, Up: noop, Down: noop},
+			},
+			err: "migration version 1 is duplicated",
+		},
+	}
+
+	for _, run := range runs {
+		t.Run(run.name, func(t *testing.T) {
+			_, err := NewMigrator(nil, run.migrations)
+			assert.EqualError(t, err, run.err, "unexpected error creating migrator")
+		})
+	}
+
+	t.Run("migrations are sorted by version", func(t *testing.T) {
+		m, err := NewMigrator(nil, testMigrations())
+		assert.NoError(t, err, "expected no error creating migrator")
+		assert.Equal(t, 1, m.Migrations[0].Version, "expected version 1 first")
+		assert.Equal(t, 2, m.Migrations[1].Version, "expected version 2 second")
+	})
+
+	t.Run("application migrations are valid", func(t *testing.T) {
+		_, err := NewMigrator(nil, Migrations)
+		assert.NoError(t, err, "expected application migrations to be valid")
+	})
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	db := ds.Client.Database("test_migrations")
+	defer db.Drop(ctx)
+
+	m, err := NewMigrator(db, testMigrations())
+	assert.NoError(t, err, "expected no error creating migrator")
+
+	t.Run("nothing is applied to begin with", func(t *testing.T) {
+		statuses, err := m.Status(ctx)
+		assert.NoError(t, err, "expected no error getting status")
+		assert.Len(t, statuses, 2, "expected both migrations to be listed")
+		assert.False(t, statuses[0].Applied, "expected version 1 to be pending")
+		assert.False(t, statuses[1].Applied, "expected version 2 to be pending")
+	})
+
+	t.Run("up applies the number of steps given", func(t *testing.T) {
+		applied, err := m.Up(ctx, 1)
+		assert.NoError(t, err, "expected no error applying migrations")
+		assert.Len(t, applied, 1, "expected one migration to be applied")
+		assert.Equal(t, 1, applied[0].Version, "expected version 1 to be applied")
+	})
+
+	t.Run("up applies every pending migration", func(t *testing.T) {
+		applied, err := m.Up(ctx, 0)
+		assert.NoError(t, err, "expected no error applying migrations")
+		assert.Len(t, applied, 1, "expected one migration to be applied")
+		assert.Equal(t, 2, applied[0].Version, "expected version 2 to be applied")
+
+		statuses, err := m.Status(ctx)
+		assert.NoError(t, err, "expected no error getting status")
+		assert.True(t, statuses[0].Applied, "expected version 1 to be applied")
+		assert.True(t, statuses[1].Applied, "expected version 2 to be applied")
+
+		indexes, err := db.Collection("widgets").Indexes().ListSpecifications(ctx)
+		assert.NoError(t, err, "expected no error listing indexes")
+		assert.Len(t, indexes, 2, "expected the _id and colour indexes")
+	})
+
+	t.Run("up is repeatable", func(t *testing.T) {
+		applied, err := m.Up(ctx, 0)
+		assert.NoError(t, err, "expected no error applying migrations")
+		assert.Len(t, applied, 0, "expected no migrations to be applied")
+	})
+
+	t.Run("down reverts the latest migration", func(t *testing.T) {
+		reverted, err := m.Down(ctx, 0)
+		assert.NoError(t, err, "expected no error reverting migrations")
+		assert.Len(t, reverted, 1, "expected one migration to be reverted")
+		assert.Equal(t, 2, reverted[0].Version, "expected version 2 to be reverted")
+
+		reverted, err = m.Down(ctx, 5)
+		assert.NoError(t, err, "expected no error reverting migrations")
+		assert.Len(t, reverted, 1, "expected one migration to be reverted")
+		assert.Equal(t, 1, reverted[0].Version, "expected version 1 to be reverted")
+	})
+
+	t.Run("a failing migration is not recorded", func(t *testing.T) {
+		failing, err := NewMigrator(db, []Migration{{
+			Version: 1,
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				return errors.New("oh no")
+			},
+			Down: func(ctx context.Context, db *mongo.Database) error { return nil },
+		}})
+		assert.NoError(t, err, "expected no error creating migrator")
+		_, err = failing.Up(ctx, 0)
+		assert.EqualError(t, err, "failed to apply migration 1: oh no", "expected migration error")
+		statuses, err := failing.Status(ctx)
+		assert.NoError(t, err, "expected no error getting status")
+		assert.False(t, statuses[0].Applied, "expected migration to not be recorded")
+	})
+}
+
+func TestMigratorLock(t *testing.T) {
+	ctx := context.Background()
+	db := ds.Client.Database("test_migrations_lock")
+	defer db.Drop(ctx)
+
+	first, err := NewMigrator(db, testMigrations())
+	assert.NoError(t, err, "expected no error creating migrator")
+	second, err := NewMigrator(db, testMigrations())
+	assert.NoError(t, err, "expected no error creating migrator")
+
+	t.Run("lock can only be held by one migrator", func(t *testing.T) {
+		err := first.tryLock(ctx)
+		assert.NoError(t, err, "expected first migrator to acquire lock")
+		err = second.tryLock(ctx)
+		assert.ErrorIs(t, err, ErrMigrationLocked, "expected second migrator to be locked out")
+
+		timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		_, err = second.Up(timeoutCtx, 0)
+		assert.ErrorIs(t, err, ErrMigrationLocked, "expected second migrator to give up waiting")
+
+		first.unlock(ctx)
+		err = second.tryLock(ctx)
+		assert.NoError(t, err, "expected second migrator to acquire released lock")
+		second.unlock(ctx)
+	})
+
+	t.Run("expired lock is taken over", func(t *testing.T) {
+		first.LockTTL = -time.Minute
+		err := first.tryLock(ctx)
+		assert.NoError(t, err, "expected first migrator to acquire lock")
+		err = second.tryLock(ctx)
+		assert.NoError(t, err, "expected second migrator to take over expired lock")
+		second.unlock(ctx)
+	})
+
+	t.Run("lock is extended while migrating", func(t *testing.T) {
+		db := ds.Client.Database("test_migrations_heartbeat")
+		defer db.Drop(ctx)
+		slow, err := NewMigrator(db, []Migration{{
+			Version: 1,
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				time.Sleep(200 * time.Millisecond)
+				return nil
+			},
+			Down: func(ctx context.Context, db *mongo.Database) error { return nil },
+		}})
+		assert.NoError(t, err, "expected no error creating migrator")
+		slow.LockTTL = 90 * time.Millisecond
+		other, err := NewMigrator(db, nil)
+		assert.NoError(t, err, "expected no error creating migrator")
+
+		errs := make(chan error, 1)
+		go func() {
+			_, err := slow.Up(ctx, 0)
+			errs <- err
+		}()
+		time.Sleep(150 * time.Millisecond)
+		err = other.tryLock(ctx)
+		assert.ErrorIs(t, err, ErrMigrationLocked, "expected lock to still be held past its TTL")
+		assert.NoError(t, <-errs, "expected no error applying migrations")
+	})
+
+	t.Run("losing the lock aborts migrating", func(t *testing.T) {
+		db := ds.Client.Database("test_migrations_lost")
+		defer db.Drop(ctx)
+		m, err := NewMigrator(db, []Migration{{
+			Version: 1,
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				_, err := db.Collection(migrationsLockCollection).UpdateOne(ctx,
+					bson.M{"_id": migrationsLockID},
+					bson.M{"$set": bson.M{"owner": "someone else"}},
+				)
+				if err != nil {
+					return err
+				}
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(time.Second):
+					return nil
+				}
+			},
+			Down: func(ctx context.Context, db *mongo.Database) error { return nil },
+		}})
+		assert.NoError(t, err, "expected no error creating migrator")
+		m.LockTTL = 30 * time.Millisecond
+
+		_, err = m.Up(ctx, 0)
+		assert.ErrorIs(t, err, ErrMigrationLockLost, "expected migrating to be aborted")
+		statuses, err := m.Status(ctx)
+		assert.NoError(t, err, "expected no error getting status")
+		assert.False(t, statuses[0].Applied, "expected migration to not be recorded")
+	})
+}
@@ -0,0 +1,86 @@
+package database
+
+import "time"
+
+const (
+	RoleAdmin     = "admin"
+	RoleCommittee = "committee"
+	RoleMember    = "member"
+)
+
+// Model is implemented by every document kept in a Store
+type Model interface {
+	GetMeta() *Meta
+}
+
+// Meta holds the fields shared by every document, it should be embedded inline
+type Meta struct {
+	ID        string    `bson:"_id" json:"id" example:"0b4c2f3e-5d6a-4b7c-8d9e-0f1a2b3c4d5e"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at" example:"2023-07-01T12:00:00Z"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at" example:"2023-07-01T12:00:00Z"`
+	// Version starts at 1 and goes up by one every time the document is
+	// updated, so an update can't overwrite changes it didn't see
+	Version int64 `bson:"version" json:"version" example:"1"`
+}
+
+func (m *Meta) GetMeta() *Meta {
+	return m
+}
+
+type User struct {
+	Meta     `bson:",inline"`
+	Username string   `bson:"username" json:"username" example:"jbloggs"`
+	Email    string   `bson:"email" json:"email" example:"j.bloggs1@universityofgalway.ie"`
+	Name     string   `bson:"name" json:"name" example:"Joe Bloggs"`
+	Roles    []string `bson:"roles" json:"roles" example:"member"`
+}
+
+// HasRole reports whether the user has the role given
+func (u *User) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Token is an API token belonging to a user. The ID of a token is the hash of
+// its secret, the secret itself is never stored.
+type Token struct {
+	Meta      `bson:",inline"`
+	UserID    string    `bson:"user_id" json:"user_id" example:"0b4c2f3e-5d6a-4b7c-8d9e-0f1a2b3c4d5e"`
+	Name      string    `bson:"name" json:"name" example:"dashboard"`
+	ExpiresAt time.Time `bson:"expires_at" json:"expires_at" example:"2024-07-01T12:00:00Z"`
+}
+
+// Expired reports whether the token has passed its expiry, a token without an
+// expiry never expires
+func (t *Token) Expired() bool {
+	return !t.ExpiresAt.IsZero() && time.Now().After(t.ExpiresAt)
+}
+
+type Society struct {
+	Meta        `bson:",inline"`
+	Slug        string `bson:"slug" json:"slug" example:"compsoc"`
+	Name        string `bson:"name" json:"name" example:"Computer Society"`
+	Description string `bson:"description" json:"description" example:"The best society on campus"`
+}
+
+type Event struct {
+	Meta        `bson:",inline"`
+	SocietyID   string    `bson:"society_id" json:"society_id" example:"0b4c2f3e-5d6a-4b7c-8d9e-0f1a2b3c4d5e"`
+	Title       string    `bson:"title" json:"title" example:"Intro to Go"`
+	Description string    `bson:"description" json:"description" example:"Learn Go with CompSoc"`
+	Location    string    `bson:"location" json:"location" example:"IT125G"`
+	StartsAt    time.Time `bson:"starts_at" json:"starts_at" example:"2023-09-20T18:00:00Z"`
+	EndsAt      time.Time `bson:"ends_at" json:"ends_at" example:"2023-09-20T20:00:00Z"`
+}
+
+type Resource struct {
+	Meta    `bson:",inline"`
+	OwnerID string `bson:"owner_id" json:"owner_id" example:"0b4c2f3e-5d6a-4b7c-8d9e-0f1a2b3c4d5e"`
+	Kind    string `bson:"kind" json:"kind" example:"vm"`
+	Name    string `bson:"name" json:"name" example:"my-first-vm"`
+	Status  string `bson:"status" json:"status" example:"running"`
+}
@@ -0,0 +1,185 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidQuery = errors.New("query is invalid")
+
+// The operators documents can be filtered with. FilterIn matches any of the
+// values in a bson.A and FilterPrefix matches strings starting with the value.
+const (
+	FilterEq     = "eq"
+	FilterNe     = "ne"
+	FilterLt     = "lt"
+	FilterLte    = "lte"
+	FilterGt     = "gt"
+	FilterGte    = "gte"
+	FilterIn     = "in"
+	FilterPrefix = "prefix"
+)
+
+// Filter matches documents whose field compares to the value with the
+// operator. Array fields match if any of their elements do, as they do in
+// Mongo.
+type Filter struct {
+	Field string
+	Op    string
+	Value interface{}
+}
+
+// SortField orders documents by a field
+type SortField struct {
+	Field      string
+	Descending bool
+}
+
+// Query selects a page of the documents of a collection, the documents must
+// match every filter
+type Query struct {
+	Filters []Filter
+	// Sort orders the documents, ties are broken by the ID of the documents
+	// so every document has its own place in the order
+	Sort []SortField
+	// After are the values of the last document of the previous page, as
+	// given by Page.Next, documents up to and including it are skipped
+	After []bson.RawValue
+	// Limit is the most documents the page holds, or every document if zero
+	Limit int
+}
+
+// Page is a page of the documents selected by a query
+type Page[T any] struct {
+	Items []T
+	// Next is given as Query.After to get the next page, it is nil on the
+	// last page
+	Next []bson.RawValue
+}
+
+// Order returns the fields documents are ordered by, which always ends with
+// the ID unless the sort already has it
+func (q Query) Order() []SortField {
+	order := make([]SortField, 0, len(q.Sort)+1)
+	for _, field := range q.Sort {
+		order = append(order, field)
+		if field.Field == "_id" {
+			return order
+		}
+	}
+	return append(order, SortField{Field: "_id"})
+}
+
+// Validate returns ErrInvalidQuery if the query can't be run
+func (q Query) Validate() error {
+	for _, filter := range q.Filters {
+		switch filter.Op {
+		case FilterEq, FilterNe, FilterLt, FilterLte, FilterGt, FilterGte:
+		case FilterIn:
+			if _, ok := filter.Value.(bson.A); !ok {
+				return fmt.Errorf("%w: the values of the in filter of %s must be a bson.A", ErrInvalidQuery, filter.Field)
+			}
+		case FilterPrefix:
+			if _, ok := filter.Value.(string); !ok {
+				return fmt.Errorf("%w: the value of the prefix filter of %s must be a string", ErrInvalidQuery, filter.Field)
+			}
+		default:
+			return fmt.Errorf("%w: unknown filter operator %s", ErrInvalidQuery, filter.Op)
+		}
+	}
+	if q.After != nil && len(q.After) != len(q.Order()) {
+		return fmt.Errorf("%w: expected %d values to start after, got %d", ErrInvalidQuery, len(q.Order()), len(q.After))
+	}
+	if q.Limit < 0 {
+		return fmt.Errorf("%w: the limit cannot be negative", ErrInvalidQuery)
+	}
+	return nil
+}
+
+// CursorOf returns the values of the fields a document is ordered by, which
+// the next page starts after. Missing fields are null, as they are in Mongo.
+func CursorOf(doc bson.Raw, order []SortField) []bson.RawValue {
+	values := make([]bson.RawValue, len(order))
+	for i, field := range order {
+		value, err := doc.LookupErr(strings.Split(field.Field, ".")...)
+		if err != nil {
+			value = bson.RawValue{Type: bsontype.Null}
+		}
+		values[i] = value
+	}
+	return values
+}
+
+// NewPage returns the page of the documents given, which are up to one more
+// than the limit of the query so that it can tell whether there is a next
+// page
+func NewPage[T any](docs []T, q Query) (*Page[T], error) {
+	if q.Limit == 0 || len(docs) <= q.Limit {
+		return &Page[T]{Items: docs}, nil
+	}
+	docs = docs[:q.Limit]
+	raw, err := bson.Marshal(&docs[len(docs)-1])
+	if err != nil {
+		return nil, err
+	}
+	return &Page[T]{Items: docs, Next: CursorOf(raw, q.Order())}, nil
+}
+
+// mongoFilter returns the Mongo filter selecting the documents of the query
+func (q Query) mongoFilter() bson.D {
+	clauses := bson.A{}
+	for _, filter := range q.Filters {
+		var condition bson.D
+		if filter.Op == FilterPrefix {
+			pattern := "^" + regexp.QuoteMeta(filter.Value.(string))
+			condition = bson.D{{Key: "$regex", Value: primitive.Regex{Pattern: pattern}}}
+		} else {
+			condition = bson.D{{Key: "$" + filter.Op, Value: filter.Value}}
+		}
+		clauses = append(clauses, bson.D{{Key: filter.Field, Value: condition}})
+	}
+
+	// the documents after the cursor are those that are further along in
+	// the order by the first field they differ in
+	if q.After != nil {
+		order := q.Order()
+		after := bson.A{}
+		for i, field := range order {
+			clause := bson.D{}
+			for j := 0; j < i; j++ {
+				clause = append(clause, bson.E{Key: order[j].Field, Value: bson.D{{Key: "$eq", Value: q.After[j]}}})
+			}
+			op := "$gt"
+			if field.Descending {
+				op = "$lt"
+			}
+			clause = append(clause, bson.E{Key: field.Field, Value: bson.D{{Key: op, Value: q.After[i]}}})
+			after = append(after, clause)
+		}
+		clauses = append(clauses, bson.D{{Key: "$or", Value: after}})
+	}
+
+	if len(clauses) == 0 {
+		return bson.D{}
+	}
+	return bson.D{{Key: "$and", Value: clauses}}
+}
+
+// mongoSort returns the Mongo sort ordering the documents of the query
+func (q Query) mongoSort() bson.D {
+	sort := bson.D{}
+	for _, field := range q.Order() {
+		direction := 1
+		if field.Descending {
+			direction = -1
+		}
+		sort = append(sort, bson.E{Key: field.Field, Value: direction})
+	}
+	return sort
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestQueryOrder(t *testing.T) {
+	t.Run("ties are broken by id", func(t *testing.T) {
+		q := Query{Sort: []SortField{{Field: "name", Descending: true}}}
+		assert.Equal(t, []SortField{{Field: "name", Descending: true}, {Field: "_id"}}, q.Order(), "unexpected order")
+	})
+
+	t.Run("fields after the id are never reached", func(t *testing.T) {
+		q := Query{Sort: []SortField{{Field: "_id", Descending: true}, {Field: "name"}}}
+		assert.Equal(t, []SortField{{Field: "_id", Descending: true}}, q.Order(), "unexpected order")
+	})
+}
+
+func TestQueryMongo(t *testing.T) {
+	name, _ := bson.Marshal(bson.D{{Key: "name", Value: "bob"}, {Key: "_id", Value: "2"}})
+	after := CursorOf(name, []SortField{{Field: "name"}, {Field: "_id"}})
+	q := Query{
+		Filters: []Filter{
+			{Field: "roles", Op: FilterIn, Value: bson.A{"admin"}},
+			{Field: "username", Op: FilterPrefix, Value: "a.b"},
+		},
+		Sort:  []SortField{{Field: "name", Descending: true}},
+		After: after,
+	}
+
+	assert.Equal(t, bson.D{{Key: "$and", Value: bson.A{
+		bson.D{{Key: "roles", Value: bson.D{{Key: "$in", Value: bson.A{"admin"}}}}},
+		bson.D{{Key: "username", Value: bson.D{{Key: "$regex", Value: primitive.Regex{Pattern: `^a\.b`}}}}},
+		bson.D{{Key: "$or", Value: bson.A{
+			bson.D{{Key: "name", Value: bson.D{{Key: "$lt", Value: after[0]}}}},
+			bson.D{
+				{Key: "name", Value: bson.D{{Key: "$eq", Value: after[0]}}},
+				{Key: "_id", Value: bson.D{{Key: "$gt", Value: after[1]}}},
+			},
+		}}},
+	}}}, q.mongoFilter(), "unexpected filter")
+	assert.Equal(t, bson.D{{Key: "name", Value: -1}, {Key: "_id", Value: 1}}, q.mongoSort(), "unexpected sort")
+	assert.Equal(t, bson.D{}, Query{}.mongoFilter(), "expected an empty query to match everything")
+}
+
+func TestQueryValidate(t *testing.T) {
+	runs := []struct {
+		name  string
+		query Query
+		valid bool
+	}{
+		{name: "empty query", query: Query{}, valid: true},
+		{name: "unknown operator", query: Query{Filters: []Filter{{Field: "name", Op: "like"}}}},
+		{name: "in without an array", query: Query{Filters: []Filter{{Field: "name", Op: FilterIn, Value: "bob"}}}},
+		{name: "prefix without a string", query: Query{Filters: []Filter{{Field: "name", Op: FilterPrefix, Value: 1}}}},
+		{name: "cursor of another order", query: Query{After: []bson.RawValue{{}, {}}}},
+		{name: "negative limit", query: Query{Limit: -1}},
+	}
+
+	for _, run := range runs {
+		run := run
+		t.Run(run.name, func(t *testing.T) {
+			err := run.query.Validate()
+			if run.valid {
+				assert.NoError(t, err, "expected the query to be valid")
+			} else {
+				assert.ErrorIs(t, err, ErrInvalidQuery, "expected the query to be invalid")
+			}
+		})
+	}
+}
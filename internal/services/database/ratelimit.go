@@ -0,0 +1,141 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// rateLimitAttempts is how many times a token is tried to be taken from a
+// bucket that is changed concurrently before giving up
+const rateLimitAttempts = 5
+
+var ErrRateLimitContention = errors.New("rate limit bucket is changing too often to take a token")
+
+// RateLimit describes a token bucket. Requests tokens are added to the bucket
+// every Period, and it holds Burst tokens, or Requests if Burst is zero.
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+// RateLimitBucket is the token bucket of a single client
+type RateLimitBucket struct {
+	Key       string    `bson:"_id"`
+	Tokens    float64   `bson:"tokens"`
+	UpdatedAt time.Time `bson:"updated_at"`
+	// ExpiresAt is when the bucket will be full again. It can be removed
+	// after this, as a missing bucket is full.
+	ExpiresAt time.Time `bson:"expires_at"`
+	// Version is incremented every time the bucket changes, so concurrent
+	// changes can be detected
+	Version int64 `bson:"version"`
+}
+
+// RateLimitResult describes the bucket of a client after taking a token
+type RateLimitResult struct {
+	Allowed bool
+	// Limit is how many tokens the bucket holds
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is how long until a token can be taken, if none could be
+	RetryAfter time.Duration
+}
+
+// RateLimitRepository keeps the token buckets of rate limited clients
+type RateLimitRepository interface {
+	// Take takes a token from the bucket with the key given, creating it if
+	// it does not exist. The result says whether a token could be taken.
+	Take(ctx context.Context, key string, limit RateLimit) (*RateLimitResult, error)
+}
+
+// TakeToken refills the bucket for the time passed since it was last updated
+// and takes a token from it, if it has one. Buckets that have never been
+// updated are full.
+func TakeToken(bucket *RateLimitBucket, limit RateLimit, now time.Time) RateLimitResult {
+	burst := float64(limit.Burst)
+	if limit.Burst == 0 {
+		burst = float64(limit.Requests)
+	}
+	// how long it takes for a single token to be added
+	interval := float64(limit.Period) / float64(limit.Requests)
+
+	tokens := burst
+	if !bucket.UpdatedAt.IsZero() {
+		elapsed := math.Max(0, float64(now.Sub(bucket.UpdatedAt)))
+		tokens = math.Min(burst, bucket.Tokens+elapsed/interval)
+	}
+
+	result := RateLimitResult{Limit: int(burst)}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - tokens) * interval)
+	}
+	result.Remaining = int(tokens)
+	result.Reset = time.Duration((burst - tokens) * interval)
+
+	bucket.Tokens = tokens
+	bucket.UpdatedAt = now
+	bucket.ExpiresAt = now.Add(result.Reset)
+	return result
+}
+
+// mongoRateLimitRepository implements RateLimitRepository on top of a Mongo
+// collection, so every replica shares the same buckets
+type mongoRateLimitRepository struct {
+	collection *mongo.Collection
+}
+
+func newMongoRateLimitRepository(db *mongo.Database) *mongoRateLimitRepository {
+	return &mongoRateLimitRepository{collection: db.Collection(RateLimitsCollection.Name)}
+}
+
+// Take reads the bucket, takes a token from it and writes it back only if no
+// one else has changed it in the meantime, trying again if they have
+func (r *mongoRateLimitRepository) Take(ctx context.Context, key string, limit RateLimit) (*RateLimitResult, error) {
+	for attempt := 0; attempt < rateLimitAttempts; attempt++ {
+		bucket := RateLimitBucket{Key: key}
+		err := r.collection.FindOne(ctx, bson.M{"_id": key}).Decode(&bucket)
+		exists := err == nil
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("failed to get rate limit bucket: %w", err)
+		}
+
+		result := TakeToken(&bucket, limit, Now())
+		if !result.Allowed {
+			// the bucket is only refilled, which is worked out again from
+			// when it was last updated, so it doesn't need to be written
+			return &result, nil
+		}
+
+		version := bucket.Version
+		bucket.Version++
+		if !exists {
+			_, err = r.collection.InsertOne(ctx, bucket)
+			if mongo.IsDuplicateKeyError(err) {
+				continue
+			}
+		} else {
+			var updated *mongo.UpdateResult
+			updated, err = r.collection.ReplaceOne(ctx, bson.M{"_id": key, "version": version}, bucket)
+			if err == nil && updated.MatchedCount == 0 {
+				continue
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to update rate limit bucket: %w", err)
+		}
+		return &result, nil
+	}
+	return nil, ErrRateLimitContention
+}
@@ -0,0 +1,50 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTakeToken(t *testing.T) {
+	limit := RateLimit{Requests: 10, Period: 10 * time.Second}
+	start := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("a new bucket is full", func(t *testing.T) {
+		bucket := RateLimitBucket{}
+		result := TakeToken(&bucket, limit, start)
+		assert.True(t, result.Allowed, "expected a token to be taken")
+		assert.Equal(t, 10, result.Limit, "expected the limit to default to the requests")
+		assert.Equal(t, 9, result.Remaining, "unexpected remaining tokens")
+		assert.Equal(t, time.Second, result.Reset, "expected the bucket to be full in a second")
+		assert.Equal(t, start.Add(time.Second), bucket.ExpiresAt, "expected the bucket to expire once full")
+	})
+
+	t.Run("an empty bucket is refilled over time", func(t *testing.T) {
+		bucket := RateLimitBucket{Tokens: 0, UpdatedAt: start}
+		result := TakeToken(&bucket, limit, start.Add(500*time.Millisecond))
+		assert.False(t, result.Allowed, "expected no token to be taken")
+		assert.Equal(t, 500*time.Millisecond, result.RetryAfter, "expected a token in half a second")
+
+		result = TakeToken(&bucket, limit, start.Add(2500*time.Millisecond))
+		assert.True(t, result.Allowed, "expected a token to be taken")
+		assert.Equal(t, 1, result.Remaining, "expected a token and a half to be left")
+		assert.Equal(t, time.Duration(0), result.RetryAfter, "expected no retry after")
+	})
+
+	t.Run("a bucket is never fuller than its burst", func(t *testing.T) {
+		bucket := RateLimitBucket{Tokens: 0, UpdatedAt: start}
+		result := TakeToken(&bucket, RateLimit{Requests: 10, Period: 10 * time.Second, Burst: 3}, start.Add(time.Hour))
+		assert.True(t, result.Allowed, "expected a token to be taken")
+		assert.Equal(t, 3, result.Limit, "expected the limit to be the burst")
+		assert.Equal(t, 2, result.Remaining, "expected the bucket to have been full")
+	})
+
+	t.Run("a clock going backwards doesn't empty the bucket", func(t *testing.T) {
+		bucket := RateLimitBucket{Tokens: 5, UpdatedAt: start}
+		result := TakeToken(&bucket, limit, start.Add(-time.Minute))
+		assert.True(t, result.Allowed, "expected a token to be taken")
+		assert.Equal(t, 4, result.Remaining, "unexpected remaining tokens")
+	})
+}
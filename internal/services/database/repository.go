@@ -0,0 +1,134 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoRepository implements Repository on top of a Mongo collection
+type mongoRepository[T any, PT ModelPointer[T]] struct {
+	collection *mongo.Collection
+}
+
+func newMongoRepository[T any, PT ModelPointer[T]](db *mongo.Database, c Collection) *mongoRepository[T, PT] {
+	return &mongoRepository[T, PT]{collection: db.Collection(c.Name)}
+}
+
+func (r *mongoRepository[T, PT]) Create(ctx context.Context, doc *T) error {
+	PrepareCreate(PT(doc))
+	_, err := r.collection.InsertOne(ctx, doc)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrConflict
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create document in %s: %w", r.collection.Name(), err)
+	}
+	return nil
+}
+
+func (r *mongoRepository[T, PT]) Get(ctx context.Context, id string) (*T, error) {
+	doc := new(T)
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document from %s: %w", r.collection.Name(), err)
+	}
+	return doc, nil
+}
+
+func (r *mongoRepository[T, PT]) List(ctx context.Context) ([]T, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list documents in %s: %w", r.collection.Name(), err)
+	}
+	docs := []T{}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode documents in %s: %w", r.collection.Name(), err)
+	}
+	return docs, nil
+}
+
+func (r *mongoRepository[T, PT]) Find(ctx context.Context, q Query) (*Page[T], error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	opts := options.Find().SetSort(q.mongoSort())
+	if q.Limit > 0 {
+		opts.SetLimit(int64(q.Limit) + 1)
+	}
+	cursor, err := r.collection.Find(ctx, q.mongoFilter(), opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find documents in %s: %w", r.collection.Name(), err)
+	}
+	docs := []T{}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode documents in %s: %w", r.collection.Name(), err)
+	}
+	return NewPage(docs, q)
+}
+
+func (r *mongoRepository[T, PT]) Update(ctx context.Context, doc *T) error {
+	meta := PT(doc).GetMeta()
+	filter := versionFilter(meta.ID, meta.Version)
+	fields, err := PrepareUpdate(PT(doc))
+	if err != nil {
+		return err
+	}
+	update := bson.M{"$set": fields, "$inc": bson.M{"version": 1}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return r.missing(ctx, meta.ID, meta.Version)
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrConflict
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update document in %s: %w", r.collection.Name(), err)
+	}
+	return nil
+}
+
+func (r *mongoRepository[T, PT]) Delete(ctx context.Context, id string, version int64) error {
+	result, err := r.collection.DeleteOne(ctx, versionFilter(id, version))
+	if err != nil {
+		return fmt.Errorf("failed to delete document from %s: %w", r.collection.Name(), err)
+	}
+	if result.DeletedCount == 0 {
+		return r.missing(ctx, id, version)
+	}
+	return nil
+}
+
+// versionFilter matches the document with the ID given, if it is at the
+// version given when it isn't 0
+func versionFilter(id string, version int64) bson.M {
+	filter := bson.M{"_id": id}
+	if version != 0 {
+		filter["version"] = version
+	}
+	return filter
+}
+
+// missing returns why a document at the version given wasn't found, which is
+// either that it doesn't exist or that it is at another version
+func (r *mongoRepository[T, PT]) missing(ctx context.Context, id string, version int64) error {
+	if version == 0 {
+		return ErrNotFound
+	}
+	count, err := r.collection.CountDocuments(ctx, bson.M{"_id": id}, options.Count().SetLimit(1))
+	if err != nil {
+		return fmt.Errorf("failed to check document in %s: %w", r.collection.Name(), err)
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return ErrVersionMismatch
+}
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	ErrNotFound = errors.New("document not found")
+	ErrConflict = errors.New("document conflicts with an existing document")
+	ErrClosed   = errors.New("store is closed")
+	// ErrVersionMismatch is returned when a document has been updated since
+	// the version given was read
+	ErrVersionMismatch = errors.New("document has been changed since it was read")
+)
+
+// Store is implemented by every backend the API can keep its documents in.
+// Handlers should depend on this rather than on a specific backend.
+type Store interface {
+	Ping(ctx context.Context) error
+	Close(ctx context.Context) error
+	Users() Repository[User]
+	Societies() Repository[Society]
+	Events() Repository[Event]
+	Resources() Repository[Resource]
+	Tokens() Repository[Token]
+	RateLimits() RateLimitRepository
+	Idempotency() IdempotencyRepository
+	FeatureFlags() FeatureFlagRepository
+}
+
+// Repository is the set of operations available on a single collection.
+// Get, Update and Delete return ErrNotFound if the document does not exist and
+// Create and Update return ErrConflict if a unique field is already taken.
+// Find returns ErrInvalidQuery if the query can't be run.
+//
+// Update only changes the document if it is still at the version it has, and
+// Delete if it is at the version given, otherwise they return
+// ErrVersionMismatch. A version of 0 changes the document whatever its
+// version. Update increments the version of the document it is given.
+type Repository[T any] interface {
+	Create(ctx context.Context, doc *T) error
+	Get(ctx context.Context, id string) (*T, error)
+	List(ctx context.Context) ([]T, error)
+	Find(ctx context.Context, q Query) (*Page[T], error)
+	Update(ctx context.Context, doc *T) error
+	Delete(ctx context.Context, id string, version int64) error
+}
+
+// ModelPointer constrains the type parameters of repository implementations
+// to pointers of models
+type ModelPointer[T any] interface {
+	*T
+	Model
+}
+
+// Collection describes a collection and the fields that must be unique in it.
+// Documents are removed once the date in the Expiry field has passed, if the
+// collection has one.
+type Collection struct {
+	Name   string
+	Unique []string
+	Expiry string
+}
+
+var (
+	UsersCollection        = Collection{Name: "users", Unique: []string{"username", "email"}}
+	SocietiesCollection    = Collection{Name: "societies", Unique: []string{"slug"}}
+	EventsCollection       = Collection{Name: "events"}
+	ResourcesCollection    = Collection{Name: "resources"}
+	TokensCollection       = Collection{Name: "tokens"}
+	RateLimitsCollection   = Collection{Name: "rate_limits", Expiry: "expires_at"}
+	IdempotencyCollection  = Collection{Name: "idempotency_keys", Expiry: "expires_at"}
+	FeatureFlagsCollection = Collection{Name: "feature_flags"}
+)
+
+// versionedCollections are the collections of models, whose documents have a
+// Meta and so a version
+var versionedCollections = []Collection{UsersCollection, SocietiesCollection, EventsCollection, ResourcesCollection, TokensCollection}
+
+// HashToken returns the ID a token with the secret given is stored under
+func HashToken(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+// Now returns the current time at the precision documents are stored with
+func Now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+// PrepareCreate assigns an ID to a new document if it has none and sets its
+// timestamps and first version
+func PrepareCreate(m Model) {
+	meta := m.GetMeta()
+	if meta.ID == "" {
+		meta.ID = uuid.New().String()
+	}
+	now := Now()
+	meta.CreatedAt = now
+	meta.UpdatedAt = now
+	meta.Version = 1
+}
+
+// PrepareUpdate sets the updated timestamp of a document and returns the
+// fields to be set in the stored document. The ID and created timestamp of a
+// stored document never change, and its version is incremented rather than
+// set.
+func PrepareUpdate(m Model) (bson.M, error) {
+	m.GetMeta().UpdatedAt = Now()
+	raw, err := bson.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	fields := bson.M{}
+	if err := bson.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "_id")
+	delete(fields, "created_at")
+	delete(fields, "version")
+	return fields, nil
+}
@@ -0,0 +1,27 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ugcompsoc/apid/internal/services/database"
+	"github.com/ugcompsoc/apid/internal/services/database_contract"
+)
+
+func TestDatastoreContract(t *testing.T) {
+	database_contract.RunStoreContractTests(t, func(t *testing.T) database.Store {
+		ds, err := database.NewTestDatastore()
+		assert.NoError(t, err, "could not connect to test database")
+		t.Cleanup(func() {
+			ds.Close(context.Background())
+		})
+		err = ds.Database.Drop(context.Background())
+		assert.NoError(t, err, "could not drop test database")
+		migrator, err := ds.Migrator()
+		assert.NoError(t, err, "could not create migrator")
+		_, err = migrator.Up(context.Background(), 0)
+		assert.NoError(t, err, "could not apply migrations")
+		return ds
+	})
+}
@@ -0,0 +1,748 @@
+package database_contract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ugcompsoc/apid/internal/services/database"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// StoreFactory should return an empty store for every call
+type StoreFactory func(t *testing.T) database.Store
+
+// RunStoreContractTests runs the tests every database.Store implementation
+// must pass so that they can be used interchangeably
+func RunStoreContractTests(t *testing.T, newStore StoreFactory) {
+	t.Run("ping", func(t *testing.T) {
+		s := newStore(t)
+		assert.NoError(t, s.Ping(context.Background()), "expected to be able to ping store")
+	})
+
+	t.Run("users", func(t *testing.T) {
+		runRepositoryContractTests(t, func(t *testing.T) database.Repository[database.User] {
+			return newStore(t).Users()
+		}, repositoryFixtures[database.User]{
+			new: func(i int) *database.User {
+				return &database.User{
+					Username: fmt.Sprintf("user%d", i),
+					Email:    fmt.Sprintf("user%d@universityofgalway.ie", i),
+					Name:     fmt.Sprintf("User %d", i),
+					Roles:    []string{"member"},
+				}
+			},
+			mutate: func(u *database.User) {
+				u.Name = "Changed Name"
+				u.Roles = append(u.Roles, "committee")
+			},
+			conflict: func(existing *database.User, u *database.User) {
+				u.Username = existing.Username
+			},
+		})
+	})
+
+	t.Run("find users", func(t *testing.T) {
+		runFindContractTests(t, func(t *testing.T) database.Repository[database.User] {
+			return newStore(t).Users()
+		})
+	})
+
+	t.Run("societies", func(t *testing.T) {
+		runRepositoryContractTests(t, func(t *testing.T) database.Repository[database.Society] {
+			return newStore(t).Societies()
+		}, repositoryFixtures[database.Society]{
+			new: func(i int) *database.Society {
+				return &database.Society{
+					Slug: fmt.Sprintf("society%d", i),
+					Name: fmt.Sprintf("Society %d", i),
+				}
+			},
+			mutate: func(s *database.Society) {
+				s.Description = "Changed description"
+			},
+			conflict: func(existing *database.Society, s *database.Society) {
+				s.Slug = existing.Slug
+			},
+		})
+	})
+
+	t.Run("events", func(t *testing.T) {
+		start := time.Date(2023, 9, 20, 18, 0, 0, 0, time.UTC)
+		runRepositoryContractTests(t, func(t *testing.T) database.Repository[database.Event] {
+			return newStore(t).Events()
+		}, repositoryFixtures[database.Event]{
+			new: func(i int) *database.Event {
+				return &database.Event{
+					Title:    fmt.Sprintf("Event %d", i),
+					StartsAt: start.Add(time.Duration(i) * time.Hour),
+					EndsAt:   start.Add(time.Duration(i+1) * time.Hour),
+				}
+			},
+			mutate: func(e *database.Event) {
+				e.Location = "IT125G"
+				e.EndsAt = e.EndsAt.Add(30 * time.Minute)
+			},
+		})
+	})
+
+	t.Run("resources", func(t *testing.T) {
+		runRepositoryContractTests(t, func(t *testing.T) database.Repository[database.Resource] {
+			return newStore(t).Resources()
+		}, repositoryFixtures[database.Resource]{
+			new: func(i int) *database.Resource {
+				return &database.Resource{
+					Kind:   "vm",
+					Name:   fmt.Sprintf("vm%d", i),
+					Status: "running",
+				}
+			},
+			mutate: func(r *database.Resource) {
+				r.Status = "stopped"
+			},
+		})
+	})
+
+	t.Run("tokens", func(t *testing.T) {
+		runRepositoryContractTests(t, func(t *testing.T) database.Repository[database.Token] {
+			return newStore(t).Tokens()
+		}, repositoryFixtures[database.Token]{
+			new: func(i int) *database.Token {
+				return &database.Token{
+					Meta:   database.Meta{ID: database.HashToken(fmt.Sprintf("secret%d", i))},
+					UserID: fmt.Sprintf("user%d", i),
+					Name:   fmt.Sprintf("token%d", i),
+				}
+			},
+			mutate: func(tk *database.Token) {
+				tk.ExpiresAt = time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+			},
+		})
+	})
+
+	t.Run("rate limits", func(t *testing.T) {
+		runRateLimitContractTests(t, func(t *testing.T) database.RateLimitRepository {
+			return newStore(t).RateLimits()
+		})
+	})
+
+	t.Run("idempotency", func(t *testing.T) {
+		runIdempotencyContractTests(t, func(t *testing.T) database.IdempotencyRepository {
+			return newStore(t).Idempotency()
+		})
+	})
+
+	t.Run("feature flags", func(t *testing.T) {
+		runFeatureFlagContractTests(t, func(t *testing.T) database.FeatureFlagRepository {
+			return newStore(t).FeatureFlags()
+		})
+	})
+
+	t.Run("closed store", func(t *testing.T) {
+		s := newStore(t)
+		assert.NoError(t, s.Close(context.Background()), "expected to be able to close store")
+		assert.Error(t, s.Ping(context.Background()), "expected ping to fail on a closed store")
+	})
+}
+
+type repositoryFixtures[T any] struct {
+	// new returns a distinct, valid document for every i
+	new func(i int) *T
+	// mutate changes a document in a way that does not conflict
+	mutate func(doc *T)
+	// conflict changes a document so a unique field clashes with existing,
+	// nil if the collection has no unique fields
+	conflict func(existing *T, doc *T)
+}
+
+func runRepositoryContractTests[T any, PT database.ModelPointer[T]](t *testing.T, newRepo func(t *testing.T) database.Repository[T], fixtures repositoryFixtures[T]) {
+	ctx := context.Background()
+
+	t.Run("create assigns an id and timestamps", func(t *testing.T) {
+		repo := newRepo(t)
+		doc := fixtures.new(0)
+		err := repo.Create(ctx, doc)
+		assert.NoError(t, err, "expected no error creating document")
+		meta := PT(doc).GetMeta()
+		assert.NotEmpty(t, meta.ID, "expected an id to be assigned")
+		assert.False(t, meta.CreatedAt.IsZero(), "expected created at to be set")
+		assert.Equal(t, meta.CreatedAt, meta.UpdatedAt, "expected updated at to equal created at")
+	})
+
+	t.Run("create keeps a given id", func(t *testing.T) {
+		repo := newRepo(t)
+		doc := fixtures.new(0)
+		PT(doc).GetMeta().ID = "given-id"
+		err := repo.Create(ctx, doc)
+		assert.NoError(t, err, "expected no error creating document")
+		got, err := repo.Get(ctx, "given-id")
+		assert.NoError(t, err, "expected no error getting document")
+		assert.Equal(t, doc, got, "expected stored document to equal created document")
+	})
+
+	t.Run("create rejects a duplicate id", func(t *testing.T) {
+		repo := newRepo(t)
+		doc := fixtures.new(0)
+		assert.NoError(t, repo.Create(ctx, doc), "expected no error creating document")
+		duplicate := fixtures.new(1)
+		PT(duplicate).GetMeta().ID = PT(doc).GetMeta().ID
+		assert.ErrorIs(t, repo.Create(ctx, duplicate), database.ErrConflict, "expected conflict creating document")
+	})
+
+	if fixtures.conflict != nil {
+		t.Run("create and update reject duplicate unique fields", func(t *testing.T) {
+			repo := newRepo(t)
+			existing := fixtures.new(0)
+			assert.NoError(t, repo.Create(ctx, existing), "expected no error creating document")
+
+			duplicate := fixtures.new(1)
+			fixtures.conflict(existing, duplicate)
+			assert.ErrorIs(t, repo.Create(ctx, duplicate), database.ErrConflict, "expected conflict creating document")
+
+			other := fixtures.new(2)
+			assert.NoError(t, repo.Create(ctx, other), "expected no error creating document")
+			fixtures.conflict(existing, other)
+			assert.ErrorIs(t, repo.Update(ctx, other), database.ErrConflict, "expected conflict updating document")
+		})
+	}
+
+	t.Run("get returns not found", func(t *testing.T) {
+		repo := newRepo(t)
+		_, err := repo.Get(ctx, "missing")
+		assert.ErrorIs(t, err, database.ErrNotFound, "expected not found getting document")
+	})
+
+	t.Run("get returns a copy", func(t *testing.T) {
+		repo := newRepo(t)
+		doc := fixtures.new(0)
+		assert.NoError(t, repo.Create(ctx, doc), "expected no error creating document")
+		got, err := repo.Get(ctx, PT(doc).GetMeta().ID)
+		assert.NoError(t, err, "expected no error getting document")
+		fixtures.mutate(got)
+		again, err := repo.Get(ctx, PT(doc).GetMeta().ID)
+		assert.NoError(t, err, "expected no error getting document")
+		assert.Equal(t, doc, again, "expected stored document to be unchanged")
+	})
+
+	t.Run("list returns every document ordered by id", func(t *testing.T) {
+		repo := newRepo(t)
+		docs, err := repo.List(ctx)
+		assert.NoError(t, err, "expected no error listing documents")
+		assert.Len(t, docs, 0, "expected no documents")
+
+		ids := []string{"c", "a", "b"}
+		for i, id := range ids {
+			doc := fixtures.new(i)
+			PT(doc).GetMeta().ID = id
+			assert.NoError(t, repo.Create(ctx, doc), "expected no error creating document")
+		}
+		docs, err = repo.List(ctx)
+		assert.NoError(t, err, "expected no error listing documents")
+		assert.Len(t, docs, 3, "expected every document")
+		for i, id := range []string{"a", "b", "c"} {
+			assert.Equal(t, id, PT(&docs[i]).GetMeta().ID, "expected documents ordered by id")
+		}
+	})
+
+	t.Run("update changes the stored document", func(t *testing.T) {
+		repo := newRepo(t)
+		doc := fixtures.new(0)
+		assert.NoError(t, repo.Create(ctx, doc), "expected no error creating document")
+		createdAt := PT(doc).GetMeta().CreatedAt
+
+		time.Sleep(2 * time.Millisecond)
+		fixtures.mutate(doc)
+		PT(doc).GetMeta().CreatedAt = time.Time{}
+		assert.NoError(t, repo.Update(ctx, doc), "expected no error updating document")
+		assert.Equal(t, createdAt, PT(doc).GetMeta().CreatedAt, "expected created at to be unchanged")
+		assert.True(t, PT(doc).GetMeta().UpdatedAt.After(createdAt), "expected updated at to move forward")
+
+		got, err := repo.Get(ctx, PT(doc).GetMeta().ID)
+		assert.NoError(t, err, "expected no error getting document")
+		assert.Equal(t, doc, got, "expected stored document to equal updated document")
+	})
+
+	t.Run("update returns not found", func(t *testing.T) {
+		repo := newRepo(t)
+		doc := fixtures.new(0)
+		PT(doc).GetMeta().ID = "missing"
+		assert.ErrorIs(t, repo.Update(ctx, doc), database.ErrNotFound, "expected not found updating document")
+	})
+
+	t.Run("delete removes the document", func(t *testing.T) {
+		repo := newRepo(t)
+		doc := fixtures.new(0)
+		assert.NoError(t, repo.Create(ctx, doc), "expected no error creating document")
+		assert.NoError(t, repo.Delete(ctx, PT(doc).GetMeta().ID, 0), "expected no error deleting document")
+		_, err := repo.Get(ctx, PT(doc).GetMeta().ID)
+		assert.ErrorIs(t, err, database.ErrNotFound, "expected document to be gone")
+		assert.ErrorIs(t, repo.Delete(ctx, PT(doc).GetMeta().ID, 0), database.ErrNotFound, "expected not found deleting document")
+		assert.ErrorIs(t, repo.Delete(ctx, PT(doc).GetMeta().ID, 1), database.ErrNotFound, "expected not found deleting a version of document")
+	})
+
+	t.Run("versions start at 1 and go up with every update", func(t *testing.T) {
+		repo := newRepo(t)
+		doc := fixtures.new(0)
+		PT(doc).GetMeta().Version = 7
+		assert.NoError(t, repo.Create(ctx, doc), "expected no error creating document")
+		assert.Equal(t, int64(1), PT(doc).GetMeta().Version, "expected a new document to be at version 1")
+
+		fixtures.mutate(doc)
+		assert.NoError(t, repo.Update(ctx, doc), "expected no error updating document")
+		assert.Equal(t, int64(2), PT(doc).GetMeta().Version, "expected the version to go up")
+		got, err := repo.Get(ctx, PT(doc).GetMeta().ID)
+		assert.NoError(t, err, "expected no error getting document")
+		assert.Equal(t, int64(2), PT(got).GetMeta().Version, "expected the version to be stored")
+	})
+
+	t.Run("update rejects a stale version", func(t *testing.T) {
+		repo := newRepo(t)
+		doc := fixtures.new(0)
+		assert.NoError(t, repo.Create(ctx, doc), "expected no error creating document")
+		stale, err := repo.Get(ctx, PT(doc).GetMeta().ID)
+		assert.NoError(t, err, "expected no error getting document")
+		assert.NoError(t, repo.Update(ctx, doc), "expected no error updating document")
+
+		fixtures.mutate(stale)
+		assert.ErrorIs(t, repo.Update(ctx, stale), database.ErrVersionMismatch, "expected a stale update to be rejected")
+		got, err := repo.Get(ctx, PT(doc).GetMeta().ID)
+		assert.NoError(t, err, "expected no error getting document")
+		assert.Equal(t, doc, got, "expected the stale update not to be stored")
+
+		PT(stale).GetMeta().Version = 0
+		assert.NoError(t, repo.Update(ctx, stale), "expected an update without a version to be stored")
+		assert.Equal(t, int64(3), PT(stale).GetMeta().Version, "expected the version to go up")
+	})
+
+	t.Run("delete rejects a stale version", func(t *testing.T) {
+		repo := newRepo(t)
+		doc := fixtures.new(0)
+		assert.NoError(t, repo.Create(ctx, doc), "expected no error creating document")
+		assert.NoError(t, repo.Update(ctx, doc), "expected no error updating document")
+		assert.ErrorIs(t, repo.Delete(ctx, PT(doc).GetMeta().ID, 1), database.ErrVersionMismatch, "expected a stale delete to be rejected")
+		assert.NoError(t, repo.Delete(ctx, PT(doc).GetMeta().ID, 2), "expected no error deleting the current version")
+	})
+
+	t.Run("concurrent updates of a version store one", func(t *testing.T) {
+		repo := newRepo(t)
+		doc := fixtures.new(0)
+		assert.NoError(t, repo.Create(ctx, doc), "expected no error creating document")
+
+		var stored, rejected int32
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				got, err := repo.Get(ctx, PT(doc).GetMeta().ID)
+				if !assert.NoError(t, err, "expected no error getting document") {
+					return
+				}
+				PT(got).GetMeta().Version = 1
+				err = repo.Update(ctx, got)
+				switch {
+				case err == nil:
+					atomic.AddInt32(&stored, 1)
+				case errors.Is(err, database.ErrVersionMismatch):
+					atomic.AddInt32(&rejected, 1)
+				default:
+					assert.NoError(t, err, "unexpected error updating document")
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int32(1), stored, "expected one update to be stored")
+		assert.Equal(t, int32(7), rejected, "expected the other updates to be rejected")
+	})
+}
+
+// runRateLimitContractTests runs the tests every database.RateLimitRepository
+// implementation must pass
+func runRateLimitContractTests(t *testing.T, newRepo func(t *testing.T) database.RateLimitRepository) {
+	ctx := context.Background()
+	limit := database.RateLimit{Requests: 3, Period: time.Hour}
+
+	t.Run("take empties the bucket", func(t *testing.T) {
+		repo := newRepo(t)
+		for remaining := 2; remaining >= 0; remaining-- {
+			result, err := repo.Take(ctx, "client", limit)
+			assert.NoError(t, err, "expected no error taking a token")
+			assert.True(t, result.Allowed, "expected a token to be taken")
+			assert.Equal(t, 3, result.Limit, "unexpected limit")
+			assert.Equal(t, remaining, result.Remaining, "unexpected remaining tokens")
+		}
+		result, err := repo.Take(ctx, "client", limit)
+		assert.NoError(t, err, "expected no error taking a token")
+		assert.False(t, result.Allowed, "expected no token to be taken from an empty bucket")
+		assert.Equal(t, 0, result.Remaining, "expected no remaining tokens")
+		assert.Greater(t, result.RetryAfter, time.Duration(0), "expected a retry after")
+		assert.LessOrEqual(t, result.RetryAfter, 20*time.Minute, "expected a token within 20 minutes")
+		assert.Greater(t, result.Reset, 40*time.Minute, "expected the bucket to be full in over 40 minutes")
+	})
+
+	t.Run("buckets are separate", func(t *testing.T) {
+		repo := newRepo(t)
+		for i := 0; i < 3; i++ {
+			_, err := repo.Take(ctx, "first", limit)
+			assert.NoError(t, err, "expected no error taking a token")
+		}
+		result, err := repo.Take(ctx, "second", limit)
+		assert.NoError(t, err, "expected no error taking a token")
+		assert.True(t, result.Allowed, "expected a token to be taken from a separate bucket")
+		assert.Equal(t, 2, result.Remaining, "unexpected remaining tokens")
+	})
+
+	t.Run("burst sets the size of the bucket", func(t *testing.T) {
+		repo := newRepo(t)
+		burst := database.RateLimit{Requests: 1, Period: time.Hour, Burst: 2}
+		for i := 0; i < 2; i++ {
+			result, err := repo.Take(ctx, "client", burst)
+			assert.NoError(t, err, "expected no error taking a token")
+			assert.True(t, result.Allowed, "expected a token to be taken")
+		}
+		result, err := repo.Take(ctx, "client", burst)
+		assert.NoError(t, err, "expected no error taking a token")
+		assert.False(t, result.Allowed, "expected no token to be taken from an empty bucket")
+	})
+
+	t.Run("concurrent takes never take more than the bucket holds", func(t *testing.T) {
+		repo := newRepo(t)
+		var wg sync.WaitGroup
+		var allowed int32
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				result, err := repo.Take(ctx, "client", limit)
+				if err == nil && result.Allowed {
+					atomic.AddInt32(&allowed, 1)
+				}
+			}()
+		}
+		wg.Wait()
+		assert.LessOrEqual(t, int(allowed), 3, "expected at most 3 tokens to be taken")
+		assert.Greater(t, int(allowed), 0, "expected a token to be taken")
+	})
+}
+
+// runIdempotencyContractTests runs the tests every
+// database.IdempotencyRepository implementation must pass
+func runIdempotencyContractTests(t *testing.T, newRepo func(t *testing.T) database.IdempotencyRepository) {
+	ctx := context.Background()
+	newRecord := func(key string, ttl time.Duration) *database.IdempotencyRecord {
+		now := database.Now()
+		return &database.IdempotencyRecord{Key: key, RequestHash: "hash", CreatedAt: now, ExpiresAt: now.Add(ttl)}
+	}
+
+	t.Run("begin stores a new key", func(t *testing.T) {
+		repo := newRepo(t)
+		record, created, err := repo.Begin(ctx, newRecord("key", time.Hour))
+		assert.NoError(t, err, "expected no error beginning a request")
+		assert.True(t, created, "expected the record to be created")
+		assert.False(t, record.Completed, "expected the record to be in progress")
+	})
+
+	t.Run("begin returns the record of a key in use", func(t *testing.T) {
+		repo := newRepo(t)
+		_, _, err := repo.Begin(ctx, newRecord("key", time.Hour))
+		assert.NoError(t, err, "expected no error beginning a request")
+		other := newRecord("key", time.Hour)
+		other.RequestHash = "other"
+		record, created, err := repo.Begin(ctx, other)
+		assert.NoError(t, err, "expected no error beginning a request")
+		assert.False(t, created, "expected the key to be in use")
+		assert.Equal(t, "hash", record.RequestHash, "expected the first record")
+	})
+
+	t.Run("completed records are returned with their response", func(t *testing.T) {
+		repo := newRepo(t)
+		record, _, err := repo.Begin(ctx, newRecord("key", time.Hour))
+		assert.NoError(t, err, "expected no error beginning a request")
+		record.Status = 201
+		record.Header = map[string][]string{"Location": {"/v2/things/1"}}
+		record.Body = []byte(`{"id":"1"}`)
+		assert.NoError(t, repo.Complete(ctx, record), "expected no error completing a request")
+		assert.ErrorIs(t, repo.Complete(ctx, record), database.ErrNotFound, "expected a record to be completed once")
+
+		got, created, err := repo.Begin(ctx, newRecord("key", time.Hour))
+		assert.NoError(t, err, "expected no error beginning a request")
+		assert.False(t, created, "expected the key to be in use")
+		assert.True(t, got.Completed, "expected the record to be completed")
+		assert.Equal(t, 201, got.Status, "unexpected status")
+		assert.Equal(t, map[string][]string{"Location": {"/v2/things/1"}}, got.Header, "unexpected header")
+		assert.Equal(t, []byte(`{"id":"1"}`), got.Body, "unexpected body")
+	})
+
+	t.Run("released keys can be used again", func(t *testing.T) {
+		repo := newRepo(t)
+		record, _, err := repo.Begin(ctx, newRecord("key", time.Hour))
+		assert.NoError(t, err, "expected no error beginning a request")
+		assert.NoError(t, repo.Release(ctx, "key"), "expected no error releasing a key")
+		assert.ErrorIs(t, repo.Complete(ctx, record), database.ErrNotFound, "expected a released record not to be completed")
+		_, created, err := repo.Begin(ctx, newRecord("key", time.Hour))
+		assert.NoError(t, err, "expected no error beginning a request")
+		assert.True(t, created, "expected the key to be free")
+	})
+
+	t.Run("completed keys are not released", func(t *testing.T) {
+		repo := newRepo(t)
+		record, _, err := repo.Begin(ctx, newRecord("key", time.Hour))
+		assert.NoError(t, err, "expected no error beginning a request")
+		assert.NoError(t, repo.Complete(ctx, record), "expected no error completing a request")
+		assert.NoError(t, repo.Release(ctx, "key"), "expected no error releasing a key")
+		_, created, err := repo.Begin(ctx, newRecord("key", time.Hour))
+		assert.NoError(t, err, "expected no error beginning a request")
+		assert.False(t, created, "expected the key to be in use")
+	})
+
+	t.Run("expired keys can be used again", func(t *testing.T) {
+		repo := newRepo(t)
+		_, _, err := repo.Begin(ctx, newRecord("key", time.Millisecond))
+		assert.NoError(t, err, "expected no error beginning a request")
+		time.Sleep(5 * time.Millisecond)
+		_, created, err := repo.Begin(ctx, newRecord("key", time.Hour))
+		assert.NoError(t, err, "expected no error beginning a request")
+		assert.True(t, created, "expected the expired key to be free")
+	})
+
+	t.Run("concurrent requests with a key only begin once", func(t *testing.T) {
+		repo := newRepo(t)
+		var wg sync.WaitGroup
+		var began int32
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, created, err := repo.Begin(ctx, newRecord("key", time.Hour))
+				if err == nil && created {
+					atomic.AddInt32(&began, 1)
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int32(1), began, "expected a single request to begin")
+	})
+}
+
+// runFeatureFlagContractTests runs the tests every
+// database.FeatureFlagRepository implementation must pass
+func runFeatureFlagContractTests(t *testing.T, newRepo func(t *testing.T) database.FeatureFlagRepository) {
+	ctx := context.Background()
+
+	t.Run("list is empty without overrides", func(t *testing.T) {
+		repo := newRepo(t)
+		overrides, err := repo.List(ctx)
+		assert.NoError(t, err, "expected no error listing overrides")
+		assert.Empty(t, overrides, "expected no overrides")
+	})
+
+	t.Run("set stores an override", func(t *testing.T) {
+		repo := newRepo(t)
+		override := &database.FeatureFlagOverride{Flag: "elections", Kind: database.FeatureFlagOverrideRole, Subject: "committee", Enabled: true}
+		assert.NoError(t, repo.Set(ctx, override), "expected no error setting an override")
+		assert.Equal(t, "elections/role/committee", override.ID, "expected the ID to be set")
+		assert.False(t, override.UpdatedAt.IsZero(), "expected updated at to be set")
+
+		overrides, err := repo.List(ctx)
+		assert.NoError(t, err, "expected no error listing overrides")
+		assert.Equal(t, []database.FeatureFlagOverride{*override}, overrides, "expected the override to be stored")
+	})
+
+	t.Run("set replaces the override of a subject", func(t *testing.T) {
+		repo := newRepo(t)
+		override := &database.FeatureFlagOverride{Flag: "elections", Kind: database.FeatureFlagOverrideUser, Subject: "1", Enabled: true}
+		assert.NoError(t, repo.Set(ctx, override), "expected no error setting an override")
+		override = &database.FeatureFlagOverride{Flag: "elections", Kind: database.FeatureFlagOverrideUser, Subject: "1", Enabled: false}
+		assert.NoError(t, repo.Set(ctx, override), "expected no error replacing an override")
+
+		overrides, err := repo.List(ctx)
+		assert.NoError(t, err, "expected no error listing overrides")
+		if assert.Len(t, overrides, 1, "expected a single override") {
+			assert.False(t, overrides[0].Enabled, "expected the override to be replaced")
+		}
+	})
+
+	t.Run("list orders overrides by ID", func(t *testing.T) {
+		repo := newRepo(t)
+		for _, subject := range []string{"2", "3", "1"} {
+			override := &database.FeatureFlagOverride{Flag: "vm_provisioning", Kind: database.FeatureFlagOverrideUser, Subject: subject}
+			assert.NoError(t, repo.Set(ctx, override), "expected no error setting an override")
+		}
+		overrides, err := repo.List(ctx)
+		assert.NoError(t, err, "expected no error listing overrides")
+		subjects := []string{}
+		for _, override := range overrides {
+			subjects = append(subjects, override.Subject)
+		}
+		assert.Equal(t, []string{"1", "2", "3"}, subjects, "expected overrides to be ordered by ID")
+	})
+
+	t.Run("delete removes an override", func(t *testing.T) {
+		repo := newRepo(t)
+		override := &database.FeatureFlagOverride{Flag: "elections", Kind: database.FeatureFlagOverrideRole, Subject: "committee", Enabled: true}
+		assert.NoError(t, repo.Set(ctx, override), "expected no error setting an override")
+		assert.NoError(t, repo.Delete(ctx, "elections", database.FeatureFlagOverrideRole, "committee"), "expected no error deleting an override")
+		assert.ErrorIs(t, repo.Delete(ctx, "elections", database.FeatureFlagOverrideRole, "committee"), database.ErrNotFound,
+			"expected a deleted override not to be found")
+		overrides, err := repo.List(ctx)
+		assert.NoError(t, err, "expected no error listing overrides")
+		assert.Empty(t, overrides, "expected the override to be removed")
+	})
+}
+
+// runFindContractTests runs the tests every implementation of Find must pass,
+// with users as they have string, time and array fields to filter on
+func runFindContractTests(t *testing.T, newRepo func(t *testing.T) database.Repository[database.User]) {
+	ctx := context.Background()
+	// created holds when each user was created, by ID
+	created := map[string]time.Time{}
+	newUsers := func(t *testing.T) database.Repository[database.User] {
+		repo := newRepo(t)
+		users := []database.User{
+			{Meta: database.Meta{ID: "1"}, Username: "alice", Name: "Alice", Roles: []string{"member", "admin"}},
+			{Meta: database.Meta{ID: "2"}, Username: "bob", Name: "Bob", Roles: []string{"member"}},
+			{Meta: database.Meta{ID: "3"}, Username: "carol", Name: "Carol", Roles: []string{"member", "committee"}},
+			{Meta: database.Meta{ID: "4"}, Username: "cathal", Name: "Bob", Roles: []string{"member"}},
+			{Meta: database.Meta{ID: "5"}, Username: "dave", Name: "Dave.", Roles: []string{}},
+		}
+		for i := range users {
+			user := users[i]
+			user.Email = user.Username + "@universityofgalway.ie"
+			assert.NoError(t, repo.Create(ctx, &user), "expected no error creating user")
+			created[user.ID] = user.CreatedAt
+			// timestamps are kept to the millisecond
+			time.Sleep(2 * time.Millisecond)
+		}
+		return repo
+	}
+	ids := func(page *database.Page[database.User]) []string {
+		ids := []string{}
+		for _, user := range page.Items {
+			ids = append(ids, user.ID)
+		}
+		return ids
+	}
+
+	runs := []struct {
+		name  string
+		query database.Query
+		ids   []string
+	}{
+		{
+			name: "every document is ordered by id without a sort",
+			ids:  []string{"1", "2", "3", "4", "5"},
+		},
+		{
+			name:  "eq",
+			query: database.Query{Filters: []database.Filter{{Field: "name", Op: database.FilterEq, Value: "Bob"}}},
+			ids:   []string{"2", "4"},
+		},
+		{
+			name:  "ne",
+			query: database.Query{Filters: []database.Filter{{Field: "name", Op: database.FilterNe, Value: "Bob"}}},
+			ids:   []string{"1", "3", "5"},
+		},
+		{
+			name:  "eq matches any element of an array",
+			query: database.Query{Filters: []database.Filter{{Field: "roles", Op: database.FilterEq, Value: "admin"}}},
+			ids:   []string{"1"},
+		},
+		{
+			name:  "ne matches arrays without the element",
+			query: database.Query{Filters: []database.Filter{{Field: "roles", Op: database.FilterNe, Value: "member"}}},
+			ids:   []string{"5"},
+		},
+		{
+			name:  "in",
+			query: database.Query{Filters: []database.Filter{{Field: "roles", Op: database.FilterIn, Value: bson.A{"admin", "committee"}}}},
+			ids:   []string{"1", "3"},
+		},
+		{
+			name:  "prefix",
+			query: database.Query{Filters: []database.Filter{{Field: "username", Op: database.FilterPrefix, Value: "ca"}}},
+			ids:   []string{"3", "4"},
+		},
+		{
+			name:  "prefix is not a pattern",
+			query: database.Query{Filters: []database.Filter{{Field: "name", Op: database.FilterPrefix, Value: "Dave."}}},
+			ids:   []string{"5"},
+		},
+		{
+			name: "comparisons of times",
+			query: database.Query{Filters: []database.Filter{
+				{Field: "created_at", Op: database.FilterGte, Value: "2"},
+				{Field: "created_at", Op: database.FilterLt, Value: "4"},
+			}},
+			ids: []string{"2", "3"},
+		},
+		{
+			name:  "comparisons only match values of the same type",
+			query: database.Query{Filters: []database.Filter{{Field: "username", Op: database.FilterGt, Value: int64(0)}}},
+			ids:   []string{},
+		},
+		{
+			name:  "sort with ties broken by id",
+			query: database.Query{Sort: []database.SortField{{Field: "name", Descending: true}}},
+			ids:   []string{"5", "3", "2", "4", "1"},
+		},
+	}
+
+	for _, run := range runs {
+		run := run
+		t.Run(run.name, func(t *testing.T) {
+			repo := newUsers(t)
+			// filters on when users were created name the user instead, as
+			// the time isn't known until they are
+			query := run.query
+			query.Filters = []database.Filter{}
+			for _, filter := range run.query.Filters {
+				if filter.Field == "created_at" {
+					filter.Value = created[filter.Value.(string)]
+				}
+				query.Filters = append(query.Filters, filter)
+			}
+			page, err := repo.Find(ctx, query)
+			assert.NoError(t, err, "expected no error finding users")
+			assert.Equal(t, run.ids, ids(page), "unexpected users")
+			assert.Nil(t, page.Next, "expected a single page")
+		})
+	}
+
+	t.Run("pages follow on from each other", func(t *testing.T) {
+		repo := newUsers(t)
+		query := database.Query{
+			Sort:  []database.SortField{{Field: "name"}},
+			Limit: 2,
+		}
+		pages := [][]string{}
+		for {
+			page, err := repo.Find(ctx, query)
+			assert.NoError(t, err, "expected no error finding users")
+			pages = append(pages, ids(page))
+			if page.Next == nil || len(pages) > 3 {
+				break
+			}
+			query.After = page.Next
+		}
+		assert.Equal(t, [][]string{{"1", "2"}, {"4", "3"}, {"5"}}, pages, "unexpected pages")
+	})
+
+	t.Run("a page that is exactly full is the last", func(t *testing.T) {
+		page, err := newUsers(t).Find(ctx, database.Query{Limit: 5})
+		assert.NoError(t, err, "expected no error finding users")
+		assert.Len(t, page.Items, 5, "expected every user")
+		assert.Nil(t, page.Next, "expected no next page")
+	})
+
+	t.Run("invalid queries are rejected", func(t *testing.T) {
+		_, err := newRepo(t).Find(ctx, database.Query{Filters: []database.Filter{{Field: "name", Op: "like", Value: "Bob"}}})
+		assert.ErrorIs(t, err, database.ErrInvalidQuery, "expected an unknown operator to be rejected")
+		_, err = newRepo(t).Find(ctx, database.Query{After: []bson.RawValue{{}}, Sort: []database.SortField{{Field: "name"}}})
+		assert.ErrorIs(t, err, database.ErrInvalidQuery, "expected a cursor of another sort to be rejected")
+	})
+}
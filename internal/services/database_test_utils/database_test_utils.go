@@ -43,8 +43,8 @@ func SetupMongoDocker(c *config.Config, pool *dockertest.Pool) (*dockertest.Reso
 		Repository: "mongo",
 		Tag:        "5.0",
 		Env: []string{
-			"MONGO_INITDB_ROOT_USERNAME=" + c.Database.Username,
-			"MONGO_INITDB_ROOT_PASSWORD=" + c.Database.Password,
+			"MONGO_INITDB_ROOT_USERNAME=" + c.Database.Username.Value(),
+			"MONGO_INITDB_ROOT_PASSWORD=" + c.Database.Password.Value(),
 		},
 		PortBindings: map[docker.Port][]docker.PortBinding{
 			"27017/tcp": {{HostIP: "localhost", HostPort: portProto}},
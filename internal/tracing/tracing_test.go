@@ -0,0 +1,51 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ugcompsoc/apid/internal/config"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+)
+
+func TestNewProvider(t *testing.T) {
+	runs := []struct {
+		name string
+		cfg  config.Tracing
+	}{
+		{name: "no exporter", cfg: config.Tracing{}},
+		{name: "none exporter", cfg: config.Tracing{Exporter: config.TracingExporterNone}},
+		{name: "stdout exporter", cfg: config.Tracing{Exporter: config.TracingExporterStdout}},
+		{name: "otlp exporter", cfg: config.Tracing{Exporter: config.TracingExporterOTLP, Endpoint: "localhost:4318", Insecure: true}},
+	}
+
+	for _, run := range runs {
+		t.Run(run.name+" creates a provider", func(t *testing.T) {
+			tp, err := NewProvider(context.Background(), run.cfg)
+			assert.NoError(t, err, "expected no error creating provider")
+			_, span := tp.Tracer(TracerName).Start(context.Background(), "test")
+			assert.True(t, span.SpanContext().IsValid(), "expected spans to be created")
+			span.End()
+		})
+	}
+}
+
+func TestNewResource(t *testing.T) {
+	res := newResource()
+	value, ok := res.Set().Value(semconv.ServiceNameKey)
+	assert.True(t, ok, "expected service name to be set")
+	assert.Equal(t, "apid", value.AsString(), "unexpected service name")
+}
+
+func TestPropagator(t *testing.T) {
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := Propagator().Extract(context.Background(), propagation.HeaderCarrier(header))
+
+	out := http.Header{}
+	Propagator().Inject(ctx, propagation.HeaderCarrier(out))
+	assert.Equal(t, header.Get("traceparent"), out.Get("traceparent"), "expected traceparent to round trip")
+}